@@ -1,24 +1,77 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/dan/moe/internal/db"
 	"github.com/dan/moe/internal/server"
+
+	// Provider backends register themselves with provider.RegisterFactory.
+	_ "github.com/dan/moe/internal/provider/intune"
+	_ "github.com/dan/moe/internal/provider/jamf"
 )
 
 func main() {
 	addr := flag.String("addr", ":8080", "HTTP listen address")
+	tlsCert := flag.String("tls-cert", "", "PEM certificate file; with -tls-key, serve HTTPS instead of plain HTTP")
+	tlsKey := flag.String("tls-key", "", "PEM private key file for -tls-cert")
 	dbPath := flag.String("db", "moe.db", "path to SQLite database file")
+	retention := flag.Int("snapshot-retention", 10, "policy snapshots kept per provider (providers may override)")
+	categoryOrder := flag.String("category-order", "", "comma-separated policy category prefixes in display order (default: Compliance, Endpoint Security, …)")
+	healthInterval := flag.Duration("health-interval", 2*time.Minute, "how often to check provider connections (providers may override)")
+	readOnly := flag.Bool("read-only", false, "reject every request that would change state (for demos and shared dashboards)")
+	healthTimeout := flag.Duration("health-timeout", 15*time.Second, "timeout for a single provider connection check")
+	missingDevices := flag.String("missing-devices", server.MissingDevicesRetire, "what a sync does with devices the provider no longer reports: retire or delete")
+	graphTimeout := flag.Duration("graph-timeout", 30*time.Second, "timeout for a single Microsoft Graph request")
+	policyConcurrency := flag.Int("policy-concurrency", 5, "parallel Graph requests during a legacy Intune policy capture")
+	staleDays := flag.Int("stale-days", 30, "days without checking in before a device counts as stale")
+	maxCaptures := flag.Int("max-captures", 2, "policy captures run at once across all providers; the rest queue")
+	settingsDepth := flag.Int("settings-depth", 4, "levels of nested policy settings the snapshot view expands into dotted keys")
+	csp := flag.String("csp", server.DefaultContentSecurityPolicy, "Content-Security-Policy header sent with every response")
+	createAdmin := flag.String("create-admin", "", "create a web UI admin user with this username and exit (password from $MOE_ADMIN_PASSWORD or stdin)")
 	flag.Parse()
 
+	if (*tlsCert == "") != (*tlsKey == "") {
+		log.Fatalf("-tls-cert and -tls-key must be given together")
+	}
+	if *retention < 1 {
+		log.Fatalf("-snapshot-retention must be at least 1")
+	}
+	if *healthInterval < server.MinHealthInterval {
+		log.Fatalf("-health-interval must be at least %s", server.MinHealthInterval)
+	}
+	if *healthTimeout <= 0 {
+		log.Fatalf("-health-timeout must be positive")
+	}
+	if *missingDevices != server.MissingDevicesRetire && *missingDevices != server.MissingDevicesDelete {
+		log.Fatalf("-missing-devices must be %q or %q", server.MissingDevicesRetire, server.MissingDevicesDelete)
+	}
+	if *graphTimeout <= 0 {
+		log.Fatalf("-graph-timeout must be positive")
+	}
+	if *policyConcurrency < 1 {
+		log.Fatalf("-policy-concurrency must be at least 1")
+	}
+	if *staleDays < 1 {
+		log.Fatalf("-stale-days must be at least 1")
+	}
+	if *maxCaptures < 1 {
+		log.Fatalf("-max-captures must be at least 1")
+	}
+	if *settingsDepth < 1 {
+		log.Fatalf("-settings-depth must be at least 1")
+	}
+
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 	log.Println("starting MOE — Mobile Operations Engine")
 
@@ -33,8 +86,36 @@ func main() {
 		log.Fatalf("migrations: %v", err)
 	}
 
+	if *createAdmin != "" {
+		password, err := readPassword()
+		if err != nil {
+			log.Fatalf("create admin: %v", err)
+		}
+		if err := server.CreateAdmin(database, *createAdmin, password); err != nil {
+			log.Fatalf("create admin: %v", err)
+		}
+		log.Printf("created admin user %q — the web UI now requires a login", *createAdmin)
+		return
+	}
+
 	// ── HTTP Server ─────────────────────────────────────────────────────
-	srv, err := server.New(database, *addr)
+	srv, err := server.New(database, server.Config{
+		Addr:                  *addr,
+		TLSCertFile:           *tlsCert,
+		TLSKeyFile:            *tlsKey,
+		SnapshotRetention:     *retention,
+		CategoryOrder:         splitList(*categoryOrder),
+		HealthInterval:        *healthInterval,
+		HealthTimeout:         *healthTimeout,
+		ReadOnly:              *readOnly,
+		MissingDevices:        *missingDevices,
+		GraphTimeout:          *graphTimeout,
+		PolicyConcurrency:     *policyConcurrency,
+		SettingsDepth:         *settingsDepth,
+		ContentSecurityPolicy: *csp,
+		StaleDeviceDays:       *staleDays,
+		MaxCaptures:           *maxCaptures,
+	})
 	if err != nil {
 		log.Fatalf("server: %v", err)
 	}
@@ -62,3 +143,28 @@ func main() {
 
 	log.Println("shutdown complete")
 }
+
+// readPassword returns the new admin's password from $MOE_ADMIN_PASSWORD,
+// or else the first line of stdin.
+func readPassword() (string, error) {
+	if pw := os.Getenv("MOE_ADMIN_PASSWORD"); pw != "" {
+		return pw, nil
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -1,8 +1,11 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
@@ -10,7 +13,8 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-// DB wraps a *sql.DB connection to SQLite.
+// DB wraps a *sql.DB connection to SQLite, MOE's only storage backend: the
+// migrations rely on FTS5 and SQLite-style table rebuilds.
 type DB struct {
 	Conn *sql.DB
 	path string
@@ -54,6 +58,54 @@ func (d *DB) Close() error {
 	return d.Conn.Close()
 }
 
+// BackupTo writes a consistent copy of the database to path, which must not
+// already exist. It uses VACUUM INTO, which reads through SQLite so pages
+// still in the WAL are included; copying the file directly would miss them.
+func (d *DB) BackupTo(path string) error {
+	if _, err := d.Conn.Exec("VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("backup database: %w", err)
+	}
+	return nil
+}
+
+// Vacuum rebuilds the database file to drop free pages, then checkpoints
+// the WAL and truncates it. Both run on one connection taken from the pool,
+// so with a single open connection they simply wait for in-flight queries to
+// finish, and queries issued meanwhile wait for the vacuum.
+func (d *DB) Vacuum() error {
+	conn, err := d.Conn.Conn(context.Background())
+	if err != nil {
+		return fmt.Errorf("vacuum database: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(context.Background(), "VACUUM"); err != nil {
+		return fmt.Errorf("vacuum database: %w", err)
+	}
+	// VACUUM in WAL mode writes the rebuilt pages to the WAL; move them into
+	// the database file and shrink the WAL back to nothing.
+	if _, err := conn.ExecContext(context.Background(), "PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return fmt.Errorf("checkpoint WAL: %w", err)
+	}
+	return nil
+}
+
+// Size returns the bytes used on disk by the database file and its WAL.
+func (d *DB) Size() (int64, error) {
+	var total int64
+	for _, path := range []string{d.path, d.path + "-wal"} {
+		info, err := os.Stat(path)
+		if errors.Is(err, fs.ErrNotExist) && path != d.path {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		total += info.Size()
+	}
+	return total, nil
+}
+
 // Ping verifies the database connection is alive.
 func (d *DB) Ping() error {
 	return d.Conn.Ping()
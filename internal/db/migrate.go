@@ -75,7 +75,20 @@ func (d *DB) Migrate() error {
 	return nil
 }
 
+// noForeignKeysDirective marks a migration that rebuilds tables referenced by
+// foreign keys (the SQLite "12-step" ALTER procedure). Foreign key enforcement
+// can't be toggled inside a transaction, so it is switched off around the
+// migration and the result verified with foreign_key_check before commit.
+const noForeignKeysDirective = "-- moe:foreign_keys=off"
+
 func (d *DB) applyMigration(name, sqlContent string) error {
+	if strings.Contains(sqlContent, noForeignKeysDirective) {
+		if _, err := d.Conn.Exec("PRAGMA foreign_keys=OFF"); err != nil {
+			return fmt.Errorf("disable foreign keys for %s: %w", name, err)
+		}
+		defer d.Conn.Exec("PRAGMA foreign_keys=ON") //nolint: errcheck
+	}
+
 	tx, err := d.Conn.Begin()
 	if err != nil {
 		return fmt.Errorf("begin tx for %s: %w", name, err)
@@ -86,6 +99,18 @@ func (d *DB) applyMigration(name, sqlContent string) error {
 		return fmt.Errorf("exec migration %s: %w", name, err)
 	}
 
+	if strings.Contains(sqlContent, noForeignKeysDirective) {
+		rows, err := tx.Query("PRAGMA foreign_key_check")
+		if err != nil {
+			return fmt.Errorf("foreign key check for %s: %w", name, err)
+		}
+		violated := rows.Next()
+		rows.Close()
+		if violated {
+			return fmt.Errorf("migration %s leaves foreign key violations", name)
+		}
+	}
+
 	if _, err := tx.Exec(
 		"INSERT INTO _migrations (name) VALUES (?)", name,
 	); err != nil {
@@ -0,0 +1,4 @@
+-- 011_snapshot_retention.sql
+-- Per-provider override for how many policy snapshots to keep (0 = server default).
+
+ALTER TABLE provider_configs ADD COLUMN snapshot_retention INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- 012_provider_silence.sql
+-- Silence window: failure alerts for a provider are suppressed until this time.
+
+ALTER TABLE provider_configs ADD COLUMN silenced_until TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+-- 013_device_enrollment.sql
+-- Ownership (corporate/personal), management agent, and enrollment date.
+
+ALTER TABLE devices ADD COLUMN ownership        TEXT NOT NULL DEFAULT 'unknown';
+ALTER TABLE devices ADD COLUMN management_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN enrolled_at      DATETIME;
+
+CREATE INDEX idx_devices_ownership ON devices(ownership);
@@ -0,0 +1,4 @@
+-- 014_provider_cloud.sql
+-- Microsoft cloud environment for Intune providers ('' / 'global', 'usgov', 'dod', 'china').
+
+ALTER TABLE provider_configs ADD COLUMN cloud TEXT NOT NULL DEFAULT '';
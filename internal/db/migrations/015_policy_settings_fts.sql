@@ -0,0 +1,28 @@
+-- 015_policy_settings_fts.sql
+-- Full-text index over policy_items.settings_json for cross-snapshot settings
+-- search. The trigram tokenizer gives substring matches, so "bitlocker" finds
+-- keys such as "requireBitLocker". Triggers keep the index in step with
+-- policy_items, including cascaded deletes from policy_snapshots.
+
+CREATE VIRTUAL TABLE IF NOT EXISTS policy_items_fts USING fts5(
+    settings_json,
+    content = 'policy_items',
+    content_rowid = 'rowid',
+    tokenize = 'trigram'
+);
+
+CREATE TRIGGER IF NOT EXISTS policy_items_fts_ai AFTER INSERT ON policy_items BEGIN
+    INSERT INTO policy_items_fts (rowid, settings_json) VALUES (new.rowid, new.settings_json);
+END;
+
+CREATE TRIGGER IF NOT EXISTS policy_items_fts_ad AFTER DELETE ON policy_items BEGIN
+    INSERT INTO policy_items_fts (policy_items_fts, rowid, settings_json) VALUES ('delete', old.rowid, old.settings_json);
+END;
+
+CREATE TRIGGER IF NOT EXISTS policy_items_fts_au AFTER UPDATE OF settings_json ON policy_items BEGIN
+    INSERT INTO policy_items_fts (policy_items_fts, rowid, settings_json) VALUES ('delete', old.rowid, old.settings_json);
+    INSERT INTO policy_items_fts (rowid, settings_json) VALUES (new.rowid, new.settings_json);
+END;
+
+-- Index rows captured before this migration.
+INSERT INTO policy_items_fts (policy_items_fts) VALUES ('rebuild');
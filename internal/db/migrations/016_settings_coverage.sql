@@ -0,0 +1,7 @@
+-- 016_settings_coverage.sql
+-- Record policies whose settings sub-resource could not be fetched, so a
+-- capture failure isn't mistaken for a genuinely empty policy.
+
+ALTER TABLE policy_items ADD COLUMN settings_error TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE policy_snapshots ADD COLUMN missing_settings_count INTEGER NOT NULL DEFAULT 0;
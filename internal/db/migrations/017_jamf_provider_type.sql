@@ -0,0 +1,88 @@
+-- 017_jamf_provider_type.sql
+-- Allow the "jamf" provider type. SQLite can't alter a CHECK constraint, so
+-- provider_configs and devices are rebuilt with the widened constraint.
+-- moe:foreign_keys=off
+
+CREATE TABLE provider_configs_new (
+    id                 TEXT PRIMARY KEY,
+    name               TEXT NOT NULL UNIQUE,
+    type               TEXT NOT NULL CHECK(type IN ('uem', 'intune', 'jamf')),
+    base_url           TEXT NOT NULL DEFAULT '',
+    tenant_id          TEXT NOT NULL DEFAULT '',
+    sync_interval      TEXT NOT NULL DEFAULT '15m',
+    enabled            INTEGER NOT NULL DEFAULT 1,
+    created_at         DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at         DATETIME DEFAULT CURRENT_TIMESTAMP,
+    client_id          TEXT NOT NULL DEFAULT '',
+    client_secret      TEXT NOT NULL DEFAULT '',
+    username           TEXT NOT NULL DEFAULT '',
+    password           TEXT NOT NULL DEFAULT '',
+    last_check_at      TEXT    NOT NULL DEFAULT '',
+    last_check_ok      INTEGER NOT NULL DEFAULT 0,
+    last_check_err     TEXT    NOT NULL DEFAULT '',
+    last_sync_at       TEXT    NOT NULL DEFAULT '',
+    consec_fails       INTEGER NOT NULL DEFAULT 0,
+    snapshot_retention INTEGER NOT NULL DEFAULT 0,
+    silenced_until     TEXT NOT NULL DEFAULT '',
+    cloud              TEXT NOT NULL DEFAULT ''
+);
+
+INSERT INTO provider_configs_new (
+    id, name, type, base_url, tenant_id, sync_interval, enabled, created_at, updated_at,
+    client_id, client_secret, username, password,
+    last_check_at, last_check_ok, last_check_err, last_sync_at, consec_fails,
+    snapshot_retention, silenced_until, cloud)
+SELECT
+    id, name, type, base_url, tenant_id, sync_interval, enabled, created_at, updated_at,
+    client_id, client_secret, username, password,
+    last_check_at, last_check_ok, last_check_err, last_sync_at, consec_fails,
+    snapshot_retention, silenced_until, cloud
+FROM provider_configs;
+
+DROP TABLE provider_configs;
+ALTER TABLE provider_configs_new RENAME TO provider_configs;
+CREATE INDEX IF NOT EXISTS idx_provider_configs_type ON provider_configs(type);
+
+CREATE TABLE devices_new (
+    id               TEXT PRIMARY KEY,
+    provider_name    TEXT NOT NULL,
+    provider_type    TEXT NOT NULL CHECK(provider_type IN ('uem', 'intune', 'jamf')),
+    source_id        TEXT NOT NULL DEFAULT '',
+    device_name      TEXT NOT NULL DEFAULT '',
+    os               TEXT NOT NULL DEFAULT '',
+    os_version       TEXT NOT NULL DEFAULT '',
+    model            TEXT NOT NULL DEFAULT '',
+    user_name        TEXT NOT NULL DEFAULT '',
+    user_email       TEXT NOT NULL DEFAULT '',
+    compliance       TEXT NOT NULL DEFAULT 'unknown' CHECK(compliance IN ('compliant', 'non-compliant', 'unknown')),
+    last_seen        DATETIME,
+    last_synced_at   DATETIME,
+    created_at       DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at       DATETIME DEFAULT CURRENT_TIMESTAMP,
+    is_encrypted     BOOLEAN NOT NULL DEFAULT 0,
+    jail_broken      TEXT NOT NULL DEFAULT '',
+    is_supervised    BOOLEAN NOT NULL DEFAULT 0,
+    threat_state     TEXT NOT NULL DEFAULT '',
+    ownership        TEXT NOT NULL DEFAULT 'unknown',
+    management_agent TEXT NOT NULL DEFAULT '',
+    enrolled_at      DATETIME,
+    UNIQUE(provider_name, source_id)
+);
+
+INSERT INTO devices_new (
+    id, provider_name, provider_type, source_id, device_name, os, os_version, model,
+    user_name, user_email, compliance, last_seen, last_synced_at, created_at, updated_at,
+    is_encrypted, jail_broken, is_supervised, threat_state, ownership, management_agent, enrolled_at)
+SELECT
+    id, provider_name, provider_type, source_id, device_name, os, os_version, model,
+    user_name, user_email, compliance, last_seen, last_synced_at, created_at, updated_at,
+    is_encrypted, jail_broken, is_supervised, threat_state, ownership, management_agent, enrolled_at
+FROM devices;
+
+DROP TABLE devices;
+ALTER TABLE devices_new RENAME TO devices;
+CREATE INDEX IF NOT EXISTS idx_devices_provider   ON devices(provider_name);
+CREATE INDEX IF NOT EXISTS idx_devices_os         ON devices(os);
+CREATE INDEX IF NOT EXISTS idx_devices_compliance ON devices(compliance);
+CREATE INDEX IF NOT EXISTS idx_devices_user_email ON devices(user_email);
+CREATE INDEX IF NOT EXISTS idx_devices_ownership  ON devices(ownership);
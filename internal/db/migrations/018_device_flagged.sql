@@ -0,0 +1,7 @@
+-- 018_device_flagged.sql
+-- Operator triage flag: marks a device for follow-up. Set only from the UI
+-- and API; provider syncs never touch it.
+
+ALTER TABLE devices ADD COLUMN flagged BOOLEAN NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_devices_flagged ON devices(flagged) WHERE flagged = 1;
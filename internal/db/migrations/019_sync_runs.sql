@@ -0,0 +1,14 @@
+-- 019_sync_runs.sql
+-- History of device syncs per provider: timing, device count and outcome.
+-- Keyed by provider name like devices; old runs are pruned by the store.
+
+CREATE TABLE IF NOT EXISTS sync_runs (
+    id            TEXT PRIMARY KEY,
+    provider_name TEXT NOT NULL,
+    started_at    DATETIME NOT NULL,
+    finished_at   DATETIME NOT NULL,
+    device_count  INTEGER NOT NULL DEFAULT 0,
+    error         TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_sync_runs_provider ON sync_runs(provider_name, started_at DESC);
@@ -0,0 +1,6 @@
+-- 020_snapshot_capture_method.sql
+-- Records how a snapshot's policies were fetched ("utcm" or "legacy"), so
+-- comparisons across capture methods can be flagged. Empty for snapshots
+-- captured before this column existed and for imports that don't carry it.
+
+ALTER TABLE policy_snapshots ADD COLUMN capture_method TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+-- 021_snapshot_coverage.sql
+-- Per-category capture results for a snapshot, as a JSON array of
+-- {category, count, error}. Lets an empty category be told apart from one
+-- that failed to fetch. Empty for snapshots captured before this column.
+
+ALTER TABLE policy_snapshots ADD COLUMN coverage_json TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,61 @@
+-- 022_snapshot_benchmark.sql
+-- Benchmark templates (CIS, Essential Eight, ...) are stored as snapshots
+-- with is_benchmark set. They are imported rather than captured, belong to
+-- no configured provider, and are exempt from per-provider retention.
+--
+-- A benchmark's provider_name is just a label, so policy_snapshots is
+-- rebuilt without its foreign key to provider_configs. Triggers keep the
+-- old guarantees for ordinary snapshots: they must name an existing
+-- provider, and a provider with snapshots can't be deleted or renamed.
+-- moe:foreign_keys=off
+
+CREATE TABLE policy_snapshots_new (
+    id                     TEXT PRIMARY KEY,
+    provider_name          TEXT NOT NULL,
+    provider_type          TEXT NOT NULL,
+    taken_at               DATETIME NOT NULL DEFAULT (datetime('now')),
+    policy_count           INTEGER NOT NULL DEFAULT 0,
+    category_count         INTEGER NOT NULL DEFAULT 0,
+    label                  TEXT NOT NULL DEFAULT '',
+    status                 TEXT NOT NULL DEFAULT 'complete',
+    status_message         TEXT NOT NULL DEFAULT '',
+    missing_settings_count INTEGER NOT NULL DEFAULT 0,
+    capture_method         TEXT NOT NULL DEFAULT '',
+    coverage_json          TEXT NOT NULL DEFAULT '',
+    is_benchmark           BOOLEAN NOT NULL DEFAULT 0
+);
+
+INSERT INTO policy_snapshots_new (
+    id, provider_name, provider_type, taken_at, policy_count, category_count,
+    label, status, status_message, missing_settings_count, capture_method, coverage_json)
+SELECT
+    id, provider_name, provider_type, taken_at, policy_count, category_count,
+    label, status, status_message, missing_settings_count, capture_method, coverage_json
+FROM policy_snapshots;
+
+DROP TABLE policy_snapshots;
+ALTER TABLE policy_snapshots_new RENAME TO policy_snapshots;
+CREATE INDEX IF NOT EXISTS idx_policy_snapshots_provider ON policy_snapshots(provider_name);
+
+CREATE TRIGGER policy_snapshots_provider_insert
+BEFORE INSERT ON policy_snapshots
+WHEN NEW.is_benchmark = 0
+    AND NOT EXISTS (SELECT 1 FROM provider_configs WHERE name = NEW.provider_name)
+BEGIN
+    SELECT RAISE(ABORT, 'FOREIGN KEY constraint failed');
+END;
+
+CREATE TRIGGER policy_snapshots_provider_delete
+BEFORE DELETE ON provider_configs
+WHEN EXISTS (SELECT 1 FROM policy_snapshots WHERE provider_name = OLD.name AND is_benchmark = 0)
+BEGIN
+    SELECT RAISE(ABORT, 'FOREIGN KEY constraint failed');
+END;
+
+CREATE TRIGGER policy_snapshots_provider_rename
+BEFORE UPDATE OF name ON provider_configs
+WHEN NEW.name != OLD.name
+    AND EXISTS (SELECT 1 FROM policy_snapshots WHERE provider_name = OLD.name AND is_benchmark = 0)
+BEGIN
+    SELECT RAISE(ABORT, 'FOREIGN KEY constraint failed');
+END;
@@ -0,0 +1,6 @@
+-- 023_policy_item_severity.sql
+-- Severity of a benchmark control ("critical", "high", "medium", "low"), as
+-- given in the imported benchmark template. Orders the remediation
+-- checklist. Empty for captured policies and for benchmarks without one.
+
+ALTER TABLE policy_items ADD COLUMN severity TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- 024_snapshot_categories.sql
+-- The policy categories a capture was narrowed to, as a JSON array of
+-- names. Empty when every category was captured.
+
+ALTER TABLE policy_snapshots ADD COLUMN categories_json TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+-- 025_snapshot_clone.sql
+-- ID of the snapshot a clone was copied from. Clones are kept as frozen
+-- reference baselines, so retention pruning skips them. Empty for captures
+-- and imports; the source may since have been deleted.
+
+ALTER TABLE policy_snapshots ADD COLUMN cloned_from TEXT NOT NULL DEFAULT '';
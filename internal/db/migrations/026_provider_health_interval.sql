@@ -0,0 +1,5 @@
+-- 026_provider_health_interval.sql
+-- Per-provider health check interval as a duration string, e.g. "10m"
+-- ('' = server default).
+
+ALTER TABLE provider_configs ADD COLUMN health_interval TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,12 @@
+-- 027_device_tags.sql
+-- Operator-assigned labels for grouping devices ("executive", "kiosk",
+-- "pilot"). Like the flag, tags are set only from the UI and API and survive
+-- provider syncs; they go when the device is deleted.
+
+CREATE TABLE IF NOT EXISTS device_tags (
+    device_id TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    tag       TEXT NOT NULL,
+    PRIMARY KEY (device_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_tags_tag ON device_tags(tag);
@@ -0,0 +1,16 @@
+-- 028_audit_log.sql
+-- Durable record of every state-changing action taken through the UI or
+-- API: who did what to which object. Unlike the in-memory activity feed,
+-- entries are never pruned automatically.
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          TEXT PRIMARY KEY,
+    at          DATETIME NOT NULL,
+    actor       TEXT NOT NULL,
+    action      TEXT NOT NULL,
+    target_type TEXT NOT NULL,
+    target_id   TEXT NOT NULL DEFAULT '',
+    detail      TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_at ON audit_log(at DESC);
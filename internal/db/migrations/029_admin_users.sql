@@ -0,0 +1,12 @@
+-- 029_admin_users.sql
+-- Web UI administrators. Passwords are stored as bcrypt hashes. While the
+-- table is empty the UI stays open, as before; once a user exists every
+-- page except /login, /health and static assets requires a session.
+
+CREATE TABLE IF NOT EXISTS admin_users (
+    id            TEXT PRIMARY KEY,
+    username      TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    created_at    DATETIME NOT NULL,
+    last_login_at TEXT NOT NULL DEFAULT ''
+);
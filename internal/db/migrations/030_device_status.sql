@@ -0,0 +1,9 @@
+-- 030_device_status.sql
+-- Lifecycle status for synced devices. A device the provider stops
+-- reporting during a full sync is marked 'retired' (or deleted, depending on
+-- the server's -missing-devices setting); it returns to 'active' if it
+-- reappears.
+
+ALTER TABLE devices ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
+
+CREATE INDEX IF NOT EXISTS idx_devices_status ON devices(status);
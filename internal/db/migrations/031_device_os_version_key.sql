@@ -0,0 +1,9 @@
+-- 031_device_os_version_key.sql
+-- Sortable form of os_version ("17.2.1" -> "000017.000002.000001.000000")
+-- so devices can be filtered by version range; plain string comparison
+-- puts "9.3" after "17.2". NULL means not yet computed: rows from before
+-- this migration are backfilled at startup, and every write sets it.
+
+ALTER TABLE devices ADD COLUMN os_version_key TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_devices_os_version_key ON devices(os_version_key);
@@ -0,0 +1,15 @@
+-- 032_device_compliance_history.sql
+-- One row per change in a device's compliance state seen by a sync, so
+-- reports can tell when a device became non-compliant rather than only
+-- that it is. A device's first sync records nothing; its created_at marks
+-- when it was first seen. Rows go when the device is deleted.
+
+CREATE TABLE IF NOT EXISTS device_compliance_history (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id  TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    from_state TEXT NOT NULL,
+    to_state   TEXT NOT NULL,
+    changed_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_compliance_history_device ON device_compliance_history(device_id, changed_at);
@@ -0,0 +1,12 @@
+-- 033_device_state_changed.sql
+-- When a sync last changed a device's compliance or encryption state, for
+-- the dashboard's recently changed feed. NULL until a change is seen;
+-- compliance changes already recorded are carried over.
+
+ALTER TABLE devices ADD COLUMN state_changed_at DATETIME;
+
+UPDATE devices SET state_changed_at = (
+    SELECT MAX(changed_at) FROM device_compliance_history h WHERE h.device_id = devices.id
+);
+
+CREATE INDEX IF NOT EXISTS idx_devices_state_changed_at ON devices(state_changed_at);
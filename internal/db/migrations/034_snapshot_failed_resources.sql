@@ -0,0 +1,6 @@
+-- 034_snapshot_failed_resources.sql
+-- Resource types a partially successful capture could not fetch, as a JSON
+-- array of "<resource type>: <reason>" strings. NULL when the capture was
+-- complete or predates this column.
+
+ALTER TABLE policy_snapshots ADD COLUMN failed_resources_json TEXT;
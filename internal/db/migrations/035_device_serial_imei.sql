@@ -0,0 +1,7 @@
+-- 035_device_serial_imei.sql
+-- Hardware identifiers reported by the provider, so the helpdesk can find a
+-- device by the serial number or IMEI printed on it. Empty until the next
+-- sync fills them in.
+
+ALTER TABLE devices ADD COLUMN serial TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN imei TEXT NOT NULL DEFAULT '';
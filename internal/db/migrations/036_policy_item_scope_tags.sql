@@ -0,0 +1,6 @@
+-- 036_policy_item_scope_tags.sql
+-- Intune role scope tags on each captured policy, as a JSON array of names
+-- ('' when the policy has none), so a team can view only the policies it
+-- administers within a shared snapshot.
+
+ALTER TABLE policy_items ADD COLUMN scope_tags TEXT NOT NULL DEFAULT '';
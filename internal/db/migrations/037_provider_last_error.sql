@@ -0,0 +1,7 @@
+-- 037_provider_last_error.sql
+-- The most recent failed health check's message and time. Unlike
+-- last_check_err these survive the next successful check, so a flapping
+-- provider still shows when and why it last failed.
+
+ALTER TABLE provider_configs ADD COLUMN last_error TEXT NOT NULL DEFAULT '';
+ALTER TABLE provider_configs ADD COLUMN last_error_at TEXT NOT NULL DEFAULT '';
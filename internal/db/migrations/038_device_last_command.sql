@@ -0,0 +1,8 @@
+-- 038_device_last_command.sql
+-- The last command MOE sent to each device, when, and whether the provider
+-- accepted it, so the helpdesk can see a command already went out before
+-- sending another. NULL/empty until the first command.
+
+ALTER TABLE devices ADD COLUMN last_command_at DATETIME;
+ALTER TABLE devices ADD COLUMN last_command_action TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN last_command_state TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+-- 039_provider_sync_page_size.sql
+-- Devices requested per page when syncing an Intune provider ($top). Zero
+-- uses the provider's default; smaller pages help tenants that are
+-- throttled, larger ones need fewer requests.
+
+ALTER TABLE provider_configs ADD COLUMN sync_page_size INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,13 @@
+-- 040_compliance_snapshots.sql
+-- Daily rollup of device compliance per provider, for charting the trend.
+-- One row per UTC date and provider; the day's row is refreshed until the
+-- date rolls over, so it ends up holding that day's last counts.
+
+CREATE TABLE IF NOT EXISTS compliance_snapshots (
+    date          TEXT NOT NULL, -- YYYY-MM-DD, UTC
+    provider_name TEXT NOT NULL,
+    compliant     INTEGER NOT NULL DEFAULT 0,
+    noncompliant  INTEGER NOT NULL DEFAULT 0,
+    unknown       INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (date, provider_name)
+);
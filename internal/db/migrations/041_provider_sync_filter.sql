@@ -0,0 +1,6 @@
+-- 041_provider_sync_filter.sql
+-- Optional Graph $filter applied to an Intune provider's device sync, e.g.
+-- "operatingSystem eq 'Windows'", to cache only part of a large tenant.
+-- Empty syncs every managed device.
+
+ALTER TABLE provider_configs ADD COLUMN sync_filter TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+-- 042_policy_item_setting_count.sql
+-- How many settings a policy item has, counted once when the item is stored
+-- so list views don't flatten every item's settings to show it. NULL for
+-- items stored before this column existed; the server backfills those at
+-- startup.
+
+ALTER TABLE policy_items ADD COLUMN setting_count INTEGER;
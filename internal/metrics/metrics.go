@@ -0,0 +1,139 @@
+// Package metrics defines MOE's Prometheus metrics and the /metrics handler.
+//
+// Collectors live on a package registry rather than the client's global
+// default so only MOE's own series (plus Go runtime and process stats) are
+// exported. The HTTP middleware, health poller, snapshot capture and the
+// Intune Graph client record into the collectors below.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "moe",
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "moe",
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency, by method and route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	providerUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "moe",
+		Name:      "provider_up",
+		Help:      "Whether the provider passed its last health check (1) or not (0).",
+	}, []string{"provider", "type"})
+
+	devices = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "moe",
+		Name:      "devices",
+		Help:      "Cached devices, by provider.",
+	}, []string{"provider"})
+
+	captureDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "moe",
+		Name:      "snapshot_capture_duration_seconds",
+		Help:      "Policy snapshot capture duration, by provider and outcome.",
+		Buckets:   []float64{5, 15, 30, 60, 120, 300, 600, 1200, 1800},
+	}, []string{"provider", "status"})
+
+	graphRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "moe",
+		Name:      "graph_requests_total",
+		Help:      "Microsoft Graph requests sent, by provider and status code (including retries).",
+	}, []string{"provider", "status"})
+
+	graphErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "moe",
+		Name:      "graph_request_errors_total",
+		Help:      "Microsoft Graph requests that failed in transport or returned HTTP 4xx/5xx, by provider.",
+	}, []string{"provider"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		providerUp, devices,
+		captureDuration,
+		graphRequests, graphErrors,
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records one HTTP request. route is the ServeMux pattern
+// that matched (e.g. "GET /devices/{id}/edit"), keeping label cardinality
+// bounded; unmatched requests should pass "".
+func ObserveRequest(method, route string, status int, elapsed time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(elapsed.Seconds())
+}
+
+// ProviderHealth is one provider's state for SetProviderHealth.
+type ProviderHealth struct {
+	Name string
+	Type string
+	Up   bool
+}
+
+// SetProviderHealth replaces the provider_up gauges, so providers that were
+// removed or disabled stop being reported.
+func SetProviderHealth(providers []ProviderHealth) {
+	providerUp.Reset()
+	for _, p := range providers {
+		v := 0.0
+		if p.Up {
+			v = 1
+		}
+		providerUp.WithLabelValues(p.Name, p.Type).Set(v)
+	}
+}
+
+// SetDeviceCounts replaces the per-provider device gauges.
+func SetDeviceCounts(counts map[string]int) {
+	devices.Reset()
+	for name, n := range counts {
+		devices.WithLabelValues(name).Set(float64(n))
+	}
+}
+
+// ObserveCapture records how long a policy snapshot capture took. status is
+// the snapshot's final status ("complete" or "error").
+func ObserveCapture(provider, status string, elapsed time.Duration) {
+	captureDuration.WithLabelValues(provider, status).Observe(elapsed.Seconds())
+}
+
+// ObserveGraphRequest records one Graph request attempt. A status of 0
+// means the request failed before a response was received.
+func ObserveGraphRequest(provider string, status int) {
+	label := strconv.Itoa(status)
+	if status == 0 {
+		label = "error"
+	}
+	graphRequests.WithLabelValues(provider, label).Inc()
+	if status == 0 || status >= 400 {
+		graphErrors.WithLabelValues(provider).Inc()
+	}
+}
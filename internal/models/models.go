@@ -4,58 +4,175 @@ import "time"
 
 // Device represents a managed device synced from a UEM or Intune tenant.
 type Device struct {
-	ID           string     `json:"id"`
-	ProviderName string     `json:"provider_name"` // e.g. "uem-anz", "intune-corp"
-	ProviderType string     `json:"provider_type"` // "uem" or "intune"
-	SourceID     string     `json:"source_id"`     // ID within the source system
-	DeviceName   string     `json:"device_name"`
-	OS           string     `json:"os"`         // "iOS", "Android", "Windows", "macOS"
-	OSVersion    string     `json:"os_version"` // e.g. "17.2.1"
-	Model        string     `json:"model"`      // e.g. "iPhone 15 Pro"
-	UserName     string     `json:"user_name"`
-	UserEmail    string     `json:"user_email"`
-	Compliance   string     `json:"compliance"` // "compliant", "non-compliant", "unknown"
-	IsEncrypted  bool       `json:"is_encrypted"`
-	JailBroken   string     `json:"jail_broken"` // "True", "False", "Unknown", or ""
-	IsSupervised bool       `json:"is_supervised"`
-	ThreatState  string     `json:"threat_state"` // "activated", "secured", "compromised", etc.
-	LastSeen     *time.Time `json:"last_seen,omitempty"`
-	LastSyncedAt *time.Time `json:"last_synced_at,omitempty"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
+	ID              string     `json:"id"`
+	ProviderName    string     `json:"provider_name"` // e.g. "uem-anz", "intune-corp"
+	ProviderType    string     `json:"provider_type"` // "uem" or "intune"
+	SourceID        string     `json:"source_id"`     // ID within the source system
+	DeviceName      string     `json:"device_name"`
+	OS              string     `json:"os"`         // "iOS", "Android", "Windows", "macOS"
+	OSVersion       string     `json:"os_version"` // e.g. "17.2.1"
+	Model           string     `json:"model"`      // e.g. "iPhone 15 Pro"
+	Serial          string     `json:"serial"`
+	IMEI            string     `json:"imei"` // IMEI, or MEID for CDMA devices
+	UserName        string     `json:"user_name"`
+	UserEmail       string     `json:"user_email"`
+	Compliance      string     `json:"compliance"` // "compliant", "non-compliant", "unknown"
+	IsEncrypted     bool       `json:"is_encrypted"`
+	JailBroken      string     `json:"jail_broken"` // "True", "False", "Unknown", or ""
+	IsSupervised    bool       `json:"is_supervised"`
+	ThreatState     string     `json:"threat_state"`     // "activated", "secured", "compromised", etc.
+	Ownership       string     `json:"ownership"`        // "corporate", "personal", "unknown"
+	ManagementAgent string     `json:"management_agent"` // e.g. "mdm", "easMdm", "configurationManagerClientMdm"
+	EnrolledAt      *time.Time `json:"enrolled_at,omitempty"`
+	Flagged         bool       `json:"flagged"`        // marked for follow-up by an operator
+	Status          string     `json:"status"`         // DeviceStatusActive or DeviceStatusRetired
+	Tags            []string   `json:"tags,omitempty"` // operator-assigned groups; loaded only for single-device lookups
+	LastSeen        *time.Time `json:"last_seen,omitempty"`
+	LastSyncedAt    *time.Time `json:"last_synced_at,omitempty"`
+	StateChangedAt  *time.Time `json:"state_changed_at,omitempty"` // last sync that changed compliance or encryption
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+
+	// The last command sent to the device from MOE and whether the provider
+	// accepted it (CommandStatePending) or not (CommandStateFailed).
+	LastCommandAt     *time.Time `json:"last_command_at,omitempty"`
+	LastCommandAction string     `json:"last_command_action,omitempty"`
+	LastCommandState  string     `json:"last_command_state,omitempty"`
+}
+
+// Device command states recorded in Device.LastCommandState.
+const (
+	CommandStatePending = "pending" // accepted by the provider
+	CommandStateFailed  = "failed"  // the provider rejected it or was unreachable
+)
+
+// Device lifecycle statuses.
+const (
+	DeviceStatusActive  = "active"
+	DeviceStatusRetired = "retired" // no longer reported by its provider
+)
+
+// ComplianceChange records a device's compliance state changing between
+// two syncs.
+type ComplianceChange struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// ComplianceSnapshot is one day's device compliance counts for a provider,
+// or for every provider when ProviderName is empty.
+type ComplianceSnapshot struct {
+	Date         string `json:"date"` // YYYY-MM-DD, UTC
+	ProviderName string `json:"provider_name,omitempty"`
+	Compliant    int    `json:"compliant"`
+	NonCompliant int    `json:"noncompliant"`
+	Unknown      int    `json:"unknown"`
 }
 
 // DeviceFilter contains optional filter criteria for querying devices.
 type DeviceFilter struct {
-	ProviderName string
-	ProviderType string
-	OS           string
-	Compliance   string
-	Search       string // free-text search across name, email, device name
-	Limit        int
-	Offset       int
+	ProviderName    string
+	ProviderType    string
+	OS              string
+	Compliance      string
+	Search          string // free-text search across name, email, device name, model, serial and IMEI
+	Ownership       string // "corporate", "personal", "unknown"
+	ManagementAgent string
+	Flagged         bool   // only devices flagged for follow-up
+	Tag             string // only devices carrying this tag
+	Status          string // "active" or "retired"; "" = any
+	OSVersionMin    string // only OS versions >= this, compared numerically; "" = no bound
+	OSVersionMax    string // only OS versions < this; "" = no bound
+	StaleDays       int    // only devices last seen more than this many days ago; 0 = any
+	SortBy          string // column to order by; see store.ValidDeviceSort. "" = updated_at
+	SortDir         string // "asc" or "desc"; "" = desc
+	Limit           int
+	Offset          int
 }
 
 // ProviderConfig represents a configured MDM tenant connection.
 type ProviderConfig struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`          // unique display name: "uem-anz"
+	Type         string `json:"type"`          // "uem", "intune" or "jamf"
+	BaseURL      string `json:"base_url"`      // API endpoint
+	TenantID     string `json:"tenant_id"`     // Intune: Azure AD tenant ID; UEM: SRP ID
+	ClientID     string `json:"client_id"`     // Intune: OAuth application/client ID
+	ClientSecret string `json:"-"`             // Intune: OAuth client secret (never serialised)
+	Cloud        string `json:"cloud"`         // Intune: "global" (or ""), "usgov", "dod", "china"
+	Username     string `json:"username"`      // UEM: admin username
+	Password     string `json:"-"`             // UEM: admin password (never serialised)
+	SyncInterval string `json:"sync_interval"` // e.g. "15m"
+	Enabled      bool   `json:"enabled"`
+	// HealthInterval overrides the server-wide health check interval for this
+	// provider, in the same form as SyncInterval. Blank means use the default.
+	HealthInterval string `json:"health_interval"`
+	// SnapshotRetention overrides the server-wide number of policy snapshots
+	// kept for this provider. Zero means use the server default.
+	SnapshotRetention int `json:"snapshot_retention"`
+	// SyncPageSize is how many devices an Intune sync requests per page.
+	// Zero means the provider's default.
+	SyncPageSize int `json:"sync_page_size"`
+	// SyncFilter is an optional Graph $filter limiting which devices an
+	// Intune sync fetches, e.g. "operatingSystem eq 'Windows'".
+	SyncFilter    string    `json:"sync_filter"`
+	LastCheckAt   time.Time `json:"last_check_at"`  // last health check time
+	LastCheckOK   bool      `json:"last_check_ok"`  // true if last check succeeded
+	LastCheckErr  string    `json:"last_check_err"` // error message from last failed check
+	LastSyncAt    time.Time `json:"last_sync_at"`   // last successful sync time
+	ConsecFails   int       `json:"consec_fails"`   // consecutive health check failures
+	SilencedUntil time.Time `json:"silenced_until"` // failure alerts suppressed until this time
+	// LastError and LastErrorAt record the most recent failed health check.
+	// Unlike LastCheckErr they are kept after the provider recovers, so a
+	// flapping provider (recent error, few consecutive failures) can be told
+	// apart from one that is down (many consecutive failures).
+	LastError   string    `json:"last_error"`
+	LastErrorAt time.Time `json:"last_error_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// IsSilenced reports whether failure alerts for the provider are currently
+// suppressed by an operator-set silence window.
+func (p *ProviderConfig) IsSilenced() bool {
+	return !p.SilencedUntil.IsZero() && time.Now().Before(p.SilencedUntil)
+}
+
+// AdminUser is an operator who can sign in to the web UI.
+type AdminUser struct {
 	ID           string    `json:"id"`
-	Name         string    `json:"name"`          // unique display name: "uem-anz"
-	Type         string    `json:"type"`          // "uem" or "intune"
-	BaseURL      string    `json:"base_url"`      // API endpoint
-	TenantID     string    `json:"tenant_id"`     // Intune: Azure AD tenant ID; UEM: SRP ID
-	ClientID     string    `json:"client_id"`     // Intune: OAuth application/client ID
-	ClientSecret string    `json:"-"`             // Intune: OAuth client secret (never serialised)
-	Username     string    `json:"username"`      // UEM: admin username
-	Password     string    `json:"-"`             // UEM: admin password (never serialised)
-	SyncInterval string    `json:"sync_interval"` // e.g. "15m"
-	Enabled      bool      `json:"enabled"`
-	LastCheckAt  time.Time `json:"last_check_at"`  // last health check time
-	LastCheckOK  bool      `json:"last_check_ok"`  // true if last check succeeded
-	LastCheckErr string    `json:"last_check_err"` // error message from last failed check
-	LastSyncAt   time.Time `json:"last_sync_at"`   // last successful sync time
-	ConsecFails  int       `json:"consec_fails"`   // consecutive health check failures
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"-"` // bcrypt
 	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	LastLoginAt  time.Time `json:"last_login_at"`
+}
+
+// AuditEntry records one state-changing action taken through the UI or API.
+type AuditEntry struct {
+	ID         string    `json:"id"`
+	At         time.Time `json:"at"`
+	Actor      string    `json:"actor"`       // who acted; "system" until users are authenticated
+	Action     string    `json:"action"`      // e.g. "create", "delete", "sync", "command"
+	TargetType string    `json:"target_type"` // e.g. "device", "provider", "snapshot"
+	TargetID   string    `json:"target_id"`
+	Detail     string    `json:"detail,omitempty"` // human-readable summary, e.g. the target's name
+}
+
+// SyncRun records one device sync of a provider.
+type SyncRun struct {
+	ID           string    `json:"id"`
+	ProviderName string    `json:"provider_name"`
+	StartedAt    time.Time `json:"started_at"`
+	FinishedAt   time.Time `json:"finished_at"`
+	DurationMS   int64     `json:"duration_ms"`
+	DeviceCount  int       `json:"device_count"` // devices synced, including pages before a failure
+	Error        string    `json:"error,omitempty"`
+}
+
+// Duration returns how long the sync took, to the millisecond.
+func (r SyncRun) Duration() time.Duration {
+	return time.Duration(r.DurationMS) * time.Millisecond
 }
 
 // PolicySnapshot represents a point-in-time capture of all policies from a provider.
@@ -67,17 +184,57 @@ type PolicySnapshot struct {
 	TakenAt       time.Time `json:"taken_at"`
 	PolicyCount   int       `json:"policy_count"`
 	CategoryCount int       `json:"category_count"`
-	Status        string    `json:"status"`         // "capturing", "complete", "error"
+	Status        string    `json:"status"`         // "queued", "capturing", "complete", "error"
 	StatusMessage string    `json:"status_message"` // error detail when status=error
+	// MissingSettingsCount is how many items have a SettingsError.
+	MissingSettingsCount int `json:"missing_settings_count"`
+	// CaptureMethod is the provider path that fetched the policies
+	// (provider.CaptureMethodUTCM or provider.CaptureMethodLegacy); empty
+	// when unknown.
+	CaptureMethod string `json:"capture_method"`
+	// Coverage is the per-category result of the capture; nil when unknown.
+	Coverage []CategoryCoverage `json:"coverage,omitempty"`
+	// FailedResources lists the resource types a partially successful
+	// capture could not fetch, as "<resource type>: <reason>".
+	FailedResources []string `json:"failed_resources,omitempty"`
+	// IsBenchmark marks an imported benchmark template that live snapshots
+	// are scored against, rather than a capture of a tenant.
+	IsBenchmark bool `json:"is_benchmark"`
+	// Categories are the policy categories the capture was narrowed to;
+	// empty when every category was captured.
+	Categories []string `json:"categories,omitempty"`
+	// ClonedFrom is the ID of the snapshot this one was cloned from. Clones
+	// are frozen reference copies and are exempt from retention pruning.
+	ClonedFrom string `json:"cloned_from,omitempty"`
+}
+
+// CategoryCoverage is one category's outcome in a snapshot capture.
+type CategoryCoverage struct {
+	Category string `json:"category"`
+	Count    int    `json:"count"`
+	Error    string `json:"error,omitempty"`
 }
 
-// Snapshot status constants.
+// Snapshot status constants. A capture is "queued" while it waits for a
+// free capture slot, then "capturing".
 const (
+	SnapshotStatusQueued    = "queued"
 	SnapshotStatusCapturing = "capturing"
 	SnapshotStatusComplete  = "complete"
 	SnapshotStatusError     = "error"
 )
 
+// InProgress reports whether the snapshot's capture is queued or running.
+func (s PolicySnapshot) InProgress() bool {
+	return s.Status == SnapshotStatusQueued || s.Status == SnapshotStatusCapturing
+}
+
+// Partial reports whether the snapshot is complete but some resource types
+// could not be captured.
+func (s PolicySnapshot) Partial() bool {
+	return s.Status == SnapshotStatusComplete && len(s.FailedResources) > 0
+}
+
 // DisplayName returns the label if set, otherwise the provider name.
 func (s PolicySnapshot) DisplayName() string {
 	if s.Label != "" {
@@ -97,4 +254,27 @@ type PolicyItem struct {
 	Platform     string `json:"platform"`    // "Windows", "iOS", "Android", "All", ""
 	Description  string `json:"description"`
 	SettingsJSON string `json:"settings_json"` // full JSON blob of settings
+	// SettingsError is non-empty when the settings could not be captured;
+	// SettingsJSON then holds policy metadata only.
+	SettingsError string `json:"settings_error,omitempty"`
+	// Severity ranks a benchmark control ("critical", "high", "medium",
+	// "low"). Only set on items imported as part of a benchmark template.
+	Severity string `json:"severity,omitempty"`
+	// ScopeTags names the Intune role scope tags the policy is visible to.
+	ScopeTags []string `json:"scope_tags,omitempty"`
+	// SettingCount is how many settings the policy has when flattened to
+	// the default depth, computed when the item is stored.
+	SettingCount int `json:"setting_count"`
+}
+
+// SettingHit is one setting matched by a cross-snapshot settings search.
+type SettingHit struct {
+	SnapshotID    string    `json:"snapshot_id"`
+	SnapshotLabel string    `json:"snapshot_label"`
+	ProviderName  string    `json:"provider_name"`
+	TakenAt       time.Time `json:"taken_at"`
+	PolicyName    string    `json:"policy_name"`
+	Category      string    `json:"category"`
+	Setting       string    `json:"setting"` // top-level key in settings_json
+	Value         string    `json:"value"`   // the setting's value; nested values as compact JSON
 }
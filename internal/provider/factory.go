@@ -0,0 +1,66 @@
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dan/moe/internal/models"
+)
+
+// Options are the server-wide settings a Factory applies to every provider
+// it builds. Zero values leave a backend's own defaults in place, and a
+// backend ignores the options it has no use for.
+type Options struct {
+	// Timeout bounds each request to the provider's API.
+	Timeout time.Duration
+	// PolicyConcurrency is how many policies a capture fetches at once.
+	PolicyConcurrency int
+}
+
+// Factory builds a Provider from its stored configuration.
+type Factory func(cfg models.ProviderConfig, opts Options) (Provider, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{}
+)
+
+// RegisterFactory makes a provider type available to New. Provider packages
+// call it from init, so a backend is linked in by importing its package.
+// It panics if the type is registered twice or fn is nil.
+func RegisterFactory(typeName string, fn Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if fn == nil {
+		panic("provider: RegisterFactory with nil factory for " + typeName)
+	}
+	if _, dup := factories[typeName]; dup {
+		panic("provider: RegisterFactory called twice for " + typeName)
+	}
+	factories[typeName] = fn
+}
+
+// New builds a Provider for cfg using the factory registered for cfg.Type.
+func New(cfg models.ProviderConfig, opts Options) (Provider, error) {
+	factoriesMu.RLock()
+	fn, ok := factories[cfg.Type]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown provider type: %s", cfg.Type)
+	}
+	return fn(cfg, opts)
+}
+
+// Types returns the registered provider types, sorted.
+func Types() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	types := make([]string, 0, len(factories))
+	for t := range factories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,178 @@
+package intune
+
+// assignments.go — Capture who each policy is assigned to.
+//
+// Both capture paths fetch the Graph /assignments sub-resource per policy
+// and store the targets under the "_assignments" key of SettingsJSON, next
+// to the "_settings" key Settings Catalog policies get. Group IDs are
+// resolved to display names through the provider's groupNameCache; a group
+// that can't be looked up keeps just its ID.
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/dan/moe/internal/provider"
+)
+
+// AssignmentsKey is the SettingsJSON key holding a policy's assignments.
+const AssignmentsKey = "_assignments"
+
+// graphAssignment is one item of a policy's /assignments collection.
+type graphAssignment struct {
+	Target struct {
+		ODataType  string `json:"@odata.type"`
+		GroupID    string `json:"groupId"`
+		FilterID   string `json:"deviceAndAppManagementAssignmentFilterId"`
+		FilterType string `json:"deviceAndAppManagementAssignmentFilterType"`
+	} `json:"target"`
+}
+
+// attachAssignments fetches a policy's assignments and merges them into its
+// SettingsJSON. Failures are logged and leave the policy without an
+// "_assignments" key; they don't fail the sync.
+func (p *Provider) attachAssignments(ctx context.Context, sp *provider.SyncPolicy, apiVersion string, ep policyEndpoint) {
+	assignments, err := p.fetchPolicyAssignments(ctx, p.policyItemURL(apiVersion, ep, sp.SourceID)+"/assignments")
+	if err != nil {
+		p.logf(ctx, "warning: could not fetch assignments for %s/%s: %v", ep.Path, sp.SourceID, err)
+		return
+	}
+	sp.SettingsJSON = mergeAssignmentsJSON(sp.SettingsJSON, assignments)
+}
+
+// fetchPolicyAssignments fetches and normalises an /assignments collection,
+// sorted so unchanged assignments compare equal across snapshots.
+func (p *Provider) fetchPolicyAssignments(ctx context.Context, url string) ([]provider.PolicyAssignment, error) {
+	items, err := p.graphGetAll(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	assignments := make([]provider.PolicyAssignment, 0, len(items))
+	for _, raw := range items {
+		var ga graphAssignment
+		if err := json.Unmarshal(raw, &ga); err != nil {
+			return nil, err
+		}
+		a := provider.PolicyAssignment{
+			Target:  strings.TrimSuffix(cleanODataType(ga.Target.ODataType), "AssignmentTarget"),
+			GroupID: ga.Target.GroupID,
+		}
+		if a.GroupID != "" {
+			a.GroupName, _ = p.groups.Resolve(ctx, a.GroupID)
+		}
+		if ga.Target.FilterID != "" && ga.Target.FilterType != "" && ga.Target.FilterType != "none" {
+			a.FilterID = ga.Target.FilterID
+			a.FilterType = ga.Target.FilterType
+		}
+		assignments = append(assignments, a)
+	}
+
+	sort.Slice(assignments, func(i, j int) bool {
+		a, b := assignments[i], assignments[j]
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		return a.GroupID < b.GroupID
+	})
+	return assignments, nil
+}
+
+// mergeAssignmentsJSON adds an "_assignments" key into the existing settings
+// JSON, mirroring mergeSettingsJSON.
+func mergeAssignmentsJSON(existingJSON string, assignments []provider.PolicyAssignment) string {
+	var m map[string]any
+	if err := json.Unmarshal([]byte(existingJSON), &m); err != nil {
+		return existingJSON
+	}
+	m[AssignmentsKey] = assignments
+	b, err := json.Marshal(m)
+	if err != nil {
+		return existingJSON
+	}
+	return string(b)
+}
+
+// PolicyAssignments extracts the assignments captured in a policy's settings
+// JSON. ok is false when none were captured, as opposed to a policy that is
+// assigned to nothing.
+func PolicyAssignments(settingsJSON string) (assignments []provider.PolicyAssignment, ok bool) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(settingsJSON), &m); err != nil {
+		return nil, false
+	}
+	raw, ok := m[AssignmentsKey]
+	if !ok {
+		return nil, false
+	}
+	if err := json.Unmarshal(raw, &assignments); err != nil {
+		return nil, false
+	}
+	if assignments == nil {
+		assignments = []provider.PolicyAssignment{}
+	}
+	return assignments, true
+}
+
+// ── UTCM ────────────────────────────────────────────────────────────────
+
+// utcmAssignmentSources maps UTCM resource types, by their short-name
+// prefix, to the Graph collection holding the same objects. UTCM instance
+// IDs are Graph object IDs, so assignments are fetched from there. The
+// first matching prefix wins; resource types with no entry (app protection,
+// WIP, roles, filters) are captured without assignments.
+var utcmAssignmentSources = []struct {
+	prefix string
+	ep     policyEndpoint
+}{
+	{"deviceCompliancePolicy", policyEndpoint{Path: "deviceCompliancePolicies"}},
+	{"deviceConfigurationAdministrativeTemplatePolicy", policyEndpoint{Path: "groupPolicyConfigurations", Beta: true}},
+	{"deviceConfiguration", policyEndpoint{Path: "deviceConfigurations"}},
+	{"wifiConfigurationPolicy", policyEndpoint{Path: "deviceConfigurations"}},
+	{"windowsUpdateForBusinessRingUpdateProfile", policyEndpoint{Path: "deviceConfigurations"}},
+	{"windowsUpdateForBusinessFeatureUpdateProfile", policyEndpoint{Path: "windowsFeatureUpdateProfiles", Beta: true}},
+	{"windowsAutopilotDeploymentProfile", policyEndpoint{Path: "windowsAutopilotDeploymentProfiles", Beta: true}},
+	{"deviceEnrollment", policyEndpoint{Path: "deviceEnrollmentConfigurations"}},
+	{"settingCatalog", policyEndpoint{Path: "configurationPolicies", Beta: true}},
+	{"antivirusPolicy", policyEndpoint{Path: "configurationPolicies", Beta: true}},
+	{"attackSurfaceReduction", policyEndpoint{Path: "configurationPolicies", Beta: true}},
+	{"endpointDetectionAndResponse", policyEndpoint{Path: "configurationPolicies", Beta: true}},
+	{"exploitProtection", policyEndpoint{Path: "configurationPolicies", Beta: true}},
+	{"accountProtection", policyEndpoint{Path: "configurationPolicies", Beta: true}},
+	{"applicationControl", policyEndpoint{Path: "configurationPolicies", Beta: true}},
+	{"policySets", policyEndpoint{FullPath: "deviceAppManagement/policySets", Beta: true}},
+}
+
+// utcmAssignmentSource returns the Graph collection for a short UTCM
+// resource type (SyncPolicy.PolicyType).
+func utcmAssignmentSource(policyType string) (policyEndpoint, bool) {
+	for _, s := range utcmAssignmentSources {
+		if strings.HasPrefix(policyType, s.prefix) {
+			return s.ep, true
+		}
+	}
+	return policyEndpoint{}, false
+}
+
+// attachUTCMAssignments fetches assignments for UTCM-captured policies.
+// UTCM's own "Assignments" property is dropped by normalizeUTCMSettings,
+// so both capture methods store the same Graph-shaped "_assignments".
+func (p *Provider) attachUTCMAssignments(ctx context.Context, policies []provider.SyncPolicy) {
+	for i := range policies {
+		sp := &policies[i]
+		ep, ok := utcmAssignmentSource(sp.PolicyType)
+		if !ok || sp.SourceID == "" {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		apiVersion := "v1.0"
+		if ep.Beta {
+			apiVersion = "beta"
+		}
+		p.attachAssignments(ctx, sp, apiVersion, ep)
+	}
+}
@@ -0,0 +1,195 @@
+package intune
+
+// groups.go — Resolve Entra ID group IDs in captured policies to names.
+//
+// Assignments carry their group's name (see assignments.go). Settings that
+// reference groups, such as "excludedGroupIds" or a local group membership
+// policy's members, get a "_groups" key mapping each referenced ID to its
+// display name, so the policy view can show names next to the GUIDs without
+// rewriting the captured values themselves.
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dan/moe/internal/provider"
+)
+
+// GroupNamesKey is the SettingsJSON key mapping group IDs referenced by a
+// policy's settings to their display names.
+const GroupNamesKey = "_groups"
+
+// Group name cache lifetimes. Failed lookups (no Group.Read.All, deleted
+// groups) are remembered for a shorter time so a sync doesn't repeat a
+// doomed request for every policy that references the group.
+const (
+	groupNameTTL = time.Hour
+	groupMissTTL = 5 * time.Minute
+)
+
+// guidPattern matches an Entra ID object ID.
+var guidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// groupNameCache lazily resolves Entra ID group IDs to display names and
+// caches the results. It is safe for concurrent use: the lock is not held
+// during lookups, and concurrent callers asking for the same ID share one.
+type groupNameCache struct {
+	lookup func(ctx context.Context, id string) (string, error)
+
+	mu       sync.Mutex
+	entries  map[string]groupNameEntry
+	inflight map[string]chan struct{} // closed when the ID's lookup finishes
+}
+
+type groupNameEntry struct {
+	name    string // "" when the lookup failed
+	expires time.Time
+}
+
+// newGroupNameCache creates a cache that resolves misses with lookup.
+func newGroupNameCache(lookup func(ctx context.Context, id string) (string, error)) *groupNameCache {
+	return &groupNameCache{
+		lookup:   lookup,
+		entries:  make(map[string]groupNameEntry),
+		inflight: make(map[string]chan struct{}),
+	}
+}
+
+// Resolve returns the display name of a group. ok is false when the group
+// can't be looked up; that is logged, not returned, so a sync carries on
+// and callers fall back to showing the raw ID.
+func (c *groupNameCache) Resolve(ctx context.Context, id string) (name string, ok bool) {
+	for {
+		c.mu.Lock()
+		e, cached := c.entries[id]
+		if cached && time.Now().Before(e.expires) {
+			c.mu.Unlock()
+			return e.name, e.name != ""
+		}
+		wait, busy := c.inflight[id]
+		if !busy {
+			c.inflight[id] = make(chan struct{})
+			c.mu.Unlock()
+			break
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return "", false
+		}
+	}
+
+	name, err := c.lookup(ctx, id)
+	ttl := groupNameTTL
+	if err != nil || name == "" {
+		if err != nil && ctx.Err() == nil {
+			log.Printf("%s warning: could not resolve group %s: %v", logTag(ctx, "intune", ""), id, err)
+		}
+		name, ttl = "", groupMissTTL
+	}
+
+	c.mu.Lock()
+	if ctx.Err() == nil { // a cancelled lookup is not a miss worth remembering
+		c.entries[id] = groupNameEntry{name: name, expires: time.Now().Add(ttl)}
+	}
+	close(c.inflight[id])
+	delete(c.inflight, id)
+	c.mu.Unlock()
+	return name, name != ""
+}
+
+// lookupGroupName fetches a group's display name from Graph.
+func (p *Provider) lookupGroupName(ctx context.Context, id string) (string, error) {
+	body, err := p.graphGet(ctx, p.graphURL+"/v1.0/groups/"+url.PathEscape(id)+"?$select=displayName")
+	if err != nil {
+		return "", err
+	}
+	var g struct {
+		DisplayName string `json:"displayName"`
+	}
+	if err := json.Unmarshal(body, &g); err != nil {
+		return "", err
+	}
+	return g.DisplayName, nil
+}
+
+// attachGroupNames resolves the groups referenced by a policy's settings
+// and merges them into its SettingsJSON under "_groups". Groups that can't
+// be resolved are left out, so the view shows just their ID.
+func (p *Provider) attachGroupNames(ctx context.Context, sp *provider.SyncPolicy) {
+	var m map[string]any
+	if err := json.Unmarshal([]byte(sp.SettingsJSON), &m); err != nil {
+		return
+	}
+	ids := map[string]bool{}
+	for k, v := range m {
+		if k == AssignmentsKey {
+			continue // assignments carry their own names
+		}
+		collectGroupIDs(k, v, false, ids)
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+
+	names := map[string]string{}
+	for _, id := range sorted {
+		if name, ok := p.groups.Resolve(ctx, id); ok {
+			names[id] = name
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	m[GroupNamesKey] = names
+	if b, err := json.Marshal(m); err == nil {
+		sp.SettingsJSON = string(b)
+	}
+}
+
+// collectGroupIDs adds to ids every GUID found under a key naming groups
+// ("groupId", "excludedGroupIds", "groups", …), at any depth.
+func collectGroupIDs(key string, v any, inGroup bool, ids map[string]bool) {
+	inGroup = inGroup || strings.Contains(strings.ToLower(key), "group")
+	switch val := v.(type) {
+	case string:
+		if inGroup && guidPattern.MatchString(val) {
+			ids[val] = true
+		}
+	case []any:
+		for _, inner := range val {
+			collectGroupIDs(key, inner, inGroup, ids)
+		}
+	case map[string]any:
+		for k, inner := range val {
+			collectGroupIDs(k, inner, inGroup, ids)
+		}
+	}
+}
+
+// GroupNames returns the group names captured for a policy's settings,
+// keyed by group ID, or nil if none were.
+func GroupNames(settingsJSON string) map[string]string {
+	var m struct {
+		Groups map[string]string `json:"_groups"`
+	}
+	if err := json.Unmarshal([]byte(settingsJSON), &m); err != nil {
+		return nil
+	}
+	return m.Groups
+}
@@ -0,0 +1,72 @@
+package intune
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dan/moe/internal/provider"
+)
+
+func TestGroupNameCache(t *testing.T) {
+	calls := map[string]int{}
+	c := newGroupNameCache(func(ctx context.Context, id string) (string, error) {
+		calls[id]++
+		if id == "gone" {
+			return "", errors.New("graph API error (HTTP 404)")
+		}
+		return "Group " + id, nil
+	})
+	ctx := context.Background()
+
+	for range 2 {
+		if name, ok := c.Resolve(ctx, "g1"); !ok || name != "Group g1" {
+			t.Errorf("Resolve(g1) = %q, %v; want Group g1", name, ok)
+		}
+		if name, ok := c.Resolve(ctx, "gone"); ok || name != "" {
+			t.Errorf("Resolve(gone) = %q, %v; want a miss", name, ok)
+		}
+	}
+	if calls["g1"] != 1 || calls["gone"] != 1 {
+		t.Errorf("lookups = %v, want one per ID (hits and misses cached)", calls)
+	}
+
+	// An expired entry is looked up again.
+	c.mu.Lock()
+	c.entries["g1"] = groupNameEntry{name: "Old", expires: time.Now().Add(-time.Second)}
+	c.mu.Unlock()
+	if name, _ := c.Resolve(ctx, "g1"); name != "Group g1" || calls["g1"] != 2 {
+		t.Errorf("after expiry Resolve(g1) = %q with %d lookups, want a fresh lookup", name, calls["g1"])
+	}
+}
+
+func TestAttachGroupNames(t *testing.T) {
+	const (
+		finance = "8f1c2d3e-0000-4000-8000-000000000001"
+		unknown = "8f1c2d3e-0000-4000-8000-000000000002"
+		device  = "8f1c2d3e-0000-4000-8000-000000000003"
+	)
+	fg := newFakeGraph(t)
+	fg.handle("GET /v1.0/groups/"+finance, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"displayName": "Finance Laptops"})
+	})
+	p := fg.provider()
+
+	sp := provider.SyncPolicy{SettingsJSON: `{
+		"excludedGroupIds": ["` + finance + `", "` + unknown + `"],
+		"deviceId": "` + device + `",
+		"passwordRequired": true
+	}`}
+	p.attachGroupNames(context.Background(), &sp)
+
+	want := map[string]string{finance: "Finance Laptops"}
+	if got := GroupNames(sp.SettingsJSON); !reflect.DeepEqual(got, want) {
+		t.Errorf("GroupNames = %v, want %v (unresolved and non-group IDs left out)", got, want)
+	}
+	if n := fg.count("GET /v1.0/groups/" + device); n != 0 {
+		t.Errorf("looked up a non-group ID %d times", n)
+	}
+}
@@ -0,0 +1,93 @@
+package intune
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeGraph is an httptest server standing in for both the Entra ID token
+// endpoint and Microsoft Graph. Tests register Graph handlers by path (e.g.
+// "GET /v1.0/deviceManagement/managedDevices"); the token endpoint is always
+// served. Unregistered paths return 404 like a missing Graph resource.
+type fakeGraph struct {
+	t   *testing.T
+	srv *httptest.Server
+	mux *http.ServeMux
+
+	mu    sync.Mutex
+	calls map[string]int // request count by "METHOD path"
+}
+
+func newFakeGraph(t *testing.T) *fakeGraph {
+	t.Helper()
+	fg := &fakeGraph{t: t, mux: http.NewServeMux(), calls: make(map[string]int)}
+
+	fg.mux.HandleFunc("POST /{tenant}/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		if want := fg.srv.URL + "/.default"; r.FormValue("scope") != want {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_scope", "scope": r.FormValue("scope")})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token": "test-token",
+			"expires_in":   3600,
+			"token_type":   "Bearer",
+		})
+	})
+
+	fg.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fg.mu.Lock()
+		fg.calls[r.Method+" "+r.URL.Path]++
+		fg.mu.Unlock()
+
+		if r.URL.Path != "/tenant-1/oauth2/v2.0/token" && r.Header.Get("Authorization") != "Bearer test-token" {
+			writeJSON(w, http.StatusUnauthorized, map[string]any{"error": "missing bearer token"})
+			return
+		}
+		fg.mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(fg.srv.Close)
+	return fg
+}
+
+// handle registers a Graph handler for a method + path pattern.
+func (fg *fakeGraph) handle(pattern string, h http.HandlerFunc) {
+	fg.mux.HandleFunc(pattern, h)
+}
+
+// count returns how many times "METHOD path" was requested.
+func (fg *fakeGraph) count(key string) int {
+	fg.mu.Lock()
+	defer fg.mu.Unlock()
+	return fg.calls[key]
+}
+
+// url returns an absolute URL on the fake server.
+func (fg *fakeGraph) url(path string) string {
+	return fg.srv.URL + path
+}
+
+// provider returns an Intune provider wired to the fake server, with a fast
+// UTCM poll interval so tests don't wait on real timings.
+func (fg *fakeGraph) provider() *Provider {
+	p := New(Config{
+		Name:         "intune-test",
+		TenantID:     "tenant-1",
+		ClientID:     "client-1",
+		ClientSecret: "secret-1",
+		GraphURL:     fg.srv.URL,
+		LoginURL:     fg.srv.URL,
+		HTTPClient:   fg.srv.Client(),
+	})
+	p.utcmPollInterval = 10 * time.Millisecond
+	return p
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -1,50 +1,275 @@
 package intune
 
 import (
+	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/dan/moe/internal/metrics"
+	"github.com/dan/moe/internal/models"
 	"github.com/dan/moe/internal/provider"
 )
 
+// Cloud holds the Microsoft Graph and Entra ID (login) endpoints for one
+// Microsoft cloud environment.
+type Cloud struct {
+	GraphURL string
+	LoginURL string
+}
+
+// Clouds lists the supported national/sovereign cloud environments by the
+// name stored on the provider config. An empty name means "global".
+var Clouds = map[string]Cloud{
+	"global": {GraphURL: "https://graph.microsoft.com", LoginURL: "https://login.microsoftonline.com"},
+	"usgov":  {GraphURL: "https://graph.microsoft.us", LoginURL: "https://login.microsoftonline.us"},
+	"dod":    {GraphURL: "https://dod-graph.microsoft.us", LoginURL: "https://login.microsoftonline.us"},
+	"china":  {GraphURL: "https://microsoftgraph.chinacloudapi.cn", LoginURL: "https://login.chinacloudapi.cn"},
+}
+
+// CloudByName returns the endpoints for a named cloud ("" is "global").
+func CloudByName(name string) (Cloud, bool) {
+	if name == "" {
+		name = "global"
+	}
+	c, ok := Clouds[name]
+	return c, ok
+}
+
+// DefaultTimeout is the Graph client's per-request timeout when
+// Config.Timeout is unset.
+const DefaultTimeout = 30 * time.Second
+
+// Device sync page sizes ($top). Graph returns at most MaxPageSize managed
+// devices per page.
+const (
+	DefaultPageSize = 200
+	MaxPageSize     = 1000
+)
+
+// maxDeviceFilterLen bounds Config.DeviceFilter, well inside Graph's URL
+// length limit.
+const maxDeviceFilterLen = 1000
+
+// ValidateDeviceFilter checks that a device sync $filter is well-formed
+// enough to send: single line, quotes closed and parentheses balanced.
+// Whether Graph accepts it is only known once a sync runs.
+func ValidateDeviceFilter(filter string) error {
+	if len(filter) > maxDeviceFilterLen {
+		return fmt.Errorf("longer than %d characters", maxDeviceFilterLen)
+	}
+	depth, quoted := 0, false
+	for _, r := range filter {
+		switch {
+		case r < ' ' || r == 0x7f:
+			return fmt.Errorf("contains a control character")
+		case r == '\'':
+			quoted = !quoted // '' inside a string is an escaped quote: two toggles
+		case quoted:
+		case r == '(':
+			depth++
+		case r == ')':
+			if depth == 0 {
+				return fmt.Errorf("unbalanced parentheses")
+			}
+			depth--
+		}
+	}
+	if quoted {
+		return fmt.Errorf("unterminated string")
+	}
+	if depth != 0 {
+		return fmt.Errorf("unbalanced parentheses")
+	}
+	return nil
+}
+
+// testConnectionTimeout bounds a TestConnection whose caller set no
+// deadline: it only fetches a token and should fail fast when the tenant
+// can't be reached.
+const testConnectionTimeout = 10 * time.Second
+
+// Connection pool settings for the Graph transport. A sync makes hundreds
+// of requests to the same host, far more than net/http's default of two
+// idle connections per host keeps warm.
+const (
+	maxIdleConns        = 100
+	maxIdleConnsPerHost = 20
+	idleConnTimeout     = 90 * time.Second
+)
+
 // Config holds the configuration for an Intune provider instance.
 type Config struct {
 	Name         string // unique name e.g. "intune-corp"
 	TenantID     string
 	ClientID     string
 	ClientSecret string
+	Cloud        string // key into Clouds; empty means "global"
+
+	// Optional overrides. Empty values use the Cloud's endpoints and a
+	// pooled client with a Timeout per request; tests point these at an
+	// httptest server.
+	GraphURL   string       // e.g. "https://graph.microsoft.com"
+	LoginURL   string       // e.g. "https://login.microsoftonline.com"
+	HTTPClient *http.Client // shared by Graph and token requests
+
+	// Timeout bounds each Graph request, including reading the body, so
+	// large Settings Catalog /settings fetches may need more than the
+	// default. Zero means DefaultTimeout. Ignored when HTTPClient is set.
+	Timeout time.Duration
+
+	// PolicyConcurrency caps the Graph requests a legacy policy sync has in
+	// flight. Zero means defaultPolicyConcurrency.
+	PolicyConcurrency int
+
+	// PageSize is how many devices SyncDevices requests per page. Zero means
+	// DefaultPageSize; values above MaxPageSize are capped to it.
+	PageSize int
+
+	// DeviceFilter is an optional Graph $filter for SyncDevices, such as
+	// "operatingSystem eq 'Windows'". Check it with ValidateDeviceFilter.
+	DeviceFilter string
 }
 
 // Provider implements the provider.Provider interface for Microsoft Intune
 // via the Microsoft Graph API.
 type Provider struct {
-	config Config
-	tokens *tokenCache
-	client *http.Client
+	config   Config
+	tokens   *tokenCache
+	client   *http.Client
+	graphURL string // base URL without trailing slash, e.g. "https://graph.microsoft.com"
+
+	// utcmPollInterval is how often a UTCM snapshot job is polled.
+	utcmPollInterval time.Duration
+
+	policyConcurrency int // see Config.PolicyConcurrency
+	pageSize          int // see Config.PageSize
+
+	groups *groupNameCache
 }
 
 // New creates a new Intune provider instance.
 func New(cfg Config) *Provider {
-	return &Provider{
-		config: cfg,
-		tokens: newTokenCache(cfg.TenantID, cfg.ClientID, cfg.ClientSecret),
-		client: &http.Client{Timeout: 30 * time.Second},
+	client := cfg.HTTPClient
+	if client == nil {
+		timeout := cfg.Timeout
+		if timeout <= 0 {
+			timeout = DefaultTimeout
+		}
+		client = &http.Client{Timeout: timeout, Transport: newTransport()}
+	}
+	cloud, ok := CloudByName(cfg.Cloud)
+	if !ok {
+		cloud = Clouds["global"]
+	}
+	graphURL := strings.TrimRight(cfg.GraphURL, "/")
+	if graphURL == "" {
+		graphURL = cloud.GraphURL
+	}
+	loginURL := strings.TrimRight(cfg.LoginURL, "/")
+	if loginURL == "" {
+		loginURL = cloud.LoginURL
+	}
+	p := &Provider{
+		config:           cfg,
+		tokens:           newTokenCache(loginURL, graphURL+"/.default", cfg.TenantID, cfg.ClientID, cfg.ClientSecret, client.Transport),
+		client:           client,
+		graphURL:         graphURL,
+		utcmPollInterval: 5 * time.Second,
 	}
+	p.policyConcurrency = cfg.PolicyConcurrency
+	if p.policyConcurrency <= 0 {
+		p.policyConcurrency = defaultPolicyConcurrency
+	}
+	p.pageSize = cfg.PageSize
+	if p.pageSize <= 0 {
+		p.pageSize = DefaultPageSize
+	}
+	p.pageSize = min(p.pageSize, MaxPageSize)
+	p.groups = newGroupNameCache(p.lookupGroupName)
+	return p
+}
+
+func init() {
+	provider.RegisterFactory("intune", func(cfg models.ProviderConfig, opts provider.Options) (provider.Provider, error) {
+		if _, ok := CloudByName(cfg.Cloud); !ok {
+			return nil, fmt.Errorf("unknown Microsoft cloud: %s", cfg.Cloud)
+		}
+		if err := ValidateDeviceFilter(cfg.SyncFilter); err != nil {
+			return nil, fmt.Errorf("invalid device sync filter: %w", err)
+		}
+		return New(Config{
+			Name:              cfg.Name,
+			TenantID:          cfg.TenantID,
+			ClientID:          cfg.ClientID,
+			ClientSecret:      cfg.ClientSecret,
+			Cloud:             cfg.Cloud,
+			Timeout:           opts.Timeout,
+			PolicyConcurrency: opts.PolicyConcurrency,
+			PageSize:          cfg.SyncPageSize,
+			DeviceFilter:      cfg.SyncFilter,
+		}), nil
+	})
+}
+
+// newTransport returns a transport like http.DefaultTransport with a larger
+// idle connection pool, so a sync reuses connections instead of churning
+// sockets.
+func newTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = maxIdleConns
+	t.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	t.IdleConnTimeout = idleConnTimeout
+	return t
 }
 
 func (p *Provider) Name() string { return p.config.Name }
 func (p *Provider) Type() string { return "intune" }
 
+// logTag builds a log line prefix such as "[intune:corp]", adding the request
+// ID when ctx carries one ("[intune:corp req=4f2a…]") so the Graph calls a
+// UI or API request triggered can be found by its X-Request-ID.
+func logTag(ctx context.Context, kind, name string) string {
+	tag := kind
+	if name != "" {
+		tag += ":" + name
+	}
+	if id := provider.RequestID(ctx); id != "" {
+		tag += " req=" + id
+	}
+	return "[" + tag + "]"
+}
+
+// logf logs a message tagged with the provider's name and ctx's request ID.
+func (p *Provider) logf(ctx context.Context, format string, args ...any) {
+	log.Print(logTag(ctx, "intune", p.config.Name) + " " + fmt.Sprintf(format, args...))
+}
+
+// utcmLogf is logf for the UTCM capture path.
+func (p *Provider) utcmLogf(ctx context.Context, format string, args ...any) {
+	log.Print(logTag(ctx, "utcm", p.config.Name) + " " + fmt.Sprintf(format, args...))
+}
+
 // TestConnection verifies the Intune tenant is reachable by acquiring an
 // OAuth2 access token. This validates tenant ID, client ID, and client secret
-// without making any Graph API data calls.
+// without making any Graph API data calls. The caller's deadline, such as
+// the health check timeout, is kept; without one it gives up after
+// testConnectionTimeout, well short of the Graph request timeout.
 func (p *Provider) TestConnection(ctx context.Context) error {
-	_, err := p.tokens.Token()
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, testConnectionTimeout)
+		defer cancel()
+	}
+	_, err := p.tokens.Token(ctx)
 	if err != nil {
 		return fmt.Errorf("authentication failed: %w", err)
 	}
@@ -65,6 +290,9 @@ type graphDevice struct {
 	OperatingSystem            string `json:"operatingSystem"`
 	OSVersion                  string `json:"osVersion"`
 	Model                      string `json:"model"`
+	SerialNumber               string `json:"serialNumber"`
+	IMEI                       string `json:"imei"`
+	MEID                       string `json:"meid"`
 	UserDisplayName            string `json:"userDisplayName"`
 	UserPrincipalName          string `json:"userPrincipalName"`
 	ComplianceState            string `json:"complianceState"`
@@ -75,6 +303,7 @@ type graphDevice struct {
 	JailBroken                 string `json:"jailBroken"`
 	IsSupervised               bool   `json:"isSupervised"`
 	PartnerReportedThreatState string `json:"partnerReportedThreatState"`
+	EnrolledDateTime           string `json:"enrolledDateTime"`
 }
 
 // SyncDevices fetches a page of managed devices from Microsoft Graph.
@@ -83,10 +312,13 @@ func (p *Provider) SyncDevices(ctx context.Context, cursor string) ([]provider.S
 	endpoint := cursor
 	if endpoint == "" {
 		// First page: request key fields, ordered for consistency.
-		endpoint = "https://graph.microsoft.com/v1.0/deviceManagement/managedDevices?" +
-			"$select=id,deviceName,operatingSystem,osVersion,model,userDisplayName,userPrincipalName,complianceState,lastSyncDateTime,managementAgent,isEncrypted,jailBroken,isSupervised,partnerReportedThreatState&" +
-			"$top=200&" +
+		endpoint = p.graphURL + "/v1.0/deviceManagement/managedDevices?" +
+			"$select=id,deviceName,operatingSystem,osVersion,model,serialNumber,imei,meid,userDisplayName,userPrincipalName,complianceState,lastSyncDateTime,managementAgent,managedDeviceOwnerType,enrolledDateTime,isEncrypted,jailBroken,isSupervised,partnerReportedThreatState&" +
+			"$top=" + strconv.Itoa(p.pageSize) + "&" +
 			"$orderby=deviceName"
+		if f := strings.TrimSpace(p.config.DeviceFilter); f != "" {
+			endpoint += "&$filter=" + url.QueryEscape(f)
+		}
 	}
 
 	body, err := p.graphGet(ctx, endpoint)
@@ -102,26 +334,33 @@ func (p *Provider) SyncDevices(ctx context.Context, cursor string) ([]provider.S
 	devices := make([]provider.SyncDevice, 0, len(resp.Value))
 	for _, gd := range resp.Value {
 		d := provider.SyncDevice{
-			SourceID:     gd.ID,
-			DeviceName:   gd.DeviceName,
-			OS:           normalizeOS(gd.OperatingSystem),
-			OSVersion:    gd.OSVersion,
-			Model:        gd.Model,
-			UserName:     gd.UserDisplayName,
-			UserEmail:    gd.UserPrincipalName,
-			Compliance:   normalizeCompliance(gd.ComplianceState),
-			IsEncrypted:  gd.IsEncrypted,
-			JailBroken:   gd.JailBroken,
-			IsSupervised: gd.IsSupervised,
-			ThreatState:  gd.PartnerReportedThreatState,
+			SourceID:        gd.ID,
+			DeviceName:      gd.DeviceName,
+			OS:              normalizeOS(gd.OperatingSystem),
+			OSVersion:       gd.OSVersion,
+			Model:           gd.Model,
+			Serial:          gd.SerialNumber,
+			IMEI:            cmp.Or(gd.IMEI, gd.MEID),
+			UserName:        gd.UserDisplayName,
+			UserEmail:       gd.UserPrincipalName,
+			Compliance:      normalizeCompliance(gd.ComplianceState),
+			IsEncrypted:     gd.IsEncrypted,
+			JailBroken:      gd.JailBroken,
+			IsSupervised:    gd.IsSupervised,
+			ThreatState:     gd.PartnerReportedThreatState,
+			Ownership:       normalizeOwnership(gd.ManagedDeviceOwnerType),
+			ManagementAgent: gd.ManagementAgent,
 		}
 		if t, err := time.Parse(time.RFC3339, gd.LastSyncDateTime); err == nil {
 			d.LastSeen = &t
 		}
+		if t, err := time.Parse(time.RFC3339, gd.EnrolledDateTime); err == nil {
+			d.EnrolledAt = &t
+		}
 		devices = append(devices, d)
 	}
 
-	log.Printf("[intune:%s] synced page: %d devices, has_next=%v", p.config.Name, len(devices), resp.NextLink != "")
+	p.logf(ctx, "synced page: %d devices, has_next=%v", len(devices), resp.NextLink != "")
 	return devices, resp.NextLink, nil
 }
 
@@ -137,7 +376,7 @@ func (p *Provider) SendCommand(ctx context.Context, sourceDeviceID string, cmd p
 	}
 
 	endpoint := fmt.Sprintf(
-		"https://graph.microsoft.com/v1.0/deviceManagement/managedDevices/%s/%s",
+		"%s/v1.0/deviceManagement/managedDevices/%s/%s", p.graphURL,
 		sourceDeviceID, action,
 	)
 
@@ -168,67 +407,114 @@ func (p *Provider) CheckCommandStatus(ctx context.Context, commandID string) (pr
 
 // ── HTTP helpers ────────────────────────────────────────────────────────
 
-func (p *Provider) graphGet(ctx context.Context, url string) ([]byte, error) {
-	token, err := p.tokens.Token()
-	if err != nil {
-		return nil, fmt.Errorf("auth: %w", err)
-	}
+// maxGraphRetries is how many times a throttled (429) or temporarily
+// unavailable (503/504) Graph request is retried before giving up.
+const maxGraphRetries = 3
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+func (p *Provider) graphGet(ctx context.Context, url string) ([]byte, error) {
+	body, status, err := p.graphDo(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Accept", "application/json")
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("graph API error (HTTP %d): %s", status, truncate(string(body), 500))
+	}
+	return body, nil
+}
 
-	resp, err := p.client.Do(req)
-	if err != nil {
-		return nil, err
+func (p *Provider) graphPost(ctx context.Context, url string, payload io.Reader) ([]byte, error) {
+	var data []byte
+	if payload != nil {
+		var err error
+		if data, err = io.ReadAll(payload); err != nil {
+			return nil, err
+		}
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	body, status, err := p.graphDo(ctx, "POST", url, data)
 	if err != nil {
 		return nil, err
 	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("graph API error (HTTP %d): %s", resp.StatusCode, truncate(string(body), 500))
+	// 200, 201, 204 are all valid success codes for Graph POST.
+	if status >= 300 {
+		return nil, fmt.Errorf("graph API error (HTTP %d): %s", status, truncate(string(body), 500))
 	}
-
 	return body, nil
 }
 
-func (p *Provider) graphPost(ctx context.Context, url string, payload io.Reader) ([]byte, error) {
-	token, err := p.tokens.Token()
-	if err != nil {
-		return nil, fmt.Errorf("auth: %w", err)
-	}
+// graphDo sends an authenticated Graph request and returns the response body
+// and status code. Retryable responses (see graphRetryable) are retried up
+// to maxGraphRetries times, honouring Retry-After when present.
+func (p *Provider) graphDo(ctx context.Context, method, url string, payload []byte) ([]byte, int, error) {
+	for attempt := 0; ; attempt++ {
+		token, err := p.tokens.Token(ctx)
+		if err != nil {
+			return nil, 0, fmt.Errorf("auth: %w", err)
+		}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, payload)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Content-Type", "application/json")
+		var reqBody io.Reader
+		if payload != nil {
+			reqBody = bytes.NewReader(payload)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+		if err != nil {
+			return nil, 0, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Accept", "application/json")
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
 
-	resp, err := p.client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+		resp, err := p.client.Do(req)
+		if err != nil {
+			metrics.ObserveGraphRequest(p.config.Name, 0)
+			return nil, 0, err
+		}
+		metrics.ObserveGraphRequest(p.config.Name, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, 0, err
+		}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+		if !graphRetryable(method, resp.StatusCode) || attempt >= maxGraphRetries {
+			return body, resp.StatusCode, nil
+		}
+
+		wait := retryDelay(resp.Header.Get("Retry-After"), attempt)
+		p.logf(ctx, "graph HTTP %d, retrying in %v (attempt %d/%d)", resp.StatusCode, wait, attempt+1, maxGraphRetries)
+		select {
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		case <-time.After(wait):
+		}
 	}
+}
 
-	// 200, 201, 204 are all valid success codes for Graph POST.
-	if resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("graph API error (HTTP %d): %s", resp.StatusCode, truncate(string(body), 500))
+// graphRetryable reports whether a request that got status may be sent
+// again. Throttling (429) means Graph refused the request, so any method
+// is retried. A 503 or 504 doesn't say whether the action happened, so only
+// reads are retried: re-sending a POST could wipe a device twice or create
+// an extra UTCM snapshot job.
+func graphRetryable(method string, status int) bool {
+	switch status {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return method == http.MethodGet
 	}
+	return false
+}
 
-	return body, nil
+// retryDelay returns how long to wait before retrying a throttled request:
+// the Retry-After seconds if given (capped at one minute), otherwise an
+// exponential backoff of 1s, 2s, 4s…
+func retryDelay(retryAfter string, attempt int) time.Duration {
+	if secs, err := strconv.Atoi(retryAfter); err == nil && secs >= 0 {
+		return min(time.Duration(secs)*time.Second, time.Minute)
+	}
+	return time.Second << attempt
 }
 
 // ── Normalisation ───────────────────────────────────────────────────────
@@ -259,6 +545,18 @@ func normalizeCompliance(state string) string {
 	}
 }
 
+// normalizeOwnership maps Graph's managedDeviceOwnerType to MOE's values.
+func normalizeOwnership(ownerType string) string {
+	switch ownerType {
+	case "company":
+		return "corporate"
+	case "personal":
+		return "personal"
+	default:
+		return "unknown"
+	}
+}
+
 func mapCommandAction(action string) string {
 	switch action {
 	case "reboot":
@@ -0,0 +1,223 @@
+package intune
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dan/moe/internal/provider"
+)
+
+func TestSyncDevicesPagination(t *testing.T) {
+	fg := newFakeGraph(t)
+	fg.handle("GET /v1.0/deviceManagement/managedDevices", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			writeJSON(w, http.StatusOK, map[string]any{
+				"value": []map[string]any{
+					{"id": "d3", "deviceName": "Gamma", "operatingSystem": "Windows", "complianceState": "unknown"},
+				},
+			})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"value": []map[string]any{
+				{"id": "d1", "deviceName": "Alpha", "operatingSystem": "iPadOS", "complianceState": "compliant", "managedDeviceOwnerType": "company",
+					"serialNumber": "DMPXK2ABCD12", "imei": "35 209900 176148 1", "meid": "35209900176148"},
+				{"id": "d2", "deviceName": "Beta", "operatingSystem": "Android", "complianceState": "noncompliant", "managedDeviceOwnerType": "personal",
+					"meid": "A0000012345678"},
+			},
+			"@odata.nextLink": fg.url("/v1.0/deviceManagement/managedDevices?page=2"),
+		})
+	})
+
+	p := fg.provider()
+	ctx := context.Background()
+
+	var names []string
+	cursor, pages := "", 0
+	for {
+		devices, next, err := p.SyncDevices(ctx, cursor)
+		if err != nil {
+			t.Fatalf("SyncDevices page %d: %v", pages+1, err)
+		}
+		pages++
+		for _, d := range devices {
+			names = append(names, d.DeviceName)
+		}
+		if pages == 1 {
+			if devices[0].OS != "iOS" || devices[0].Ownership != "corporate" {
+				t.Errorf("first device = %+v, want OS iOS and corporate ownership", devices[0])
+			}
+			if devices[1].Compliance != "non-compliant" || devices[1].Ownership != "personal" {
+				t.Errorf("second device = %+v, want non-compliant personal", devices[1])
+			}
+			if devices[0].Serial != "DMPXK2ABCD12" || devices[0].IMEI != "35 209900 176148 1" {
+				t.Errorf("first device serial, IMEI = %q, %q; want the Graph serialNumber and imei", devices[0].Serial, devices[0].IMEI)
+			}
+			if devices[1].IMEI != "A0000012345678" {
+				t.Errorf("second device IMEI = %q, want its MEID when Graph has no IMEI", devices[1].IMEI)
+			}
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	if pages != 2 {
+		t.Errorf("pages = %d, want 2", pages)
+	}
+	if len(names) != 3 || names[2] != "Gamma" {
+		t.Errorf("devices = %v, want [Alpha Beta Gamma]", names)
+	}
+}
+
+func TestSyncDevicesPageSize(t *testing.T) {
+	fg := newFakeGraph(t)
+	var top string
+	fg.handle("GET /v1.0/deviceManagement/managedDevices", func(w http.ResponseWriter, r *http.Request) {
+		top = r.URL.Query().Get("$top")
+		writeJSON(w, http.StatusOK, map[string]any{"value": []map[string]any{}})
+	})
+
+	for _, tt := range []struct {
+		size int
+		want string
+	}{
+		{0, "200"},
+		{50, "50"},
+		{5000, "1000"},
+	} {
+		p := fg.provider()
+		p.pageSize = New(Config{PageSize: tt.size}).pageSize
+		if _, _, err := p.SyncDevices(context.Background(), ""); err != nil {
+			t.Fatal(err)
+		}
+		if top != tt.want {
+			t.Errorf("PageSize %d: $top = %s, want %s", tt.size, top, tt.want)
+		}
+	}
+}
+
+func TestSyncDevicesFilter(t *testing.T) {
+	fg := newFakeGraph(t)
+	var filter string
+	fg.handle("GET /v1.0/deviceManagement/managedDevices", func(w http.ResponseWriter, r *http.Request) {
+		filter = r.URL.Query().Get("$filter")
+		writeJSON(w, http.StatusOK, map[string]any{"value": []map[string]any{}})
+	})
+
+	p := fg.provider()
+	p.config.DeviceFilter = "operatingSystem eq 'Windows' and deviceName ne 'A&B'"
+	if _, _, err := p.SyncDevices(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if filter != p.config.DeviceFilter {
+		t.Errorf("$filter = %q, want %q", filter, p.config.DeviceFilter)
+	}
+}
+
+func TestValidateDeviceFilter(t *testing.T) {
+	for filter, ok := range map[string]bool{
+		"":                             true,
+		"operatingSystem eq 'Windows'": true,
+		"(operatingSystem eq 'iOS') or (operatingSystem eq 'iPadOS')": true,
+		"deviceName eq 'O''Brien (2)'":                                true,
+		"operatingSystem eq 'Windows":                                 false,
+		"(operatingSystem eq 'Windows'":                               false,
+		"operatingSystem eq 'Windows')":                               false,
+		"operatingSystem eq\n'Windows'":                               false,
+	} {
+		if err := ValidateDeviceFilter(filter); (err == nil) != ok {
+			t.Errorf("ValidateDeviceFilter(%q) = %v, want ok %v", filter, err, ok)
+		}
+	}
+}
+
+func TestGraphGetRetriesOn429(t *testing.T) {
+	fg := newFakeGraph(t)
+	attempts := 0
+	fg.handle("GET /v1.0/deviceManagement/managedDevices", func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts <= 2 {
+			w.Header().Set("Retry-After", "0")
+			writeJSON(w, http.StatusTooManyRequests, map[string]any{"error": map[string]any{"code": "TooManyRequests"}})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"value": []map[string]any{{"id": "d1", "deviceName": "Alpha"}},
+		})
+	})
+
+	devices, _, err := fg.provider().SyncDevices(context.Background(), "")
+	if err != nil {
+		t.Fatalf("SyncDevices: %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("attempts = %d, want 3 (two throttled, one success)", attempts)
+	}
+	if len(devices) != 1 {
+		t.Errorf("devices = %d, want 1", len(devices))
+	}
+}
+
+func TestGraphGetGivesUpAfterMaxRetries(t *testing.T) {
+	fg := newFakeGraph(t)
+	fg.handle("GET /v1.0/deviceManagement/managedDevices", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		writeJSON(w, http.StatusTooManyRequests, map[string]any{})
+	})
+
+	_, _, err := fg.provider().SyncDevices(context.Background(), "")
+	if err == nil {
+		t.Fatal("SyncDevices succeeded, want error after exhausting retries")
+	}
+	if got := fg.count("GET /v1.0/deviceManagement/managedDevices"); got != maxGraphRetries+1 {
+		t.Errorf("requests = %d, want %d", got, maxGraphRetries+1)
+	}
+}
+
+func TestGraphPostNotRetriedOnGatewayTimeout(t *testing.T) {
+	fg := newFakeGraph(t)
+	fg.handle("POST /v1.0/deviceManagement/managedDevices/d1/wipe", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		writeJSON(w, http.StatusGatewayTimeout, map[string]any{})
+	})
+
+	if _, err := fg.provider().SendCommand(context.Background(), "d1", provider.Command{Action: "wipe"}); err == nil {
+		t.Fatal("SendCommand succeeded, want the 504 reported")
+	}
+	if got := fg.count("POST /v1.0/deviceManagement/managedDevices/d1/wipe"); got != 1 {
+		t.Errorf("requests = %d, want 1: a wipe that may have happened must not be re-sent", got)
+	}
+}
+
+func TestNewResolvesCloudEndpoints(t *testing.T) {
+	p := New(Config{Name: "gov", TenantID: "t", Cloud: "usgov"})
+	if p.graphURL != "https://graph.microsoft.us" {
+		t.Errorf("graphURL = %q, want the US Government Graph endpoint", p.graphURL)
+	}
+	if p.tokens.loginURL != "https://login.microsoftonline.us" || p.tokens.scope != "https://graph.microsoft.us/.default" {
+		t.Errorf("token cache = %q scope %q, want US Government login and scope", p.tokens.loginURL, p.tokens.scope)
+	}
+
+	// Explicit URLs win over the cloud preset.
+	p = New(Config{Name: "x", Cloud: "china", GraphURL: "http://127.0.0.1:9/"})
+	if p.graphURL != "http://127.0.0.1:9" {
+		t.Errorf("graphURL = %q, want the explicit override without trailing slash", p.graphURL)
+	}
+}
+
+func TestNewClientTimeout(t *testing.T) {
+	if got := New(Config{Name: "x"}).client.Timeout; got != DefaultTimeout {
+		t.Errorf("default client timeout = %v, want %v", got, DefaultTimeout)
+	}
+	p := New(Config{Name: "x", Timeout: 2 * time.Minute})
+	if p.client.Timeout != 2*time.Minute {
+		t.Errorf("client timeout = %v, want the configured 2m", p.client.Timeout)
+	}
+	if tr, ok := p.client.Transport.(*http.Transport); !ok || tr.MaxIdleConnsPerHost != maxIdleConnsPerHost {
+		t.Errorf("transport = %#v, want a pooled transport keeping %d idle connections per host", p.client.Transport, maxIdleConnsPerHost)
+	}
+}
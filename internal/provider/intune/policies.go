@@ -4,9 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/dan/moe/internal/provider"
 )
@@ -18,43 +19,45 @@ type policyEndpoint struct {
 	FullPath string // If set, used as-is instead of deviceManagement/{Path}
 	Beta     bool   // If true, use the beta endpoint instead of v1.0
 	Settings bool   // If true, fetch /settings sub-resource per item (Settings Catalog)
+	// Assignments, if true, fetches the /assignments sub-resource per item.
+	Assignments bool
 }
 
 // policyEndpoints is the list of Intune policy collection endpoints.
 // Discovered via Graph $metadata NavigationProperty inspection on deviceManagement.
 var policyEndpoints = []policyEndpoint{
 	// ── Compliance ──
-	{Category: "Compliance Policies", Path: "deviceCompliancePolicies"},
-	{Category: "Compliance Policies (Settings Catalog)", Path: "compliancePolicies", Beta: true, Settings: true},
-	{Category: "Compliance Scripts", Path: "deviceComplianceScripts", Beta: true},
+	{Category: "Compliance Policies", Path: "deviceCompliancePolicies", Assignments: true},
+	{Category: "Compliance Policies (Settings Catalog)", Path: "compliancePolicies", Beta: true, Settings: true, Assignments: true},
+	{Category: "Compliance Scripts", Path: "deviceComplianceScripts", Beta: true, Assignments: true},
 
 	// ── Configuration ──
-	{Category: "Configuration Profiles", Path: "deviceConfigurations"},
-	{Category: "Settings Catalog", Path: "configurationPolicies", Beta: true, Settings: true},
-	{Category: "Group Policy (Admin Templates)", Path: "groupPolicyConfigurations", Beta: true},
+	{Category: "Configuration Profiles", Path: "deviceConfigurations", Assignments: true},
+	{Category: "Settings Catalog", Path: "configurationPolicies", Beta: true, Settings: true, Assignments: true},
+	{Category: "Group Policy (Admin Templates)", Path: "groupPolicyConfigurations", Beta: true, Assignments: true},
 
 	// ── Endpoint Security ──
-	{Category: "Endpoint Security", Path: "intents", Beta: true},
+	{Category: "Endpoint Security", Path: "intents", Beta: true, Assignments: true},
 	{Category: "Security Baselines", Path: "templates", Beta: true},
 
 	// ── App Protection ──
 	{Category: "App Protection", FullPath: "deviceAppManagement/managedAppPolicies", Beta: true},
 
 	// ── Scripts ──
-	{Category: "PowerShell Scripts", Path: "deviceManagementScripts", Beta: true},
-	{Category: "Shell Scripts (macOS)", Path: "deviceShellScripts", Beta: true},
-	{Category: "Health Scripts (Remediations)", Path: "deviceHealthScripts", Beta: true},
-	{Category: "Custom Attribute Scripts", Path: "deviceCustomAttributeShellScripts", Beta: true},
+	{Category: "PowerShell Scripts", Path: "deviceManagementScripts", Beta: true, Assignments: true},
+	{Category: "Shell Scripts (macOS)", Path: "deviceShellScripts", Beta: true, Assignments: true},
+	{Category: "Health Scripts (Remediations)", Path: "deviceHealthScripts", Beta: true, Assignments: true},
+	{Category: "Custom Attribute Scripts", Path: "deviceCustomAttributeShellScripts", Beta: true, Assignments: true},
 
 	// ── Enrollment ──
-	{Category: "Enrollment Configurations", Path: "deviceEnrollmentConfigurations"},
-	{Category: "Autopilot Profiles", Path: "windowsAutopilotDeploymentProfiles", Beta: true},
+	{Category: "Enrollment Configurations", Path: "deviceEnrollmentConfigurations", Assignments: true},
+	{Category: "Autopilot Profiles", Path: "windowsAutopilotDeploymentProfiles", Beta: true, Assignments: true},
 
 	// ── Updates ──
-	{Category: "Windows Update Policies", Path: "windowsQualityUpdatePolicies", Beta: true},
+	{Category: "Windows Update Policies", Path: "windowsQualityUpdatePolicies", Beta: true, Assignments: true},
 
 	// ── Hardware ──
-	{Category: "Hardware Configurations", Path: "hardwareConfigurations", Beta: true},
+	{Category: "Hardware Configurations", Path: "hardwareConfigurations", Beta: true, Assignments: true},
 
 	// ── Reusable ──
 	{Category: "Reusable Policy Settings", Path: "reusablePolicySettings", Beta: true},
@@ -64,52 +67,117 @@ var policyEndpoints = []policyEndpoint{
 // UTCM (Unified Tenant Configuration Management) APIs for a comprehensive
 // snapshot, and falls back to the legacy per-endpoint approach if UTCM is
 // unavailable (missing permissions, service principal not configured, etc.).
-func (p *Provider) SyncPolicies(ctx context.Context, progress func(category string, count int)) ([]provider.SyncPolicy, error) {
+//
+// opts.Categories narrows both paths to the matching UTCM resource types and
+// legacy endpoints; see provider.PolicySyncOptions.IncludesCategory.
+func (p *Provider) SyncPolicies(ctx context.Context, opts provider.PolicySyncOptions, progress func(category string, count int)) ([]provider.SyncPolicy, provider.PolicyProvenance, error) {
 	// Try UTCM first — broader coverage, single async operation
-	policies, err := p.SyncPoliciesUTCM(ctx, progress)
+	policies, prov, err := p.SyncPoliciesUTCM(ctx, opts, progress)
 	if err == nil && len(policies) > 0 {
-		return policies, nil
+		return policies, prov, nil
 	}
 	if err != nil {
-		log.Printf("[intune:%s] UTCM snapshot failed, falling back to legacy endpoints: %v", p.config.Name, err)
+		p.logf(ctx, "UTCM snapshot failed, falling back to legacy endpoints: %v", err)
 		if progress != nil {
 			progress("UTCM unavailable — using legacy sync", 0)
 		}
 	}
 
 	// Fall back to legacy per-endpoint approach
-	return p.syncPoliciesLegacy(ctx, progress)
+	return p.syncPoliciesLegacy(ctx, opts, progress)
 }
 
-// syncPoliciesLegacy is the original per-endpoint approach: iterates through
-// known Intune/Graph policy endpoints, fetches all items with pagination, and
-// returns them as a flat slice of SyncPolicy.
-func (p *Provider) syncPoliciesLegacy(ctx context.Context, progress func(category string, count int)) ([]provider.SyncPolicy, error) {
+// defaultPolicyConcurrency is how many Graph requests a legacy policy sync
+// has in flight when Config.PolicyConcurrency is unset. Higher values are
+// faster on large tenants but more likely to be throttled.
+const defaultPolicyConcurrency = 5
+
+// syncPoliciesLegacy is the original per-endpoint approach: fetches every
+// known Intune/Graph policy endpoint with pagination and returns the items
+// as a flat slice of SyncPolicy. Each endpoint is one category in the
+// returned coverage; endpoints outside opts.Categories are skipped and left
+// out of it.
+//
+// Endpoints and their per-policy sub-resources are fetched in parallel, with
+// at most p.policyConcurrency requests in flight. Results are assembled in
+// policyEndpoints order, so the output doesn't depend on timing.
+func (p *Provider) syncPoliciesLegacy(ctx context.Context, opts provider.PolicySyncOptions, progress func(category string, count int)) ([]provider.SyncPolicy, provider.PolicyProvenance, error) {
+	var endpoints []policyEndpoint
+	for _, ep := range policyEndpoints {
+		if opts.IncludesCategory(ep.Category) {
+			endpoints = append(endpoints, ep)
+		}
+	}
+
+	type endpointResult struct {
+		items []provider.SyncPolicy
+		err   error
+	}
+	results := make([]endpointResult, len(endpoints))
+	sem := make(chan struct{}, p.policyConcurrency)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex // serialises progress so counts only grow
+		fetched int
+	)
+	for i, ep := range endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			items, err := p.fetchPolicyEndpoint(ctx, ep, sem)
+			results[i] = endpointResult{items, err}
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			fetched += len(items)
+			if progress != nil {
+				progress(ep.Category, fetched)
+			}
+		}()
+	}
+	wg.Wait()
+
 	var all []provider.SyncPolicy
+	prov := provider.PolicyProvenance{CaptureMethod: provider.CaptureMethodLegacy}
+	if err := ctx.Err(); err != nil {
+		return nil, prov, err
+	}
 
-	for _, ep := range policyEndpoints {
-		items, err := p.fetchPolicyEndpoint(ctx, ep)
+	for i, ep := range endpoints {
+		items, err := results[i].items, results[i].err
 		if err != nil {
 			// Log and continue — some endpoints may not be licensed or accessible
-			log.Printf("[intune:%s] warning: could not fetch %s: %v", p.config.Name, ep.Path, err)
+			p.logf(ctx, "warning: could not fetch %s: %v", ep.Path, err)
+			prov.Coverage = append(prov.Coverage, provider.CategoryCoverage{Category: ep.Category, Error: err.Error()})
 			continue
 		}
 
 		all = append(all, items...)
+		prov.Coverage = append(prov.Coverage, provider.CategoryCoverage{Category: ep.Category, Count: len(items)})
+		p.logf(ctx, "fetched %s: %d items", ep.Category, len(items))
+	}
+	p.resolveScopeTags(ctx, all)
 
-		if progress != nil {
-			progress(ep.Category, len(all))
-		}
+	return all, prov, nil
+}
 
-		log.Printf("[intune:%s] fetched %s: %d items", p.config.Name, ep.Category, len(items))
+// acquire takes a slot in sem, giving up if ctx is cancelled first.
+func acquire(ctx context.Context, sem chan struct{}) error {
+	select {
+	case sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-
-	return all, nil
 }
 
 // fetchPolicyEndpoint fetches all items from a single Graph policy collection,
-// following @odata.nextLink for pagination.
-func (p *Provider) fetchPolicyEndpoint(ctx context.Context, ep policyEndpoint) ([]provider.SyncPolicy, error) {
+// following @odata.nextLink for pagination, then fetches each item's
+// sub-resources in parallel. Every Graph request holds a slot in sem.
+func (p *Provider) fetchPolicyEndpoint(ctx context.Context, ep policyEndpoint, sem chan struct{}) ([]provider.SyncPolicy, error) {
 	apiVersion := "v1.0"
 	if ep.Beta {
 		apiVersion = "beta"
@@ -118,15 +186,19 @@ func (p *Provider) fetchPolicyEndpoint(ctx context.Context, ep policyEndpoint) (
 	// Build the collection URL
 	var url string
 	if ep.FullPath != "" {
-		url = fmt.Sprintf("https://graph.microsoft.com/%s/%s", apiVersion, ep.FullPath)
+		url = fmt.Sprintf("%s/%s/%s", p.graphURL, apiVersion, ep.FullPath)
 	} else {
-		url = fmt.Sprintf("https://graph.microsoft.com/%s/deviceManagement/%s", apiVersion, ep.Path)
+		url = fmt.Sprintf("%s/%s/deviceManagement/%s", p.graphURL, apiVersion, ep.Path)
 	}
 
 	var policies []provider.SyncPolicy
 
 	for url != "" {
+		if err := acquire(ctx, sem); err != nil {
+			return policies, err
+		}
 		body, err := p.graphGet(ctx, url)
+		<-sem
 		if err != nil {
 			return policies, fmt.Errorf("fetch %s: %w", ep.Path, err)
 		}
@@ -139,66 +211,98 @@ func (p *Provider) fetchPolicyEndpoint(ctx context.Context, ep policyEndpoint) (
 		for _, raw := range resp.Value {
 			sp, err := parsePolicyItem(raw, ep.Category)
 			if err != nil {
-				log.Printf("[intune] warning: skipping item in %s: %v", ep.Path, err)
+				p.logf(ctx, "warning: skipping item in %s: %v", ep.Path, err)
 				continue
 			}
-
-			// For Settings Catalog policies, fetch the /settings sub-resource
-			// which contains the actual configuration values.
-			if ep.Settings && sp.SourceID != "" {
-				settings, err := p.fetchPolicySettings(ctx, apiVersion, ep, sp.SourceID)
-				if err != nil {
-					log.Printf("[intune] warning: could not fetch settings for %s/%s: %v", ep.Path, sp.SourceID, err)
-				} else if settings != "" {
-					sp.SettingsJSON = mergeSettingsJSON(sp.SettingsJSON, settings)
-				}
-			}
-
 			policies = append(policies, sp)
 		}
 
 		url = resp.NextLink
 	}
 
+	var wg sync.WaitGroup
+	for i := range policies {
+		if err := acquire(ctx, sem); err != nil {
+			wg.Wait()
+			return policies, err
+		}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			p.enrichPolicy(ctx, &policies[i], apiVersion, ep)
+		}()
+	}
+	wg.Wait()
+
 	return policies, nil
 }
 
+// enrichPolicy fetches a policy's sub-resources: Settings Catalog settings,
+// assignments, and the names of groups its settings reference.
+func (p *Provider) enrichPolicy(ctx context.Context, sp *provider.SyncPolicy, apiVersion string, ep policyEndpoint) {
+	// For Settings Catalog policies, fetch the /settings sub-resource
+	// which contains the actual configuration values.
+	if ep.Settings && sp.SourceID != "" {
+		settings, err := p.fetchPolicySettings(ctx, apiVersion, ep, sp.SourceID)
+		if err != nil {
+			p.logf(ctx, "warning: could not fetch settings for %s/%s: %v", ep.Path, sp.SourceID, err)
+			sp.SettingsError = truncate(err.Error(), 500)
+		} else if settings != "" {
+			sp.SettingsJSON = mergeSettingsJSON(sp.SettingsJSON, settings)
+		}
+	}
+	if ep.Assignments && sp.SourceID != "" {
+		p.attachAssignments(ctx, sp, apiVersion, ep)
+	}
+	p.attachGroupNames(ctx, sp)
+}
+
 // fetchPolicySettings fetches the /settings sub-resource for a Settings Catalog
 // or Compliance v2 policy, which contains the actual configured values.
 func (p *Provider) fetchPolicySettings(ctx context.Context, apiVersion string, ep policyEndpoint, policyID string) (string, error) {
-	var base string
-	if ep.FullPath != "" {
-		base = fmt.Sprintf("https://graph.microsoft.com/%s/%s/%s/settings", apiVersion, ep.FullPath, policyID)
-	} else {
-		base = fmt.Sprintf("https://graph.microsoft.com/%s/deviceManagement/%s/%s/settings", apiVersion, ep.Path, policyID)
+	allSettings, err := p.graphGetAll(ctx, p.policyItemURL(apiVersion, ep, policyID)+"/settings")
+	if err != nil {
+		return "", err
 	}
 
-	var allSettings []json.RawMessage
-	url := base
+	if len(allSettings) == 0 {
+		return "", nil
+	}
 
+	b, err := json.Marshal(allSettings)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// policyItemURL returns the Graph URL of one policy in an endpoint's
+// collection; sub-resources are appended to it.
+func (p *Provider) policyItemURL(apiVersion string, ep policyEndpoint, policyID string) string {
+	if ep.FullPath != "" {
+		return fmt.Sprintf("%s/%s/%s/%s", p.graphURL, apiVersion, ep.FullPath, policyID)
+	}
+	return fmt.Sprintf("%s/%s/deviceManagement/%s/%s", p.graphURL, apiVersion, ep.Path, policyID)
+}
+
+// graphGetAll fetches every item of a Graph collection, following
+// @odata.nextLink for pagination.
+func (p *Provider) graphGetAll(ctx context.Context, url string) ([]json.RawMessage, error) {
+	var all []json.RawMessage
 	for url != "" {
 		body, err := p.graphGet(ctx, url)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
 		var resp graphCollectionResponse
 		if err := json.Unmarshal(body, &resp); err != nil {
-			return "", err
+			return nil, err
 		}
-		allSettings = append(allSettings, resp.Value...)
+		all = append(all, resp.Value...)
 		url = resp.NextLink
 	}
-
-	if len(allSettings) == 0 {
-		return "", nil
-	}
-
-	b, err := json.Marshal(allSettings)
-	if err != nil {
-		return "", err
-	}
-	return string(b), nil
+	return all, nil
 }
 
 // mergeSettingsJSON adds a "_settings" key into the existing settings JSON
@@ -242,6 +346,8 @@ func parsePolicyItem(raw json.RawMessage, category string) (provider.SyncPolicy,
 		Name         string `json:"name"`
 		Platforms    string `json:"platforms"`    // Settings Catalog: "windows10", "iOS", etc.
 		PlatformType string `json:"platformType"` // Security Baselines/templates: "android", "iOS", etc.
+
+		RoleScopeTagIDs []string `json:"roleScopeTagIds"`
 	}
 	if err := json.Unmarshal(raw, &common); err != nil {
 		return provider.SyncPolicy{}, err
@@ -278,6 +384,7 @@ func parsePolicyItem(raw json.RawMessage, category string) (provider.SyncPolicy,
 		Platform:     platform,
 		Description:  common.Description,
 		SettingsJSON: settingsJSON,
+		ScopeTags:    common.RoleScopeTagIDs,
 	}, nil
 }
 
@@ -290,23 +397,9 @@ func buildSettingsJSON(raw json.RawMessage) string {
 		return string(raw)
 	}
 
-	// Remove OData metadata and non-setting fields
-	skipPrefixes := []string{"@odata", "@microsoft"}
-	skipKeys := map[string]bool{
-		"id": true, "createdDateTime": true, "lastModifiedDateTime": true,
-		"version": true, "roleScopeTagIds": true, "creationSource": true,
-	}
-
 	clean := make(map[string]any)
 	for k, v := range m {
-		skip := false
-		for _, prefix := range skipPrefixes {
-			if strings.HasPrefix(k, prefix) {
-				skip = true
-				break
-			}
-		}
-		if skip || skipKeys[k] {
+		if isGraphMetaKey(k) {
 			continue
 		}
 		clean[k] = v
@@ -319,6 +412,20 @@ func buildSettingsJSON(raw json.RawMessage) string {
 	return string(b)
 }
 
+// graphMetaKeys are top-level Graph properties that describe the object
+// rather than its settings. UTCM settings are filtered with the same list
+// (see normalizeUTCMSettings) so both capture methods compare alike.
+var graphMetaKeys = map[string]bool{
+	"id": true, "createdDateTime": true, "lastModifiedDateTime": true,
+	"version": true, "roleScopeTagIds": true, "creationSource": true,
+}
+
+// isGraphMetaKey reports whether a top-level key is OData metadata or one
+// of graphMetaKeys.
+func isGraphMetaKey(k string) bool {
+	return strings.HasPrefix(k, "@odata") || strings.HasPrefix(k, "@microsoft") || graphMetaKeys[k]
+}
+
 // guessPlatformFromField maps the explicit "platforms" enum field from
 // Settings Catalog / Compliance v2 policies to a display name.
 func guessPlatformFromField(platforms string) string {
@@ -370,29 +477,71 @@ func cleanODataType(t string) string {
 
 // ── Settings flattening for display ─────────────────────────────────────
 
+// DefaultFlattenDepth is how many levels below the top-level keys
+// FlattenSettings expands.
+const DefaultFlattenDepth = 4
+
 // FlattenSettings takes a settings_json string and returns flattened key/value
-// pairs suitable for display. Nested objects are rendered as JSON strings.
+// pairs suitable for display, expanding DefaultFlattenDepth levels.
 func FlattenSettings(settingsJSON string) []provider.SyncPolicySetting {
+	return FlattenSettingsDepth(settingsJSON, DefaultFlattenDepth)
+}
+
+// FlattenSettingsDepth flattens a settings_json string into key/value pairs
+// with dotted key paths: nested objects and arrays are expanded into
+// "parent.child" and "parent.0" entries up to depth levels below the
+// top-level keys, and anything nested deeper is rendered as JSON. A depth
+// of zero keeps one entry per top-level key. Empty objects and arrays stay
+// as "{}" and "[]" rather than vanishing. Top-level keys are sorted, object
+// keys sorted within their parent, and array entries kept in order, so
+// "list.2" comes before "list.10".
+func FlattenSettingsDepth(settingsJSON string, depth int) []provider.SyncPolicySetting {
 	var m map[string]any
 	if err := json.Unmarshal([]byte(settingsJSON), &m); err != nil {
 		return nil
 	}
 
 	var settings []provider.SyncPolicySetting
-	for k, v := range m {
-		settings = append(settings, provider.SyncPolicySetting{
-			Name:  k,
-			Value: formatValue(v),
-		})
+	for _, k := range sortedKeys(m) {
+		settings = flattenValue(settings, k, m[k], depth)
 	}
-
-	// Sort by key name for stable display
-	sort.Slice(settings, func(i, j int) bool {
-		return settings[i].Name < settings[j].Name
-	})
 	return settings
 }
 
+// flattenValue appends the entries for v, named key, to settings,
+// expanding up to depth more levels.
+func flattenValue(settings []provider.SyncPolicySetting, key string, v any, depth int) []provider.SyncPolicySetting {
+	if depth > 0 {
+		switch val := v.(type) {
+		case map[string]any:
+			if len(val) > 0 {
+				for _, k := range sortedKeys(val) {
+					settings = flattenValue(settings, key+"."+k, val[k], depth-1)
+				}
+				return settings
+			}
+		case []any:
+			if len(val) > 0 {
+				for i, inner := range val {
+					settings = flattenValue(settings, key+"."+strconv.Itoa(i), inner, depth-1)
+				}
+				return settings
+			}
+		}
+	}
+	return append(settings, provider.SyncPolicySetting{Name: key, Value: formatValue(v)})
+}
+
+// sortedKeys returns m's keys in order.
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // formatValue converts a value to a display string.
 func formatValue(v any) string {
 	switch val := v.(type) {
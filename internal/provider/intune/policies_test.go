@@ -0,0 +1,515 @@
+package intune
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dan/moe/internal/provider"
+)
+
+func TestSyncPoliciesUTCMPartialSuccess(t *testing.T) {
+	fg := newFakeGraph(t)
+	polls := 0
+
+	fg.handle("POST "+utcmPath+"/configurationSnapshots/createSnapshot", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusCreated, map[string]any{"id": "job-1", "status": "notStarted"})
+	})
+	fg.handle("GET "+utcmPath+"/configurationSnapshotJobs/job-1", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		if polls < 2 {
+			writeJSON(w, http.StatusOK, map[string]any{"id": "job-1", "status": "running"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"id":               "job-1",
+			"status":           "partiallySuccessful",
+			"resourceLocation": fg.url("/snapshots/job-1/content"),
+			"errorDetails":     []string{"microsoft.intune.deviceConfigurationPolicyiOS: access denied"},
+		})
+	})
+	fg.handle("DELETE "+utcmPath+"/configurationSnapshotJobs/job-1", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	fg.handle("GET /snapshots/job-1/content", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"resources": []map[string]any{
+				{
+					"resourceType": "microsoft.intune.deviceCompliancePolicyWindows10",
+					"instances": []map[string]any{
+						{"DisplayName": "Win10 Baseline", "Id": "p1", "PasswordRequired": true},
+					},
+				},
+			},
+		})
+	})
+
+	policies, prov, err := fg.provider().SyncPolicies(context.Background(), provider.PolicySyncOptions{}, nil)
+	if err != nil {
+		t.Fatalf("SyncPolicies: %v", err)
+	}
+	if len(policies) != 1 {
+		t.Fatalf("policies = %d, want 1", len(policies))
+	}
+	if policies[0].PolicyName != "Win10 Baseline" || policies[0].Platform != "Windows" {
+		t.Errorf("policy = %+v, want Win10 Baseline on Windows", policies[0])
+	}
+	if prov.CaptureMethod != provider.CaptureMethodUTCM {
+		t.Errorf("CaptureMethod = %q, want %q", prov.CaptureMethod, provider.CaptureMethodUTCM)
+	}
+	var compliance, config provider.CategoryCoverage
+	for _, c := range prov.Coverage {
+		switch c.Category {
+		case "Compliance":
+			compliance = c
+		case "Configuration Profiles":
+			config = c
+		}
+	}
+	if compliance.Count != 1 || compliance.Error != "" {
+		t.Errorf("Compliance coverage = %+v, want 1 policy and no error", compliance)
+	}
+	if config.Count != 0 || !strings.Contains(config.Error, "access denied") {
+		t.Errorf("Configuration Profiles coverage = %+v, want the iOS access-denied error", config)
+	}
+	if want := []string{"deviceConfigurationPolicyiOS: access denied"}; !reflect.DeepEqual(prov.FailedResources, want) {
+		t.Errorf("FailedResources = %q, want %q", prov.FailedResources, want)
+	}
+	if polls < 2 {
+		t.Errorf("polls = %d, want at least 2", polls)
+	}
+	if n := fg.count("GET /v1.0/deviceManagement/deviceCompliancePolicies"); n != 0 {
+		t.Errorf("legacy endpoint called %d times, want 0 when UTCM succeeds", n)
+	}
+}
+
+func TestUTCMCreateSnapshotPrunesOldJobs(t *testing.T) {
+	fg := newFakeGraph(t)
+	now := time.Now().UTC()
+
+	// A full quota: eight finished jobs, one abandoned mid-run, one another
+	// capture has just started, one from another MOE provider on the same
+	// tenant, and one created by another tool.
+	var jobs []map[string]any
+	for i := range 8 {
+		jobs = append(jobs, map[string]any{
+			"id":              fmt.Sprintf("moe-%d", i),
+			"displayName":     fmt.Sprintf("MOE intune test %d", i),
+			"status":          "succeeded",
+			"createdDateTime": now.Add(-time.Duration(10-i) * time.Hour),
+		})
+	}
+	jobs = append(jobs,
+		map[string]any{"id": "moe-abandoned", "displayName": "MOE intune test 98", "status": "running", "createdDateTime": now.Add(-48 * time.Hour)},
+		map[string]any{"id": "moe-running", "displayName": "MOE intune test 99", "status": "running", "createdDateTime": now.Add(-time.Minute)},
+		map[string]any{"id": "other", "displayName": "Nightly export", "status": "failed", "createdDateTime": now.Add(-72 * time.Hour)},
+		map[string]any{"id": "other-moe", "displayName": "MOE intune test2 1", "status": "succeeded", "createdDateTime": now.Add(-96 * time.Hour)},
+	)
+
+	fg.handle("GET "+utcmPath+"/configurationSnapshotJobs", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"value": jobs})
+	})
+	var deleted []string
+	fg.handle("DELETE "+utcmPath+"/configurationSnapshotJobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		deleted = append(deleted, r.PathValue("id"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	fg.handle("POST "+utcmPath+"/configurationSnapshots/createSnapshot", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusCreated, map[string]any{"id": "job-new", "status": "notStarted"})
+	})
+
+	if _, err := fg.provider().utcmCreateSnapshot(context.Background(), "MOE intune test 100", nil); err != nil {
+		t.Fatalf("utcmCreateSnapshot: %v", err)
+	}
+	if want := []string{"moe-abandoned", "moe-0"}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("deleted = %v, want the two oldest prunable MOE jobs %v", deleted, want)
+	}
+}
+
+func TestUTCMPrunableJobs(t *testing.T) {
+	now := time.Now()
+	jobs := []utcmSnapshotJob{
+		{ID: "old", DisplayName: "MOE t1 1", Status: "succeeded", CreatedDateTime: now.Add(-time.Hour)},
+		{ID: "fresh", DisplayName: "MOE t1 2", Status: "succeeded", CreatedDateTime: now.Add(-time.Minute)},
+		{ID: "running", DisplayName: "MOE t1 3", Status: "running", CreatedDateTime: now.Add(-time.Minute)},
+		{ID: "abandoned", DisplayName: "MOE t1 4", Status: "running", CreatedDateTime: now.Add(-2 * time.Hour)},
+		{ID: "other", DisplayName: "MOE t10 1", Status: "failed", CreatedDateTime: now.Add(-3 * time.Hour)},
+	}
+	var got []string
+	for _, job := range utcmPrunableJobs(jobs, "MOE t1 ", now) {
+		got = append(got, job.ID)
+	}
+	if want := []string{"abandoned", "old"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("prunable = %v, want %v", got, want)
+	}
+}
+
+func TestSyncPoliciesFallsBackToLegacy(t *testing.T) {
+	fg := newFakeGraph(t)
+
+	// UTCM not provisioned in the tenant.
+	fg.handle("POST "+utcmPath+"/configurationSnapshots/createSnapshot", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusForbidden, map[string]any{"error": map[string]any{"code": "Authorization_RequestDenied"}})
+	})
+	fg.handle("GET /v1.0/deviceManagement/deviceCompliancePolicies", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"value": []map[string]any{
+				{
+					"@odata.type":      "#microsoft.graph.iosCompliancePolicy",
+					"id":               "c1",
+					"displayName":      "iOS Compliance",
+					"passcodeRequired": true,
+				},
+			},
+		})
+	})
+	// Every other legacy endpoint is unregistered and returns 404, which
+	// syncPoliciesLegacy logs and skips.
+
+	var categories []string
+	policies, prov, err := fg.provider().SyncPolicies(context.Background(), provider.PolicySyncOptions{}, func(category string, count int) {
+		categories = append(categories, category)
+	})
+	if err != nil {
+		t.Fatalf("SyncPolicies: %v", err)
+	}
+	if len(policies) != 1 || policies[0].PolicyName != "iOS Compliance" {
+		t.Fatalf("policies = %+v, want the single legacy compliance policy", policies)
+	}
+	if policies[0].Category != "Compliance Policies" {
+		t.Errorf("category = %q, want %q", policies[0].Category, "Compliance Policies")
+	}
+	if prov.CaptureMethod != provider.CaptureMethodLegacy {
+		t.Errorf("CaptureMethod = %q, want %q", prov.CaptureMethod, provider.CaptureMethodLegacy)
+	}
+	if len(prov.Coverage) != len(policyEndpoints) {
+		t.Errorf("coverage has %d categories, want one per endpoint (%d)", len(prov.Coverage), len(policyEndpoints))
+	}
+	for _, c := range prov.Coverage {
+		if c.Category == "Compliance Policies" && (c.Count != 1 || c.Error != "") {
+			t.Errorf("Compliance Policies coverage = %+v, want 1 policy and no error", c)
+		}
+		if c.Category == "Settings Catalog" && c.Error == "" {
+			t.Errorf("Settings Catalog coverage = %+v, want the 404 recorded", c)
+		}
+	}
+
+	sawFallback := false
+	for _, c := range categories {
+		if c == "UTCM unavailable — using legacy sync" {
+			sawFallback = true
+		}
+	}
+	if !sawFallback {
+		t.Errorf("progress categories %v missing the legacy fallback notice", categories)
+	}
+}
+
+func TestSyncPoliciesFlagsMissingSettings(t *testing.T) {
+	fg := newFakeGraph(t)
+	fg.handle("POST "+utcmPath+"/configurationSnapshots/createSnapshot", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusForbidden, map[string]any{})
+	})
+	fg.handle("GET /beta/deviceManagement/configurationPolicies", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"value": []map[string]any{
+				{"id": "sc1", "name": "BitLocker", "platforms": "windows10"},
+			},
+		})
+	})
+	fg.handle("GET /beta/deviceManagement/configurationPolicies/sc1/settings", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": map[string]any{"code": "InternalServerError"}})
+	})
+
+	policies, _, err := fg.provider().SyncPolicies(context.Background(), provider.PolicySyncOptions{}, nil)
+	if err != nil {
+		t.Fatalf("SyncPolicies: %v", err)
+	}
+	if len(policies) != 1 {
+		t.Fatalf("policies = %d, want 1", len(policies))
+	}
+	if policies[0].SettingsError == "" {
+		t.Errorf("SettingsError empty, want the /settings failure recorded")
+	}
+}
+
+func TestSyncPoliciesCapturesAssignments(t *testing.T) {
+	fg := newFakeGraph(t)
+	fg.handle("POST "+utcmPath+"/configurationSnapshots/createSnapshot", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusForbidden, map[string]any{})
+	})
+	fg.handle("GET /v1.0/deviceManagement/deviceCompliancePolicies", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"value": []map[string]any{
+				{"id": "c1", "displayName": "BitLocker"},
+				{"id": "c2", "displayName": "Firewall"},
+			},
+		})
+	})
+	fg.handle("GET /v1.0/deviceManagement/deviceCompliancePolicies/c1/assignments", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"value": []map[string]any{
+				{"id": "a1", "target": map[string]any{"@odata.type": "#microsoft.graph.groupAssignmentTarget", "groupId": "g1", "deviceAndAppManagementAssignmentFilterType": "none"}},
+				{"id": "a2", "target": map[string]any{"@odata.type": "#microsoft.graph.allDevicesAssignmentTarget"}},
+			},
+		})
+	})
+	fg.handle("GET /v1.0/deviceManagement/deviceCompliancePolicies/c2/assignments", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"value": []map[string]any{
+				{"id": "a3", "target": map[string]any{"@odata.type": "#microsoft.graph.exclusionGroupAssignmentTarget", "groupId": "g1"}},
+			},
+		})
+	})
+	fg.handle("GET /v1.0/groups/g1", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"displayName": "Finance Laptops"})
+	})
+
+	policies, _, err := fg.provider().SyncPolicies(context.Background(), provider.PolicySyncOptions{}, nil)
+	if err != nil {
+		t.Fatalf("SyncPolicies: %v", err)
+	}
+	if len(policies) != 2 {
+		t.Fatalf("policies = %d, want 2", len(policies))
+	}
+
+	got, ok := PolicyAssignments(policies[0].SettingsJSON)
+	want := []provider.PolicyAssignment{
+		{Target: "allDevices"},
+		{Target: "group", GroupID: "g1", GroupName: "Finance Laptops"},
+	}
+	if !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("BitLocker assignments = %+v (ok=%v), want %+v", got, ok, want)
+	}
+	got, _ = PolicyAssignments(policies[1].SettingsJSON)
+	if len(got) != 1 || got[0].Target != "exclusionGroup" || got[0].GroupName != "Finance Laptops" {
+		t.Errorf("Firewall assignments = %+v, want the excluded Finance Laptops group", got)
+	}
+	if n := fg.count("GET /v1.0/groups/g1"); n != 1 {
+		t.Errorf("group looked up %d times, want 1 (cached)", n)
+	}
+}
+
+func TestSyncPoliciesLegacyCapsConcurrency(t *testing.T) {
+	fg := newFakeGraph(t)
+	fg.handle("POST "+utcmPath+"/configurationSnapshots/createSnapshot", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusForbidden, map[string]any{})
+	})
+
+	var inFlight, peak atomic.Int32
+	track := func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				old := peak.Load()
+				if n <= old || peak.CompareAndSwap(old, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			h(w, r)
+		}
+	}
+
+	var items []map[string]any
+	for i := range 12 {
+		items = append(items, map[string]any{"id": fmt.Sprintf("sc%02d", i), "name": fmt.Sprintf("Policy %02d", i)})
+	}
+	fg.handle("GET /beta/deviceManagement/configurationPolicies", track(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"value": items})
+	}))
+	fg.handle("GET /beta/deviceManagement/configurationPolicies/{id}/settings", track(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"value": []map[string]any{{"id": "0"}}})
+	}))
+	fg.handle("GET /beta/deviceManagement/configurationPolicies/{id}/assignments", track(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"value": []map[string]any{}})
+	}))
+
+	p := fg.provider()
+	p.policyConcurrency = 3
+	opts := provider.PolicySyncOptions{Categories: []string{"Settings Catalog"}}
+	policies, _, err := p.SyncPolicies(context.Background(), opts, nil)
+	if err != nil {
+		t.Fatalf("SyncPolicies: %v", err)
+	}
+	if len(policies) != len(items) {
+		t.Fatalf("policies = %d, want %d", len(policies), len(items))
+	}
+	for i, sp := range policies {
+		if want := fmt.Sprintf("Policy %02d", i); sp.PolicyName != want {
+			t.Errorf("policies[%d] = %q, want %q (order preserved)", i, sp.PolicyName, want)
+		}
+		if sp.SettingsError != "" || !strings.Contains(sp.SettingsJSON, "_settings") {
+			t.Errorf("policies[%d] settings not captured: %+v", i, sp)
+		}
+	}
+	if got := peak.Load(); got > 3 {
+		t.Errorf("peak in-flight requests = %d, want at most 3", got)
+	}
+	if got := peak.Load(); got < 2 {
+		t.Errorf("peak in-flight requests = %d, want requests to overlap", got)
+	}
+}
+
+func TestUTCMSettingsMatchLegacyShape(t *testing.T) {
+	utcm := map[string]any{
+		"DisplayName":           "Win10 Baseline",
+		"Description":           "Corporate baseline",
+		"Id":                    "p1",
+		"Identity":              "p1",
+		"Ensure":                "Present",
+		"ApplicationId":         "app",
+		"TenantId":              "contoso.onmicrosoft.com",
+		"CertificateThumbprint": "ABC123",
+		"RoleScopeTagIds":       []any{"0"},
+		"PasswordRequired":      true,
+		"PasswordMinimumLength": float64(8),
+		"Assignments": []any{
+			map[string]any{"CIMType": "MSFT_DeviceManagementConfigurationPolicyAssignments", "groupId": "g1"},
+		},
+		"ValidOperatingSystemBuildRanges": []any{
+			map[string]any{"CIMType": "MSFT_OperatingSystemVersionRange", "odataType": "#microsoft.graph.operatingSystemVersionRange", "LowestVersion": "10.0.19045"},
+		},
+	}
+	legacy := `{
+		"@odata.type": "#microsoft.graph.windows10CompliancePolicy",
+		"id": "p1",
+		"displayName": "Win10 Baseline",
+		"description": "Corporate baseline",
+		"version": 3,
+		"roleScopeTagIds": ["0"],
+		"lastModifiedDateTime": "2026-01-01T10:00:00Z",
+		"passwordRequired": true,
+		"passwordMinimumLength": 8,
+		"validOperatingSystemBuildRanges": [
+			{"@odata.type": "#microsoft.graph.operatingSystemVersionRange", "lowestVersion": "10.0.19045"}
+		]
+	}`
+
+	var got, want map[string]any
+	if err := json.Unmarshal([]byte(buildUTCMSettingsJSON(utcm)), &got); err != nil {
+		t.Fatalf("UTCM settings: %v", err)
+	}
+	if err := json.Unmarshal([]byte(buildSettingsJSON(json.RawMessage(legacy))), &want); err != nil {
+		t.Fatalf("legacy settings: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("UTCM settings = %v\nwant legacy shape %v", got, want)
+	}
+}
+
+func TestUTCMSettingsPreferCamelCase(t *testing.T) {
+	got := normalizeUTCMSettings(map[string]any{"DisplayName": "dsc", "displayName": "graph"})
+	if got["displayName"] != "graph" || len(got) != 1 {
+		t.Errorf("settings = %v, want the camelCase value kept", got)
+	}
+}
+
+func TestSyncPoliciesNarrowsCategories(t *testing.T) {
+	fg := newFakeGraph(t)
+
+	var requested []string
+	fg.handle("POST "+utcmPath+"/configurationSnapshots/createSnapshot", func(w http.ResponseWriter, r *http.Request) {
+		var body utcmSnapshotRequest
+		json.NewDecoder(r.Body).Decode(&body)
+		requested = body.Resources
+		writeJSON(w, http.StatusForbidden, map[string]any{"error": map[string]any{"code": "Authorization_RequestDenied"}})
+	})
+	fg.handle("GET /v1.0/deviceManagement/deviceCompliancePolicies", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"value": []map[string]any{}})
+	})
+
+	opts := provider.PolicySyncOptions{Categories: []string{"compliance"}}
+	_, prov, err := fg.provider().SyncPolicies(context.Background(), opts, nil)
+	if err != nil {
+		t.Fatalf("SyncPolicies: %v", err)
+	}
+
+	if len(requested) == 0 {
+		t.Fatal("UTCM snapshot requested no resources")
+	}
+	for _, rt := range requested {
+		if utcmResourceIndex[rt].Category != "Compliance" {
+			t.Errorf("UTCM requested %s outside the Compliance category", rt)
+		}
+	}
+	if n := fg.count("GET /v1.0/deviceManagement/deviceConfigurations"); n != 0 {
+		t.Errorf("deviceConfigurations fetched %d times, want 0 when only Compliance is selected", n)
+	}
+	var got []string
+	for _, c := range prov.Coverage {
+		got = append(got, c.Category)
+	}
+	want := []string{"Compliance Policies", "Compliance Policies (Settings Catalog)", "Compliance Scripts"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("coverage categories = %v, want %v", got, want)
+	}
+}
+
+func TestPolicySyncOptionsIncludesCategory(t *testing.T) {
+	all := provider.PolicySyncOptions{}
+	if !all.IncludesCategory("Roles") {
+		t.Error("empty selection should include every category")
+	}
+
+	opts := provider.PolicySyncOptions{Categories: []string{"Compliance Policies", "Windows Update"}}
+	for category, want := range map[string]bool{
+		"Compliance":                     true, // UTCM name is a prefix of the selection
+		"Compliance Policies":            true,
+		"Compliance Scripts":             false,
+		"Windows Update Policies":        true, // legacy name extends the selection
+		"Configuration Profiles":         false,
+		"Windows Information Protection": false,
+	} {
+		if got := opts.IncludesCategory(category); got != want {
+			t.Errorf("IncludesCategory(%q) = %v, want %v", category, got, want)
+		}
+	}
+}
+
+func TestFlattenSettingsDepth(t *testing.T) {
+	const settings = `{
+		"passwordRequired": true,
+		"omaSettings": [
+			{"omaUri": "./Vendor/MSFT/A", "value": 1},
+			{"omaUri": "./Vendor/MSFT/B", "value": {"nested": {"deep": "x"}}}
+		],
+		"emptyList": [],
+		"emptyObject": {}
+	}`
+	got := map[string]string{}
+	var names []string
+	for _, s := range FlattenSettingsDepth(settings, 2) {
+		got[s.Name] = s.Value
+		names = append(names, s.Name)
+	}
+
+	want := map[string]string{
+		"passwordRequired":     "true",
+		"omaSettings.0.omaUri": "./Vendor/MSFT/A",
+		"omaSettings.0.value":  "1",
+		"omaSettings.1.omaUri": "./Vendor/MSFT/B",
+		"omaSettings.1.value":  "{\n  \"nested\": {\n    \"deep\": \"x\"\n  }\n}", // beyond the depth limit
+		"emptyList":            "[]",
+		"emptyObject":          "{}",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FlattenSettingsDepth(2) = %q, want %q", got, want)
+	}
+	wantOrder := []string{"emptyList", "emptyObject", "omaSettings.0.omaUri", "omaSettings.0.value",
+		"omaSettings.1.omaUri", "omaSettings.1.value", "passwordRequired"}
+	if !reflect.DeepEqual(names, wantOrder) {
+		t.Errorf("order = %v, want %v", names, wantOrder)
+	}
+
+	if top := FlattenSettingsDepth(settings, 0); len(top) != 4 {
+		t.Errorf("depth 0 gave %d entries, want one per top-level key", len(top))
+	}
+}
@@ -0,0 +1,83 @@
+package intune
+
+// scopetags.go — Capture the role scope tags each policy carries.
+//
+// Graph policies list their scope tags in "roleScopeTagIds", and UTCM
+// instances in "RoleScopeTagIds". buildSettingsJSON leaves them out of the
+// settings, since they say who administers a policy rather than what it
+// configures; they are kept on SyncPolicy.ScopeTags instead, resolved to
+// display names from /deviceManagement/roleScopeTags once per capture.
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+
+	"github.com/dan/moe/internal/provider"
+)
+
+// graphScopeTag is one item of the /roleScopeTags collection.
+type graphScopeTag struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+}
+
+// scopeTagIDs returns the role scope tag IDs listed on a UTCM instance, under
+// either spelling of the key.
+func scopeTagIDs(m map[string]any) []string {
+	v, ok := m["RoleScopeTagIds"]
+	if !ok {
+		v = m["roleScopeTagIds"]
+	}
+	list, _ := v.([]any)
+	var ids []string
+	for _, id := range list {
+		if s, ok := id.(string); ok && s != "" {
+			ids = append(ids, s)
+		}
+	}
+	return ids
+}
+
+// fetchScopeTagNames returns the tenant's role scope tag names keyed by ID.
+func (p *Provider) fetchScopeTagNames(ctx context.Context) (map[string]string, error) {
+	items, err := p.graphGetAll(ctx, p.graphURL+"/beta/deviceManagement/roleScopeTags?$select=id,displayName")
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(items))
+	for _, raw := range items {
+		var tag graphScopeTag
+		if err := json.Unmarshal(raw, &tag); err != nil {
+			return nil, err
+		}
+		if tag.DisplayName != "" {
+			names[tag.ID] = tag.DisplayName
+		}
+	}
+	return names, nil
+}
+
+// resolveScopeTags replaces the scope tag IDs collected on policies with
+// their names. If the tags can't be listed (no DeviceManagementRBAC.Read.All)
+// that is logged and the IDs are kept, so a capture never fails over it.
+func (p *Provider) resolveScopeTags(ctx context.Context, policies []provider.SyncPolicy) {
+	tagged := slices.ContainsFunc(policies, func(sp provider.SyncPolicy) bool { return len(sp.ScopeTags) > 0 })
+	if !tagged {
+		return
+	}
+	names, err := p.fetchScopeTagNames(ctx)
+	if err != nil {
+		p.logf(ctx, "warning: could not resolve role scope tags: %v", err)
+	}
+	for i := range policies {
+		tags := policies[i].ScopeTags
+		for j, id := range tags {
+			if name, ok := names[id]; ok {
+				tags[j] = name
+			}
+		}
+		slices.Sort(tags)
+		policies[i].ScopeTags = slices.Compact(tags)
+	}
+}
@@ -0,0 +1,68 @@
+package intune
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/dan/moe/internal/provider"
+)
+
+func TestParsePolicyItemScopeTags(t *testing.T) {
+	raw := json.RawMessage(`{"id": "p1", "displayName": "Baseline", "roleScopeTagIds": ["0", "7"], "passwordRequired": true}`)
+	sp, err := parsePolicyItem(raw, "Compliance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"0", "7"}; !reflect.DeepEqual(sp.ScopeTags, want) {
+		t.Errorf("ScopeTags = %v, want %v", sp.ScopeTags, want)
+	}
+	var settings map[string]any
+	if err := json.Unmarshal([]byte(sp.SettingsJSON), &settings); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := settings["roleScopeTagIds"]; ok {
+		t.Error("roleScopeTagIds kept in the settings, want it only on ScopeTags")
+	}
+}
+
+func TestResolveScopeTags(t *testing.T) {
+	fg := newFakeGraph(t)
+	fg.handle("GET /beta/deviceManagement/roleScopeTags", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"value": []map[string]any{
+			{"id": "0", "displayName": "Default"},
+			{"id": "7", "displayName": "Finance"},
+		}})
+	})
+	p := fg.provider()
+
+	policies := []provider.SyncPolicy{
+		{PolicyName: "a", ScopeTags: []string{"7", "0"}},
+		{PolicyName: "b", ScopeTags: []string{"9"}}, // deleted tag: keeps its ID
+		{PolicyName: "c"},
+	}
+	p.resolveScopeTags(context.Background(), policies)
+
+	want := [][]string{{"Default", "Finance"}, {"9"}, nil}
+	for i, sp := range policies {
+		if !reflect.DeepEqual(sp.ScopeTags, want[i]) {
+			t.Errorf("%s: ScopeTags = %v, want %v", sp.PolicyName, sp.ScopeTags, want[i])
+		}
+	}
+	if n := fg.count("GET /beta/deviceManagement/roleScopeTags"); n != 1 {
+		t.Errorf("listed scope tags %d times, want once per capture", n)
+	}
+}
+
+func TestResolveScopeTagsKeepsIDsOnError(t *testing.T) {
+	fg := newFakeGraph(t) // no roleScopeTags handler: 404
+	p := fg.provider()
+
+	policies := []provider.SyncPolicy{{PolicyName: "a", ScopeTags: []string{"7", "0"}}}
+	p.resolveScopeTags(context.Background(), policies)
+	if want := []string{"0", "7"}; !reflect.DeepEqual(policies[0].ScopeTags, want) {
+		t.Errorf("ScopeTags = %v, want the IDs %v", policies[0].ScopeTags, want)
+	}
+}
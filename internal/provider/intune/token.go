@@ -1,22 +1,94 @@
 package intune
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
 )
 
+// Token request retry settings. Only transient failures (network errors,
+// HTTP 429 and 5xx) are retried; a 4xx such as invalid_client will not fix
+// itself and fails immediately.
+const (
+	tokenAttempts = 3
+	tokenTimeout  = 10 * time.Second // per attempt
+)
+
+// aadstsPattern matches an Entra ID error code such as "AADSTS7000215".
+var aadstsPattern = regexp.MustCompile(`AADSTS\d+`)
+
+// aadstsHints maps common Entra ID token error codes to short explanations
+// an operator can act on.
+var aadstsHints = map[string]string{
+	"AADSTS7000215": "invalid client secret — check the secret value, not the secret ID",
+	"AADSTS7000222": "client secret has expired — create a new secret in the app registration",
+	"AADSTS700016":  "application not found in tenant — check the client ID and tenant ID",
+	"AADSTS90002":   "tenant not found — check the tenant ID and Microsoft cloud",
+	"AADSTS900023":  "invalid tenant ID — use the directory (tenant) ID GUID or a verified domain",
+	"AADSTS65001":   "admin consent required — grant admin consent for the app's API permissions",
+	"AADSTS7000112": "application is disabled in the tenant",
+	"AADSTS500011":  "Graph not found for this tenant — check the Microsoft cloud setting and API permissions",
+	"AADSTS70011":   "invalid scope — check the Microsoft cloud setting",
+}
+
+// tokenErrorResponse is the error body returned by the Entra ID token
+// endpoint.
+type tokenErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	ErrorCodes       []int  `json:"error_codes"`
+}
+
+// describeTokenError turns a failed token response into a concise message
+// such as "invalid client secret — … (AADSTS7000215)". Known AADSTS codes
+// get a hint; otherwise the first line of the error description is used.
+// Bodies that aren't an Entra ID error fall back to the raw text.
+func describeTokenError(status int, body []byte) string {
+	var er tokenErrorResponse
+	if err := json.Unmarshal(body, &er); err != nil || (er.Error == "" && er.ErrorDescription == "") {
+		return fmt.Sprintf("token error (HTTP %d): %s", status, truncate(string(body), 500))
+	}
+
+	code := aadstsPattern.FindString(er.ErrorDescription)
+	if code == "" && len(er.ErrorCodes) > 0 {
+		code = fmt.Sprintf("AADSTS%d", er.ErrorCodes[0])
+	}
+	if hint, ok := aadstsHints[code]; ok {
+		return fmt.Sprintf("%s (%s)", hint, code)
+	}
+
+	// Descriptions look like "AADSTS123: Message.\r\nTrace ID: …"; keep
+	// just the message.
+	msg, _, _ := strings.Cut(er.ErrorDescription, "\n")
+	msg = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(msg), code+":"))
+	if msg == "" {
+		msg = er.Error
+	}
+	if code == "" {
+		return fmt.Sprintf("%s (HTTP %d)", msg, status)
+	}
+	return fmt.Sprintf("%s (%s)", msg, code)
+}
+
 // tokenCache handles OAuth2 client credentials token acquisition and caching
 // for Microsoft Entra ID (Azure AD).
 type tokenCache struct {
+	loginURL     string // e.g. "https://login.microsoftonline.com"
+	scope        string // e.g. "https://graph.microsoft.com/.default"
 	tenantID     string
 	clientID     string
 	clientSecret string
+	client       *http.Client
+	retryBase    time.Duration // first retry delay, doubled per attempt
 
 	mu      sync.Mutex
 	token   string
@@ -29,16 +101,24 @@ type tokenResponse struct {
 	TokenType   string `json:"token_type"`
 }
 
-func newTokenCache(tenantID, clientID, clientSecret string) *tokenCache {
+// newTokenCache creates a token cache. The token endpoint gets its own HTTP
+// client with a per-attempt timeout, sharing transport's connection pool
+// (nil means the default transport).
+func newTokenCache(loginURL, scope, tenantID, clientID, clientSecret string, transport http.RoundTripper) *tokenCache {
 	return &tokenCache{
+		loginURL:     loginURL,
+		scope:        scope,
 		tenantID:     tenantID,
 		clientID:     clientID,
 		clientSecret: clientSecret,
+		client:       &http.Client{Timeout: tokenTimeout, Transport: transport},
+		retryBase:    time.Second,
 	}
 }
 
-// Token returns a valid access token, refreshing if expired or missing.
-func (tc *tokenCache) Token() (string, error) {
+// Token returns a valid access token, refreshing if expired or missing. ctx
+// bounds the refresh, including any retries.
+func (tc *tokenCache) Token(ctx context.Context) (string, error) {
 	tc.mu.Lock()
 	defer tc.mu.Unlock()
 
@@ -47,7 +127,7 @@ func (tc *tokenCache) Token() (string, error) {
 		return tc.token, nil
 	}
 
-	token, expiresIn, err := tc.fetchToken()
+	token, expiresIn, err := tc.fetchTokenWithRetry(ctx)
 	if err != nil {
 		return "", err
 	}
@@ -57,32 +137,72 @@ func (tc *tokenCache) Token() (string, error) {
 	return tc.token, nil
 }
 
-func (tc *tokenCache) fetchToken() (string, int, error) {
+// tokenError is a failed token request. Transient errors are worth retrying.
+type tokenError struct {
+	err       error
+	transient bool
+}
+
+func (e *tokenError) Error() string { return e.err.Error() }
+func (e *tokenError) Unwrap() error { return e.err }
+
+// fetchTokenWithRetry calls fetchToken up to tokenAttempts times, backing
+// off exponentially between transient failures. It gives up early when ctx
+// is done.
+func (tc *tokenCache) fetchTokenWithRetry(ctx context.Context) (string, int, error) {
+	for attempt := 1; ; attempt++ {
+		token, expiresIn, err := tc.fetchToken(ctx)
+		if err == nil {
+			return token, expiresIn, nil
+		}
+		te, ok := err.(*tokenError)
+		if !ok || !te.transient || attempt >= tokenAttempts || ctx.Err() != nil {
+			return "", 0, err
+		}
+		wait := tc.retryBase << (attempt - 1)
+		log.Printf("%s token request failed, retrying in %v (attempt %d/%d): %v", logTag(ctx, "intune", ""), wait, attempt, tokenAttempts, err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return "", 0, fmt.Errorf("token request: %w", ctx.Err())
+		}
+	}
+}
+
+func (tc *tokenCache) fetchToken(ctx context.Context) (string, int, error) {
 	endpoint := fmt.Sprintf(
-		"https://login.microsoftonline.com/%s/oauth2/v2.0/token",
-		tc.tenantID,
+		"%s/%s/oauth2/v2.0/token",
+		tc.loginURL, tc.tenantID,
 	)
 
 	data := url.Values{
 		"grant_type":    {"client_credentials"},
 		"client_id":     {tc.clientID},
 		"client_secret": {tc.clientSecret},
-		"scope":         {"https://graph.microsoft.com/.default"},
+		"scope":         {tc.scope},
 	}
 
-	resp, err := http.Post(endpoint, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(data.Encode()))
 	if err != nil {
 		return "", 0, fmt.Errorf("token request: %w", err)
 	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := tc.client.Do(req)
+	if err != nil {
+		return "", 0, &tokenError{err: fmt.Errorf("token request: %w", err), transient: true}
+	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", 0, fmt.Errorf("read token response: %w", err)
+		return "", 0, &tokenError{err: fmt.Errorf("read token response: %w", err), transient: true}
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", 0, fmt.Errorf("token error (HTTP %d): %s", resp.StatusCode, string(body))
+		return "", 0, &tokenError{
+			err:       errors.New(describeTokenError(resp.StatusCode, body)),
+			transient: resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500,
+		}
 	}
 
 	var tr tokenResponse
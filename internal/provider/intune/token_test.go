@@ -0,0 +1,138 @@
+package intune
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// tokenServer serves the token endpoint with the given responses in turn,
+// repeating the last one, and counts requests.
+func tokenServer(t *testing.T, responses ...func(w http.ResponseWriter)) (*tokenCache, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		responses[min(n, len(responses))-1](w)
+	}))
+	t.Cleanup(srv.Close)
+
+	tc := newTokenCache(srv.URL, "scope", "tenant-1", "client-1", "secret-1", srv.Client().Transport)
+	tc.retryBase = 0
+	return tc, &calls
+}
+
+func tokenOK(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]any{"access_token": "tok", "expires_in": 3600})
+}
+
+func tokenStatus(status int, body map[string]any) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) { writeJSON(w, status, body) }
+}
+
+func TestTokenRetriesTransientFailures(t *testing.T) {
+	unavailable := tokenStatus(http.StatusServiceUnavailable, map[string]any{"error": "temporarily_unavailable"})
+	tc, calls := tokenServer(t, unavailable, unavailable, tokenOK)
+
+	tok, err := tc.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() error = %v, want success on third attempt", err)
+	}
+	if tok != "tok" || calls.Load() != 3 {
+		t.Errorf("token = %q after %d calls, want %q after 3", tok, calls.Load(), "tok")
+	}
+}
+
+func TestTokenGivesUpAfterMaxAttempts(t *testing.T) {
+	tc, calls := tokenServer(t, tokenStatus(http.StatusInternalServerError, map[string]any{"error": "server_error"}))
+
+	if _, err := tc.Token(context.Background()); err == nil {
+		t.Fatal("Token() error = nil, want failure")
+	}
+	if calls.Load() != tokenAttempts {
+		t.Errorf("calls = %d, want %d", calls.Load(), tokenAttempts)
+	}
+}
+
+func TestTokenDoesNotRetryInvalidClient(t *testing.T) {
+	tc, calls := tokenServer(t, tokenStatus(http.StatusUnauthorized, map[string]any{
+		"error":             "invalid_client",
+		"error_description": "AADSTS7000215: Invalid client secret provided.",
+		"error_codes":       []int{7000215},
+	}))
+
+	_, err := tc.Token(context.Background())
+	if err == nil {
+		t.Fatal("Token() error = nil, want invalid_client failure")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("calls = %d, want 1 (no retry for a permanent failure)", calls.Load())
+	}
+	if !strings.Contains(err.Error(), "AADSTS7000215") {
+		t.Errorf("error = %q, want it to include the AADSTS code", err)
+	}
+}
+
+func TestDescribeTokenError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{
+			"known code gets a hint",
+			401,
+			`{"error":"invalid_client","error_description":"AADSTS7000215: Invalid client secret provided.\r\nTrace ID: abc\r\nCorrelation ID: def","error_codes":[7000215]}`,
+			"invalid client secret — check the secret value, not the secret ID (AADSTS7000215)",
+		},
+		{
+			"code from error_codes only",
+			400,
+			`{"error":"invalid_request","error_description":"Tenant not found.","error_codes":[90002]}`,
+			"tenant not found — check the tenant ID and Microsoft cloud (AADSTS90002)",
+		},
+		{
+			"unknown code keeps the description",
+			400,
+			`{"error":"invalid_request","error_description":"AADSTS12345: Something odd happened.\r\nTrace ID: abc"}`,
+			"Something odd happened. (AADSTS12345)",
+		},
+		{
+			"no code or description",
+			400,
+			`{"error":"invalid_scope"}`,
+			"invalid_scope (HTTP 400)",
+		},
+		{
+			"not JSON",
+			502,
+			`<html>Bad Gateway</html>`,
+			"token error (HTTP 502): <html>Bad Gateway</html>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeTokenError(tt.status, []byte(tt.body)); got != tt.want {
+				t.Errorf("describeTokenError() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenStopsRetryingWhenContextDone(t *testing.T) {
+	unavailable := tokenStatus(http.StatusServiceUnavailable, map[string]any{"error": "temporarily_unavailable"})
+	tc, calls := tokenServer(t, unavailable)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := tc.Token(ctx); err == nil {
+		t.Fatal("Token() error = nil, want failure with a cancelled context")
+	}
+	if calls.Load() > 1 {
+		t.Errorf("calls = %d, want no retries once the context is done", calls.Load())
+	}
+}
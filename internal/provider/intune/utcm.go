@@ -19,9 +19,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/dan/moe/internal/metrics"
+	"github.com/dan/moe/internal/provider"
 )
 
 // ── UTCM resource definitions ───────────────────────────────────────────
@@ -145,22 +148,73 @@ func init() {
 	}
 }
 
-// allUTCMResourceNames returns the resource type strings for the snapshot request.
-func allUTCMResourceNames() []string {
-	names := make([]string, len(utcmIntuneResources))
-	for i, r := range utcmIntuneResources {
+// selectUTCMResources returns the resource types whose category is
+// selected by opts, in utcmIntuneResources order.
+func selectUTCMResources(opts provider.PolicySyncOptions) []utcmResource {
+	var out []utcmResource
+	for _, r := range utcmIntuneResources {
+		if opts.IncludesCategory(r.Category) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// utcmResourceNames returns the resource type strings for the snapshot request.
+func utcmResourceNames(resources []utcmResource) []string {
+	names := make([]string, len(resources))
+	for i, r := range resources {
 		names[i] = r.ResourceType
 	}
 	return names
 }
 
+// PolicyCategories lists the policy categories a capture can be narrowed
+// to, in display order. These are the UTCM categories; each also selects
+// the legacy endpoints it prefixes (see provider.PolicySyncOptions).
+func PolicyCategories() []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, r := range utcmIntuneResources {
+		if !seen[r.Category] {
+			seen[r.Category] = true
+			out = append(out, r.Category)
+		}
+	}
+	return out
+}
+
 // ── UTCM API types ──────────────────────────────────────────────────────
 
+// utcmPath is the UTCM API root, relative to the Graph base URL.
+const utcmPath = "/beta/admin/configurationManagement"
+
+// UTCM keeps at most utcmJobQuota snapshot jobs visible per tenant and
+// refuses new ones beyond that. Before creating a job, MOE deletes its own
+// finished or abandoned jobs, oldest first, until utcmJobHeadroom slots are
+// free. Jobs are recognised as this provider's by utcmJobPrefix.
 const (
-	utcmBaseURL           = "https://graph.microsoft.com/beta/admin/configurationManagement"
-	utcmCreateSnapshotURL = utcmBaseURL + "/configurationSnapshots/createSnapshot"
+	utcmJobQuota    = 12
+	utcmJobHeadroom = 2
+	utcmLabelPrefix = "MOE "
 )
 
+// utcmMaxWait is how long a snapshot job may run. A job still unfinished
+// after that was abandoned, e.g. by a capture interrupted by a crash.
+const utcmMaxWait = 10 * time.Minute
+
+// utcmJobPrefix returns the display-name prefix of the snapshot jobs this
+// provider creates. It includes the provider name so that jobs from other
+// MOE instances or providers on the same tenant are never pruned.
+func (p *Provider) utcmJobPrefix() string {
+	return sanitiseSnapshotLabel(utcmLabelPrefix+p.config.Name) + " "
+}
+
+// utcmURL returns the UTCM API root for this provider's Graph endpoint.
+func (p *Provider) utcmURL() string {
+	return p.graphURL + utcmPath
+}
+
 // utcmSnapshotRequest is the POST body for createSnapshot.
 type utcmSnapshotRequest struct {
 	DisplayName string   `json:"displayName"`
@@ -198,12 +252,15 @@ type utcmSnapshotResourceGroup struct {
 
 // ── UTCM API methods on Provider ────────────────────────────────────────
 
-// utcmCreateSnapshot submits a snapshot job to the UTCM API.
-func (p *Provider) utcmCreateSnapshot(ctx context.Context, label string) (*utcmSnapshotJob, error) {
+// utcmCreateSnapshot submits a snapshot job to the UTCM API, first pruning
+// old MOE jobs so the tenant's job quota has room for it.
+func (p *Provider) utcmCreateSnapshot(ctx context.Context, label string, resources []utcmResource) (*utcmSnapshotJob, error) {
+	p.utcmPruneSnapshotJobs(ctx)
+
 	reqBody := utcmSnapshotRequest{
 		DisplayName: label,
 		Description: fmt.Sprintf("MOE snapshot: %s", label),
-		Resources:   allUTCMResourceNames(),
+		Resources:   utcmResourceNames(resources),
 	}
 
 	bodyBytes, err := json.Marshal(reqBody)
@@ -211,7 +268,7 @@ func (p *Provider) utcmCreateSnapshot(ctx context.Context, label string) (*utcmS
 		return nil, fmt.Errorf("marshal snapshot request: %w", err)
 	}
 
-	respBytes, err := p.graphPost(ctx, utcmCreateSnapshotURL, strings.NewReader(string(bodyBytes)))
+	respBytes, err := p.graphPost(ctx, p.utcmURL()+"/configurationSnapshots/createSnapshot", strings.NewReader(string(bodyBytes)))
 	if err != nil {
 		return nil, fmt.Errorf("create snapshot job: %w", err)
 	}
@@ -221,15 +278,14 @@ func (p *Provider) utcmCreateSnapshot(ctx context.Context, label string) (*utcmS
 		return nil, fmt.Errorf("parse snapshot job response: %w", err)
 	}
 
-	log.Printf("[utcm:%s] snapshot job created: id=%s status=%s resources=%d",
-		p.config.Name, job.ID, job.Status, len(job.Resources))
+	p.utcmLogf(ctx, "snapshot job created: id=%s status=%s resources=%d", job.ID, job.Status, len(job.Resources))
 	return &job, nil
 }
 
 // utcmGetSnapshotJob retrieves the current state of a snapshot job.
 // Uses $select to explicitly request resourceLocation, which is not returned by default.
 func (p *Provider) utcmGetSnapshotJob(ctx context.Context, jobID string) (*utcmSnapshotJob, error) {
-	url := fmt.Sprintf("%s/configurationSnapshotJobs/%s?$select=id,displayName,description,status,resources,createdDateTime,completedDateTime,resourceLocation,errorDetails", utcmBaseURL, jobID)
+	url := fmt.Sprintf("%s/configurationSnapshotJobs/%s?$select=id,displayName,description,status,resources,createdDateTime,completedDateTime,resourceLocation,errorDetails", p.utcmURL(), jobID)
 
 	respBytes, err := p.graphGet(ctx, url)
 	if err != nil {
@@ -244,23 +300,91 @@ func (p *Provider) utcmGetSnapshotJob(ctx context.Context, jobID string) (*utcmS
 	return &job, nil
 }
 
+// utcmListSnapshotJobs returns every snapshot job visible in the tenant,
+// including those created by other tools.
+func (p *Provider) utcmListSnapshotJobs(ctx context.Context) ([]utcmSnapshotJob, error) {
+	items, err := p.graphGetAll(ctx, p.utcmURL()+"/configurationSnapshotJobs?$select=id,displayName,status,createdDateTime")
+	if err != nil {
+		return nil, fmt.Errorf("list snapshot jobs: %w", err)
+	}
+	jobs := make([]utcmSnapshotJob, 0, len(items))
+	for _, raw := range items {
+		var job utcmSnapshotJob
+		if err := json.Unmarshal(raw, &job); err != nil {
+			return nil, fmt.Errorf("parse snapshot job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// utcmPruneSnapshotJobs deletes this provider's snapshot jobs, oldest first,
+// until utcmJobHeadroom of the tenant's utcmJobQuota slots are free. Jobs
+// younger than utcmMaxWait are kept, since another capture may still be
+// waiting on or downloading them; jobs created by other tools or other
+// providers are never touched. Failures are logged and left for createSnapshot to report.
+func (p *Provider) utcmPruneSnapshotJobs(ctx context.Context) {
+	jobs, err := p.utcmListSnapshotJobs(ctx)
+	if err != nil {
+		p.utcmLogf(ctx, "warning: could not check snapshot job quota: %v", err)
+		return
+	}
+	excess := len(jobs) - (utcmJobQuota - utcmJobHeadroom)
+	if excess <= 0 {
+		return
+	}
+
+	candidates := utcmPrunableJobs(jobs, p.utcmJobPrefix(), time.Now())
+	pruned := 0
+	for _, job := range candidates {
+		if pruned == excess {
+			break
+		}
+		if err := p.utcmDeleteSnapshotJob(ctx, job.ID); err != nil {
+			p.utcmLogf(ctx, "warning: could not prune snapshot job %s (%q): %v", job.ID, job.DisplayName, err)
+			continue
+		}
+		p.utcmLogf(ctx, "pruned snapshot job %s (%q, %s, created %s)",
+			job.ID, job.DisplayName, job.Status, job.CreatedDateTime.Format(time.RFC3339))
+		pruned++
+	}
+	if pruned < excess {
+		p.utcmLogf(ctx, "warning: %d of %d snapshot job slots in use after pruning %d", len(jobs)-pruned, utcmJobQuota, pruned)
+	}
+}
+
+// utcmPrunableJobs returns the jobs named with prefix that may be deleted,
+// oldest first: those older than utcmMaxWait. A younger job may still be
+// running, or have just succeeded and be mid-download by another capture.
+func utcmPrunableJobs(jobs []utcmSnapshotJob, prefix string, now time.Time) []utcmSnapshotJob {
+	var out []utcmSnapshotJob
+	for _, job := range jobs {
+		if !strings.HasPrefix(job.DisplayName, prefix) {
+			continue
+		}
+		if now.Sub(job.CreatedDateTime) < utcmMaxWait {
+			continue
+		}
+		out = append(out, job)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedDateTime.Before(out[j].CreatedDateTime) })
+	return out
+}
+
 // utcmWaitForSnapshot polls a snapshot job until it completes or context expires.
 // Returns the completed job with resourceLocation populated.
 func (p *Provider) utcmWaitForSnapshot(ctx context.Context, jobID string, progress func(status string)) (*utcmSnapshotJob, error) {
-	const pollInterval = 5 * time.Second
-	const maxWait = 10 * time.Minute
-
 	start := time.Now()
-	deadline := start.Add(maxWait)
+	deadline := start.Add(utcmMaxWait)
 	for {
 		if time.Now().After(deadline) {
-			return nil, fmt.Errorf("snapshot job timed out after %v", maxWait)
+			return nil, fmt.Errorf("snapshot job timed out after %v", utcmMaxWait)
 		}
 
 		select {
 		case <-ctx.Done():
 			return nil, ctx.Err()
-		case <-time.After(pollInterval):
+		case <-time.After(p.utcmPollInterval):
 		}
 
 		job, err := p.utcmGetSnapshotJob(ctx, jobID)
@@ -276,9 +400,9 @@ func (p *Provider) utcmWaitForSnapshot(ctx context.Context, jobID string, progre
 
 		switch job.Status {
 		case "succeeded", "partiallySuccessful":
-			log.Printf("[utcm:%s] snapshot completed: status=%s (%v elapsed)", p.config.Name, job.Status, elapsed)
+			p.utcmLogf(ctx, "snapshot completed: status=%s (%v elapsed)", job.Status, elapsed)
 			if len(job.ErrorDetails) > 0 {
-				log.Printf("[utcm:%s] snapshot warnings: %v", p.config.Name, job.ErrorDetails)
+				p.utcmLogf(ctx, "snapshot warnings: %v", job.ErrorDetails)
 			}
 			return job, nil
 		case "failed":
@@ -288,10 +412,10 @@ func (p *Provider) utcmWaitForSnapshot(ctx context.Context, jobID string, progre
 			}
 			return nil, fmt.Errorf("%s", errMsg)
 		case "notStarted", "running":
-			log.Printf("[utcm:%s] snapshot in progress: status=%s (%v elapsed)", p.config.Name, job.Status, elapsed)
+			p.utcmLogf(ctx, "snapshot in progress: status=%s (%v elapsed)", job.Status, elapsed)
 			continue
 		default:
-			log.Printf("[utcm:%s] unknown snapshot status: %s (%v elapsed)", p.config.Name, job.Status, elapsed)
+			p.utcmLogf(ctx, "unknown snapshot status: %s (%v elapsed)", job.Status, elapsed)
 			continue
 		}
 	}
@@ -377,9 +501,9 @@ func parseRawSnapshotJSON(data []byte) (*utcmSnapshotResult, error) {
 // utcmDeleteSnapshotJob deletes a completed snapshot job to free up quota.
 // UTCM allows max 12 visible snapshot jobs.
 func (p *Provider) utcmDeleteSnapshotJob(ctx context.Context, jobID string) error {
-	url := fmt.Sprintf("%s/configurationSnapshotJobs/%s", utcmBaseURL, jobID)
+	url := fmt.Sprintf("%s/configurationSnapshotJobs/%s", p.utcmURL(), jobID)
 
-	token, err := p.tokens.Token()
+	token, err := p.tokens.Token(ctx)
 	if err != nil {
 		return fmt.Errorf("auth: %w", err)
 	}
@@ -391,14 +515,16 @@ func (p *Provider) utcmDeleteSnapshotJob(ctx context.Context, jobID string) erro
 
 	resp, err := p.client.Do(req)
 	if err != nil {
+		metrics.ObserveGraphRequest(p.config.Name, 0)
 		return fmt.Errorf("delete snapshot job: %w", err)
 	}
 	defer resp.Body.Close()
+	metrics.ObserveGraphRequest(p.config.Name, resp.StatusCode)
 
 	if resp.StatusCode >= 300 {
 		return fmt.Errorf("delete snapshot job: HTTP %d", resp.StatusCode)
 	}
 
-	log.Printf("[utcm:%s] deleted snapshot job %s", p.config.Name, jobID)
+	p.utcmLogf(ctx, "deleted snapshot job %s", jobID)
 	return nil
 }
@@ -0,0 +1,123 @@
+package intune
+
+// utcm_normalize.go — Reshape UTCM resource instances so their settings
+// line up with what the legacy Graph endpoints return for the same policy.
+//
+// UTCM instances follow the Microsoft365DSC resource conventions rather than
+// the Graph schema. The differences that matter for comparison are:
+//
+//   - Property names are PascalCase ("PasswordRequired") where Graph uses
+//     camelCase ("passwordRequired"). Every key, at any depth, has its first
+//     letter lowered. If an instance carries both spellings the camelCase one
+//     wins, since that is the value Graph would have returned.
+//   - Resource state: "Ensure" ("Present"/"Absent") describes whether the
+//     resource should exist, not how it is configured.
+//   - Authentication parameters: "Credential", "ApplicationId", "TenantId",
+//     "CertificateThumbprint", "ApplicationSecret", "ManagedIdentity" and
+//     "AccessTokens" are how the DSC resource connected, not policy settings.
+//   - Identity: "Identity" and "Id" hold the Graph object ID, which the legacy
+//     path drops as "id".
+//   - Assignments: "Assignments" lists group targets in DSC form. Both paths
+//     capture assignments from Graph's /assignments sub-resource instead
+//     (see assignments.go), so the DSC copy is dropped.
+//   - CIM wrappers: nested objects are CIM instances that may carry a
+//     "CIMType"/"CimClass" key naming the MSFT_* class. The class name has
+//     no Graph counterpart and is dropped; the object's properties are kept.
+//   - OData type: nested CIM instances record the Graph type as "odataType",
+//     which is renamed to "@odata.type" to match Graph's nested objects.
+//
+// After renaming, top-level keys pass through the same isGraphMetaKey filter
+// as legacy settings, so version/timestamp/scope-tag fields are dropped from
+// both. Settings Catalog policies are not reconciled: DSC flattens their
+// setting instances into top-level properties while the legacy path stores
+// the raw settingInstance tree under "_settings".
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// utcmDSCKeys are DSC convention fields stripped from every instance
+// (compared case-insensitively, at the top level only).
+var utcmDSCKeys = map[string]bool{
+	"ensure":                true,
+	"credential":            true,
+	"applicationid":         true,
+	"tenantid":              true,
+	"certificatethumbprint": true,
+	"applicationsecret":     true,
+	"managedidentity":       true,
+	"accesstokens":          true,
+	"identity":              true,
+	"assignments":           true,
+}
+
+// utcmCIMKeys are CIM class markers stripped from nested objects.
+var utcmCIMKeys = map[string]bool{
+	"cimtype":  true,
+	"cimclass": true,
+}
+
+// normalizeUTCMSettings returns a copy of instance reshaped to the legacy
+// Graph settings layout described above.
+func normalizeUTCMSettings(instance map[string]any) map[string]any {
+	clean := make(map[string]any, len(instance))
+	for k, v := range instance {
+		if utcmDSCKeys[strings.ToLower(k)] {
+			continue
+		}
+		putNormalized(clean, k, normalizeUTCMValue(v))
+	}
+	for k := range clean {
+		if isGraphMetaKey(k) {
+			delete(clean, k)
+		}
+	}
+	return clean
+}
+
+// normalizeUTCMValue applies the nested-object conventions recursively.
+func normalizeUTCMValue(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, inner := range val {
+			if utcmCIMKeys[strings.ToLower(k)] {
+				continue
+			}
+			putNormalized(out, k, normalizeUTCMValue(inner))
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, inner := range val {
+			out[i] = normalizeUTCMValue(inner)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// putNormalized stores v under the Graph spelling of key. A key that was
+// already camelCase in the source takes precedence over a PascalCase twin.
+func putNormalized(m map[string]any, key string, v any) {
+	name := graphKeyName(key)
+	if _, exists := m[name]; exists && name != key {
+		return
+	}
+	m[name] = v
+}
+
+// graphKeyName converts a DSC property name to its Graph spelling.
+func graphKeyName(key string) string {
+	if strings.EqualFold(key, "odataType") {
+		return "@odata.type"
+	}
+	r, size := utf8.DecodeRuneInString(key)
+	if r == utf8.RuneError || unicode.IsLower(r) {
+		return key
+	}
+	return string(unicode.ToLower(r)) + key[size:]
+}
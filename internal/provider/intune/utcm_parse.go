@@ -6,7 +6,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"sort"
 	"strings"
@@ -17,18 +16,24 @@ import (
 
 // SyncPoliciesUTCM captures an Intune configuration snapshot using the UTCM API,
 // waits for completion, downloads the results, and maps them to SyncPolicy.
+// Only resource types in opts.Categories are requested.
 // Falls back to the legacy per-endpoint approach if UTCM fails.
-func (p *Provider) SyncPoliciesUTCM(ctx context.Context, progress func(category string, count int)) ([]provider.SyncPolicy, error) {
-	label := sanitiseSnapshotLabel(fmt.Sprintf("MOE %s %d", p.config.Name, nowUnixMilli()))
+func (p *Provider) SyncPoliciesUTCM(ctx context.Context, opts provider.PolicySyncOptions, progress func(category string, count int)) ([]provider.SyncPolicy, provider.PolicyProvenance, error) {
+	label := sanitiseSnapshotLabel(fmt.Sprintf("%s%s %d", utcmLabelPrefix, p.config.Name, nowUnixMilli()))
 	total := 0
 
+	resources := selectUTCMResources(opts)
+	if len(resources) == 0 {
+		return nil, provider.PolicyProvenance{}, fmt.Errorf("UTCM: no resource types match categories %v", opts.Categories)
+	}
+
 	// 1. Create snapshot job
 	if progress != nil {
 		progress("UTCM: creating snapshot", 0)
 	}
-	job, err := p.utcmCreateSnapshot(ctx, label)
+	job, err := p.utcmCreateSnapshot(ctx, label, resources)
 	if err != nil {
-		return nil, fmt.Errorf("UTCM create snapshot: %w", err)
+		return nil, provider.PolicyProvenance{}, fmt.Errorf("UTCM create snapshot: %w", err)
 	}
 	jobID := job.ID
 
@@ -43,7 +48,7 @@ func (p *Provider) SyncPoliciesUTCM(ctx context.Context, progress func(category
 	if err != nil {
 		// Clean up the failed job
 		_ = p.utcmDeleteSnapshotJob(context.Background(), jobID)
-		return nil, fmt.Errorf("UTCM wait: %w", err)
+		return nil, provider.PolicyProvenance{}, fmt.Errorf("UTCM wait: %w", err)
 	}
 
 	// 3. Download results
@@ -54,26 +59,41 @@ func (p *Provider) SyncPoliciesUTCM(ctx context.Context, progress func(category
 	if err != nil {
 		// Clean up
 		_ = p.utcmDeleteSnapshotJob(context.Background(), job.ID)
-		return nil, fmt.Errorf("UTCM download: %w", err)
+		return nil, provider.PolicyProvenance{}, fmt.Errorf("UTCM download: %w", err)
 	}
 
 	// 4. Parse into SyncPolicy
 	policies := utcmResultToSyncPolicies(result)
 	total = len(policies)
 
+	if progress != nil {
+		progress("UTCM: fetching assignments", total)
+	}
+	p.attachUTCMAssignments(ctx, policies)
+	for i := range policies {
+		p.attachGroupNames(ctx, &policies[i])
+	}
+	p.resolveScopeTags(ctx, policies)
+
 	if progress != nil {
 		progress("UTCM: parsing complete", total)
 	}
 
-	log.Printf("[utcm:%s] snapshot complete: %d policies from %d resource groups",
-		p.config.Name, total, len(result.Resources))
+	p.utcmLogf(ctx, "snapshot complete: %d policies from %d resource groups", total, len(result.Resources))
 
 	// 5. Clean up the snapshot job (they count towards the 12-job quota)
 	go func() {
 		_ = p.utcmDeleteSnapshotJob(context.Background(), job.ID)
 	}()
 
-	return policies, nil
+	prov := provider.PolicyProvenance{
+		CaptureMethod: provider.CaptureMethodUTCM,
+		Coverage:      utcmCoverage(resources, policies, job.ErrorDetails),
+	}
+	if job.Status == "partiallySuccessful" {
+		prov.FailedResources = utcmFailedResources(job.ErrorDetails)
+	}
+	return policies, prov, nil
 }
 
 // utcmResultToSyncPolicies converts downloaded UTCM snapshot results into
@@ -113,6 +133,71 @@ func utcmResultToSyncPolicies(result *utcmSnapshotResult) []provider.SyncPolicy
 	return policies
 }
 
+// utcmCoverage reports per-category results for a UTCM snapshot. Every
+// category we request is listed, in utcmIntuneResources order, followed by
+// any categories guessed for unrecognised resource types. Job error details
+// of the form "<resourceType>: <message>" are attributed to that resource's
+// category.
+func utcmCoverage(resources []utcmResource, policies []provider.SyncPolicy, errorDetails []string) []provider.CategoryCoverage {
+	var cov []provider.CategoryCoverage
+	idx := make(map[string]int)
+	entry := func(category string) *provider.CategoryCoverage {
+		i, ok := idx[category]
+		if !ok {
+			i = len(cov)
+			idx[category] = i
+			cov = append(cov, provider.CategoryCoverage{Category: category})
+		}
+		return &cov[i]
+	}
+
+	for _, r := range resources {
+		entry(r.Category)
+	}
+	for _, sp := range policies {
+		entry(sp.Category).Count++
+	}
+	for _, detail := range errorDetails {
+		rt, msg, ok := strings.Cut(detail, ":")
+		meta, known := utcmResourceIndex[strings.TrimSpace(rt)]
+		if !ok || !known {
+			continue
+		}
+		c := entry(meta.Category)
+		msg = shortResourceType(meta.ResourceType) + ": " + strings.TrimSpace(msg)
+		if c.Error != "" {
+			c.Error += "; "
+		}
+		c.Error += msg
+	}
+	return cov
+}
+
+// utcmFailedResources lists the resource types a partially successful
+// snapshot job reported as failed. Error details of the form
+// "<resourceType>: <message>" use the short resource type name; others are
+// kept as they are. A job that reports no details still gets one entry, so
+// the capture is never mistaken for a complete one.
+func utcmFailedResources(errorDetails []string) []string {
+	var failed []string
+	for _, detail := range errorDetails {
+		detail = strings.TrimSpace(detail)
+		if detail == "" {
+			continue
+		}
+		if rt, msg, ok := strings.Cut(detail, ":"); ok {
+			if meta, known := utcmResourceIndex[strings.TrimSpace(rt)]; known {
+				detail = shortResourceType(meta.ResourceType) + ": " + strings.TrimSpace(msg)
+			}
+		}
+		failed = append(failed, detail)
+	}
+	if len(failed) == 0 {
+		failed = []string{"unknown resource types: the job reported no error details"}
+	}
+	return failed
+}
+
 // utcmInstanceToSyncPolicy maps a single UTCM resource instance to a SyncPolicy.
 func utcmInstanceToSyncPolicy(instance map[string]interface{}, meta utcmResource) provider.SyncPolicy {
 	sp := provider.SyncPolicy{
@@ -162,25 +247,17 @@ func utcmInstanceToSyncPolicy(instance map[string]interface{}, meta utcmResource
 
 	// Build settings JSON: everything except the extracted fields
 	sp.SettingsJSON = buildUTCMSettingsJSON(instance)
+	sp.ScopeTags = scopeTagIDs(instance)
 
 	return sp
 }
 
-// buildUTCMSettingsJSON serialises the instance properties as a clean JSON blob.
-// Strips internal/meta fields that aren't useful for comparison.
+// buildUTCMSettingsJSON serialises the instance properties as a clean JSON
+// blob in the same shape buildSettingsJSON produces for the legacy endpoints,
+// so snapshots taken by either capture method diff cleanly against each
+// other. See utcm_normalize.go for the DSC conventions that are undone.
 func buildUTCMSettingsJSON(instance map[string]interface{}) string {
-	// Copy, removing fields we've already extracted as top-level SyncPolicy fields
-	clean := make(map[string]interface{}, len(instance))
-	for k, v := range instance {
-		// Skip internal fields
-		switch k {
-		case "@odata.type", "@odata.context", "Ensure":
-			continue
-		}
-		clean[k] = v
-	}
-
-	data, err := json.MarshalIndent(clean, "", "  ")
+	data, err := json.Marshal(normalizeUTCMSettings(instance))
 	if err != nil {
 		// Fallback: dump as-is
 		raw, _ := json.Marshal(instance)
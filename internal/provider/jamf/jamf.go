@@ -0,0 +1,344 @@
+package jamf
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dan/moe/internal/models"
+	"github.com/dan/moe/internal/provider"
+)
+
+// pageSize is the number of records requested per Jamf inventory page.
+const pageSize = 100
+
+// Config holds the configuration for a Jamf Pro provider instance.
+type Config struct {
+	Name         string // unique name e.g. "jamf-apple"
+	BaseURL      string // e.g. "https://acme.jamfcloud.com"
+	ClientID     string
+	ClientSecret string
+
+	// HTTPClient is optional; nil uses a client with a 30s timeout.
+	HTTPClient *http.Client
+}
+
+// Provider implements the provider.Provider interface for Jamf Pro via the
+// Jamf Pro API. Devices come from two inventories, computers (macOS) and
+// mobile devices (iOS/iPadOS/tvOS), which SyncDevices pages through in turn.
+type Provider struct {
+	config  Config
+	tokens  *tokenCache
+	client  *http.Client
+	baseURL string // without trailing slash
+}
+
+// New creates a new Jamf Pro provider instance.
+func New(cfg Config) *Provider {
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	baseURL := strings.TrimRight(cfg.BaseURL, "/")
+	return &Provider{
+		config:  cfg,
+		tokens:  newTokenCache(baseURL, cfg.ClientID, cfg.ClientSecret, client),
+		client:  client,
+		baseURL: baseURL,
+	}
+}
+
+func init() {
+	provider.RegisterFactory("jamf", func(cfg models.ProviderConfig, _ provider.Options) (provider.Provider, error) {
+		return New(Config{
+			Name:         cfg.Name,
+			BaseURL:      cfg.BaseURL,
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+		}), nil
+	})
+}
+
+func (p *Provider) Name() string { return p.config.Name }
+func (p *Provider) Type() string { return "jamf" }
+
+// TestConnection verifies the Jamf Pro server is reachable and the
+// credentials are valid by acquiring a bearer token.
+func (p *Provider) TestConnection(ctx context.Context) error {
+	if p.baseURL == "" {
+		return fmt.Errorf("server URL is not configured")
+	}
+	if _, err := p.tokens.Token(ctx); err != nil {
+		return fmt.Errorf("authentication failed: %w", err)
+	}
+	return nil
+}
+
+// ── Sync ────────────────────────────────────────────────────────────────
+
+// Inventory phases, in sync order. The cursor is "<phase>:<page>".
+const (
+	phaseComputers = "computers"
+	phaseMobile    = "mobile"
+)
+
+type inventoryPage[T any] struct {
+	TotalCount int `json:"totalCount"`
+	Results    []T `json:"results"`
+}
+
+// computerRecord is the subset of /api/v2/computers-inventory used by MOE.
+type computerRecord struct {
+	ID      string `json:"id"`
+	General struct {
+		Name                                 string `json:"name"`
+		LastContactTime                      string `json:"lastContactTime"`
+		LastEnrolledDate                     string `json:"lastEnrolledDate"`
+		Supervised                           bool   `json:"supervised"`
+		EnrolledViaAutomatedDeviceEnrollment bool   `json:"enrolledViaAutomatedDeviceEnrollment"`
+	} `json:"general"`
+	Hardware struct {
+		Model        string `json:"model"`
+		SerialNumber string `json:"serialNumber"`
+	} `json:"hardware"`
+	OperatingSystem struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"operatingSystem"`
+	UserAndLocation struct {
+		Username string `json:"username"`
+		RealName string `json:"realname"`
+		Email    string `json:"email"`
+	} `json:"userAndLocation"`
+	DiskEncryption struct {
+		BootPartitionEncryptionDetails struct {
+			PartitionFileVault2State string `json:"partitionFileVault2State"`
+		} `json:"bootPartitionEncryptionDetails"`
+	} `json:"diskEncryption"`
+}
+
+// mobileRecord is the subset of /api/v2/mobile-devices/detail, the mobile
+// device inventory, used by MOE.
+type mobileRecord struct {
+	ID      string `json:"mobileDeviceId"`
+	Type    string `json:"deviceType"` // "iOS", "tvOS"
+	General struct {
+		DisplayName             string `json:"displayName"`
+		OSVersion               string `json:"osVersion"`
+		LastInventoryUpdateDate string `json:"lastInventoryUpdateDate"`
+	} `json:"general"`
+	Hardware struct {
+		Model        string `json:"model"`
+		SerialNumber string `json:"serialNumber"`
+	} `json:"hardware"`
+	UserAndLocation struct {
+		Username string `json:"username"`
+		RealName string `json:"realName"`
+		Email    string `json:"emailAddress"`
+	} `json:"userAndLocation"`
+}
+
+// SyncDevices fetches one page of devices. Computers are synced first, then
+// mobile devices; the returned cursor moves between them. Jamf Pro has no
+// device compliance state of its own (that comes from Intune's compliance
+// partner integration), so Compliance is always "unknown".
+func (p *Provider) SyncDevices(ctx context.Context, cursor string) ([]provider.SyncDevice, string, error) {
+	phase, page, err := parseCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var (
+		devices []provider.SyncDevice
+		total   int
+	)
+	switch phase {
+	case phaseComputers:
+		q := url.Values{
+			"section":   {"GENERAL", "HARDWARE", "OPERATING_SYSTEM", "USER_AND_LOCATION", "DISK_ENCRYPTION"},
+			"page":      {strconv.Itoa(page)},
+			"page-size": {strconv.Itoa(pageSize)},
+			"sort":      {"general.name:asc"},
+		}
+		var resp inventoryPage[computerRecord]
+		if err := p.getJSON(ctx, "/api/v2/computers-inventory?"+q.Encode(), &resp); err != nil {
+			return nil, "", fmt.Errorf("sync computers: %w", err)
+		}
+		total = resp.TotalCount
+		devices = make([]provider.SyncDevice, 0, len(resp.Results))
+		for _, c := range resp.Results {
+			devices = append(devices, computerToDevice(c))
+		}
+	case phaseMobile:
+		q := url.Values{
+			"section":   {"GENERAL", "HARDWARE", "USER_AND_LOCATION"},
+			"page":      {strconv.Itoa(page)},
+			"page-size": {strconv.Itoa(pageSize)},
+			"sort":      {"displayName:asc"},
+		}
+		var resp inventoryPage[mobileRecord]
+		if err := p.getJSON(ctx, "/api/v2/mobile-devices/detail?"+q.Encode(), &resp); err != nil {
+			return nil, "", fmt.Errorf("sync mobile devices: %w", err)
+		}
+		total = resp.TotalCount
+		devices = make([]provider.SyncDevice, 0, len(resp.Results))
+		for _, m := range resp.Results {
+			devices = append(devices, mobileToDevice(m))
+		}
+	}
+
+	next := ""
+	switch {
+	case (page+1)*pageSize < total:
+		next = fmt.Sprintf("%s:%d", phase, page+1)
+	case phase == phaseComputers:
+		next = phaseMobile + ":0"
+	}
+
+	log.Printf("[jamf:%s] synced %s page %d: %d devices, has_next=%v", p.config.Name, phase, page, len(devices), next != "")
+	return devices, next, nil
+}
+
+// parseCursor splits a SyncDevices cursor. An empty cursor is the first
+// computers page.
+func parseCursor(cursor string) (string, int, error) {
+	if cursor == "" {
+		return phaseComputers, 0, nil
+	}
+	phase, pageStr, ok := strings.Cut(cursor, ":")
+	page, err := strconv.Atoi(pageStr)
+	if !ok || err != nil || page < 0 || (phase != phaseComputers && phase != phaseMobile) {
+		return "", 0, fmt.Errorf("invalid sync cursor %q", cursor)
+	}
+	return phase, page, nil
+}
+
+func computerToDevice(c computerRecord) provider.SyncDevice {
+	d := provider.SyncDevice{
+		SourceID:        "computer-" + c.ID,
+		DeviceName:      c.General.Name,
+		OS:              "macOS",
+		OSVersion:       c.OperatingSystem.Version,
+		Model:           c.Hardware.Model,
+		Serial:          c.Hardware.SerialNumber,
+		UserName:        c.UserAndLocation.RealName,
+		UserEmail:       c.UserAndLocation.Email,
+		Compliance:      "unknown",
+		IsEncrypted:     c.DiskEncryption.BootPartitionEncryptionDetails.PartitionFileVault2State == "ENCRYPTED",
+		IsSupervised:    c.General.Supervised,
+		Ownership:       "unknown",
+		ManagementAgent: "jamf",
+	}
+	if d.UserName == "" {
+		d.UserName = c.UserAndLocation.Username
+	}
+	if c.General.EnrolledViaAutomatedDeviceEnrollment {
+		d.Ownership = "corporate"
+	}
+	if t, err := time.Parse(time.RFC3339, c.General.LastContactTime); err == nil {
+		d.LastSeen = &t
+	}
+	if t, err := time.Parse(time.RFC3339, c.General.LastEnrolledDate); err == nil {
+		d.EnrolledAt = &t
+	}
+	return d
+}
+
+func mobileToDevice(m mobileRecord) provider.SyncDevice {
+	d := provider.SyncDevice{
+		SourceID:        "mobile-" + m.ID,
+		DeviceName:      m.General.DisplayName,
+		OS:              normalizeMobileOS(m.Type),
+		OSVersion:       m.General.OSVersion,
+		Model:           m.Hardware.Model,
+		Serial:          m.Hardware.SerialNumber,
+		UserName:        m.UserAndLocation.RealName,
+		UserEmail:       m.UserAndLocation.Email,
+		Compliance:      "unknown",
+		Ownership:       "unknown",
+		ManagementAgent: "jamf",
+	}
+	if d.UserName == "" {
+		d.UserName = m.UserAndLocation.Username
+	}
+	if t, err := time.Parse(time.RFC3339, m.General.LastInventoryUpdateDate); err == nil {
+		d.LastSeen = &t
+	}
+	return d
+}
+
+// normalizeMobileOS maps a Jamf mobile device type to MOE's OS names.
+// iPadOS is reported as "ios" and, as with Intune, folds into "iOS".
+func normalizeMobileOS(deviceType string) string {
+	switch strings.ToLower(deviceType) {
+	case "ios", "ipados", "":
+		return "iOS"
+	case "tvos":
+		return "tvOS"
+	default:
+		return deviceType
+	}
+}
+
+// ── Commands ────────────────────────────────────────────────────────────
+
+// SendCommand is not yet supported for Jamf Pro; MDM commands are a later
+// phase.
+func (p *Provider) SendCommand(ctx context.Context, sourceDeviceID string, cmd provider.Command) (string, error) {
+	return "", fmt.Errorf("jamf: device commands are not supported yet")
+}
+
+// CheckCommandStatus is not yet supported for Jamf Pro.
+func (p *Provider) CheckCommandStatus(ctx context.Context, commandID string) (provider.CommandStatus, error) {
+	return provider.CommandStatus{}, fmt.Errorf("jamf: device commands are not supported yet")
+}
+
+// ── HTTP helpers ────────────────────────────────────────────────────────
+
+// getJSON issues an authenticated GET for path (relative to the base URL)
+// and decodes the JSON response into v.
+func (p *Provider) getJSON(ctx context.Context, path string, v any) error {
+	token, err := p.tokens.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("get token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("jamf API error (HTTP %d): %s", resp.StatusCode, truncate(string(body), 500))
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("parse response: %w", err)
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "…"
+}
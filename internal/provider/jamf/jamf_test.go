@@ -0,0 +1,104 @@
+package jamf
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSyncDevicesPagesComputersThenMobile(t *testing.T) {
+	tokenCalls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/auth/token", func(w http.ResponseWriter, r *http.Request) {
+		tokenCalls++
+		if user, pass, ok := r.BasicAuth(); !ok || user != "client" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"token": "tok", "expires": "2099-01-01T00:00:00Z"})
+	})
+	mux.HandleFunc("GET /api/v2/computers-inventory", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"totalCount": 1,
+			"results": []map[string]any{{
+				"id": "7",
+				"general": map[string]any{
+					"name":                                 "mac-01",
+					"lastContactTime":                      "2026-01-02T03:04:05Z",
+					"enrolledViaAutomatedDeviceEnrollment": true,
+				},
+				"hardware":        map[string]any{"serialNumber": "C02XK0AAJGH5"},
+				"operatingSystem": map[string]any{"version": "15.1"},
+				"diskEncryption": map[string]any{
+					"bootPartitionEncryptionDetails": map[string]any{"partitionFileVault2State": "ENCRYPTED"},
+				},
+			}},
+		})
+	})
+	mux.HandleFunc("GET /api/v2/mobile-devices/detail", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"totalCount": 1,
+			"results": []map[string]any{{
+				"mobileDeviceId": "9",
+				"deviceType":     "iOS",
+				"general": map[string]any{
+					"displayName":             "ipad-01",
+					"osVersion":               "17.4",
+					"lastInventoryUpdateDate": "2026-01-03T04:05:06Z",
+				},
+				"hardware": map[string]any{"model": "iPad Air", "serialNumber": "DMPX1234"},
+			}},
+		})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	p := New(Config{Name: "jamf-test", BaseURL: srv.URL + "/", ClientID: "client", ClientSecret: "secret", HTTPClient: srv.Client()})
+	ctx := context.Background()
+
+	if err := p.TestConnection(ctx); err != nil {
+		t.Fatalf("TestConnection: %v", err)
+	}
+
+	computers, next, err := p.SyncDevices(ctx, "")
+	if err != nil {
+		t.Fatalf("SyncDevices computers: %v", err)
+	}
+	if next != "mobile:0" {
+		t.Fatalf("next = %q, want mobile:0", next)
+	}
+	if len(computers) != 1 || computers[0].OS != "macOS" || !computers[0].IsEncrypted || computers[0].Ownership != "corporate" || computers[0].LastSeen == nil || computers[0].Serial != "C02XK0AAJGH5" {
+		t.Errorf("computers = %+v, want one encrypted corporate macOS device", computers)
+	}
+
+	mobile, next, err := p.SyncDevices(ctx, next)
+	if err != nil {
+		t.Fatalf("SyncDevices mobile: %v", err)
+	}
+	if next != "" {
+		t.Errorf("next = %q, want end of sync", next)
+	}
+	if len(mobile) != 1 || mobile[0].OS != "iOS" || mobile[0].SourceID != "mobile-9" || mobile[0].DeviceName != "ipad-01" {
+		t.Fatalf("mobile = %+v, want one iOS device", mobile)
+	}
+	if m := mobile[0]; m.OSVersion != "17.4" || m.Serial != "DMPX1234" || m.LastSeen == nil {
+		t.Errorf("mobile = %+v, want its OS version, serial and last-seen time", m)
+	}
+	if tokenCalls != 1 {
+		t.Errorf("token requests = %d, want 1 (cached)", tokenCalls)
+	}
+}
+
+func TestParseCursorRejectsGarbage(t *testing.T) {
+	for _, c := range []string{"printers:0", "mobile:x", "mobile", "computers:-1"} {
+		if _, _, err := parseCursor(c); err == nil {
+			t.Errorf("parseCursor(%q) succeeded, want error", c)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package jamf
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// tokenCache handles Jamf Pro bearer token acquisition and caching via
+// POST /api/v1/auth/token with HTTP Basic credentials.
+type tokenCache struct {
+	baseURL      string // e.g. "https://acme.jamfcloud.com"
+	clientID     string
+	clientSecret string
+	client       *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+type tokenResponse struct {
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+func newTokenCache(baseURL, clientID, clientSecret string, client *http.Client) *tokenCache {
+	return &tokenCache{
+		baseURL:      baseURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		client:       client,
+	}
+}
+
+// Token returns a valid bearer token, refreshing if expired or missing.
+func (tc *tokenCache) Token(ctx context.Context) (string, error) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	// Jamf tokens last 30 minutes by default; refresh with a 1 min buffer.
+	if tc.token != "" && time.Now().Before(tc.expires.Add(-time.Minute)) {
+		return tc.token, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", tc.baseURL+"/api/v1/auth/token", nil)
+	if err != nil {
+		return "", fmt.Errorf("create token request: %w", err)
+	}
+	req.SetBasicAuth(tc.clientID, tc.clientSecret)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := tc.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request failed (HTTP %d): %s", resp.StatusCode, truncate(string(body), 300))
+	}
+
+	var tr tokenResponse
+	if err := json.Unmarshal(body, &tr); err != nil {
+		return "", fmt.Errorf("parse token response: %w", err)
+	}
+	if tr.Token == "" {
+		return "", fmt.Errorf("token response missing token")
+	}
+	if tr.Expires.IsZero() {
+		tr.Expires = time.Now().Add(20 * time.Minute)
+	}
+
+	tc.token = tr.Token
+	tc.expires = tr.Expires
+	return tc.token, nil
+}
@@ -2,6 +2,7 @@ package provider
 
 import (
 	"context"
+	"strings"
 	"time"
 )
 
@@ -10,7 +11,7 @@ import (
 type Provider interface {
 	// Identity
 	Name() string // Unique name matching ProviderConfig.Name, e.g. "intune-corp"
-	Type() string // "uem" or "intune"
+	Type() string // "uem", "intune" or "jamf"
 
 	// ── Connectivity ────────────────────────────────────────────────────
 	// TestConnection performs a lightweight connectivity check (e.g. acquire
@@ -33,19 +34,24 @@ type Provider interface {
 // SyncDevice is the normalised device record returned by a provider during sync.
 // The sync engine maps this to the internal Device model.
 type SyncDevice struct {
-	SourceID     string
-	DeviceName   string
-	OS           string
-	OSVersion    string
-	Model        string
-	UserName     string
-	UserEmail    string
-	Compliance   string // "compliant", "non-compliant", "unknown"
-	IsEncrypted  bool
-	JailBroken   string
-	IsSupervised bool
-	ThreatState  string
-	LastSeen     *time.Time
+	SourceID        string
+	DeviceName      string
+	OS              string
+	OSVersion       string
+	Model           string
+	Serial          string
+	IMEI            string // IMEI, or MEID for CDMA devices
+	UserName        string
+	UserEmail       string
+	Compliance      string // "compliant", "non-compliant", "unknown"
+	IsEncrypted     bool
+	JailBroken      string
+	IsSupervised    bool
+	ThreatState     string
+	LastSeen        *time.Time
+	Ownership       string // "corporate", "personal", "unknown"
+	ManagementAgent string
+	EnrolledAt      *time.Time
 }
 
 // Command represents an action to send to a device.
@@ -54,6 +60,22 @@ type Command struct {
 	Params map[string]string // action-specific parameters
 }
 
+// CommandActions lists the device actions a Command may carry.
+var CommandActions = []string{
+	"reboot", "lock", "sync", "retire", "wipe", "resetPasscode",
+	"shutDown", "windowsDefenderScan", "windowsDefenderUpdateSignatures",
+}
+
+// IsCommandAction reports whether action is one of CommandActions.
+func IsCommandAction(action string) bool {
+	for _, a := range CommandActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
 // CommandStatus represents the current state of a previously sent command.
 type CommandStatus struct {
 	ID        string
@@ -67,10 +89,70 @@ type CommandStatus struct {
 // PolicyProvider is an optional interface for providers that can fetch policies.
 // Separate from Provider because not all backends may support policy retrieval.
 type PolicyProvider interface {
-	// SyncPolicies fetches all policies from the provider.
-	// The progress callback is invoked as each category is fetched with
-	// (categoryName, itemsFetchedSoFar). Pass nil if no progress is needed.
-	SyncPolicies(ctx context.Context, progress func(category string, count int)) ([]SyncPolicy, error)
+	// SyncPolicies fetches the policies selected by opts from the provider,
+	// along with how they were fetched and which categories came back
+	// populated. The progress callback is invoked as each category is
+	// fetched with (categoryName, itemsFetchedSoFar). Pass nil if no
+	// progress is needed.
+	SyncPolicies(ctx context.Context, opts PolicySyncOptions, progress func(category string, count int)) ([]SyncPolicy, PolicyProvenance, error)
+}
+
+// PolicySyncOptions narrows what a SyncPolicies run captures. The zero
+// value captures everything.
+type PolicySyncOptions struct {
+	// Categories limits the run to these policy categories. Empty means all.
+	Categories []string
+}
+
+// IncludesCategory reports whether a provider category is selected.
+// Names compare case-insensitively, and either may be a whole-word prefix
+// of the other. Providers name the same area differently depending on the
+// API path, so "Compliance" selects the legacy "Compliance Policies" and
+// "Compliance Scripts" endpoints, and "Compliance Policies" still selects
+// UTCM's broader "Compliance" resources.
+func (o PolicySyncOptions) IncludesCategory(category string) bool {
+	if len(o.Categories) == 0 {
+		return true
+	}
+	c := strings.ToLower(category)
+	for _, sel := range o.Categories {
+		s := strings.ToLower(strings.TrimSpace(sel))
+		if s == "" {
+			continue
+		}
+		if c == s || strings.HasPrefix(c, s+" ") || strings.HasPrefix(s, c+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyProvenance describes how a SyncPolicies run produced its result.
+type PolicyProvenance struct {
+	// CaptureMethod identifies the API path used. The same policy can be
+	// shaped differently depending on the path, so snapshots record it to
+	// flag cross-method comparisons.
+	CaptureMethod string
+	// Coverage lists every category the run attempted, in request order.
+	Coverage []CategoryCoverage
+	// FailedResources lists the resource types a partially successful
+	// capture could not fetch, each as "<resource type>: <reason>". Empty
+	// when the capture was complete.
+	FailedResources []string
+}
+
+// Policy capture methods for PolicyProvenance.CaptureMethod.
+const (
+	CaptureMethodUTCM   = "utcm"   // Intune UTCM configuration snapshot
+	CaptureMethodLegacy = "legacy" // per-endpoint Graph collections
+)
+
+// CategoryCoverage is one attempted category's outcome. A category with no
+// policies and no Error was fetched successfully and is genuinely empty.
+type CategoryCoverage struct {
+	Category string
+	Count    int    // policies returned
+	Error    string // why some or all of the category could not be fetched
 }
 
 // SyncPolicy is the normalised policy record returned by a provider during sync.
@@ -82,6 +164,14 @@ type SyncPolicy struct {
 	Platform     string // "Windows", "iOS", "Android", "All", ""
 	Description  string
 	SettingsJSON string // serialised JSON blob of all settings/properties
+	// SettingsError is set when the policy's settings could not be fetched
+	// (e.g. the Settings Catalog /settings sub-resource failed), so its
+	// SettingsJSON holds metadata only.
+	SettingsError string
+	// ScopeTags names the role scope tags that segment who administers the
+	// policy (Intune), sorted. A tag whose name couldn't be looked up keeps
+	// its ID.
+	ScopeTags []string
 }
 
 // SyncPolicySetting is a flattened key/value pair from a policy's settings JSON.
@@ -89,3 +179,14 @@ type SyncPolicySetting struct {
 	Name  string
 	Value string
 }
+
+// PolicyAssignment is one target a policy is assigned to, as captured from
+// the source system. Intune records these under the "_assignments" key of
+// SettingsJSON.
+type PolicyAssignment struct {
+	Target     string `json:"target"` // "group", "exclusionGroup", "allDevices", "allLicensedUsers"
+	GroupID    string `json:"groupId,omitempty"`
+	GroupName  string `json:"groupName,omitempty"`
+	FilterID   string `json:"filterId,omitempty"`
+	FilterType string `json:"filterType,omitempty"` // "include" or "exclude"
+}
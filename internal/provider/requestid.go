@@ -0,0 +1,24 @@
+package provider
+
+import "context"
+
+// requestIDKey is the context key for the ID of the HTTP request that led to
+// a provider call.
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID id, so a
+// provider can tag its log lines with the UI or API request that triggered
+// them. An empty id returns ctx unchanged.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "" if there is none,
+// as for scheduled work.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dan/moe/internal/models"
+)
+
+// ── Alerts ──────────────────────────────────────────────────────────────
+
+// notify is the one path a provider alert takes: a background failure
+// (kind "error") or a recovery from one (kind "success"), so the incident a
+// failure opened is closed in the same place. The event goes to the activity
+// log with kind as its type. While the provider is silenced it is written to
+// the server log only, so planned work does not flood the console. Any
+// further sink belongs here so that silencing covers it too. Status tracking
+// is unaffected either way.
+func (s *Server) notify(cfg *models.ProviderConfig, kind, format string, args ...any) {
+	if cfg.IsSilenced() {
+		log.Printf("[alerts] %s silenced until %s — suppressed %s: %s",
+			cfg.Name, cfg.SilencedUntil.Format(time.RFC3339), kind, fmt.Sprintf(format, args...))
+		return
+	}
+	s.activity.Logf(cfg.Name, kind, format, args...)
+}
+
+// isRecovery reports whether a successful health check ends an outage: the
+// stored config counts failed checks, or the last tracked status (read
+// before this check marked the provider "checking") was an error.
+func isRecovery(prev *ProviderStatus, consecFails int) bool {
+	return consecFails > 0 || (prev != nil && prev.Status == "error")
+}
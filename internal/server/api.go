@@ -1,16 +1,25 @@
 package server
 
 import (
+	"archive/zip"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dan/moe/internal/models"
 	"github.com/dan/moe/internal/provider"
+	"github.com/dan/moe/internal/provider/intune"
+	"github.com/dan/moe/internal/store"
 )
 
 // ── JSON helpers ────────────────────────────────────────────────────────
@@ -35,16 +44,60 @@ func jsonError(w http.ResponseWriter, status int, msg string) {
 
 // ── Devices ─────────────────────────────────────────────────────────────
 
-// GET /api/v1/devices?provider=&os=&compliance=&q=&limit=&offset=
+// apiDevice is a device as the API returns it: the stored fields plus its
+// staleness, computed from LastSeen when the response is built.
+type apiDevice struct {
+	models.Device
+	StaleDays int  `json:"stale_days"` // whole days since last seen; 0 if never seen
+	IsStale   bool `json:"is_stale"`   // not seen for Config.StaleDeviceDays or more
+}
+
+// deviceStaleness returns how many whole days ago a device was last seen
+// and whether that makes it stale. A device never seen isn't stale, matching
+// the stale_days filter.
+func (s *Server) deviceStaleness(lastSeen *time.Time, now time.Time) (days int, stale bool) {
+	if lastSeen == nil {
+		return 0, false
+	}
+	days = int(now.Sub(*lastSeen) / (24 * time.Hour))
+	return days, days >= s.cfg.StaleDeviceDays
+}
+
+// toAPIDevice wraps a device with its staleness as of now.
+func (s *Server) toAPIDevice(d models.Device, now time.Time) apiDevice {
+	ad := apiDevice{Device: d}
+	ad.StaleDays, ad.IsStale = s.deviceStaleness(d.LastSeen, now)
+	return ad
+}
+
+// apiDevices wraps devices with their staleness for an API response.
+func (s *Server) apiDevices(devices []models.Device) []apiDevice {
+	now := time.Now()
+	out := make([]apiDevice, len(devices))
+	for i, d := range devices {
+		out[i] = s.toAPIDevice(d, now)
+	}
+	return out
+}
+
+// GET /api/v1/devices?provider=&os=&compliance=&ownership=&agent=&q=&flagged=&tag=&status=&stale_days=&os_version_min=&os_version_max=&sort=&dir=&limit=&offset=
+// sort is one of device_name, provider_name, os, compliance, last_seen,
+// enrolled_at or updated_at (the default); dir is asc or desc (the default).
+// os_version_min is inclusive and os_version_max exclusive, so
+// os=iOS&os_version_max=17 lists iOS devices not yet on 17.
 func (s *Server) apiListDevices(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
-	f := models.DeviceFilter{
-		ProviderName: q.Get("provider"),
-		OS:           q.Get("os"),
-		Compliance:   q.Get("compliance"),
-		Search:       q.Get("q"),
-		Limit:        queryInt(q, "limit", 200),
-		Offset:       queryInt(q, "offset", 0),
+	f := deviceFilterFromQuery(q)
+	f.Limit = queryInt(q, "limit", 200)
+	f.Offset = queryInt(q, "offset", 0)
+
+	if !store.ValidDeviceSort(f.SortBy, f.SortDir) {
+		jsonError(w, http.StatusBadRequest, "invalid sort or dir")
+		return
+	}
+	if msg := invalidVersionBounds(f); msg != "" {
+		jsonError(w, http.StatusBadRequest, msg)
+		return
 	}
 
 	devices, total, err := s.devices.List(f)
@@ -54,11 +107,131 @@ func (s *Server) apiListDevices(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jsonOK(w, map[string]any{
-		"devices": devices,
+	resp := map[string]any{
+		"devices": s.apiDevices(devices),
 		"total":   total,
 		"limit":   f.Limit,
 		"offset":  f.Offset,
+	}
+	addPageNav(w, r, resp, total, f.Limit, f.Offset)
+	jsonOK(w, resp)
+}
+
+// DELETE /api/v1/devices?provider=&os=&compliance=&ownership=&agent=&q=&flagged=&tag=&status=&stale_days=&os_version_min=&os_version_max=
+// Deletes every device matching the filter, which takes the same parameters
+// as the device list, and returns how many were deleted. At least one filter
+// is required so a bare DELETE can't wipe the cache.
+func (s *Server) apiDeleteDevices(w http.ResponseWriter, r *http.Request) {
+	f := deviceFilterFromQuery(r.URL.Query())
+	if msg := invalidVersionBounds(f); msg != "" {
+		jsonError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	n, err := s.devices.DeleteByFilter(f)
+	if errors.Is(err, store.ErrEmptyDeviceFilter) {
+		jsonError(w, http.StatusBadRequest, "at least one filter is required")
+		return
+	}
+	if err != nil {
+		log.Printf("[api] delete devices error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to delete devices")
+		return
+	}
+
+	s.auditf(r, "delete", auditDevice, "", "%d devices matching %s", n, r.URL.RawQuery)
+	jsonOK(w, map[string]any{"deleted": n})
+}
+
+// apiDeviceStats is the JSON shape returned by the device stats endpoint.
+type apiDeviceStats struct {
+	Total        int            `json:"total"`
+	ByOS         map[string]int `json:"by_os"` // "" counts devices with no OS recorded
+	ByCompliance map[string]int `json:"by_compliance"`
+	ByProvider   map[string]int `json:"by_provider"`
+	ByOwnership  map[string]int `json:"by_ownership"`
+}
+
+// GET /api/v1/devices/stats — device counts by OS, compliance, provider and
+// ownership in one response, for dashboards that don't need the devices.
+func (s *Server) apiDeviceStats(w http.ResponseWriter, r *http.Request) {
+	var (
+		stats apiDeviceStats
+		errs  [5]error
+	)
+	stats.Total, errs[0] = s.devices.Count()
+	stats.ByOS, errs[1] = s.devices.CountByOS()
+	stats.ByCompliance, errs[2] = s.devices.ComplianceBreakdown()
+	stats.ByProvider, errs[3] = s.devices.CountByProvider()
+	stats.ByOwnership, errs[4] = s.devices.CountByOwnership()
+	if err := errors.Join(errs[:]...); err != nil {
+		log.Printf("[api] device stats error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to count devices")
+		return
+	}
+	jsonOK(w, stats)
+}
+
+// GET /api/v1/devices/stale?days=30
+// Devices last seen more than days ago (default Config.StaleDeviceDays). Accepts the
+// same filter and paging parameters as the device list.
+func (s *Server) apiListStaleDevices(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := deviceFilterFromQuery(q)
+	f.StaleDays = queryInt(q, "days", s.cfg.StaleDeviceDays)
+	f.Limit = queryInt(q, "limit", 200)
+	f.Offset = queryInt(q, "offset", 0)
+
+	if msg := invalidVersionBounds(f); msg != "" {
+		jsonError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	devices, total, err := s.devices.List(f)
+	if err != nil {
+		log.Printf("[api] list stale devices error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to list stale devices")
+		return
+	}
+
+	resp := map[string]any{
+		"devices":      s.apiDevices(devices),
+		"total":        total,
+		"days":         f.StaleDays,
+		"stale_before": time.Now().AddDate(0, 0, -f.StaleDays).UTC(),
+		"limit":        f.Limit,
+		"offset":       f.Offset,
+	}
+	addPageNav(w, r, resp, total, f.Limit, f.Offset)
+	jsonOK(w, resp)
+}
+
+// GET /api/v1/devices/changes?since=2024-05-01T00:00:00Z
+// Devices whose compliance or encryption state a sync changed since the
+// given RFC 3339 time, most recent first. since defaults to
+// recentChangeWindow ago.
+func (s *Server) apiListChangedDevices(w http.ResponseWriter, r *http.Request) {
+	since := time.Now().Add(-recentChangeWindow)
+	if v := r.URL.Query().Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, "invalid since; expected an RFC 3339 time such as 2024-05-01T00:00:00Z")
+			return
+		}
+		since = t
+	}
+
+	devices, err := s.devices.RecentlyChanged(since)
+	if err != nil {
+		log.Printf("[api] list changed devices error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to list changed devices")
+		return
+	}
+
+	jsonOK(w, map[string]any{
+		"devices": s.apiDevices(devices),
+		"total":   len(devices),
+		"since":   since.UTC(),
 	})
 }
 
@@ -75,7 +248,491 @@ func (s *Server) apiGetDevice(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusNotFound, "device not found")
 		return
 	}
-	jsonOK(w, device)
+	if device.Tags, err = s.devices.TagsForDevice(id); err != nil {
+		log.Printf("[api] get device tags error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to get device tags")
+		return
+	}
+	jsonOK(w, s.toAPIDevice(*device, time.Now()))
+}
+
+// POST /api/v1/devices/{id}/tags  {"tag": "kiosk"}
+// Tags are lower-cased; adding one the device already has is a no-op.
+// Responds with the device's tags.
+func (s *Server) apiAddDeviceTag(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Tag string `json:"tag"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	tag, ok := cleanTag(body.Tag)
+	if !ok {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("'tag' must be 1-%d characters", maxTagLength))
+		return
+	}
+
+	id := r.PathValue("id")
+	device, err := s.devices.GetByID(id)
+	if err != nil {
+		log.Printf("[api] tag device error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to get device")
+		return
+	}
+	if device == nil {
+		jsonError(w, http.StatusNotFound, "device not found")
+		return
+	}
+	if err := s.devices.AddTag(id, tag); err != nil {
+		log.Printf("[api] tag device error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to tag device")
+		return
+	}
+	s.auditf(r, "tag", auditDevice, id, "%s tagged %q", device.DeviceName, tag)
+	s.writeDeviceTags(w, id)
+}
+
+// DELETE /api/v1/devices/{id}/tags/{tag}
+// Responds with the device's remaining tags, or 404 if it didn't have tag.
+func (s *Server) apiRemoveDeviceTag(w http.ResponseWriter, r *http.Request) {
+	tag, _ := cleanTag(r.PathValue("tag"))
+	id := r.PathValue("id")
+	removed, err := s.devices.RemoveTag(id, tag)
+	if err != nil {
+		log.Printf("[api] untag device error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to remove tag")
+		return
+	}
+	if !removed {
+		jsonError(w, http.StatusNotFound, "device does not have that tag")
+		return
+	}
+	s.auditf(r, "untag", auditDevice, id, "removed tag %q", tag)
+	s.writeDeviceTags(w, id)
+}
+
+// writeDeviceTags responds with a device's ID and current tags.
+func (s *Server) writeDeviceTags(w http.ResponseWriter, id string) {
+	tags, err := s.devices.TagsForDevice(id)
+	if err != nil {
+		log.Printf("[api] list device tags error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to list device tags")
+		return
+	}
+	jsonOK(w, map[string]any{"id": id, "tags": tags})
+}
+
+// POST /api/v1/devices/{id}/flag  {"flagged": true}
+// An empty body toggles the current flag.
+func (s *Server) apiFlagDevice(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Flagged *bool `json:"flagged"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	device, err := s.toggleDeviceFlag(r.PathValue("id"), body.Flagged)
+	if err != nil {
+		log.Printf("[api] flag device error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to flag device")
+		return
+	}
+	if device == nil {
+		jsonError(w, http.StatusNotFound, "device not found")
+		return
+	}
+	s.auditDeviceFlag(r, device)
+	jsonOK(w, map[string]any{"id": device.ID, "flagged": device.Flagged})
+}
+
+// GET /api/v1/devices/export/csv?provider=&os=&compliance=&ownership=&agent=&q=&sort=&dir=
+func (s *Server) apiExportDevicesCSV(w http.ResponseWriter, r *http.Request) {
+	devices, err := s.devices.ListAll(deviceFilterFromQuery(r.URL.Query()))
+	if err != nil {
+		log.Printf("[api] export devices csv error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to list devices")
+		return
+	}
+
+	fname := fmt.Sprintf("moe-devices-%s.csv", time.Now().UTC().Format("20060102"))
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fname))
+
+	cw := csv.NewWriter(w)
+	defer cw.Flush()
+
+	// Header row
+	cw.Write([]string{"DeviceName", "OS", "OSVersion", "Model", "UserName", "UserEmail", "Compliance", "IsEncrypted", "JailBroken", "LastSeen", "StaleDays", "IsStale", "ProviderName", "SourceID",
+		"Serial", "IMEI", "Ownership", "ManagementAgent", "EnrolledAt", "IsSupervised", "ThreatState"})
+
+	now := time.Now()
+	for _, d := range devices {
+		lastSeen, enrolledAt := "", ""
+		if d.LastSeen != nil {
+			lastSeen = d.LastSeen.UTC().Format(time.RFC3339)
+		}
+		if d.EnrolledAt != nil {
+			enrolledAt = d.EnrolledAt.UTC().Format(time.RFC3339)
+		}
+		staleDays, stale := s.deviceStaleness(d.LastSeen, now)
+		cw.Write([]string{
+			d.DeviceName,
+			d.OS,
+			d.OSVersion,
+			d.Model,
+			d.UserName,
+			d.UserEmail,
+			d.Compliance,
+			strconv.FormatBool(d.IsEncrypted),
+			d.JailBroken,
+			lastSeen,
+			strconv.Itoa(staleDays),
+			strconv.FormatBool(stale),
+			d.ProviderName,
+			d.SourceID,
+			d.Serial,
+			d.IMEI,
+			d.Ownership,
+			d.ManagementAgent,
+			enrolledAt,
+			strconv.FormatBool(d.IsSupervised),
+			d.ThreatState,
+		})
+	}
+}
+
+// maxDeviceImportBytes bounds a device CSV upload.
+const maxDeviceImportBytes = 16 << 20
+
+// deviceImportColumns are the columns a device CSV import reads, matched
+// case-insensitively. They are the export's columns: ProviderName and
+// SourceID identify the device, and the computed StaleDays and IsStale are
+// accepted but ignored, so an export can be edited and imported again.
+var deviceImportColumns = []string{
+	"ProviderName", "SourceID", "DeviceName", "OS", "OSVersion", "Model", "Serial", "IMEI",
+	"UserName", "UserEmail", "Compliance", "Ownership", "IsEncrypted", "JailBroken", "LastSeen",
+	"ManagementAgent", "EnrolledAt", "IsSupervised", "ThreatState",
+	"StaleDays", "IsStale",
+}
+
+// deviceImportRow is a CSV row that passed validation.
+type deviceImportRow struct {
+	Line    int // line in the file; the header is line 1
+	Device  models.Device
+	Columns map[string]bool // the file's columns, shared by every row
+}
+
+// deviceImportError is a CSV row that was not imported, and why.
+type deviceImportError struct {
+	Line     int    `json:"line"`
+	SourceID string `json:"source_id,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// deviceImportResult is the response to a device CSV import.
+type deviceImportResult struct {
+	Created int                 `json:"created"`
+	Updated int                 `json:"updated"`
+	Skipped int                 `json:"skipped"`
+	Errors  []deviceImportError `json:"errors"`
+}
+
+// parseDeviceCSV reads and validates an uploaded device CSV. Rows without a
+// ProviderName column or value belong to defaultProvider. A row that fails
+// validation is returned as an error and the rest carry on; the returned
+// error is for a file that can't be read at all, and is meant for the client.
+func parseDeviceCSV(rd io.Reader, defaultProvider string) ([]deviceImportRow, []deviceImportError, error) {
+	cr := csv.NewReader(rd)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil, errors.New("the CSV file is empty")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	col := map[string]int{}
+	columns := map[string]bool{}
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")) // Excel writes a BOM
+		j := slices.IndexFunc(deviceImportColumns, func(c string) bool { return strings.EqualFold(c, name) })
+		if j < 0 {
+			return nil, nil, fmt.Errorf("unknown column %q", name)
+		}
+		col[deviceImportColumns[j]] = i
+		columns[deviceImportColumns[j]] = true
+	}
+	for _, required := range []string{"SourceID", "DeviceName"} {
+		if _, ok := col[required]; !ok {
+			return nil, nil, fmt.Errorf("missing column %s", required)
+		}
+	}
+	if _, ok := col["ProviderName"]; !ok && defaultProvider == "" {
+		return nil, nil, errors.New("missing column ProviderName; add it or choose a provider for every row")
+	}
+
+	var (
+		rows []deviceImportRow
+		errs []deviceImportError
+		seen = map[[2]string]int{} // (provider, source ID) → line
+	)
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		if len(rec) == 1 && strings.TrimSpace(rec[0]) == "" {
+			continue
+		}
+		field := func(name string) string {
+			if i, ok := col[name]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		d, reason := deviceFromCSV(field, defaultProvider)
+		if reason == "" && len(rec) != len(header) {
+			reason = fmt.Sprintf("has %d fields, the header has %d", len(rec), len(header))
+		}
+		if reason == "" {
+			key := [2]string{d.ProviderName, d.SourceID}
+			if prev, dup := seen[key]; dup {
+				reason = fmt.Sprintf("duplicates line %d", prev)
+			} else {
+				seen[key] = line
+			}
+		}
+		if reason != "" {
+			errs = append(errs, deviceImportError{Line: line, SourceID: field("SourceID"), Reason: reason})
+			continue
+		}
+		rows = append(rows, deviceImportRow{Line: line, Device: d, Columns: columns})
+	}
+	return rows, errs, nil
+}
+
+// deviceFromCSV builds a device from one CSV row's fields, returning why the
+// row is invalid, or "".
+func deviceFromCSV(field func(string) string, defaultProvider string) (models.Device, string) {
+	d := models.Device{
+		ProviderName:    field("ProviderName"),
+		SourceID:        field("SourceID"),
+		DeviceName:      field("DeviceName"),
+		OS:              field("OS"),
+		OSVersion:       field("OSVersion"),
+		Model:           field("Model"),
+		Serial:          field("Serial"),
+		IMEI:            field("IMEI"),
+		UserName:        field("UserName"),
+		UserEmail:       field("UserEmail"),
+		Compliance:      strings.ToLower(field("Compliance")),
+		Ownership:       strings.ToLower(field("Ownership")),
+		ThreatState:     field("ThreatState"),
+		ManagementAgent: field("ManagementAgent"),
+	}
+	if d.ProviderName == "" {
+		d.ProviderName = defaultProvider
+	}
+	switch {
+	case d.ProviderName == "":
+		return d, "ProviderName is required"
+	case d.SourceID == "":
+		return d, "SourceID is required"
+	case d.DeviceName == "":
+		return d, "DeviceName is required"
+	}
+
+	switch d.Compliance {
+	case "":
+		d.Compliance = "unknown"
+	case "compliant", "non-compliant", "unknown":
+	default:
+		return d, fmt.Sprintf("Compliance %q is not compliant, non-compliant or unknown", field("Compliance"))
+	}
+	switch d.Ownership {
+	case "":
+		d.Ownership = "unknown"
+	case "corporate", "personal", "unknown":
+	default:
+		return d, fmt.Sprintf("Ownership %q is not corporate, personal or unknown", field("Ownership"))
+	}
+	if v := field("IsEncrypted"); v != "" {
+		enc, err := strconv.ParseBool(v)
+		if err != nil {
+			return d, fmt.Sprintf("IsEncrypted %q is not true or false", v)
+		}
+		d.IsEncrypted = enc
+	}
+	if v := field("IsSupervised"); v != "" {
+		sup, err := strconv.ParseBool(v)
+		if err != nil {
+			return d, fmt.Sprintf("IsSupervised %q is not true or false", v)
+		}
+		d.IsSupervised = sup
+	}
+	switch v := strings.ToLower(field("JailBroken")); v {
+	case "":
+	case "true", "false", "unknown":
+		d.JailBroken = strings.ToUpper(v[:1]) + v[1:]
+	default:
+		return d, fmt.Sprintf("JailBroken %q is not True, False or Unknown", field("JailBroken"))
+	}
+	if v := field("LastSeen"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return d, fmt.Sprintf("LastSeen %q is not an RFC 3339 time", v)
+		}
+		t = t.UTC()
+		d.LastSeen = &t
+	}
+	if v := field("EnrolledAt"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return d, fmt.Sprintf("EnrolledAt %q is not an RFC 3339 time", v)
+		}
+		t = t.UTC()
+		d.EnrolledAt = &t
+	}
+	return d, ""
+}
+
+// mergeDeviceCSV copies into dst the fields of src that come from the given
+// CSV columns, so updating a device from a file leaves the columns it
+// doesn't have as they were.
+func mergeDeviceCSV(dst *models.Device, src models.Device, columns map[string]bool) {
+	for c := range columns {
+		switch c {
+		case "DeviceName":
+			dst.DeviceName = src.DeviceName
+		case "OS":
+			dst.OS = src.OS
+		case "OSVersion":
+			dst.OSVersion = src.OSVersion
+		case "Model":
+			dst.Model = src.Model
+		case "Serial":
+			dst.Serial = src.Serial
+		case "IMEI":
+			dst.IMEI = src.IMEI
+		case "UserName":
+			dst.UserName = src.UserName
+		case "UserEmail":
+			dst.UserEmail = src.UserEmail
+		case "Compliance":
+			dst.Compliance = src.Compliance
+		case "Ownership":
+			dst.Ownership = src.Ownership
+		case "IsEncrypted":
+			dst.IsEncrypted = src.IsEncrypted
+		case "JailBroken":
+			dst.JailBroken = src.JailBroken
+		case "LastSeen":
+			dst.LastSeen = src.LastSeen
+		case "ManagementAgent":
+			dst.ManagementAgent = src.ManagementAgent
+		case "EnrolledAt":
+			dst.EnrolledAt = src.EnrolledAt
+		case "IsSupervised":
+			dst.IsSupervised = src.IsSupervised
+		case "ThreatState":
+			dst.ThreatState = src.ThreatState
+		}
+	}
+}
+
+// POST /api/v1/devices/import/csv — create or update devices from a CSV
+// upload (multipart field "file"), for providers MOE doesn't sync. Devices
+// are matched on provider and source ID; "provider" names the provider of
+// rows that don't give one. An update only changes the columns the file
+// has. Rows for a synced provider, whose next sync would overwrite them,
+// and invalid rows are skipped and listed in errors.
+func (s *Server) apiImportDevicesCSV(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxDeviceImportBytes)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("file is larger than %d MB", maxDeviceImportBytes>>20))
+			return
+		}
+		jsonError(w, http.StatusBadRequest, `a CSV file is required in the multipart field "file"`)
+		return
+	}
+	defer file.Close()
+
+	rows, errs, err := parseDeviceCSV(file, strings.TrimSpace(r.FormValue("provider")))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	providers, err := s.providerConfigs.ListAll()
+	if err != nil {
+		log.Printf("[api] import devices csv error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to list providers")
+		return
+	}
+	types := make(map[string]string, len(providers))
+	for _, p := range providers {
+		types[p.Name] = p.Type
+	}
+	synced := provider.Types()
+
+	result := deviceImportResult{Errors: errs}
+	for _, row := range rows {
+		d := row.Device
+		d.ProviderType = types[d.ProviderName]
+		if d.ProviderType == "" {
+			d.ProviderType = "uem" // fallback, as for devices added by hand
+		}
+		if slices.Contains(synced, d.ProviderType) {
+			result.Errors = append(result.Errors, deviceImportError{Line: row.Line, SourceID: d.SourceID,
+				Reason: fmt.Sprintf("%s is synced from %s; its devices can't be imported", d.ProviderName, d.ProviderType)})
+			continue
+		}
+
+		existing, err := s.devices.GetBySource(d.ProviderName, d.SourceID)
+		if err == nil {
+			target := &d
+			if existing == nil {
+				d.ID, d.CreatedAt = newID(), time.Now().UTC()
+			} else {
+				mergeDeviceCSV(existing, d, row.Columns)
+				target = existing
+			}
+			// Upsert records compliance history and state changes and
+			// reactivates a retired device, as a sync does.
+			err = s.devices.Upsert(target)
+		}
+		if err != nil {
+			log.Printf("[api] import devices csv line %d error: %v", row.Line, err)
+			result.Errors = append(result.Errors, deviceImportError{Line: row.Line, SourceID: d.SourceID, Reason: "could not be saved"})
+			continue
+		}
+		if existing == nil {
+			result.Created++
+		} else {
+			result.Updated++
+		}
+	}
+	slices.SortFunc(result.Errors, func(a, b deviceImportError) int { return a.Line - b.Line })
+	if result.Errors == nil {
+		result.Errors = []deviceImportError{}
+	}
+	result.Skipped = len(result.Errors)
+
+	s.auditf(r, "import", auditDevice, "", "CSV, %d created, %d updated, %d skipped", result.Created, result.Updated, result.Skipped)
+	s.activity.Logf("system", "info", "Imported devices from CSV: %d created, %d updated, %d skipped", result.Created, result.Updated, result.Skipped)
+	jsonOK(w, result)
 }
 
 // ── Providers ───────────────────────────────────────────────────────────
@@ -91,6 +748,348 @@ func (s *Server) apiListProviders(w http.ResponseWriter, r *http.Request) {
 	jsonOK(w, providers)
 }
 
+// GET /api/v1/providers/{name}/sync-runs?limit=20
+func (s *Server) apiListSyncRuns(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	cfg, err := s.providerConfigs.GetByName(name)
+	if err != nil || cfg == nil {
+		jsonError(w, http.StatusNotFound, "provider not found")
+		return
+	}
+
+	runs, err := s.syncRuns.List(cfg.Name, queryInt(r.URL.Query(), "limit", 20))
+	if err != nil {
+		log.Printf("[api] list sync runs error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to list sync runs")
+		return
+	}
+	if runs == nil {
+		runs = []models.SyncRun{}
+	}
+	jsonOK(w, runs)
+}
+
+// POST /api/v1/providers/check
+// Starts a background health check of every enabled provider and returns
+// 202 at once; 409 if a sweep is already running or in maintenance mode.
+func (s *Server) apiCheckProviders(w http.ResponseWriter, r *http.Request) {
+	if err := s.startHealthSweep(); err != nil {
+		jsonError(w, http.StatusConflict, err.Error())
+		return
+	}
+	s.auditf(r, "check", auditProvider, "", "all enabled providers")
+	w.WriteHeader(http.StatusAccepted)
+	jsonOK(w, map[string]bool{"started": true})
+}
+
+// GET /api/v1/providers/{name}/latency
+// Recent successful connection check latencies in milliseconds, oldest
+// first, for trend sparklines. Samples are kept in memory only.
+func (s *Server) apiProviderLatency(w http.ResponseWriter, r *http.Request) {
+	cfg, err := s.providerConfigs.GetByName(r.PathValue("name"))
+	if err != nil || cfg == nil {
+		jsonError(w, http.StatusNotFound, "provider not found")
+		return
+	}
+
+	history := s.status.History(cfg.Name)
+	samples := make([]float64, len(history))
+	for i, d := range history {
+		samples[i] = float64(d.Microseconds()) / 1000
+	}
+	jsonOK(w, map[string]any{
+		"name":       cfg.Name,
+		"samples_ms": samples,
+	})
+}
+
+// PUT /api/v1/providers/{id}/silence  {"until": "RFC3339"} or {"duration": "4h"}
+func (s *Server) apiSilenceProvider(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	cfg, err := s.providerConfigs.GetByID(id)
+	if err != nil || cfg == nil {
+		jsonError(w, http.StatusNotFound, "provider not found")
+		return
+	}
+
+	var body struct {
+		Until    time.Time `json:"until"`
+		Duration string    `json:"duration"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	until := body.Until
+	if until.IsZero() {
+		until, err = silenceUntil(body.Duration)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, "invalid duration")
+			return
+		}
+	}
+	if until.IsZero() || !until.After(time.Now()) {
+		jsonError(w, http.StatusBadRequest, "until or duration must be in the future")
+		return
+	}
+
+	if err := s.providerConfigs.SetSilencedUntil(id, until); err != nil {
+		log.Printf("[api] silence provider error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to silence provider")
+		return
+	}
+	s.activity.Logf(cfg.Name, "info", "Alerts silenced via API until %s", until.UTC().Format(time.RFC3339))
+	s.auditf(r, "silence", auditProvider, id, "%s until %s", cfg.Name, until.UTC().Format(time.RFC3339))
+
+	cfg, _ = s.providerConfigs.GetByID(id)
+	jsonOK(w, cfg)
+}
+
+// DELETE /api/v1/providers/{id}/silence
+func (s *Server) apiUnsilenceProvider(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	cfg, err := s.providerConfigs.GetByID(id)
+	if err != nil || cfg == nil {
+		jsonError(w, http.StatusNotFound, "provider not found")
+		return
+	}
+	if err := s.providerConfigs.SetSilencedUntil(id, time.Time{}); err != nil {
+		log.Printf("[api] unsilence provider error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to unsilence provider")
+		return
+	}
+	s.activity.Logf(cfg.Name, "info", "Alerts unsilenced via API")
+	s.auditf(r, "unsilence", auditProvider, id, "%s", cfg.Name)
+
+	cfg, _ = s.providerConfigs.GetByID(id)
+	jsonOK(w, cfg)
+}
+
+// providerExportVersion is the format version of providerExport. Bump it
+// when the shape changes.
+const providerExportVersion = 1
+
+// providerExport is the JSON shape for copying provider configs between
+// MOE instances. ProviderConfig's secrets are tagged json:"-", so they are
+// never written; the importer supplies them separately.
+type providerExport struct {
+	Version    int                     `json:"version"`
+	ExportedAt time.Time               `json:"exported_at"`
+	Providers  []models.ProviderConfig `json:"providers"`
+}
+
+// providerImport is the body of a provider import: an export plus the
+// secrets to store, keyed by provider name.
+type providerImport struct {
+	providerExport
+	Secrets map[string]string `json:"secrets,omitempty"`
+}
+
+// providerImportResult reports what an import did. MissingSecrets names
+// the providers that were created without a secret; they are left disabled
+// until one is entered on the edit form.
+type providerImportResult struct {
+	Created        []string `json:"created"`
+	Updated        []string `json:"updated"`
+	MissingSecrets []string `json:"missing_secrets"`
+}
+
+// GET /api/v1/providers/export — provider configs without secrets
+func (s *Server) apiExportProviders(w http.ResponseWriter, r *http.Request) {
+	providers, err := s.providerConfigs.ListAll()
+	if err != nil {
+		log.Printf("[api] export providers error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to list providers")
+		return
+	}
+	if providers == nil {
+		providers = []models.ProviderConfig{}
+	}
+
+	export := providerExport{
+		Version:    providerExportVersion,
+		ExportedAt: time.Now().UTC(),
+		Providers:  providers,
+	}
+	fname := fmt.Sprintf("moe-providers-%s.json", export.ExportedAt.Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fname))
+	json.NewEncoder(w).Encode(export)
+}
+
+// POST /api/v1/providers/import — create or update provider configs from an
+// export. Providers are matched by name; an existing provider keeps its ID,
+// status and secret unless a new secret is supplied in "secrets". A provider
+// left without a secret is imported disabled.
+func (s *Server) apiImportProviders(w http.ResponseWriter, r *http.Request) {
+	var body providerImport
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if body.Version < 1 || body.Version > providerExportVersion {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("unsupported export version %d (this server reads up to %d)", body.Version, providerExportVersion))
+		return
+	}
+	if err := validateProviderImport(body.Providers); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result := providerImportResult{Created: []string{}, Updated: []string{}, MissingSecrets: []string{}}
+	for _, in := range body.Providers {
+		secret := body.Secrets[in.Name]
+		existing, err := s.providerConfigs.GetByName(in.Name)
+		if err != nil {
+			log.Printf("[api] import provider %s error: %v", in.Name, err)
+			jsonError(w, http.StatusInternalServerError, "failed to import provider "+in.Name)
+			return
+		}
+
+		if existing != nil {
+			p := existing
+			oldType, oldSecret := p.Type, providerSecret(p)
+			copyPortableProviderFields(p, &in)
+			if secret == "" && oldType == p.Type {
+				secret = oldSecret
+			}
+			setProviderSecret(p, secret)
+			if secret == "" {
+				p.Enabled = false
+				result.MissingSecrets = append(result.MissingSecrets, p.Name)
+			}
+			if err := s.providerConfigs.Update(p); err != nil {
+				log.Printf("[api] import provider %s error: %v", in.Name, err)
+				jsonError(w, http.StatusInternalServerError, "failed to import provider "+in.Name)
+				return
+			}
+			s.auditf(r, "import", auditProvider, p.ID, "%s (%s), updated", p.Name, p.Type)
+			result.Updated = append(result.Updated, p.Name)
+			continue
+		}
+
+		p := &models.ProviderConfig{ID: newID()}
+		copyPortableProviderFields(p, &in)
+		setProviderSecret(p, secret)
+		if secret == "" {
+			p.Enabled = false
+			result.MissingSecrets = append(result.MissingSecrets, p.Name)
+		}
+		if err := s.providerConfigs.Create(p); err != nil {
+			log.Printf("[api] import provider %s error: %v", in.Name, err)
+			jsonError(w, http.StatusInternalServerError, "failed to import provider "+in.Name)
+			return
+		}
+		s.auditf(r, "import", auditProvider, p.ID, "%s (%s), created", p.Name, p.Type)
+		result.Created = append(result.Created, p.Name)
+	}
+
+	jsonOK(w, result)
+}
+
+// validateProviderImport checks every imported config before any is saved,
+// so a bad file doesn't leave a half-finished import behind.
+func validateProviderImport(providers []models.ProviderConfig) error {
+	if len(providers) == 0 {
+		return fmt.Errorf("no providers to import")
+	}
+	seen := map[string]bool{}
+	for i, p := range providers {
+		if strings.TrimSpace(p.Name) == "" {
+			return fmt.Errorf("provider %d: name is required", i)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("provider %q appears more than once", p.Name)
+		}
+		seen[p.Name] = true
+		switch p.Type {
+		case "intune", "jamf", "uem":
+		default:
+			return fmt.Errorf("provider %q: unknown type %q", p.Name, p.Type)
+		}
+		if err := validHealthInterval(p.HealthInterval); err != nil {
+			return fmt.Errorf("provider %q: invalid health check interval: %v", p.Name, err)
+		}
+		if p.SnapshotRetention < 0 {
+			return fmt.Errorf("provider %q: snapshot retention can't be negative", p.Name)
+		}
+		if err := validSyncPageSize(p.SyncPageSize); err != nil {
+			return fmt.Errorf("provider %q: invalid sync page size: %v", p.Name, err)
+		}
+		if err := intune.ValidateDeviceFilter(p.SyncFilter); err != nil {
+			return fmt.Errorf("provider %q: invalid device sync filter: %v", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// copyPortableProviderFields copies the settings an export carries from src
+// to dst, leaving dst's ID, secrets and check/sync state alone. Intune-only
+// settings are dropped for other types, as the provider form does.
+func copyPortableProviderFields(dst, src *models.ProviderConfig) {
+	dst.Name = src.Name
+	dst.Type = src.Type
+	dst.BaseURL = src.BaseURL
+	dst.TenantID = src.TenantID
+	dst.ClientID = src.ClientID
+	dst.Cloud = src.Cloud
+	dst.Username = src.Username
+	dst.SyncInterval = src.SyncInterval
+	dst.Enabled = src.Enabled
+	dst.HealthInterval = src.HealthInterval
+	dst.SnapshotRetention = src.SnapshotRetention
+	dst.SyncPageSize, dst.SyncFilter = 0, ""
+	if src.Type == "intune" {
+		dst.SyncPageSize = src.SyncPageSize
+		dst.SyncFilter = src.SyncFilter
+	}
+}
+
+// providerSecret returns the credential a provider of p's type uses: the
+// UEM password or the Intune/Jamf client secret.
+func providerSecret(p *models.ProviderConfig) string {
+	if p.Type == "uem" {
+		return p.Password
+	}
+	return p.ClientSecret
+}
+
+// setProviderSecret stores secret in the field p's type uses and clears the
+// other, as the provider form does when the type changes.
+func setProviderSecret(p *models.ProviderConfig, secret string) {
+	if p.Type == "uem" {
+		p.Password, p.ClientSecret = secret, ""
+		return
+	}
+	p.ClientSecret, p.Password = secret, ""
+}
+
+// ── Maintenance ─────────────────────────────────────────────────────────
+
+// GET /api/v1/maintenance
+func (s *Server) apiGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	jsonOK(w, map[string]bool{"enabled": s.inMaintenance()})
+}
+
+// PUT /api/v1/maintenance  {"enabled": true}
+func (s *Server) apiSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Enabled == nil {
+		jsonError(w, http.StatusBadRequest, "enabled (bool) is required")
+		return
+	}
+	if err := s.setMaintenance(*body.Enabled, "API"); err != nil {
+		log.Printf("[api] set maintenance error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to set maintenance mode")
+		return
+	}
+	s.auditMaintenance(r, *body.Enabled)
+	jsonOK(w, map[string]bool{"enabled": s.inMaintenance()})
+}
+
 // ── Policy snapshots ────────────────────────────────────────────────────
 
 // GET /api/v1/policies/snapshots
@@ -126,7 +1125,8 @@ func (s *Server) apiGetSnapshot(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// GET /api/v1/policies/snapshots/{id}/items?category=&q=
+// GET /api/v1/policies/snapshots/{id}/items?category=&q=&scope_tag=&limit=&offset=
+// Without a limit, every item from offset on is returned.
 func (s *Server) apiListSnapshotItems(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	q := r.URL.Query()
@@ -137,17 +1137,160 @@ func (s *Server) apiListSnapshotItems(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	items, err := s.policies.ListItems(id, q.Get("category"), q.Get("q"))
+	items, err := s.policies.ListItems(id, q.Get("category"), q.Get("q"), q.Get("scope_tag"))
 	if err != nil {
 		log.Printf("[api] list snapshot items error: %v", err)
 		jsonError(w, http.StatusInternalServerError, "failed to list items")
 		return
 	}
 
-	jsonOK(w, map[string]any{
+	total := len(items)
+	limit := queryInt(q, "limit", 0)
+	offset := min(queryInt(q, "offset", 0), total)
+	items = items[offset:]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+
+	resp := map[string]any{
 		"snapshot_id": id,
 		"count":       len(items),
+		"total":       total,
+		"limit":       limit,
+		"offset":      offset,
 		"items":       items,
+	}
+	addPageNav(w, r, resp, total, limit, offset)
+	jsonOK(w, resp)
+}
+
+// policyItemRef identifies one side of a single-policy diff.
+type policyItemRef struct {
+	ID           string `json:"id"`
+	SnapshotID   string `json:"snapshot_id"`
+	SnapshotName string `json:"snapshot_name"`
+	PolicyName   string `json:"policy_name"`
+	Category     string `json:"category"`
+	Platform     string `json:"platform"`
+}
+
+// apiPolicyItemDiff is the JSON shape of a single-policy diff.
+type apiPolicyItemDiff struct {
+	Left     policyItemRef `json:"left"`
+	Right    policyItemRef `json:"right"`
+	Matching bool          `json:"matching"`
+	Settings []SettingDiff `json:"settings"`
+}
+
+// GET /api/v1/policies/items/{id}/settings
+// Returns one policy's settings flattened for display, as the snapshot view
+// loads them when the policy is expanded.
+func (s *Server) apiPolicyItemSettings(w http.ResponseWriter, r *http.Request) {
+	item, err := s.policies.GetItem(r.PathValue("id"))
+	if err != nil {
+		log.Printf("[api] policy item settings error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to load policy")
+		return
+	}
+	if item == nil {
+		jsonError(w, http.StatusNotFound, "policy not found")
+		return
+	}
+	jsonOK(w, map[string]any{
+		"id":       item.ID,
+		"settings": viewSettings(item.SettingsJSON, s.settingsDepth()),
+	})
+}
+
+// GET /api/v1/policies/items/{id}/diff?against={otherItemId}&ignore=&strict_empty=&ignore_volatile=
+// Diffs two individual policies, which may come from different snapshots
+// and needn't share a name or category.
+func (s *Server) apiDiffPolicyItems(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	againstID := q.Get("against")
+	if againstID == "" {
+		jsonError(w, http.StatusBadRequest, "'against' policy item ID is required")
+		return
+	}
+
+	left, err := s.loadPolicyItem(r.PathValue("id"))
+	if err != nil {
+		log.Printf("[api] diff policy items error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to load policy")
+		return
+	}
+	if left == nil {
+		jsonError(w, http.StatusNotFound, "policy not found")
+		return
+	}
+	right, err := s.loadPolicyItem(againstID)
+	if err != nil {
+		log.Printf("[api] diff policy items error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to load policy")
+		return
+	}
+	if right == nil {
+		jsonError(w, http.StatusNotFound, "'against' policy not found")
+		return
+	}
+
+	settings, matching := diffSettings(left.item.SettingsJSON, right.item.SettingsJSON, diffOptionsFromQuery(q))
+	if settings == nil {
+		settings = []SettingDiff{}
+	}
+	jsonOK(w, apiPolicyItemDiff{
+		Left:     left.policyItemRef,
+		Right:    right.policyItemRef,
+		Matching: matching,
+		Settings: settings,
+	})
+}
+
+// loadedPolicyItem is a policy item with the reference the diff reports.
+type loadedPolicyItem struct {
+	policyItemRef
+	item *models.PolicyItem
+}
+
+// loadPolicyItem loads a policy item and names its snapshot. It returns nil
+// if the item doesn't exist.
+func (s *Server) loadPolicyItem(id string) (*loadedPolicyItem, error) {
+	item, err := s.policies.GetItem(id)
+	if err != nil || item == nil {
+		return nil, err
+	}
+	ref := policyItemRef{
+		ID:         item.ID,
+		SnapshotID: item.SnapshotID,
+		PolicyName: item.PolicyName,
+		Category:   item.Category,
+		Platform:   item.Platform,
+	}
+	if snap, err := s.policies.GetSnapshot(item.SnapshotID); err == nil && snap != nil {
+		ref.SnapshotName = snap.DisplayName()
+	}
+	return &loadedPolicyItem{policyItemRef: ref, item: item}, nil
+}
+
+// GET /api/v1/policies/search?q=bitlocker — settings name/value search across all snapshots.
+func (s *Server) apiSearchSettings(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		jsonError(w, http.StatusBadRequest, "'q' is required")
+		return
+	}
+
+	hits, err := s.policies.SearchSettings(query)
+	if err != nil {
+		log.Printf("[api] search settings error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to search settings")
+		return
+	}
+
+	jsonOK(w, map[string]any{
+		"query": query,
+		"count": len(hits),
+		"hits":  hits,
 	})
 }
 
@@ -159,70 +1302,208 @@ func (s *Server) apiSnapshotStatus(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusNotFound, "snapshot not found")
 		return
 	}
-	jsonOK(w, map[string]any{
-		"id":             snap.ID,
-		"status":         snap.Status,
-		"status_message": snap.StatusMessage,
-		"policy_count":   snap.PolicyCount,
-		"category_count": snap.CategoryCount,
-	})
+	resp := map[string]any{
+		"id":                     snap.ID,
+		"status":                 snap.Status,
+		"status_message":         snap.StatusMessage,
+		"policy_count":           snap.PolicyCount,
+		"category_count":         snap.CategoryCount,
+		"missing_settings_count": snap.MissingSettingsCount,
+	}
+	if p, ok := s.SnapshotProgress(snap.ID); ok && snap.Status == models.SnapshotStatusCapturing {
+		resp["progress"] = p
+	}
+	jsonOK(w, resp)
 }
 
 // ── Policy comparison ───────────────────────────────────────────────────
 
-// apiCompareResult is the JSON shape returned by the compare endpoint.
-type apiCompareResult struct {
-	Left   *models.PolicySnapshot `json:"left"`
-	Right  *models.PolicySnapshot `json:"right"`
-	Filter string                 `json:"filter,omitempty"`
-	Stats  CompareStats           `json:"stats"`
-	Diffs  []PolicyDiff           `json:"diffs"`
+// apiCompareResult is the JSON shape returned by the compare endpoint.
+type apiCompareResult struct {
+	Left           *models.PolicySnapshot `json:"left"`
+	Right          *models.PolicySnapshot `json:"right"`
+	Filter         string                 `json:"filter,omitempty"`
+	Ignore         []string               `json:"ignore,omitempty"`
+	StrictEmpty    bool                   `json:"strict_empty"`
+	IgnoreVolatile bool                   `json:"ignore_volatile"`
+	Stats          CompareStats           `json:"stats"`
+	Diffs          []PolicyDiff           `json:"diffs"`
+	Platforms      []string               `json:"platforms"`  // distinct platforms across diffs
+	Categories     []string               `json:"categories"` // distinct categories across diffs
+	MethodWarning  string                 `json:"method_warning,omitempty"`
+}
+
+// GET /api/v1/policies/compare?left={id}&right={id}&filter=&ignore=lastModified*,version&strict_empty=false&ignore_volatile=false
+func (s *Server) apiCompareSnapshots(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	leftID := q.Get("left")
+	rightID := q.Get("right")
+	filter := q.Get("filter")
+	opts := diffOptionsFromQuery(q)
+
+	if leftID == "" || rightID == "" {
+		jsonError(w, http.StatusBadRequest, "both 'left' and 'right' snapshot IDs are required")
+		return
+	}
+
+	leftSnap, err := s.policies.GetSnapshot(leftID)
+	if err != nil || leftSnap == nil {
+		jsonError(w, http.StatusNotFound, "left snapshot not found")
+		return
+	}
+	rightSnap, err := s.policies.GetSnapshot(rightID)
+	if err != nil || rightSnap == nil {
+		jsonError(w, http.StatusNotFound, "right snapshot not found")
+		return
+	}
+
+	stats, diffs, err := s.compareSnapshots(leftSnap, rightSnap, filter, opts)
+	if err != nil {
+		log.Printf("[api] compare error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to load snapshot items")
+		return
+	}
+	platforms, categories := extractDimensions(diffs, s.categoryOrder)
+
+	jsonOK(w, apiCompareResult{
+		Left:           leftSnap,
+		Right:          rightSnap,
+		Filter:         filter,
+		Ignore:         opts.Ignore,
+		StrictEmpty:    opts.StrictEmpty,
+		IgnoreVolatile: opts.IgnoreVolatile,
+		Stats:          stats,
+		Diffs:          diffs,
+		Platforms:      platforms,
+		Categories:     categories,
+		MethodWarning:  captureMethodMismatch(leftSnap, rightSnap),
+	})
 }
 
-// GET /api/v1/policies/compare?left={id}&right={id}&filter=
-func (s *Server) apiCompareSnapshots(w http.ResponseWriter, r *http.Request) {
+// POST /api/v1/policies/compare/upload?left={id}&filter=&ignore=&strict_empty=&ignore_volatile=
+// — compare a stored snapshot against a snapshot export posted as the right
+// side, without importing it. The body is parsed exactly as an import is;
+// items an import would skip are left out of the comparison.
+func (s *Server) apiCompareUpload(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
 	leftID := q.Get("left")
-	rightID := q.Get("right")
 	filter := q.Get("filter")
+	opts := diffOptionsFromQuery(q)
 
-	if leftID == "" || rightID == "" {
-		jsonError(w, http.StatusBadRequest, "both 'left' and 'right' snapshot IDs are required")
+	if leftID == "" {
+		jsonError(w, http.StatusBadRequest, "'left' snapshot ID is required")
 		return
 	}
-
 	leftSnap, err := s.policies.GetSnapshot(leftID)
 	if err != nil || leftSnap == nil {
 		jsonError(w, http.StatusNotFound, "left snapshot not found")
 		return
 	}
-	rightSnap, err := s.policies.GetSnapshot(rightID)
-	if err != nil || rightSnap == nil {
-		jsonError(w, http.StatusNotFound, "right snapshot not found")
-		return
-	}
 
-	leftItems, err := s.policies.ListItems(leftID, "", "")
+	imp, err := parseSnapshotImport(w, r)
 	if err != nil {
-		log.Printf("[api] compare left items error: %v", err)
-		jsonError(w, http.StatusInternalServerError, "failed to load left snapshot items")
+		jsonError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	rightItems, err := s.policies.ListItems(rightID, "", "")
+	rightSnap := imp.Snapshot
+	rightSnap.PolicyCount = len(imp.Items)
+
+	leftItems, err := s.policies.ListItems(leftID, "", "", "")
 	if err != nil {
-		log.Printf("[api] compare right items error: %v", err)
-		jsonError(w, http.StatusInternalServerError, "failed to load right snapshot items")
+		log.Printf("[api] compare upload left items error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to load left snapshot items")
 		return
 	}
 
-	stats, diffs := computeDiff(leftItems, rightItems, filter)
+	stats, diffs := computeDiff(leftItems, imp.Items, filter, opts)
+	platforms, categories := extractDimensions(diffs, s.categoryOrder)
 
 	jsonOK(w, apiCompareResult{
-		Left:   leftSnap,
-		Right:  rightSnap,
-		Filter: filter,
-		Stats:  stats,
-		Diffs:  diffs,
+		Left:           leftSnap,
+		Right:          rightSnap,
+		Filter:         filter,
+		Ignore:         opts.Ignore,
+		StrictEmpty:    opts.StrictEmpty,
+		IgnoreVolatile: opts.IgnoreVolatile,
+		Stats:          stats,
+		Diffs:          diffs,
+		Platforms:      platforms,
+		Categories:     categories,
+		MethodWarning:  captureMethodMismatch(leftSnap, rightSnap),
+	})
+}
+
+// apiCompare3Result is the JSON shape for a three-way comparison.
+type apiCompare3Result struct {
+	Base  *models.PolicySnapshot `json:"base"`
+	Left  *models.PolicySnapshot `json:"left"`
+	Right *models.PolicySnapshot `json:"right"`
+	Stats Compare3Stats          `json:"stats"`
+	Diffs []PolicyDiff3          `json:"diffs"`
+}
+
+// GET /api/v1/policies/compare3?base=&left=&right=&ignore=&strict_empty=&ignore_volatile=
+func (s *Server) apiCompareSnapshots3(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	sides := []string{"base", "left", "right"}
+	snaps := make([]*models.PolicySnapshot, len(sides))
+	items := make([][]models.PolicyItem, len(sides))
+
+	for i, side := range sides {
+		id := q.Get(side)
+		if id == "" {
+			jsonError(w, http.StatusBadRequest, "'base', 'left' and 'right' snapshot IDs are required")
+			return
+		}
+		snap, err := s.policies.GetSnapshot(id)
+		if err != nil || snap == nil {
+			jsonError(w, http.StatusNotFound, side+" snapshot not found")
+			return
+		}
+		its, err := s.policies.ListItems(id, "", "", "")
+		if err != nil {
+			log.Printf("[api] compare3 %s items error: %v", side, err)
+			jsonError(w, http.StatusInternalServerError, "failed to load "+side+" snapshot items")
+			return
+		}
+		snaps[i], items[i] = snap, its
+	}
+
+	stats, diffs := computeDiff3(items[0], items[1], items[2], diffOptionsFromQuery(q))
+
+	jsonOK(w, apiCompare3Result{
+		Base:  snaps[0],
+		Left:  snaps[1],
+		Right: snaps[2],
+		Stats: stats,
+		Diffs: diffs,
+	})
+}
+
+// apiBenchmarkResult is the JSON shape for a benchmark evaluation.
+type apiBenchmarkResult struct {
+	Benchmark *models.PolicySnapshot `json:"benchmark"`
+	Snapshot  *models.PolicySnapshot `json:"snapshot"`
+	Score     float64                `json:"score"`   // percentage of controls passing
+	Summary   string                 `json:"summary"` // e.g. "87.5% compliant with CIS L1 (35 of 40 controls)"
+	Stats     BenchmarkStats         `json:"stats"`
+	Failures  []BenchmarkControl     `json:"failures"` // failed and not-configured controls
+}
+
+// GET /api/v1/policies/benchmark?snapshot={id}&benchmark={id}&ignore=&strict_empty=&ignore_volatile=
+func (s *Server) apiBenchmarkSnapshot(w http.ResponseWriter, r *http.Request) {
+	ev, status, err := s.evaluateBenchmarkQuery(r.URL.Query())
+	if err != nil {
+		jsonError(w, status, err.Error())
+		return
+	}
+	jsonOK(w, apiBenchmarkResult{
+		Benchmark: ev.Benchmark,
+		Snapshot:  ev.Snapshot,
+		Score:     ev.Stats.Score,
+		Summary:   benchmarkSummary(ev.Benchmark.DisplayName(), ev.Stats),
+		Stats:     ev.Stats,
+		Failures:  benchmarkFailures(ev.Controls),
 	})
 }
 
@@ -230,11 +1511,12 @@ func (s *Server) apiCompareSnapshots(w http.ResponseWriter, r *http.Request) {
 
 // apiCreateSnapshot triggers a policy snapshot for the given provider.
 // apiCreateSnapshot triggers a policy snapshot for the given provider.
-// POST /api/v1/policies/snapshots  {"provider_id": "..."}
+// POST /api/v1/policies/snapshots  {"provider_id": "...", "label": "...", "categories": ["Compliance", ...]}
 func (s *Server) apiCreateSnapshot(w http.ResponseWriter, r *http.Request) {
 	var body struct {
-		ProviderID string `json:"provider_id"`
-		Label      string `json:"label"`
+		ProviderID string   `json:"provider_id"`
+		Label      string   `json:"label"`
+		Categories []string `json:"categories"` // optional; empty captures everything
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		jsonError(w, http.StatusBadRequest, "invalid JSON body")
@@ -275,6 +1557,7 @@ func (s *Server) apiCreateSnapshot(w http.ResponseWriter, r *http.Request) {
 		Label:        body.Label,
 		TakenAt:      time.Now().UTC(),
 		Status:       models.SnapshotStatusCapturing,
+		Categories:   cleanCategories(body.Categories),
 	}
 	if err := s.policies.CreateSnapshot(snap); err != nil {
 		log.Printf("[api] create snapshot error: %v", err)
@@ -282,11 +1565,14 @@ func (s *Server) apiCreateSnapshot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.auditf(r, "snapshot", auditSnapshot, snapshotID, "%s capture started", snap.DisplayName())
+
 	// Launch async capture
+	ctx := s.captureContext(r)
 	s.bgWg.Add(1)
 	go func() {
 		defer s.bgWg.Done()
-		s.runSnapshotCapture(s.shutdownCtx, snapshotID, cfg.Name, pp)
+		s.runSnapshotCapture(ctx, snapshotID, cfg.Name, pp, snap.Categories)
 	}()
 
 	w.WriteHeader(http.StatusAccepted)
@@ -295,6 +1581,11 @@ func (s *Server) apiCreateSnapshot(w http.ResponseWriter, r *http.Request) {
 
 // ── Export / Import ──────────────────────────────────────────────────────
 
+// snapshotExportVersion is the export format this build writes and the
+// newest it can import. Bump it when the shape of snapshotExport changes and
+// teach migrateSnapshotExport to upgrade the older versions.
+const snapshotExportVersion = 1
+
 // snapshotExport is the JSON shape for a portable snapshot.
 type snapshotExport struct {
 	Version    int                   `json:"version"`
@@ -311,86 +1602,473 @@ func (s *Server) apiExportSnapshot(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusNotFound, "snapshot not found")
 		return
 	}
-	items, err := s.policies.ListItems(id, "", "")
+	if notModified(w, r, snapshotETag(snap, "json")) {
+		return
+	}
+	export, err := s.exportSnapshot(snap)
 	if err != nil {
 		log.Printf("[api] export items error: %v", err)
 		jsonError(w, http.StatusInternalServerError, "failed to load snapshot items")
 		return
 	}
 
-	export := snapshotExport{
-		Version:    1,
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, snapshotExportName(snap)))
+	json.NewEncoder(w).Encode(export)
+}
+
+// exportSnapshot builds a snapshot's export, its items in display order.
+func (s *Server) exportSnapshot(snap *models.PolicySnapshot) (*snapshotExport, error) {
+	items, err := s.policies.ListItems(snap.ID, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	s.categoryOrder.sortItems(items)
+	return &snapshotExport{
+		Version:    snapshotExportVersion,
 		ExportedAt: time.Now().UTC(),
 		Snapshot:   *snap,
 		Items:      items,
+	}, nil
+}
+
+// snapshotExportName is the file name of a snapshot's JSON export.
+func snapshotExportName(snap *models.PolicySnapshot) string {
+	return fmt.Sprintf("moe-snapshot-%s-%s.json", snap.ProviderName, snap.TakenAt.Format("20060102-150405"))
+}
+
+// exportAllWriteTimeout bounds writing one snapshot into the export bundle.
+// It replaces the server's WriteTimeout, which a bundle of many large
+// snapshots would otherwise run past.
+const exportAllWriteTimeout = time.Minute
+
+// GET /api/v1/policies/export/all — every snapshot's JSON export in one ZIP,
+// streamed one snapshot at a time so the bundle is never held in memory.
+// Snapshots still capturing are left out. Once streaming has begun an error
+// can only be logged, leaving the client a truncated archive.
+func (s *Server) apiExportAllSnapshots(w http.ResponseWriter, r *http.Request) {
+	snaps, err := s.policies.ListSnapshots()
+	if err != nil {
+		log.Printf("[api] export all list snapshots error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to list snapshots")
+		return
 	}
 
-	fname := fmt.Sprintf("moe-snapshot-%s-%s.json", snap.ProviderName, snap.TakenAt.Format("20060102-150405"))
-	w.Header().Set("Content-Type", "application/json")
+	fname := fmt.Sprintf("moe-snapshots-%s.zip", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/zip")
 	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fname))
-	json.NewEncoder(w).Encode(export)
+
+	rc := http.NewResponseController(w)
+	zw := zip.NewWriter(w)
+	names := make(map[string]bool)
+	for i := range snaps {
+		snap := &snaps[i]
+		if snap.InProgress() {
+			continue
+		}
+		export, err := s.exportSnapshot(snap)
+		if err != nil {
+			log.Printf("[api] export all snapshot %s error: %v", snap.ID, err)
+			return
+		}
+
+		// Provider names are free text; keep them from adding directories.
+		name := strings.NewReplacer("/", "_", `\`, "_").Replace(snapshotExportName(snap))
+		if names[name] {
+			name = strings.TrimSuffix(name, ".json") + "-" + snap.ID + ".json"
+		}
+		names[name] = true
+
+		rc.SetWriteDeadline(time.Now().Add(exportAllWriteTimeout))
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: snap.TakenAt})
+		if err == nil {
+			err = json.NewEncoder(f).Encode(export)
+		}
+		if err != nil {
+			log.Printf("[api] export all write error: %v", err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("[api] export all write error: %v", err)
+	}
 }
 
-// POST /api/v1/policies/snapshots/import — import a previously exported snapshot
-func (s *Server) apiImportSnapshot(w http.ResponseWriter, r *http.Request) {
+// importClockSkew is how far in the future an imported snapshot's taken_at
+// may be before it is treated as invalid, allowing for clock drift between
+// the exporting and importing instances.
+const importClockSkew = 5 * time.Minute
+
+// importTakenAt normalises an imported snapshot timestamp to UTC. A zero
+// taken_at, or one more than importClockSkew ahead of now, would sort the
+// snapshot ahead of live captures, so it falls back to the export's
+// exported_at (when that is itself valid) or to now. The second result
+// reports whether the original value was replaced.
+func importTakenAt(takenAt, exportedAt, now time.Time) (time.Time, bool) {
+	valid := func(t time.Time) bool {
+		return !t.IsZero() && !t.After(now.Add(importClockSkew))
+	}
+	switch {
+	case valid(takenAt):
+		return takenAt.UTC(), false
+	case valid(exportedAt):
+		return exportedAt.UTC(), true
+	default:
+		return now.UTC(), true
+	}
+}
+
+// maxImportBytes bounds a snapshot import body. Real exports of large
+// tenants are a few megabytes.
+const maxImportBytes = 64 << 20
+
+// snapshotImport is a decoded and validated import body.
+type snapshotImport struct {
+	Snapshot        *models.PolicySnapshot // ready to create once given an ID
+	Items           []models.PolicyItem    // the items that passed validation
+	Skipped         []importSkip           // the items that didn't, and why
+	TakenAtAdjusted bool                   // the export's taken_at was invalid and replaced
+
+	positions []int // index in the export of each of Items
+}
+
+// importSkip is an exported item that was not imported.
+type importSkip struct {
+	Index      int    `json:"index"` // position in the export's items
+	PolicyName string `json:"policy_name"`
+	Reason     string `json:"reason"`
+}
+
+// migrateSnapshotExport upgrades an export written by an older MOE to the
+// current snapshotExportVersion in place. Exports newer than this build are
+// rejected, since fields it doesn't know about would be silently dropped.
+func migrateSnapshotExport(imp *snapshotExport) error {
+	switch {
+	case imp.Version > snapshotExportVersion:
+		return fmt.Errorf("export version %d is newer than this MOE supports (%d); upgrade MOE to import it", imp.Version, snapshotExportVersion)
+	case imp.Version < 0:
+		return fmt.Errorf("invalid export version %d", imp.Version)
+	}
+	// Version 0 is an export with no version field, which has the version 1
+	// shape. There are no older formats to upgrade yet.
+	imp.Version = snapshotExportVersion
+	return nil
+}
+
+// validateImportItem returns why an exported item can't be imported, or "".
+func validateImportItem(item models.PolicyItem) string {
+	switch {
+	case strings.TrimSpace(item.SettingsJSON) == "":
+		return "settings_json is empty"
+	case !json.Valid([]byte(item.SettingsJSON)):
+		return "settings_json is not valid JSON"
+	}
+	return ""
+}
+
+// parseSnapshotImport decodes and validates a snapshot export posted for
+// import, applying the ?benchmark=true override. It is shared by the import
+// and its preview so both accept exactly the same payloads; the error is
+// meant for the client.
+func parseSnapshotImport(w http.ResponseWriter, r *http.Request) (*snapshotImport, error) {
 	var imp snapshotExport
-	if err := json.NewDecoder(r.Body).Decode(&imp); err != nil {
-		jsonError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
-		return
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportBytes)).Decode(&imp); err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			return nil, fmt.Errorf("import is larger than %d MB", maxImportBytes>>20)
+		}
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if err := migrateSnapshotExport(&imp); err != nil {
+		return nil, err
+	}
+	if r.URL.Query().Get("benchmark") == "true" {
+		imp.Snapshot.IsBenchmark = true
+	}
+	if imp.Snapshot.IsBenchmark && imp.Snapshot.ProviderName == "" {
+		imp.Snapshot.ProviderName = "benchmark"
 	}
 	if imp.Snapshot.ProviderName == "" {
-		jsonError(w, http.StatusBadRequest, "snapshot.provider_name is required")
-		return
+		return nil, errors.New("snapshot.provider_name is required")
 	}
 
-	// Create a new snapshot with a fresh ID
-	newSnapID := newID()
 	label := imp.Snapshot.Label
 	if label == "" {
 		label = imp.Snapshot.DisplayName() + " (imported)"
 	}
-	snap := &models.PolicySnapshot{
-		ID:           newSnapID,
-		ProviderName: imp.Snapshot.ProviderName,
-		ProviderType: imp.Snapshot.ProviderType,
-		Label:        label,
-		TakenAt:      imp.Snapshot.TakenAt,
+	takenAt, adjusted := importTakenAt(imp.Snapshot.TakenAt, imp.ExportedAt, time.Now())
+	out := &snapshotImport{
+		Snapshot: &models.PolicySnapshot{
+			ProviderName:    imp.Snapshot.ProviderName,
+			ProviderType:    imp.Snapshot.ProviderType,
+			Label:           label,
+			TakenAt:         takenAt,
+			StatusMessage:   partialCaptureMessage(imp.Snapshot.FailedResources),
+			CaptureMethod:   imp.Snapshot.CaptureMethod,
+			Coverage:        imp.Snapshot.Coverage,
+			FailedResources: imp.Snapshot.FailedResources,
+			IsBenchmark:     imp.Snapshot.IsBenchmark,
+			Categories:      imp.Snapshot.Categories,
+		},
+		TakenAtAdjusted: adjusted,
 	}
-	if err := s.policies.CreateSnapshot(snap); err != nil {
+	for i, item := range imp.Items {
+		if reason := validateImportItem(item); reason != "" {
+			out.Skipped = append(out.Skipped, importSkip{Index: i, PolicyName: item.PolicyName, Reason: reason})
+			continue
+		}
+		out.Items = append(out.Items, item)
+		out.positions = append(out.positions, i)
+	}
+	return out, nil
+}
+
+// importResult is the response to an import: the new snapshot plus what
+// was left out of it.
+type importResult struct {
+	models.PolicySnapshot
+	Inserted int          `json:"inserted"`
+	Skipped  []importSkip `json:"skipped"`
+}
+
+// POST /api/v1/policies/snapshots/import?benchmark=true — import a previously
+// exported snapshot. With benchmark=true (or snapshot.is_benchmark in the
+// body) it is stored as a benchmark template; provider_name then defaults to
+// "benchmark".
+func (s *Server) apiImportSnapshot(w http.ResponseWriter, r *http.Request) {
+	imp, err := parseSnapshotImport(w, r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Create a new snapshot with a fresh ID
+	snap := imp.Snapshot
+	snap.ID = newID()
+	takenAt := snap.TakenAt
+	if imp.TakenAtAdjusted {
+		log.Printf("[api] import snapshot: invalid taken_at, using %s", takenAt.Format(time.RFC3339))
+	}
+	inserted, failed, err := s.copySnapshot(snap, imp.Items)
+	if err != nil {
 		log.Printf("[api] import create snapshot error: %v", err)
 		jsonError(w, http.StatusInternalServerError, "failed to create snapshot")
 		return
 	}
+	skipped := imp.Skipped
+	for _, f := range failed {
+		f.Index = imp.positions[f.Index]
+		skipped = append(skipped, f)
+	}
+	slices.SortFunc(skipped, func(a, b importSkip) int { return a.Index - b.Index })
+	if skipped == nil {
+		skipped = []importSkip{}
+	}
+
+	snap, _ = s.policies.GetSnapshot(snap.ID)
+	kind := "snapshot"
+	if snap.IsBenchmark {
+		kind = "benchmark"
+	}
+	s.activity.Logf(snap.ProviderName, "success", "Imported %s with %d policies", kind, inserted)
+	s.auditf(r, "import", auditSnapshot, snap.ID, "%s %s, %d policies", kind, snap.DisplayName(), inserted)
+	if imp.TakenAtAdjusted {
+		s.activity.Logf(snap.ProviderName, "warning", "Imported snapshot had an invalid capture time; recorded as %s", takenAt.Format("2006-01-02 15:04 UTC"))
+	}
+	if len(skipped) > 0 {
+		s.activity.Logf(snap.ProviderName, "warning", "Import skipped %d of %d policies (first: %s)", len(skipped), inserted+len(skipped), skipped[0].Reason)
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	jsonOK(w, importResult{PolicySnapshot: *snap, Inserted: inserted, Skipped: skipped})
+}
+
+// POST /api/v1/policies/snapshots/import/preview?benchmark=true — validate a
+// snapshot export and summarise what importing it would create, without
+// writing anything. Accepts exactly what the import does; policy_count and
+// the breakdowns cover only the items that would be imported.
+func (s *Server) apiPreviewSnapshotImport(w http.ResponseWriter, r *http.Request) {
+	imp, err := parseSnapshotImport(w, r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	inserted := 0
+	categories := map[string]int{}
+	platforms := map[string]int{}
+	missing := 0
 	for _, item := range imp.Items {
+		categories[item.Category]++
+		platform := item.Platform
+		if platform == "" {
+			platform = "Other"
+		}
+		platforms[platform]++
+		if item.SettingsError != "" {
+			missing++
+		}
+	}
+
+	skipped := imp.Skipped
+	if skipped == nil {
+		skipped = []importSkip{}
+	}
+	snap := imp.Snapshot
+	jsonOK(w, map[string]any{
+		"provider_name":          snap.ProviderName,
+		"provider_type":          snap.ProviderType,
+		"label":                  snap.Label,
+		"taken_at":               snap.TakenAt,
+		"taken_at_adjusted":      imp.TakenAtAdjusted,
+		"is_benchmark":           snap.IsBenchmark,
+		"capture_method":         snap.CaptureMethod,
+		"policy_count":           len(imp.Items),
+		"missing_settings_count": missing,
+		"categories":             categories,
+		"platforms":              platforms,
+		"skipped":                skipped,
+	})
+}
+
+// PATCH /api/v1/policies/snapshots/{id}  {"label": "..."}
+// Relabels a snapshot. The label can't be blank; snapshots without one are
+// named after their provider and capture time.
+func (s *Server) apiUpdateSnapshot(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Label *string `json:"label"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if body.Label == nil {
+		jsonError(w, http.StatusBadRequest, "label is required")
+		return
+	}
+	label := strings.TrimSpace(*body.Label)
+	if label == "" {
+		jsonError(w, http.StatusBadRequest, "label must not be empty")
+		return
+	}
+
+	snap, err := s.policies.GetSnapshot(r.PathValue("id"))
+	if err != nil || snap == nil {
+		jsonError(w, http.StatusNotFound, "snapshot not found")
+		return
+	}
+	if err := s.policies.UpdateSnapshotLabel(snap.ID, label); err != nil {
+		log.Printf("[api] relabel snapshot error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to update snapshot")
+		return
+	}
+
+	old := snap.DisplayName()
+	snap.Label = label
+	s.auditf(r, "relabel", auditSnapshot, snap.ID, "%s to %s", old, label)
+	jsonOK(w, snap)
+}
+
+// POST /api/v1/policies/snapshots/{id}/clone  {"label": "..."}
+// Copies a complete snapshot and its items under a new ID. The clone keeps
+// the source's capture time and is exempt from retention pruning. label
+// defaults to "<source name> (copy)".
+func (s *Server) apiCloneSnapshot(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Label string `json:"label"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	src, err := s.policies.GetSnapshot(r.PathValue("id"))
+	if err != nil || src == nil {
+		jsonError(w, http.StatusNotFound, "snapshot not found")
+		return
+	}
+	if src.Status != models.SnapshotStatusComplete {
+		jsonError(w, http.StatusConflict, "only complete snapshots can be cloned")
+		return
+	}
+	items, err := s.policies.ListItems(src.ID, "", "", "")
+	if err != nil {
+		log.Printf("[api] clone items error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to load snapshot items")
+		return
+	}
+
+	label := strings.TrimSpace(body.Label)
+	if label == "" {
+		label = src.DisplayName() + " (copy)"
+	}
+	clone := &models.PolicySnapshot{
+		ID:              newID(),
+		ProviderName:    src.ProviderName,
+		ProviderType:    src.ProviderType,
+		Label:           label,
+		TakenAt:         src.TakenAt,
+		StatusMessage:   partialCaptureMessage(src.FailedResources),
+		CaptureMethod:   src.CaptureMethod,
+		Coverage:        src.Coverage,
+		FailedResources: src.FailedResources,
+		IsBenchmark:     src.IsBenchmark,
+		Categories:      src.Categories,
+		ClonedFrom:      src.ID,
+	}
+	inserted, _, err := s.copySnapshot(clone, items)
+	if err != nil {
+		log.Printf("[api] clone snapshot error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to clone snapshot")
+		return
+	}
+
+	clone, _ = s.policies.GetSnapshot(clone.ID)
+	s.activity.Logf(clone.ProviderName, "success", "Cloned %s as %s with %d policies", src.DisplayName(), clone.DisplayName(), inserted)
+	s.auditf(r, "clone", auditSnapshot, clone.ID, "%s from %s", clone.DisplayName(), src.DisplayName())
+
+	w.WriteHeader(http.StatusCreated)
+	jsonOK(w, clone)
+}
+
+// copySnapshot creates snap and inserts a copy of each item under it with
+// fresh IDs, then refreshes its counts. Used by import and clone. Items that
+// fail to insert are logged and skipped; it returns how many were copied and
+// the failures, indexed by position in items.
+func (s *Server) copySnapshot(snap *models.PolicySnapshot, items []models.PolicyItem) (inserted int, failed []importSkip, err error) {
+	if err := s.policies.CreateSnapshot(snap); err != nil {
+		return 0, nil, err
+	}
+
+	for i, item := range items {
 		newItem := &models.PolicyItem{
-			ID:           newID(),
-			SnapshotID:   newSnapID,
-			Category:     item.Category,
-			SourceID:     item.SourceID,
-			PolicyName:   item.PolicyName,
-			PolicyType:   item.PolicyType,
-			Platform:     item.Platform,
-			Description:  item.Description,
-			SettingsJSON: item.SettingsJSON,
+			ID:            newID(),
+			SnapshotID:    snap.ID,
+			Category:      item.Category,
+			SourceID:      item.SourceID,
+			PolicyName:    item.PolicyName,
+			PolicyType:    item.PolicyType,
+			Platform:      item.Platform,
+			Description:   item.Description,
+			SettingsJSON:  item.SettingsJSON,
+			SettingsError: item.SettingsError,
+			Severity:      item.Severity,
+			ScopeTags:     item.ScopeTags,
+			SettingCount:  settingCount(item.SettingsJSON), // not trusted from an import
 		}
 		if err := s.policies.InsertItem(newItem); err != nil {
-			log.Printf("[api] import insert item error: %v", err)
+			log.Printf("[api] copy snapshot insert item error: %v", err)
+			failed = append(failed, importSkip{Index: i, PolicyName: item.PolicyName, Reason: "could not be saved"})
 			continue
 		}
 		inserted++
 	}
-	_ = s.policies.UpdateSnapshotCounts(newSnapID)
-
-	snap, _ = s.policies.GetSnapshot(newSnapID)
-	s.activity.Logf(snap.ProviderName, "success", "Imported snapshot with %d policies", inserted)
-
-	w.WriteHeader(http.StatusCreated)
-	jsonOK(w, snap)
+	_ = s.policies.UpdateSnapshotCounts(snap.ID)
+	return inserted, failed, nil
 }
 
-// GET /api/v1/policies/snapshots/{id}/export/csv — flattened CSV export
+// GET /api/v1/policies/snapshots/{id}/export/csv?mode=flat
+// One row per policy with its settings JSON, or with mode=flat one row per
+// setting, flattened as on the snapshot page.
 func (s *Server) apiExportSnapshotCSV(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	snap, err := s.policies.GetSnapshot(id)
@@ -398,20 +2076,47 @@ func (s *Server) apiExportSnapshotCSV(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusNotFound, "snapshot not found")
 		return
 	}
-	items, err := s.policies.ListItems(id, "", "")
+	mode := r.URL.Query().Get("mode")
+	if mode != "" && mode != "policy" && mode != "flat" {
+		jsonError(w, http.StatusBadRequest, "invalid mode; expected policy or flat")
+		return
+	}
+	flat := mode == "flat"
+	format := "csv"
+	if flat {
+		format = fmt.Sprintf("csv-flat-%d", s.settingsDepth()) // the depth shapes the rows
+	}
+	if notModified(w, r, snapshotETag(snap, format)) {
+		return
+	}
+	items, err := s.policies.ListItems(id, "", "", "")
 	if err != nil {
 		log.Printf("[api] export csv items error: %v", err)
 		jsonError(w, http.StatusInternalServerError, "failed to load snapshot items")
 		return
 	}
+	s.categoryOrder.sortItems(items)
 
 	fname := fmt.Sprintf("moe-snapshot-%s-%s.csv", snap.ProviderName, snap.TakenAt.Format("20060102-150405"))
+	if flat {
+		fname = fmt.Sprintf("moe-snapshot-%s-%s-settings.csv", snap.ProviderName, snap.TakenAt.Format("20060102-150405"))
+	}
 	w.Header().Set("Content-Type", "text/csv")
 	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fname))
 
 	cw := csv.NewWriter(w)
 	defer cw.Flush()
 
+	if flat {
+		cw.Write([]string{"Category", "PolicyName", "Platform", "SettingName", "SettingValue"})
+		for _, item := range items {
+			for _, setting := range viewSettings(item.SettingsJSON, s.settingsDepth()) {
+				cw.Write([]string{item.Category, item.PolicyName, item.Platform, setting.Name, setting.Value})
+			}
+		}
+		return
+	}
+
 	// Header row
 	cw.Write([]string{"Category", "PolicyName", "PolicyType", "Platform", "Description", "SettingsJSON"})
 
@@ -427,8 +2132,175 @@ func (s *Server) apiExportSnapshotCSV(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// ── Reports ─────────────────────────────────────────────────────────────
+
+// platformCoverage compares, for one platform, the devices in the inventory
+// with the policies in a snapshot that target it.
+type platformCoverage struct {
+	Platform string `json:"platform"`
+	Devices  int    `json:"devices"`
+	Policies int    `json:"policies"`
+}
+
+// buildPlatformCoverage joins device counts by OS with policy counts by
+// platform. Policies for "All" platforms get a row of their own, counted
+// against every device; devices and policies with no OS or platform are
+// reported as "Other". Platforms with the most devices come first.
+func buildPlatformCoverage(devicesByOS, policiesByPlatform map[string]int) []platformCoverage {
+	rows := map[string]*platformCoverage{}
+	row := func(name string) *platformCoverage {
+		if name == "" {
+			name = "Other"
+		}
+		if rows[name] == nil {
+			rows[name] = &platformCoverage{Platform: name}
+		}
+		return rows[name]
+	}
+	total := 0
+	for os, n := range devicesByOS {
+		row(os).Devices += n
+		total += n
+	}
+	for platform, n := range policiesByPlatform {
+		row(platform).Policies += n
+	}
+	if all, ok := rows["All"]; ok {
+		all.Devices = total
+	}
+
+	out := make([]platformCoverage, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, *r)
+	}
+	slices.SortFunc(out, func(a, b platformCoverage) int {
+		if a.Devices != b.Devices {
+			return b.Devices - a.Devices
+		}
+		return strings.Compare(a.Platform, b.Platform)
+	})
+	return out
+}
+
+// GET /api/v1/reports/platform-coverage?snapshot={id}
+// Per platform, how many devices of that OS are in the inventory and how
+// many of the snapshot's policies target it, to show coverage gaps.
+func (s *Server) apiPlatformCoverage(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("snapshot")
+	if id == "" {
+		jsonError(w, http.StatusBadRequest, "snapshot is required")
+		return
+	}
+	snap, err := s.policies.GetSnapshot(id)
+	if err != nil || snap == nil {
+		jsonError(w, http.StatusNotFound, "snapshot not found")
+		return
+	}
+
+	byPlatform, err := s.policies.CountByPlatform(snap.ID)
+	if err != nil {
+		log.Printf("[api] platform coverage error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to count policies")
+		return
+	}
+	byOS, err := s.devices.CountByOS()
+	if err != nil {
+		log.Printf("[api] platform coverage error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to count devices")
+		return
+	}
+	jsonOK(w, buildPlatformCoverage(byOS, byPlatform))
+}
+
+// GET /api/v1/reports/compliance-trend?provider=&days=30
+// Daily compliance counts over the last days (today included), oldest
+// first, for one provider or summed over all of them. Days before the
+// rollup started, or when the server was down, have no entry.
+func (s *Server) apiComplianceTrend(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	days := min(queryInt(q, "days", defaultTrendDays), maxTrendDays)
+	since := time.Now().UTC().AddDate(0, 0, 1-days)
+
+	series, err := s.complianceTrend.Series(q.Get("provider"), since)
+	if err != nil {
+		log.Printf("[api] compliance trend error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to load compliance trend")
+		return
+	}
+	jsonOK(w, series)
+}
+
 // ── Helpers ─────────────────────────────────────────────────────────────
 
+// snapshotETag returns a strong ETag for an export of snap in the given
+// format. Complete snapshots are immutable apart from their label, so the
+// tag is derived from the ID, policy count, taken_at and label. Snapshots
+// that are still capturing (or failed) get no tag.
+func snapshotETag(snap *models.PolicySnapshot, format string) string {
+	if snap.Status != "complete" {
+		return ""
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00%s\x00%s\x00%s",
+		snap.ID, snap.PolicyCount, snap.TakenAt.UTC().Format(time.RFC3339Nano), snap.Label, format)
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// notModified sets the ETag header and reports whether the request's
+// If-None-Match already matches it, in which case a 304 has been written.
+// An empty etag disables caching for the response.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	w.Header().Set("ETag", etag)
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == etag || tag == "W/"+etag || tag == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// addPageNav adds has_more, next_offset and prev_offset to a paginated list
+// response, the offsets being null at either end, and sets a Link header with
+// rel="next" and rel="prev" URLs that keep the request's other parameters.
+// A limit of zero means the page runs to the end of the list.
+func addPageNav(w http.ResponseWriter, r *http.Request, resp map[string]any, total, limit, offset int) {
+	var next, prev *int
+	if n := offset + limit; limit > 0 && n < total {
+		next = &n
+	}
+	if offset > 0 {
+		p := 0
+		if limit > 0 {
+			p = max(offset-limit, 0)
+		}
+		prev = &p
+	}
+	resp["has_more"] = next != nil
+	resp["next_offset"] = next
+	resp["prev_offset"] = prev
+
+	var links []string
+	for _, l := range []struct {
+		rel    string
+		offset *int
+	}{{"next", next}, {"prev", prev}} {
+		if l.offset == nil {
+			continue
+		}
+		q := r.URL.Query()
+		q.Set("offset", strconv.Itoa(*l.offset))
+		links = append(links, fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, q.Encode(), l.rel))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
 func queryInt(q map[string][]string, key string, fallback int) int {
 	v := q[key]
 	if len(v) == 0 || v[0] == "" {
@@ -0,0 +1,500 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dan/moe/internal/models"
+	"github.com/dan/moe/internal/provider"
+	"github.com/dan/moe/internal/store"
+)
+
+func TestImportTakenAt(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	aest := time.FixedZone("AEST", 10*60*60)
+	exported := now.Add(-time.Hour)
+
+	tests := []struct {
+		name     string
+		takenAt  time.Time
+		exported time.Time
+		want     time.Time
+		adjusted bool
+	}{
+		{"valid is kept", now.Add(-24 * time.Hour), exported, now.Add(-24 * time.Hour), false},
+		{"non-UTC is normalised", time.Date(2026, 2, 1, 10, 0, 0, 0, aest), exported, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), false},
+		{"within clock skew is kept", now.Add(2 * time.Minute), exported, now.Add(2 * time.Minute), false},
+		{"zero falls back to exported_at", time.Time{}, exported, exported, true},
+		{"future falls back to exported_at", now.Add(48 * time.Hour), exported, exported, true},
+		{"zero with no exported_at uses now", time.Time{}, time.Time{}, now, true},
+		{"future with future exported_at uses now", now.Add(time.Hour), now.Add(time.Hour), now, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, adjusted := importTakenAt(tt.takenAt, tt.exported, now)
+			if !got.Equal(tt.want) || got.Location() != time.UTC {
+				t.Errorf("takenAt = %v, want %v in UTC", got, tt.want)
+			}
+			if adjusted != tt.adjusted {
+				t.Errorf("adjusted = %v, want %v", adjusted, tt.adjusted)
+			}
+		})
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	h := readOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		method, path string
+		want         int
+		json         bool
+	}{
+		{http.MethodGet, "/policies", http.StatusNoContent, false},
+		{http.MethodHead, "/api/v1/devices", http.StatusNoContent, false},
+		{http.MethodPost, "/maintenance", http.StatusSeeOther, false},
+		{http.MethodPost, "/api/v1/policies/snapshots/import", http.StatusForbidden, true},
+		{http.MethodPost, "/api/v1/policies/snapshots/import/preview", http.StatusNoContent, false},
+		{http.MethodDelete, "/api/v1/devices/x", http.StatusForbidden, true},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+		if isJSON := rec.Header().Get("Content-Type") == "application/json"; tt.want == http.StatusForbidden && isJSON != tt.json {
+			t.Errorf("%s %s: JSON response = %v, want %v", tt.method, tt.path, isJSON, tt.json)
+		}
+	}
+
+	// A refused form post goes back to the page it came from with a flash,
+	// but never off-site.
+	redirects := []struct{ referer, wantPath, wantOS string }{
+		{"http://moe.example/devices?os=iOS", "/devices", "iOS"},
+		{"http://moe.example//evil.example/x", "/", ""},
+		{"http://moe.example/\\evil.example/x", "/", ""},
+		{"", "/", ""},
+	}
+	for _, tt := range redirects {
+		r := httptest.NewRequest(http.MethodPost, "/maintenance", nil)
+		r.Header.Set("Referer", tt.referer)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		loc, err := url.Parse(rec.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("Referer %q: bad Location: %v", tt.referer, err)
+		}
+		q := loc.Query()
+		if loc.Host != "" || loc.Path != tt.wantPath || q.Get("os") != tt.wantOS || q.Get("flash_type") != "error" || q.Get("flash") == "" {
+			t.Errorf("Referer %q: Location = %q, want %s with os=%q and an error flash", tt.referer, loc, tt.wantPath, tt.wantOS)
+		}
+	}
+}
+
+func TestRequestIDs(t *testing.T) {
+	var seen string
+	h := requestIDs(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = provider.RequestID(r.Context())
+	}))
+
+	tests := []struct {
+		name, header string
+		kept         bool
+	}{
+		{"client ID is kept", "trace-42.a_b", true},
+		{"missing ID is generated", "", false},
+		{"unsafe ID is replaced", "bad id\nforged log line", false},
+		{"overlong ID is replaced", strings.Repeat("a", maxRequestIDLen+1), false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.header != "" {
+			r.Header.Set(requestIDHeader, tt.header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		got := rec.Header().Get(requestIDHeader)
+		if got == "" || got != seen {
+			t.Errorf("%s: header %q, context %q; want the same non-empty ID", tt.name, got, seen)
+		}
+		if (got == tt.header) != tt.kept {
+			t.Errorf("%s: ID %q, kept = %v", tt.name, got, tt.kept)
+		}
+	}
+}
+
+func TestAddPageNav(t *testing.T) {
+	offset := func(n int) *int { return &n }
+	tests := []struct {
+		name                 string
+		total, limit, offset int
+		next, prev           *int
+		link                 string
+	}{
+		{"first page", 25, 10, 0, offset(10), nil,
+			`</api/v1/devices?offset=10&os=iOS>; rel="next"`},
+		{"middle page", 25, 10, 10, offset(20), offset(0),
+			`</api/v1/devices?offset=20&os=iOS>; rel="next", </api/v1/devices?offset=0&os=iOS>; rel="prev"`},
+		{"last page", 25, 10, 20, nil, offset(10),
+			`</api/v1/devices?offset=10&os=iOS>; rel="prev"`},
+		{"offset past a page boundary", 25, 10, 5, offset(15), offset(0), ""},
+		{"single page", 5, 10, 0, nil, nil, ""},
+		{"no limit", 25, 0, 5, nil, offset(0), ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/devices?os=iOS&offset="+strconv.Itoa(tt.offset), nil)
+		resp := map[string]any{}
+		addPageNav(rec, r, resp, tt.total, tt.limit, tt.offset)
+
+		next, prev := resp["next_offset"].(*int), resp["prev_offset"].(*int)
+		if !reflect.DeepEqual(next, tt.next) || !reflect.DeepEqual(prev, tt.prev) {
+			t.Errorf("%s: next_offset, prev_offset = %v, %v; want %v, %v", tt.name, fmtOffset(next), fmtOffset(prev), fmtOffset(tt.next), fmtOffset(tt.prev))
+		}
+		if resp["has_more"] != (tt.next != nil) {
+			t.Errorf("%s: has_more = %v", tt.name, resp["has_more"])
+		}
+		if tt.link != "" && rec.Header().Get("Link") != tt.link {
+			t.Errorf("%s: Link = %q, want %q", tt.name, rec.Header().Get("Link"), tt.link)
+		}
+	}
+}
+
+func fmtOffset(n *int) string {
+	if n == nil {
+		return "null"
+	}
+	return strconv.Itoa(*n)
+}
+
+func TestParseSnapshotImport(t *testing.T) {
+	parse := func(target, body string) (*snapshotImport, error) {
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		return parseSnapshotImport(httptest.NewRecorder(), r)
+	}
+
+	imp, err := parse("/api/v1/policies/snapshots/import/preview",
+		`{"version":1,"snapshot":{"provider_name":"intune-corp","taken_at":"2026-01-02T03:04:05Z"},"items":[
+			{"category":"Compliance","settings_json":"{}"},
+			{"policy_name":"Empty","settings_json":""},
+			{"policy_name":"Broken","settings_json":"{\"a\":"}]}`)
+	if err != nil {
+		t.Fatalf("valid export: %v", err)
+	}
+	if imp.Snapshot.Label != "intune-corp (imported)" || len(imp.Items) != 1 || imp.TakenAtAdjusted {
+		t.Errorf("import = %+v, want a default label, one item and the original taken_at", imp)
+	}
+	if len(imp.Skipped) != 2 || imp.Skipped[0].Index != 1 || imp.Skipped[1].PolicyName != "Broken" {
+		t.Errorf("skipped = %+v, want the empty and broken items", imp.Skipped)
+	}
+
+	imp, err = parse("/api/v1/policies/snapshots/import?benchmark=true", `{"snapshot":{},"items":[]}`)
+	if err != nil || imp.Snapshot.ProviderName != "benchmark" || !imp.Snapshot.IsBenchmark {
+		t.Errorf("benchmark import = %+v, %v; want provider_name defaulted to benchmark", imp, err)
+	}
+
+	for name, body := range map[string]string{
+		"malformed":        `{"snapshot":`,
+		"missing provider": `{"snapshot":{},"items":[]}`,
+		"newer version":    `{"version":99,"snapshot":{"provider_name":"x"},"items":[]}`,
+		"too large":        `{"items":[{"description":"` + strings.Repeat("x", maxImportBytes) + `"}]}`,
+	} {
+		if _, err := parse("/api/v1/policies/snapshots/import", body); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestCleanTag(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{" Kiosk ", "kiosk", true},
+		{"pilot", "pilot", true},
+		{"   ", "", false},
+		{strings.Repeat("x", maxTagLength+1), "", false},
+	}
+	for _, tt := range tests {
+		got, ok := cleanTag(tt.in)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("cleanTag(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCopyPortableProviderFieldsDropsIntuneSettings(t *testing.T) {
+	src := models.ProviderConfig{Name: "jamf-1", Type: "jamf", SyncPageSize: 500, SyncFilter: "deviceName eq 'x'"}
+	dst := models.ProviderConfig{Type: "intune", SyncPageSize: 200, SyncFilter: "operatingSystem eq 'iOS'"}
+	copyPortableProviderFields(&dst, &src)
+	if dst.SyncPageSize != 0 || dst.SyncFilter != "" {
+		t.Errorf("jamf import kept Intune settings: page size %d, filter %q", dst.SyncPageSize, dst.SyncFilter)
+	}
+
+	src.Type = "intune"
+	copyPortableProviderFields(&dst, &src)
+	if dst.SyncPageSize != 500 || dst.SyncFilter != src.SyncFilter {
+		t.Errorf("intune import = page size %d, filter %q; want %d, %q", dst.SyncPageSize, dst.SyncFilter, 500, src.SyncFilter)
+	}
+}
+
+func TestDeviceFilterTagIsNormalized(t *testing.T) {
+	f := deviceFilterFromQuery(map[string][]string{"tag": {" Kiosk "}})
+	if f.Tag != "kiosk" {
+		t.Errorf("Tag = %q, want the stored form %q", f.Tag, "kiosk")
+	}
+}
+
+func TestSnapshotETag(t *testing.T) {
+	snap := &models.PolicySnapshot{
+		ID:          "abc",
+		PolicyCount: 12,
+		TakenAt:     time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		Status:      "complete",
+	}
+	etag := snapshotETag(snap, "json")
+	if etag == "" || etag != snapshotETag(snap, "json") {
+		t.Fatalf("etag %q is not stable", etag)
+	}
+	if etag == snapshotETag(snap, "csv") {
+		t.Error("json and csv exports share an etag")
+	}
+
+	for _, inm := range []string{etag, `"other", ` + etag, "W/" + etag, "*"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("If-None-Match", inm)
+		if !notModified(rec, req, etag) || rec.Code != http.StatusNotModified {
+			t.Errorf("If-None-Match %q: want 304, got %d", inm, rec.Code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", `"stale"`)
+	if notModified(rec, req, etag) || rec.Header().Get("ETag") != etag {
+		t.Errorf("stale If-None-Match: want ETag %q without 304", etag)
+	}
+
+	snap.Status = "capturing"
+	if got := snapshotETag(snap, "json"); got != "" {
+		t.Errorf("capturing snapshot etag = %q, want none", got)
+	}
+}
+
+func TestOSVersionBounds(t *testing.T) {
+	// Versions in ascending order; string comparison would misplace 9.3.
+	ordered := []string{"9.3", "16.7.2", "17", "17.0.1", "17.2.1", "17.10", "10000.0.22631.2861"}
+	var prev string
+	for _, v := range ordered {
+		key, ok := store.OSVersionKey(v)
+		if !ok {
+			t.Fatalf("OSVersionKey(%q) not ok", v)
+		}
+		if key <= prev {
+			t.Errorf("OSVersionKey(%q) = %q does not sort after %q", v, key, prev)
+		}
+		prev = key
+	}
+	if a, _ := store.OSVersionKey("17"); a != mustKey(t, "17.0.0") {
+		t.Error(`"17" and "17.0.0" should have the same key`)
+	}
+	if a := mustKey(t, "14.2 (23C64)"); a != mustKey(t, "14.2") {
+		t.Error("build suffix should be ignored")
+	}
+
+	tests := []struct {
+		min, max string
+		ok       bool
+	}{
+		{"", "", true},
+		{"16.4", "17", true},
+		{"abc", "", false},
+		{"", "1..2", false},
+	}
+	for _, tt := range tests {
+		msg := invalidVersionBounds(models.DeviceFilter{OSVersionMin: tt.min, OSVersionMax: tt.max})
+		if (msg == "") != tt.ok {
+			t.Errorf("invalidVersionBounds(%q, %q) = %q, want ok=%v", tt.min, tt.max, msg, tt.ok)
+		}
+	}
+}
+
+func mustKey(t *testing.T, v string) string {
+	t.Helper()
+	key, ok := store.OSVersionKey(v)
+	if !ok {
+		t.Fatalf("OSVersionKey(%q) not ok", v)
+	}
+	return key
+}
+
+func TestDeviceStaleness(t *testing.T) {
+	s := &Server{cfg: Config{StaleDeviceDays: 30}}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+
+	tests := []struct {
+		name     string
+		lastSeen *time.Time
+		days     int
+		stale    bool
+	}{
+		{"never seen", nil, 0, false},
+		{"seen today", ago(time.Hour), 0, false},
+		{"just under threshold", ago(30*24*time.Hour - time.Minute), 29, false},
+		{"at threshold", ago(30 * 24 * time.Hour), 30, true},
+		{"long gone", ago(90 * 24 * time.Hour), 90, true},
+	}
+	for _, tt := range tests {
+		days, stale := s.deviceStaleness(tt.lastSeen, now)
+		if days != tt.days || stale != tt.stale {
+			t.Errorf("%s: deviceStaleness = %d, %v; want %d, %v", tt.name, days, stale, tt.days, tt.stale)
+		}
+	}
+
+	b, err := json.Marshal(s.toAPIDevice(models.Device{ID: "d1", LastSeen: ago(45 * 24 * time.Hour)}, now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	json.Unmarshal(b, &got)
+	if got["id"] != "d1" || got["stale_days"] != float64(45) || got["is_stale"] != true {
+		t.Errorf("API device = %s, want the device fields plus stale_days and is_stale", b)
+	}
+}
+
+func TestProviderExportOmitsSecrets(t *testing.T) {
+	export := providerExport{Version: providerExportVersion, Providers: []models.ProviderConfig{
+		{Name: "corp", Type: "intune", ClientID: "app", ClientSecret: "s3cret-intune"},
+		{Name: "ws1", Type: "uem", Username: "admin", Password: "s3cret-uem"},
+	}}
+	b, err := json.Marshal(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "s3cret") {
+		t.Errorf("export leaked a secret: %s", b)
+	}
+}
+
+func TestValidateProviderImport(t *testing.T) {
+	valid := models.ProviderConfig{Name: "corp", Type: "intune", HealthInterval: "10m"}
+	tests := []struct {
+		name      string
+		providers []models.ProviderConfig
+		wantErr   bool
+	}{
+		{"valid", []models.ProviderConfig{valid, {Name: "mac", Type: "jamf"}}, false},
+		{"empty", nil, true},
+		{"no name", []models.ProviderConfig{{Type: "jamf"}}, true},
+		{"duplicate name", []models.ProviderConfig{valid, valid}, true},
+		{"unknown type", []models.ProviderConfig{{Name: "x", Type: "mobileiron"}}, true},
+		{"bad health interval", []models.ProviderConfig{{Name: "x", Type: "uem", HealthInterval: "soon"}}, true},
+	}
+	for _, tt := range tests {
+		if err := validateProviderImport(tt.providers); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateProviderImport() error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseDeviceCSV(t *testing.T) {
+	csvText := "\ufeffsourceid,DeviceName,Compliance,Ownership,IsEncrypted,JailBroken,LastSeen,ProviderName\n" +
+		"a1,Alpha,Compliant,,true,false,2026-03-01T10:00:00+10:00,\n" +
+		"a2,Bravo,,personal,,,,other\n" +
+		"a3,,compliant,,,,,\n" +
+		"a4,Delta,sort of,,,,,\n" +
+		"a5,Echo,,,maybe,,,\n" +
+		"a6,Foxtrot,,,,,yesterday,\n" +
+		"a1,Alpha again,,,,,,\n" +
+		"a7,Golf\n"
+	rows, errs, err := parseDeviceCSV(strings.NewReader(csvText), "manual")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("rows = %+v, want a1 and a2", rows)
+	}
+	a1 := rows[0].Device
+	if rows[0].Line != 2 || a1.ProviderName != "manual" || a1.SourceID != "a1" || a1.Compliance != "compliant" ||
+		a1.Ownership != "unknown" || !a1.IsEncrypted || a1.JailBroken != "False" ||
+		a1.LastSeen == nil || !a1.LastSeen.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("a1 = line %d %+v", rows[0].Line, a1)
+	}
+	if a2 := rows[1].Device; a2.ProviderName != "other" || a2.Compliance != "unknown" || a2.Ownership != "personal" {
+		t.Errorf("a2 = %+v", a2)
+	}
+
+	var lines []int
+	for _, e := range errs {
+		lines = append(lines, e.Line)
+	}
+	if want := []int{4, 5, 6, 7, 8, 9}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("error lines = %v, want %v (%+v)", lines, want, errs)
+	}
+	if errs[4].Reason != "duplicates line 2" {
+		t.Errorf("duplicate reason = %q", errs[4].Reason)
+	}
+
+	for name, text := range map[string]string{
+		"empty":            "",
+		"unknown column":   "SourceID,DeviceName,Colour\n",
+		"missing SourceID": "DeviceName\n",
+	} {
+		if _, _, err := parseDeviceCSV(strings.NewReader(text), "manual"); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+	if _, _, err := parseDeviceCSV(strings.NewReader("SourceID,DeviceName\n"), ""); err == nil {
+		t.Error("no ProviderName column or default provider: no error")
+	}
+}
+
+func TestMergeDeviceCSV(t *testing.T) {
+	enrolled := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	dst := models.Device{DeviceName: "old", Serial: "C02X", Ownership: "corporate", EnrolledAt: &enrolled,
+		IsSupervised: true, Status: models.DeviceStatusRetired}
+	src := models.Device{DeviceName: "new", Compliance: "compliant", Ownership: "unknown"}
+	mergeDeviceCSV(&dst, src, map[string]bool{"SourceID": true, "DeviceName": true, "Compliance": true})
+
+	if dst.DeviceName != "new" || dst.Compliance != "compliant" {
+		t.Errorf("given columns not applied: %+v", dst)
+	}
+	if dst.Serial != "C02X" || dst.Ownership != "corporate" || dst.EnrolledAt != &enrolled ||
+		!dst.IsSupervised || dst.Status != models.DeviceStatusRetired {
+		t.Errorf("columns the file doesn't have were changed: %+v", dst)
+	}
+}
+
+func TestBuildPlatformCoverage(t *testing.T) {
+	got := buildPlatformCoverage(
+		map[string]int{"macOS": 300, "Windows": 120, "iOS": 40, "": 2},
+		map[string]int{"macOS": 2, "Windows": 35, "All": 4, "Linux": 1},
+	)
+	want := []platformCoverage{
+		{"All", 462, 4},
+		{"macOS", 300, 2},
+		{"Windows", 120, 35},
+		{"iOS", 40, 0},
+		{"Other", 2, 0},
+		{"Linux", 0, 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("buildPlatformCoverage = %+v\nwant %+v", got, want)
+	}
+}
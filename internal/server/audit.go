@@ -0,0 +1,110 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dan/moe/internal/models"
+)
+
+// Audit target types.
+const (
+	auditDevice   = "device"
+	auditProvider = "provider"
+	auditSnapshot = "snapshot"
+	auditServer   = "server" // server-wide settings such as maintenance mode
+	auditAdmin    = "admin"  // web UI administrators
+)
+
+// auditPageSize is the number of entries per page on /audit.
+const auditPageSize = 50
+
+// auditActor identifies who made a request: the signed-in admin, or
+// "system" when no one is signed in (the UI is open until an admin user
+// exists).
+func auditActor(r *http.Request) string {
+	if user := sessionUser(r); user != "" {
+		return user
+	}
+	return "system"
+}
+
+// auditf records a state-changing action in the durable audit log. detail
+// is a short human-readable summary, typically the target's name. Failures
+// are logged rather than returned: a full audit table must not block the
+// action itself.
+func (s *Server) auditf(r *http.Request, action, targetType, targetID, format string, args ...any) {
+	e := &models.AuditEntry{
+		ID:         newID(),
+		At:         time.Now().UTC(),
+		Actor:      auditActor(r),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Detail:     fmt.Sprintf(format, args...),
+	}
+	if err := s.auditLog.Record(e); err != nil {
+		log.Printf("[audit] record %s %s %s: %v", action, targetType, targetID, err)
+	}
+}
+
+type auditPageData struct {
+	Nav     string
+	Entries []models.AuditEntry
+	Total   int
+	Page    int
+	Pages   int
+	Prev    int // newer page number; 0 on the first page
+	Next    int // older page number; 0 on the last page
+}
+
+// handleAuditLog renders the audit log, newest first, auditPageSize entries
+// per page.
+// GET /audit?page=
+func (s *Server) handleAuditLog(w http.ResponseWriter, r *http.Request) {
+	page := queryInt(r.URL.Query(), "page", 1)
+	entries, total, err := s.auditLog.List(auditPageSize, (page-1)*auditPageSize)
+	if err != nil {
+		log.Printf("[audit] list error: %v", err)
+		http.Error(w, "Failed to load audit log", http.StatusInternalServerError)
+		return
+	}
+	data := auditPageData{
+		Nav:     "audit",
+		Entries: entries,
+		Total:   total,
+		Page:    page,
+		Pages:   max(1, (total+auditPageSize-1)/auditPageSize),
+	}
+	if page > 1 {
+		data.Prev = page - 1
+	}
+	if page < data.Pages {
+		data.Next = page + 1
+	}
+	s.render.render(w, "audit.html", data)
+}
+
+// GET /api/v1/audit?limit=&offset=
+func (s *Server) apiListAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := min(queryInt(q, "limit", 100), 1000)
+	offset := queryInt(q, "offset", 0)
+
+	entries, total, err := s.auditLog.List(limit, offset)
+	if err != nil {
+		log.Printf("[api] list audit error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to list audit log")
+		return
+	}
+	resp := map[string]any{
+		"entries": entries,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	}
+	addPageNav(w, r, resp, total, limit, offset)
+	jsonOK(w, resp)
+}
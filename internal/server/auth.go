@@ -0,0 +1,290 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/dan/moe/internal/db"
+	"github.com/dan/moe/internal/models"
+	"github.com/dan/moe/internal/store"
+)
+
+// Sessions are stateless signed cookies: base64(username|expiry) followed by
+// an HMAC-SHA256 of that payload under a key kept in the settings table, so
+// sessions survive restarts and need no server-side storage.
+const (
+	sessionCookie     = "moe_session"
+	sessionTTL        = 12 * time.Hour
+	settingSessionKey = "session_key"
+)
+
+// minPasswordLength is the shortest admin password CreateAdmin accepts.
+const minPasswordLength = 8
+
+// authRecheckInterval is how often a server without admin users counts them
+// again, so one created by -create-admin while it runs takes effect without
+// a restart.
+const authRecheckInterval = 5 * time.Second
+
+type ctxKey int
+
+const userKey ctxKey = iota
+
+// CreateAdmin adds a web UI administrator. It is used by the -create-admin
+// flag to bootstrap the first user; once any admin exists the UI requires
+// a login.
+func CreateAdmin(database *db.DB, username, password string) error {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return errors.New("username is required")
+	}
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+	return store.NewAdminUserStore(database.Conn).Create(&models.AdminUser{
+		ID:           newID(),
+		Username:     username,
+		PasswordHash: string(hash),
+	})
+}
+
+// loadAuth reads the session signing key, creating one on first run, and
+// decides whether logins are required (only once an admin user exists).
+func (s *Server) loadAuth() error {
+	key, err := s.settings.Get(settingSessionKey)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		b := make([]byte, 32)
+		rand.Read(b)
+		key = hex.EncodeToString(b)
+		if err := s.settings.Set(settingSessionKey, key); err != nil {
+			return err
+		}
+	}
+	s.sessionKey, err = hex.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("decode session key: %w", err)
+	}
+
+	n, err := s.admins.Count()
+	if err != nil {
+		return err
+	}
+	s.authRequired.Store(n > 0)
+	s.authChecked = time.Now()
+	if n == 0 {
+		log.Println("[auth] no admin users — the UI is open to anyone who can reach it; create one with -create-admin")
+	}
+	return nil
+}
+
+// loginRequired reports whether an admin user exists, and so whether the UI
+// requires a login. Admins are created by a separate -create-admin run, so
+// until one exists the count is read again every authRecheckInterval. Once
+// logins are required they stay required.
+func (s *Server) loginRequired() bool {
+	if s.authRequired.Load() {
+		return true
+	}
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	if time.Since(s.authChecked) < authRecheckInterval {
+		return s.authRequired.Load()
+	}
+	s.authChecked = time.Now()
+	n, err := s.admins.Count()
+	if err != nil {
+		log.Printf("[auth] count admin users: %v", err)
+		return false
+	}
+	if n > 0 {
+		s.authRequired.Store(true)
+		log.Println("[auth] admin user created — the UI now requires a login")
+	}
+	return n > 0
+}
+
+// signSession returns a cookie value for username valid until expires.
+func (s *Server) signSession(username string, expires time.Time) string {
+	payload := username + "|" + strconv.FormatInt(expires.Unix(), 10)
+	mac := hmac.New(sha256.New, s.sessionKey)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifySession returns the username in a valid, unexpired session cookie
+// value, or "" if it is forged, malformed or expired.
+func (s *Server) verifySession(value string, now time.Time) string {
+	p, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(p)
+	if err != nil {
+		return ""
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, s.sessionKey)
+	mac.Write(payload)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return ""
+	}
+
+	i := strings.LastIndexByte(string(payload), '|')
+	if i < 0 {
+		return ""
+	}
+	exp, err := strconv.ParseInt(string(payload[i+1:]), 10, 64)
+	if err != nil || now.Unix() >= exp {
+		return ""
+	}
+	return string(payload[:i])
+}
+
+// sessionUser returns the signed-in username for r, or "".
+func sessionUser(r *http.Request) string {
+	u, _ := r.Context().Value(userKey).(string)
+	return u
+}
+
+// publicPath reports whether path is served without a session: the login
+// page, the health and metrics endpoints used by monitoring, and static
+// assets. /metrics is public so Prometheus can scrape it without a session;
+// it exposes request counts, durations and provider health, but no device
+// or policy data. Restrict it at the proxy or firewall if even that is too
+// much.
+func publicPath(path string) bool {
+	switch path {
+	case "/login", "/health", "/metrics":
+		return true
+	}
+	return strings.HasPrefix(path, "/static/")
+}
+
+// requireAuth lets requests through only with a valid session once an admin
+// user exists. Browsers are sent to /login (htmx via HX-Redirect); API
+// callers get 401.
+func (s *Server) requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie(sessionCookie); err == nil {
+			if user := s.verifySession(c.Value, time.Now()); user != "" {
+				r = r.WithContext(context.WithValue(r.Context(), userKey, user))
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		if !s.loginRequired() || publicPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			jsonError(w, http.StatusUnauthorized, "login required")
+			return
+		}
+		login := "/login?next=" + url.QueryEscape(r.URL.RequestURI())
+		if r.Header.Get("HX-Request") == "true" {
+			w.Header().Set("HX-Redirect", login)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, login, http.StatusSeeOther)
+	})
+}
+
+type loginPageData struct {
+	Nav      string
+	Next     string
+	Username string
+	Error    string
+}
+
+// safeNext returns next if it is a local path, otherwise "/", so the login
+// form can't be used as an open redirect.
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// GET /login
+func (s *Server) handleLoginPage(w http.ResponseWriter, r *http.Request) {
+	s.render.render(w, "login.html", loginPageData{Nav: "login", Next: safeNext(r.URL.Query().Get("next"))})
+}
+
+// POST /login
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	username := strings.TrimSpace(r.FormValue("username"))
+	password := r.FormValue("password")
+	next := safeNext(r.FormValue("next"))
+
+	user, err := s.admins.GetByUsername(username)
+	if err != nil {
+		log.Printf("[auth] login lookup error: %v", err)
+	}
+	if user == nil || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		log.Printf("[auth] failed login for %q from %s", username, r.RemoteAddr)
+		w.WriteHeader(http.StatusUnauthorized)
+		s.render.render(w, "login.html", loginPageData{
+			Nav:      "login",
+			Next:     next,
+			Username: username,
+			Error:    "Incorrect username or password.",
+		})
+		return
+	}
+
+	expires := time.Now().Add(sessionTTL)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    s.signSession(user.Username, expires),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	_ = s.admins.RecordLogin(user.Username)
+	r = r.WithContext(context.WithValue(r.Context(), userKey, user.Username))
+	s.auditf(r, "login", auditAdmin, user.ID, "%s", user.Username)
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// POST /logout
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSessionCookie(t *testing.T) {
+	s := &Server{sessionKey: []byte("0123456789abcdef0123456789abcdef")}
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	v := s.signSession("ops|lead", now.Add(time.Hour))
+
+	if got := s.verifySession(v, now); got != "ops|lead" {
+		t.Errorf("verifySession = %q, want %q", got, "ops|lead")
+	}
+	if got := s.verifySession(v, now.Add(2*time.Hour)); got != "" {
+		t.Errorf("expired session verified as %q", got)
+	}
+	if got := s.verifySession(v[:len(v)-2]+"AA", now); got != "" {
+		t.Errorf("tampered session verified as %q", got)
+	}
+	other := &Server{sessionKey: []byte("another key entirely, 32 bytes!!")}
+	if got := other.verifySession(v, now); got != "" {
+		t.Errorf("session signed with another key verified as %q", got)
+	}
+}
+
+func TestSafeNext(t *testing.T) {
+	tests := map[string]string{
+		"/devices?os=iOS":      "/devices?os=iOS",
+		"":                     "/",
+		"https://evil.example": "/",
+		"//evil.example":       "/",
+		"/\\evil.example":      "/",
+	}
+	for in, want := range tests {
+		if got := safeNext(in); got != want {
+			t.Errorf("safeNext(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRequireAuthKeepsRoute(t *testing.T) {
+	s := &Server{sessionKey: []byte("0123456789abcdef0123456789abcdef")}
+	s.authRequired.Store(true)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /devices/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	h := s.requireAuth(notFound(mux, http.NotFoundHandler()))
+
+	r := httptest.NewRequest("GET", "/devices/d1", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: s.signSession("ops", time.Now().Add(time.Hour))})
+	rw := &responseWriter{ResponseWriter: httptest.NewRecorder(), status: http.StatusOK}
+	h.ServeHTTP(rw, r)
+	if rw.route != "GET /devices/{id}" {
+		t.Errorf("route = %q, want the matched pattern for a signed-in request", rw.route)
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// backupWriteTimeout bounds making the backup copy, and then writing each
+// chunk of it. It replaces the server's WriteTimeout, which a large
+// database would otherwise run past while streaming.
+const backupWriteTimeout = time.Minute
+
+// deadlineWriter extends a response's write deadline before every write.
+type deadlineWriter struct {
+	w       io.Writer
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+func (dw deadlineWriter) Write(p []byte) (int, error) {
+	dw.rc.SetWriteDeadline(time.Now().Add(dw.timeout))
+	return dw.w.Write(p)
+}
+
+// GET /api/v1/admin/backup
+// Streams a consistent copy of the SQLite database as an attachment. The
+// copy holds provider credentials and the session key, so it is only
+// served once admin login is enabled.
+func (s *Server) apiBackup(w http.ResponseWriter, r *http.Request) {
+	if !s.loginRequired() {
+		jsonError(w, http.StatusForbidden, "backups require admin login; create an admin with -create-admin first")
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "moe-backup-")
+	if err != nil {
+		log.Printf("[api] backup temp dir error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to create backup")
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Now().Add(backupWriteTimeout))
+	path := filepath.Join(dir, "moe.db")
+	if err := s.db.BackupTo(path); err != nil {
+		log.Printf("[api] backup error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to create backup")
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("[api] backup open error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to create backup")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		log.Printf("[api] backup stat error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to create backup")
+		return
+	}
+
+	s.auditf(r, "backup", auditServer, "", "%d bytes", info.Size())
+
+	fname := fmt.Sprintf("moe-backup-%s.db", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fname))
+	w.Header().Set("Content-Length", fmt.Sprint(info.Size()))
+	if _, err := io.Copy(deadlineWriter{w, rc, backupWriteTimeout}, f); err != nil {
+		log.Printf("[api] backup stream error: %v", err)
+	}
+}
+
+// vacuumWriteTimeout replaces the server's WriteTimeout for a vacuum, which
+// has to finish before its response is written.
+const vacuumWriteTimeout = 10 * time.Minute
+
+// POST /api/v1/admin/vacuum
+// Compacts the database after snapshot churn: VACUUM, then a WAL checkpoint.
+// Every other query waits while it runs, which on a large database can take
+// a while, so like backups it is only allowed once admin login is enabled.
+func (s *Server) apiVacuum(w http.ResponseWriter, r *http.Request) {
+	if !s.loginRequired() {
+		jsonError(w, http.StatusForbidden, "vacuum requires admin login; create an admin with -create-admin first")
+		return
+	}
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(vacuumWriteTimeout))
+
+	before, err := s.db.Size()
+	if err != nil {
+		log.Printf("[api] vacuum size error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to read database size")
+		return
+	}
+	start := time.Now()
+	if err := s.db.Vacuum(); err != nil {
+		log.Printf("[api] vacuum error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to vacuum database")
+		return
+	}
+	after, err := s.db.Size()
+	if err != nil {
+		log.Printf("[api] vacuum size error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to read database size")
+		return
+	}
+
+	reclaimed := max(before-after, 0)
+	log.Printf("[api] vacuum reclaimed %d bytes (%d → %d) in %s", reclaimed, before, after, time.Since(start).Round(time.Millisecond))
+	s.auditf(r, "vacuum", auditServer, "", "%d bytes reclaimed", reclaimed)
+	jsonOK(w, map[string]int64{"size_before": before, "size_after": after, "reclaimed": reclaimed})
+}
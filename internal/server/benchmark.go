@@ -0,0 +1,420 @@
+package server
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/dan/moe/internal/models"
+)
+
+// ── Benchmark evaluation types ──────────────────────────────────────────
+
+// Benchmark outcomes, used for both controls and their individual settings.
+const (
+	benchmarkPass          = "pass"
+	benchmarkFail          = "fail"           // configured with a different value
+	benchmarkNotConfigured = "not-configured" // no matching policy sets it
+)
+
+// BenchmarkStats holds summary counts for a benchmark evaluation. Score is
+// the percentage of controls that pass, to one decimal place; a control only
+// counts once every one of its settings passes.
+type BenchmarkStats struct {
+	Controls      int     `json:"Controls"`
+	Passed        int     `json:"Passed"`
+	Failed        int     `json:"Failed"`
+	NotConfigured int     `json:"NotConfigured"`
+	Score         float64 `json:"Score"`
+}
+
+// BenchmarkSetting is one expected setting within a control.
+type BenchmarkSetting struct {
+	Name     string `json:"Name"`
+	Expected string `json:"Expected"`
+	Actual   string `json:"Actual"`
+	Status   string `json:"Status"`
+	Source   string `json:"Source,omitempty"` // target policy the actual value came from
+}
+
+// BenchmarkControl is one benchmark policy evaluated against a snapshot.
+type BenchmarkControl struct {
+	PolicyName  string             `json:"PolicyName"`
+	Category    string             `json:"Category"`
+	PolicyType  string             `json:"PolicyType"`
+	Platform    string             `json:"Platform"`
+	Description string             `json:"Description"`
+	Severity    string             `json:"Severity,omitempty"`
+	Status      string             `json:"Status"`
+	Settings    []BenchmarkSetting `json:"Settings"`
+}
+
+// policyBenchmarkPageData is the data for the /policies/benchmark page.
+type policyBenchmarkPageData struct {
+	Nav         string
+	Benchmarks  []PolicySnapshotSummary
+	Snapshots   []PolicySnapshotSummary
+	BenchmarkID string
+	SnapshotID  string
+	HasResults  bool
+	Benchmark   PolicySnapshotSummary
+	Snapshot    PolicySnapshotSummary
+	Stats       BenchmarkStats
+	Controls    []BenchmarkControl
+}
+
+// RemediationItem is one line of a remediation checklist: a setting that a
+// failing control expects, what the baseline has now, and where to fix it.
+type RemediationItem struct {
+	Severity string
+	Control  string
+	Category string
+	Platform string
+	Setting  string
+	Expected string
+	Current  string // empty when no matching policy sets it
+	Policy   string // policy to change; empty when one must be created
+	Status   string // benchmarkFail or benchmarkNotConfigured
+}
+
+// benchmarkEvaluation is a benchmark evaluated against one snapshot.
+type benchmarkEvaluation struct {
+	Benchmark *models.PolicySnapshot
+	Snapshot  *models.PolicySnapshot
+	Stats     BenchmarkStats
+	Controls  []BenchmarkControl
+}
+
+// policyChecklistPageData is the data for the remediation checklist page.
+type policyChecklistPageData struct {
+	Nav       string
+	Benchmark *models.PolicySnapshot
+	Snapshot  *models.PolicySnapshot
+	Stats     BenchmarkStats
+	Items     []RemediationItem
+	CSVURL    string
+}
+
+// ── Benchmark evaluation logic ──────────────────────────────────────────
+
+// evaluateBenchmark checks each benchmark policy (a control) against the
+// target snapshot. Benchmark templates are written independently of any
+// tenant, so controls are not matched by policy name: each expected setting
+// passes if any target policy of the same type (or category, when the
+// control has no type) and platform holds an equal value. Settings compare
+// with the same rules as the diff engine, so opts.Ignore, StrictEmpty and
+// IgnoreVolatile apply.
+//
+// A control passes when all of its settings pass, fails when any is set to
+// a different value, and is not-configured otherwise.
+func evaluateBenchmark(benchmark, target []models.PolicyItem, opts diffOptions) (BenchmarkStats, []BenchmarkControl) {
+	targetMaps := make([]map[string]any, len(target))
+	for i, item := range target {
+		targetMaps[i] = parseSettingsMap(item.SettingsJSON)
+	}
+
+	var stats BenchmarkStats
+	controls := make([]BenchmarkControl, 0, len(benchmark))
+	for _, b := range benchmark {
+		var candidates []int
+		for i, t := range target {
+			if benchmarkApplies(b, t) {
+				candidates = append(candidates, i)
+			}
+		}
+
+		expected := parseSettingsMap(b.SettingsJSON)
+		keys := make([]string, 0, len(expected))
+		for k := range expected {
+			keys = append(keys, k)
+		}
+		keys = filterSettingKeys(keys, opts.Ignore)
+		sort.Strings(keys)
+
+		c := BenchmarkControl{
+			PolicyName:  b.PolicyName,
+			Category:    b.Category,
+			PolicyType:  b.PolicyType,
+			Platform:    b.Platform,
+			Description: b.Description,
+			Severity:    b.Severity,
+			Status:      benchmarkPass,
+			Settings:    make([]BenchmarkSetting, 0, len(keys)),
+		}
+		for _, k := range keys {
+			s := evaluateBenchmarkSetting(k, expected, candidates, target, targetMaps, opts)
+			switch {
+			case s.Status == benchmarkFail:
+				c.Status = benchmarkFail
+			case s.Status == benchmarkNotConfigured && c.Status == benchmarkPass:
+				c.Status = benchmarkNotConfigured
+			}
+			c.Settings = append(c.Settings, s)
+		}
+
+		stats.Controls++
+		switch c.Status {
+		case benchmarkPass:
+			stats.Passed++
+		case benchmarkFail:
+			stats.Failed++
+		case benchmarkNotConfigured:
+			stats.NotConfigured++
+		}
+		controls = append(controls, c)
+	}
+
+	if stats.Controls > 0 {
+		stats.Score = math.Round(float64(stats.Passed)*1000/float64(stats.Controls)) / 10
+	}
+
+	// Failures first, then not-configured, then passes; benchmark order within.
+	statusOrder := map[string]int{benchmarkFail: 0, benchmarkNotConfigured: 1, benchmarkPass: 2}
+	sort.SliceStable(controls, func(i, j int) bool {
+		return statusOrder[controls[i].Status] < statusOrder[controls[j].Status]
+	})
+	return stats, controls
+}
+
+// benchmarkFailures returns the controls that did not pass, in the order
+// evaluateBenchmark sorted them.
+func benchmarkFailures(controls []BenchmarkControl) []BenchmarkControl {
+	failures := make([]BenchmarkControl, 0)
+	for _, c := range controls {
+		if c.Status != benchmarkPass {
+			failures = append(failures, c)
+		}
+	}
+	return failures
+}
+
+// severityRank orders benchmark severities, most urgent first. Unknown
+// and missing severities sort last.
+var severityRank = map[string]int{"critical": 0, "high": 1, "medium": 2, "low": 3}
+
+func severityOrder(severity string) int {
+	if r, ok := severityRank[strings.ToLower(severity)]; ok {
+		return r
+	}
+	return len(severityRank)
+}
+
+// remediationChecklist lists every failing setting of every failing
+// control, ordered by control severity when the benchmark defines one.
+// Within a severity, failed controls (wrong value) come before
+// not-configured ones, as evaluateBenchmark ordered them.
+func remediationChecklist(controls []BenchmarkControl) []RemediationItem {
+	failures := benchmarkFailures(controls)
+	sort.SliceStable(failures, func(i, j int) bool {
+		return severityOrder(failures[i].Severity) < severityOrder(failures[j].Severity)
+	})
+
+	items := make([]RemediationItem, 0)
+	for _, c := range failures {
+		for _, st := range c.Settings {
+			if st.Status == benchmarkPass {
+				continue
+			}
+			items = append(items, RemediationItem{
+				Severity: c.Severity,
+				Control:  c.PolicyName,
+				Category: c.Category,
+				Platform: c.Platform,
+				Setting:  st.Name,
+				Expected: st.Expected,
+				Current:  st.Actual,
+				Policy:   st.Source,
+				Status:   st.Status,
+			})
+		}
+	}
+	return items
+}
+
+// benchmarkSummary is the one-line result auditors quote.
+func benchmarkSummary(name string, stats BenchmarkStats) string {
+	return fmt.Sprintf("%g%% compliant with %s (%d of %d controls)", stats.Score, name, stats.Passed, stats.Controls)
+}
+
+// evaluateBenchmarkSetting checks one expected setting against the
+// candidate target policies. The first equal value passes; otherwise the
+// first candidate that sets it with another value is reported as a failure.
+func evaluateBenchmarkSetting(key string, expected map[string]any, candidates []int, target []models.PolicyItem, targetMaps []map[string]any, opts diffOptions) BenchmarkSetting {
+	s := BenchmarkSetting{
+		Name:     key,
+		Expected: formatSettingValue(expected[key]),
+		Status:   benchmarkNotConfigured,
+	}
+	want := opts.compareValue(expected, key)
+	for _, i := range candidates {
+		m := targetMaps[i]
+		if opts.compareValue(m, key) == want {
+			s.Status = benchmarkPass
+			s.Actual = formatSettingValue(m[key])
+			s.Source = target[i].PolicyName
+			return s
+		}
+		if _, ok := m[key]; ok && s.Status != benchmarkFail {
+			s.Status = benchmarkFail
+			s.Actual = formatSettingValue(m[key])
+			s.Source = target[i].PolicyName
+		}
+	}
+	return s
+}
+
+// benchmarkApplies reports whether a target policy can satisfy a benchmark
+// control: same policy type (or category when the control names no type),
+// and same platform unless the control targets all platforms.
+func benchmarkApplies(control, target models.PolicyItem) bool {
+	switch {
+	case control.PolicyType != "":
+		if !strings.EqualFold(control.PolicyType, target.PolicyType) {
+			return false
+		}
+	case control.Category != "":
+		if !strings.EqualFold(control.Category, target.Category) {
+			return false
+		}
+	}
+	if control.Platform == "" || strings.EqualFold(control.Platform, "All") {
+		return true
+	}
+	return strings.EqualFold(control.Platform, target.Platform)
+}
+
+// evaluateBenchmarkQuery loads the benchmark and snapshot named by the
+// benchmark= and snapshot= query parameters and evaluates one against the
+// other. On failure it returns an HTTP status and a client-facing error.
+func (s *Server) evaluateBenchmarkQuery(q url.Values) (*benchmarkEvaluation, int, error) {
+	snapID := q.Get("snapshot")
+	benchID := q.Get("benchmark")
+	if snapID == "" || benchID == "" {
+		return nil, http.StatusBadRequest, errors.New("both 'snapshot' and 'benchmark' IDs are required")
+	}
+
+	bench, err := s.policies.GetSnapshot(benchID)
+	if err != nil || bench == nil {
+		return nil, http.StatusNotFound, errors.New("benchmark not found")
+	}
+	if !bench.IsBenchmark {
+		return nil, http.StatusBadRequest, errors.New("'benchmark' is a snapshot, not a benchmark template")
+	}
+	snap, err := s.policies.GetSnapshot(snapID)
+	if err != nil || snap == nil {
+		return nil, http.StatusNotFound, errors.New("snapshot not found")
+	}
+
+	benchItems, err := s.policies.ListItems(bench.ID, "", "", "")
+	if err != nil {
+		log.Printf("[policies] benchmark items error: %v", err)
+		return nil, http.StatusInternalServerError, errors.New("failed to load benchmark items")
+	}
+	targetItems, err := s.policies.ListItems(snap.ID, "", "", "")
+	if err != nil {
+		log.Printf("[policies] benchmark snapshot items error: %v", err)
+		return nil, http.StatusInternalServerError, errors.New("failed to load snapshot items")
+	}
+
+	ev := &benchmarkEvaluation{Benchmark: bench, Snapshot: snap}
+	ev.Stats, ev.Controls = evaluateBenchmark(benchItems, targetItems, diffOptionsFromQuery(q))
+	return ev, http.StatusOK, nil
+}
+
+// ── Handlers ────────────────────────────────────────────────────────────
+
+// handlePolicyBenchmark serves the benchmark evaluation page: pick a
+// benchmark and a snapshot, and list each control's pass/fail result.
+func (s *Server) handlePolicyBenchmark(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	data := policyBenchmarkPageData{
+		Nav:         "policies",
+		BenchmarkID: q.Get("benchmark"),
+		SnapshotID:  q.Get("snapshot"),
+	}
+
+	snapshots, err := s.policies.ListSnapshots()
+	if err != nil {
+		log.Printf("[policies] list snapshots error: %v", err)
+	}
+	for _, snap := range snapshots {
+		switch {
+		case snap.IsBenchmark:
+			data.Benchmarks = append(data.Benchmarks, snapshotToSummary(snap))
+		case snap.Status == models.SnapshotStatusComplete:
+			data.Snapshots = append(data.Snapshots, snapshotToSummary(snap))
+		}
+	}
+
+	if data.BenchmarkID != "" && data.SnapshotID != "" {
+		bench, _ := s.policies.GetSnapshot(data.BenchmarkID)
+		snap, _ := s.policies.GetSnapshot(data.SnapshotID)
+		if bench != nil && bench.IsBenchmark && snap != nil {
+			benchItems, _ := s.policies.ListItems(bench.ID, "", "", "")
+			targetItems, _ := s.policies.ListItems(snap.ID, "", "", "")
+			data.HasResults = true
+			data.Benchmark = snapshotToSummary(*bench)
+			data.Snapshot = snapshotToSummary(*snap)
+			data.Stats, data.Controls = evaluateBenchmark(benchItems, targetItems, diffOptionsFromQuery(q))
+		}
+	}
+
+	s.render.render(w, "policy_benchmark.html", data)
+}
+
+// handleBenchmarkChecklist renders the remediation checklist for a
+// benchmark evaluation as a printable page.
+func (s *Server) handleBenchmarkChecklist(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	ev, _, err := s.evaluateBenchmarkQuery(q)
+	if err != nil {
+		http.Redirect(w, r, "/policies/benchmark?flash="+url.QueryEscape(err.Error())+"&flash_type=error", http.StatusSeeOther)
+		return
+	}
+
+	s.render.render(w, "policy_checklist.html", policyChecklistPageData{
+		Nav:       "policies",
+		Benchmark: ev.Benchmark,
+		Snapshot:  ev.Snapshot,
+		Stats:     ev.Stats,
+		Items:     remediationChecklist(ev.Controls),
+		CSVURL:    "/api/v1/policies/benchmark/checklist/csv?" + q.Encode(),
+	})
+}
+
+// GET /api/v1/policies/benchmark/checklist/csv?snapshot={id}&benchmark={id}&ignore=&strict_empty=&ignore_volatile=
+func (s *Server) apiBenchmarkChecklistCSV(w http.ResponseWriter, r *http.Request) {
+	ev, status, err := s.evaluateBenchmarkQuery(r.URL.Query())
+	if err != nil {
+		jsonError(w, status, err.Error())
+		return
+	}
+
+	fname := fmt.Sprintf("moe-remediation-%s-%s.csv", ev.Snapshot.ProviderName, ev.Snapshot.TakenAt.Format("20060102-150405"))
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fname))
+
+	cw := csv.NewWriter(w)
+	defer cw.Flush()
+
+	cw.Write([]string{"Severity", "Control", "Category", "Platform", "Setting", "Expected", "Current", "PolicyToChange", "Status"})
+	for _, item := range remediationChecklist(ev.Controls) {
+		cw.Write([]string{
+			item.Severity,
+			item.Control,
+			item.Category,
+			item.Platform,
+			item.Setting,
+			item.Expected,
+			item.Current,
+			item.Policy,
+			item.Status,
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/dan/moe/internal/models"
+)
+
+// categoryOrder ranks policy categories for display, most important first.
+// A category takes the rank of the first entry it starts with, ignoring
+// case, so "Compliance" ranks "Compliance Policies" and "Compliance
+// Scripts" together. Categories matching no entry follow all ranked ones;
+// ties sort alphabetically.
+type categoryOrder []string
+
+// defaultCategoryOrder is the review order used unless the server is
+// configured with its own (-category-order).
+var defaultCategoryOrder = categoryOrder{
+	"Compliance",
+	"Endpoint Security",
+	"Security Baselines",
+	"Configuration Profiles",
+	"Settings Catalog",
+	"Group Policy",
+	"App Protection",
+	"Windows Update",
+	"Enrollment",
+	"Autopilot",
+}
+
+// rank returns the index of the first entry cat starts with, or len(o).
+func (o categoryOrder) rank(cat string) int {
+	lc := strings.ToLower(cat)
+	for i, prefix := range o {
+		if strings.HasPrefix(lc, strings.ToLower(prefix)) {
+			return i
+		}
+	}
+	return len(o)
+}
+
+func (o categoryOrder) less(a, b string) bool {
+	if ra, rb := o.rank(a), o.rank(b); ra != rb {
+		return ra < rb
+	}
+	return a < b
+}
+
+// sortStrings sorts category names in place.
+func (o categoryOrder) sortStrings(cats []string) {
+	sort.SliceStable(cats, func(i, j int) bool { return o.less(cats[i], cats[j]) })
+}
+
+// sortItems orders policy items by category, keeping the existing order
+// (policy name, from the store) within each category.
+func (o categoryOrder) sortItems(items []models.PolicyItem) {
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Category == items[j].Category {
+			return false
+		}
+		return o.less(items[i].Category, items[j].Category)
+	})
+}
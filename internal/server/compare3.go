@@ -0,0 +1,189 @@
+package server
+
+import (
+	"sort"
+
+	"github.com/dan/moe/internal/models"
+)
+
+// ── Three-way comparison types ──────────────────────────────────────────
+
+// Three-way classifications, used for both policies and individual settings.
+const (
+	class3AllMatch      = "all-match"
+	class3OneDiffers    = "one-differs"
+	class3AllDiffer     = "all-differ"
+	class3MissingInSome = "missing-in-some"
+)
+
+// Compare3Stats holds summary counts for a three-way comparison.
+type Compare3Stats struct {
+	AllMatch      int `json:"AllMatch"`
+	OneDiffers    int `json:"OneDiffers"`
+	AllDiffer     int `json:"AllDiffer"`
+	MissingInSome int `json:"MissingInSome"`
+}
+
+// SettingDiff3 is one setting row across base, left and right.
+type SettingDiff3 struct {
+	Name       string `json:"Name"`
+	BaseValue  string `json:"BaseValue"`
+	LeftValue  string `json:"LeftValue"`
+	RightValue string `json:"RightValue"`
+	Class      string `json:"Class"`
+	Odd        string `json:"Odd,omitempty"`      // "base", "left" or "right" when Class is one-differs
+	Volatile   bool   `json:"Volatile,omitempty"` // differs only in timestamp/GUID-shaped values
+}
+
+// PolicyDiff3 is one policy's three-way comparison result.
+type PolicyDiff3 struct {
+	PolicyName   string         `json:"PolicyName"`
+	Category     string         `json:"Category"`
+	PolicyType   string         `json:"PolicyType"`
+	Platform     string         `json:"Platform"`
+	Class        string         `json:"Class"`
+	InBase       bool           `json:"InBase"`
+	InLeft       bool           `json:"InLeft"`
+	InRight      bool           `json:"InRight"`
+	SettingDiffs []SettingDiff3 `json:"SettingDiffs"`
+}
+
+// ── Three-way comparison logic ──────────────────────────────────────────
+
+// computeDiff3 compares base, left and right policy sets. Policies are matched
+// with keyOf, the same key used by the two-way computeDiff. A policy missing
+// from any side is classed missing-in-some; otherwise its class is the worst
+// class among its settings (all-differ > one-differs > all-match).
+func computeDiff3(base, left, right []models.PolicyItem, opts diffOptions) (Compare3Stats, []PolicyDiff3) {
+	baseIdx := indexByKey(base)
+	leftIdx := indexByKey(left)
+	rightIdx := indexByKey(right)
+
+	// Union of keys, in first-seen order across base, left, right.
+	var keys []policyKey
+	seen := make(map[policyKey]bool)
+	for _, set := range [][]models.PolicyItem{base, left, right} {
+		for _, item := range set {
+			k := keyOf(item)
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+
+	var stats Compare3Stats
+	diffs := make([]PolicyDiff3, 0, len(keys))
+
+	for _, k := range keys {
+		b, inBase := baseIdx[k]
+		l, inLeft := leftIdx[k]
+		r, inRight := rightIdx[k]
+
+		d := PolicyDiff3{
+			PolicyName: k.Name,
+			Category:   k.Category,
+			PolicyType: k.PolicyType,
+			Platform:   k.Platform,
+			InBase:     inBase,
+			InLeft:     inLeft,
+			InRight:    inRight,
+		}
+		d.SettingDiffs = diffSettings3(b.SettingsJSON, l.SettingsJSON, r.SettingsJSON, opts)
+
+		if !inBase || !inLeft || !inRight {
+			d.Class = class3MissingInSome
+			stats.MissingInSome++
+		} else {
+			d.Class = class3AllMatch
+			for _, sd := range d.SettingDiffs {
+				if sd.Class == class3AllDiffer {
+					d.Class = class3AllDiffer
+					break
+				}
+				if sd.Class == class3OneDiffers {
+					d.Class = class3OneDiffers
+				}
+			}
+			switch d.Class {
+			case class3AllMatch:
+				stats.AllMatch++
+			case class3OneDiffers:
+				stats.OneDiffers++
+			case class3AllDiffer:
+				stats.AllDiffer++
+			}
+		}
+		diffs = append(diffs, d)
+	}
+
+	// Sort: all-differ first, then one-differs, missing-in-some, all-match
+	classOrder := map[string]int{class3AllDiffer: 0, class3OneDiffers: 1, class3MissingInSome: 2, class3AllMatch: 3}
+	sort.SliceStable(diffs, func(i, j int) bool {
+		oi, oj := classOrder[diffs[i].Class], classOrder[diffs[j].Class]
+		if oi != oj {
+			return oi < oj
+		}
+		return diffs[i].PolicyName < diffs[j].PolicyName
+	})
+
+	return stats, diffs
+}
+
+// diffSettings3 compares three JSON settings blobs and returns per-setting
+// rows. opts.Ignore, opts.StrictEmpty and opts.IgnoreVolatile apply as in
+// the two-way diffSettings.
+func diffSettings3(baseJSON, leftJSON, rightJSON string, opts diffOptions) []SettingDiff3 {
+	maps := []map[string]any{
+		parseSettingsMap(baseJSON),
+		parseSettingsMap(leftJSON),
+		parseSettingsMap(rightJSON),
+	}
+
+	allKeys := make(map[string]bool)
+	for _, m := range maps {
+		for k := range m {
+			allKeys[k] = true
+		}
+	}
+	keys := make([]string, 0, len(allKeys))
+	for k := range allKeys {
+		keys = append(keys, k)
+	}
+	keys = filterSettingKeys(keys, opts.Ignore)
+	sort.Strings(keys)
+
+	rows := make([]SettingDiff3, 0, len(keys))
+	for _, k := range keys {
+		row := SettingDiff3{
+			Name:       k,
+			BaseValue:  formatSettingValue(maps[0][k]),
+			LeftValue:  formatSettingValue(maps[1][k]),
+			RightValue: formatSettingValue(maps[2][k]),
+		}
+		row.Class, row.Odd = classify3(opts.compareValue(maps[0], k), opts.compareValue(maps[1], k), opts.compareValue(maps[2], k))
+		if row.Class != class3AllMatch {
+			mb := maskVolatile(row.BaseValue)
+			row.Volatile = mb == maskVolatile(row.LeftValue) && mb == maskVolatile(row.RightValue)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// classify3 classifies three values. When exactly one differs it also names
+// the odd side out.
+func classify3(b, l, r string) (class, odd string) {
+	switch {
+	case b == l && l == r:
+		return class3AllMatch, ""
+	case b == l:
+		return class3OneDiffers, "right"
+	case b == r:
+		return class3OneDiffers, "left"
+	case l == r:
+		return class3OneDiffers, "base"
+	default:
+		return class3AllDiffer, ""
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/dan/moe/internal/models"
+)
+
+// compareCacheSize is how many two-way comparisons are kept in memory. A
+// comparison of two large baselines holds every setting of both, so this is
+// kept small.
+const compareCacheSize = 16
+
+// compareKey identifies a comparison: the two snapshots and everything that
+// changes the diff computed between them.
+type compareKey struct {
+	left, right    string
+	filter         string
+	ignore         string // diffOptions.Ignore, comma-joined
+	strictEmpty    bool
+	ignoreVolatile bool
+}
+
+func newCompareKey(leftID, rightID, filter string, opts diffOptions) compareKey {
+	return compareKey{
+		left:           leftID,
+		right:          rightID,
+		filter:         filter,
+		ignore:         strings.Join(opts.Ignore, ","),
+		strictEmpty:    opts.StrictEmpty,
+		ignoreVolatile: opts.IgnoreVolatile,
+	}
+}
+
+type compareEntry struct {
+	key   compareKey
+	stats CompareStats
+	diffs []PolicyDiff
+}
+
+// compareCache is a least-recently-used cache of computed comparisons. Only
+// comparisons between complete snapshots are stored, since their items no
+// longer change. Cached diffs are shared between requests and must not be
+// modified.
+type compareCache struct {
+	size int
+
+	mu      sync.Mutex
+	order   *list.List // of *compareEntry, most recently used first
+	entries map[compareKey]*list.Element
+}
+
+func newCompareCache(size int) *compareCache {
+	return &compareCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[compareKey]*list.Element),
+	}
+}
+
+// get returns a cached comparison and marks it recently used.
+func (c *compareCache) get(k compareKey) (CompareStats, []PolicyDiff, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[k]
+	if !ok {
+		return CompareStats{}, nil, false
+	}
+	c.order.MoveToFront(el)
+	e := el.Value.(*compareEntry)
+	return e.stats, e.diffs, true
+}
+
+// put stores a comparison, evicting the least recently used one when full.
+func (c *compareCache) put(k compareKey, stats CompareStats, diffs []PolicyDiff) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[k]; ok {
+		c.order.MoveToFront(el)
+		el.Value = &compareEntry{key: k, stats: stats, diffs: diffs}
+		return
+	}
+	c.entries[k] = c.order.PushFront(&compareEntry{key: k, stats: stats, diffs: diffs})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*compareEntry).key)
+	}
+}
+
+// forget drops every comparison involving a snapshot, e.g. once it's deleted.
+func (c *compareCache) forget(snapshotID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, el := range c.entries {
+		if k.left == snapshotID || k.right == snapshotID {
+			c.order.Remove(el)
+			delete(c.entries, k)
+		}
+	}
+}
+
+// clear drops every comparison.
+func (c *compareCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	clear(c.entries)
+}
+
+// compareSnapshots diffs two snapshots' items, consulting the compare cache
+// first when both snapshots are complete.
+func (s *Server) compareSnapshots(left, right *models.PolicySnapshot, filter string, opts diffOptions) (CompareStats, []PolicyDiff, error) {
+	key := newCompareKey(left.ID, right.ID, filter, opts)
+	cacheable := left.Status == models.SnapshotStatusComplete && right.Status == models.SnapshotStatusComplete
+	if cacheable {
+		if stats, diffs, ok := s.compareCache.get(key); ok {
+			return stats, diffs, nil
+		}
+	}
+
+	leftItems, err := s.policies.ListItems(left.ID, "", "", "")
+	if err != nil {
+		return CompareStats{}, nil, fmt.Errorf("load left snapshot items: %w", err)
+	}
+	rightItems, err := s.policies.ListItems(right.ID, "", "", "")
+	if err != nil {
+		return CompareStats{}, nil, fmt.Errorf("load right snapshot items: %w", err)
+	}
+
+	stats, diffs := computeDiff(leftItems, rightItems, filter, opts)
+	if cacheable {
+		s.compareCache.put(key, stats, diffs)
+	}
+	return stats, diffs, nil
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"log"
+	"time"
+)
+
+// complianceRollupTick is how often the compliance rollup refreshes today's
+// counts. Each UTC day keeps the counts of its last refresh.
+const complianceRollupTick = time.Hour
+
+// Compliance trend report window, in days.
+const (
+	defaultTrendDays = 30
+	maxTrendDays     = 366
+)
+
+// complianceRollup records the fleet's compliance breakdown for the compliance
+// trend at startup and then every complianceRollupTick, until shutdown. Like
+// the other background jobs it is paused in maintenance mode.
+func (s *Server) complianceRollup() {
+	ticker := time.NewTicker(complianceRollupTick)
+	defer ticker.Stop()
+	for {
+		if !s.inMaintenance() {
+			if _, err := s.complianceTrend.Record(time.Now()); err != nil {
+				log.Printf("[trend] %v", err)
+			}
+		}
+		select {
+		case <-s.shutdownCtx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,36 +1,87 @@
 package server
 
 import (
+	"bytes"
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// consoleEventLimit is how many activity events the console shows.
+const consoleEventLimit = 100
+
+// Console event stream timings. Keepalives stop proxies from closing an
+// idle stream; a write that takes longer than the timeout means the client
+// is gone or stuck, and ends the stream.
+const (
+	consoleStreamKeepalive    = 30 * time.Second
+	consoleStreamWriteTimeout = 10 * time.Second
+)
+
+// activityEventTypes are the ActivityEvent types the console can filter on.
+var activityEventTypes = []string{"info", "success", "warning", "error"}
+
 // ── Template data ───────────────────────────────────────────────────────
 
 type consoleData struct {
-	Nav      string
-	Statuses map[string]*ProviderStatus
-	Events   []ActivityEvent
-	Seq      int64
+	Nav        string
+	Statuses   map[string]*ProviderStatus
+	Events     []ActivityEvent
+	Seq        int64
+	Limit      int
+	Filter     consoleFilter
+	Providers  []string
+	EventTypes []string
+}
+
+// consoleFilter narrows the activity feed to one provider and/or type.
+type consoleFilter struct {
+	Provider string
+	Type     string
+}
+
+// consoleFilterFromQuery reads the provider and type query parameters. An
+// unknown type is ignored rather than filtering everything out.
+func consoleFilterFromQuery(q url.Values) consoleFilter {
+	f := consoleFilter{Provider: q.Get("provider"), Type: q.Get("type")}
+	if !slices.Contains(activityEventTypes, f.Type) {
+		f.Type = ""
+	}
+	return f
 }
 
 // handleConsole renders the full console page.
 func (s *Server) handleConsole(w http.ResponseWriter, r *http.Request) {
+	filter := consoleFilterFromQuery(r.URL.Query())
+	providers, err := s.providerConfigs.ProviderNames()
+	if err != nil {
+		log.Printf("[console] list provider names: %v", err)
+	}
 	s.render.render(w, "console.html", consoleData{
-		Nav:      "console",
-		Statuses: s.status.All(),
-		Events:   s.activity.Recent(100),
-		Seq:      s.activity.Seq(),
+		Nav:        "console",
+		Statuses:   s.status.All(),
+		Events:     s.activity.RecentFiltered(consoleEventLimit, filter.Provider, filter.Type),
+		Seq:        s.activity.Seq(),
+		Limit:      consoleEventLimit,
+		Filter:     filter,
+		Providers:  providers,
+		EventTypes: activityEventTypes,
 	})
 }
 
 // handleConsoleEvents returns just the activity log rows as an HTML fragment,
-// for htmx polling. It returns 204 No Content if nothing has changed (htmx
-// will skip swapping).
+// for htmx polling and for re-filtering the feed. It returns 204 No Content
+// if nothing has changed (htmx will skip swapping).
 func (s *Server) handleConsoleEvents(w http.ResponseWriter, r *http.Request) {
 	// htmx sends the last known seq as a query param.
 	lastSeq := r.URL.Query().Get("seq")
 	currentSeq := s.activity.Seq()
+	filter := consoleFilterFromQuery(r.URL.Query())
 
 	if lastSeq == fmt.Sprintf("%d", currentSeq) {
 		w.WriteHeader(http.StatusNoContent) // 204 — htmx skips swap
@@ -41,11 +92,110 @@ func (s *Server) handleConsoleEvents(w http.ResponseWriter, r *http.Request) {
 		Events []ActivityEvent
 		Seq    int64
 	}{
-		Events: s.activity.Recent(100),
+		Events: s.activity.RecentFiltered(consoleEventLimit, filter.Provider, filter.Type),
 		Seq:    currentSeq,
 	})
 }
 
+// handleConsoleStream pushes activity events to the console as they are
+// added, as Server-Sent Events whose data is the rendered table row and
+// whose ID is the event's seq. It starts after the seq query parameter, or
+// after the Last-Event-ID an EventSource sends when it reconnects, so no
+// events are missed in between. The provider and type parameters filter it
+// like the console's feed. GET /console/stream
+func (s *Server) handleConsoleStream(w http.ResponseWriter, r *http.Request) {
+	filter := consoleFilterFromQuery(r.URL.Query())
+	after := s.activity.Seq()
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		after, _ = strconv.ParseInt(v, 10, 64)
+	} else if v := r.URL.Query().Get("seq"); v != "" {
+		after, _ = strconv.ParseInt(v, 10, 64)
+	}
+
+	events, backlog := s.activity.Subscribe(after)
+	defer s.activity.Unsubscribe(events)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	// write sends one SSE message and flushes it. Each write gets its own
+	// deadline in place of the server's WriteTimeout, which would otherwise
+	// cut every stream off after two minutes. The deadline is cleared once
+	// the write is through: under HTTP/2 it would otherwise expire while the
+	// stream sits idle between keepalives and reset it.
+	write := func(msg []byte) bool {
+		rc.SetWriteDeadline(time.Now().Add(consoleStreamWriteTimeout))
+		if _, err := w.Write(msg); err != nil {
+			return false
+		}
+		if rc.Flush() != nil {
+			return false
+		}
+		rc.SetWriteDeadline(time.Time{})
+		return true
+	}
+	send := func(e ActivityEvent) bool {
+		if !e.Matches(filter.Provider, filter.Type) {
+			return true
+		}
+		msg, err := s.consoleStreamMessage(e)
+		if err != nil {
+			log.Printf("[console] render stream event: %v", err)
+			return true // skip it rather than drop the stream
+		}
+		return write(msg)
+	}
+
+	if !write([]byte(": connected\n\n")) {
+		return
+	}
+	for _, e := range backlog {
+		if !send(e) {
+			return
+		}
+	}
+
+	keepalive := time.NewTicker(consoleStreamKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return // fell behind; the client reconnects and catches up
+			}
+			if !send(e) {
+				return
+			}
+		case <-keepalive.C:
+			if !write([]byte(": keepalive\n\n")) {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-s.shutdownCtx.Done():
+			return
+		}
+	}
+}
+
+// consoleStreamMessage renders an activity event as an SSE message carrying
+// its table row.
+func (s *Server) consoleStreamMessage(e ActivityEvent) ([]byte, error) {
+	var row bytes.Buffer
+	if err := s.render.executeBlock(&row, "console.html", "event-row", e); err != nil {
+		return nil, err
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "id: %d\n", e.Seq)
+	for _, line := range strings.Split(strings.TrimSpace(row.String()), "\n") {
+		fmt.Fprintf(&msg, "data: %s\n", line)
+	}
+	msg.WriteString("\n")
+	return msg.Bytes(), nil
+}
+
 // handleConsoleStatuses returns just the provider status cards as an HTML
 // fragment for htmx polling.
 func (s *Server) handleConsoleStatuses(w http.ResponseWriter, r *http.Request) {
@@ -56,6 +206,17 @@ func (s *Server) handleConsoleStatuses(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleProviderCheckAll starts a background re-check of every enabled
+// provider and redirects back. POST /providers/check
+func (s *Server) handleProviderCheckAll(w http.ResponseWriter, r *http.Request) {
+	if err := s.startHealthSweep(); err != nil {
+		http.Redirect(w, r, "/providers?flash="+url.QueryEscape(err.Error())+"&flash_type=info", http.StatusSeeOther)
+		return
+	}
+	s.auditf(r, "check", auditProvider, "", "all enabled providers")
+	http.Redirect(w, r, "/providers?flash=Re-checking+all+providers+—+see+the+console+for+results&flash_type=info", http.StatusSeeOther)
+}
+
 // handleProviderTest triggers an immediate connection test for a provider
 // and redirects back. POST /providers/{id}/test
 func (s *Server) handleProviderTest(w http.ResponseWriter, r *http.Request) {
@@ -68,6 +229,7 @@ func (s *Server) handleProviderTest(w http.ResponseWriter, r *http.Request) {
 
 	// Run the check synchronously (fast — just an auth call).
 	s.CheckProviderNow(cfg.Name, cfg.Type)
+	s.auditf(r, "test", auditProvider, id, "%s", cfg.Name)
 
 	status := s.status.Get(cfg.Name)
 	if status != nil && status.Status == "connected" {
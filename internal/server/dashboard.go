@@ -1,35 +1,158 @@
 package server
 
-import "net/http"
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/dan/moe/internal/models"
+)
+
+// recentChangeWindow is how far back the dashboard and the changes API look
+// for devices whose compliance or encryption state changed.
+const recentChangeWindow = 24 * time.Hour
+
+// maxDashboardChanges caps the recently changed devices listed on the
+// dashboard; the rest are counted.
+const maxDashboardChanges = 10
+
+// defaultStaleDeviceDays is used when Config.StaleDeviceDays is unset.
+const defaultStaleDeviceDays = 30
 
 // dashboardData is the template data for the dashboard page.
 type dashboardData struct {
-	Nav   string
-	Stats dashboardStats
+	Nav       string
+	Stats     dashboardStats
+	Fleet     dashboardFleet
+	Changes   dashboardChanges
+	Snapshots dashboardSnapshots
 }
 
 type dashboardStats struct {
 	Devices    int
+	Flagged    int // devices flagged for follow-up
 	Providers  int
 	Campaigns  int
 	Migrations int
 }
 
+// dashboardFleet is the at-a-glance fleet health rollup.
+type dashboardFleet struct {
+	Total      int
+	Compliance map[string]int // "compliant", "non-compliant", "unknown"
+	OS         []osCount      // largest first
+	Stale      int            // devices not seen for StaleDays
+	StaleDays  int
+}
+
+type osCount struct {
+	OS    string // "" when the provider reported none
+	Count int
+}
+
+// Percent returns the share of devices in a compliance state, for sizing
+// the compliance bar.
+func (f dashboardFleet) Percent(state string) int {
+	if f.Total == 0 {
+		return 0
+	}
+	return f.Compliance[state] * 100 / f.Total
+}
+
+// dashboardChanges lists devices whose compliance or encryption state
+// changed within recentChangeWindow.
+type dashboardChanges struct {
+	Devices []models.Device // most recent first, at most maxDashboardChanges
+	Total   int
+}
+
+// dashboardSnapshots summarises policy snapshot activity for the dashboard.
+type dashboardSnapshots struct {
+	Total     int
+	LatestPer []PolicySnapshotSummary // most recent complete snapshot per provider
+	Attention []PolicySnapshotSummary // snapshots still capturing or in error
+}
+
 // handleDashboard renders the main dashboard overview page.
 func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 	migrations, _ := s.db.MigrationCount()
 	deviceCount, _ := s.devices.Count()
+	flagged, _ := s.devices.CountFlagged()
 	providers, _ := s.providerConfigs.ListAll()
 
 	data := dashboardData{
 		Nav: "dashboard",
 		Stats: dashboardStats{
 			Devices:    deviceCount,
+			Flagged:    flagged,
 			Providers:  len(providers),
 			Campaigns:  0, // Populated in Phase 5
 			Migrations: migrations,
 		},
+		Fleet:     s.fleetHealth(deviceCount),
+		Changes:   s.recentChanges(),
+		Snapshots: s.snapshotActivity(),
 	}
 
 	s.render.render(w, "dashboard.html", data)
 }
+
+// fleetHealth builds the dashboard compliance, OS and staleness rollup.
+func (s *Server) fleetHealth(total int) dashboardFleet {
+	compliance, _ := s.devices.ComplianceBreakdown()
+	byOS, _ := s.devices.CountByOS()
+	stale, _ := s.devices.CountStale(time.Now().AddDate(0, 0, -s.cfg.StaleDeviceDays))
+
+	f := dashboardFleet{
+		Total:      total,
+		Compliance: compliance,
+		Stale:      stale,
+		StaleDays:  s.cfg.StaleDeviceDays,
+	}
+	for os, n := range byOS {
+		f.OS = append(f.OS, osCount{OS: os, Count: n})
+	}
+	sort.Slice(f.OS, func(i, j int) bool {
+		if f.OS[i].Count != f.OS[j].Count {
+			return f.OS[i].Count > f.OS[j].Count
+		}
+		return f.OS[i].OS < f.OS[j].OS
+	})
+	return f
+}
+
+// recentChanges builds the dashboard's recently changed devices feed.
+func (s *Server) recentChanges() dashboardChanges {
+	devices, _ := s.devices.RecentlyChanged(time.Now().Add(-recentChangeWindow))
+	c := dashboardChanges{Devices: devices, Total: len(devices)}
+	if len(c.Devices) > maxDashboardChanges {
+		c.Devices = c.Devices[:maxDashboardChanges]
+	}
+	return c
+}
+
+// snapshotActivity builds the dashboard snapshot summary. ListSnapshots is
+// newest first, so the first complete snapshot seen for a provider is its
+// latest.
+func (s *Server) snapshotActivity() dashboardSnapshots {
+	snapshots, _ := s.policies.ListSnapshots()
+
+	out := dashboardSnapshots{Total: len(snapshots)}
+	seen := make(map[string]bool)
+	for _, snap := range snapshots {
+		if snap.IsBenchmark {
+			out.Total--
+			continue
+		}
+		switch snap.Status {
+		case models.SnapshotStatusQueued, models.SnapshotStatusCapturing, models.SnapshotStatusError:
+			out.Attention = append(out.Attention, snapshotToSummary(snap))
+		default:
+			if !seen[snap.ProviderName] {
+				seen[snap.ProviderName] = true
+				out.LatestPer = append(out.LatestPer, snapshotToSummary(snap))
+			}
+		}
+	}
+	return out
+}
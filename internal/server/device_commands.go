@@ -0,0 +1,269 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dan/moe/internal/models"
+	"github.com/dan/moe/internal/provider"
+)
+
+// commandTimeout bounds a single device command dispatch to the provider.
+const commandTimeout = 30 * time.Second
+
+// maxBulkDevices caps the number of device IDs in one bulk request.
+const maxBulkDevices = 500
+
+// commandError is a dispatch failure with the HTTP status it maps to.
+type commandError struct {
+	status int
+	msg    string
+}
+
+func (e *commandError) Error() string { return e.msg }
+
+// commandStatus returns the HTTP status for a dispatchCommand error.
+func commandStatus(err error) int {
+	var ce *commandError
+	if errors.As(err, &ce) {
+		return ce.status
+	}
+	return http.StatusInternalServerError
+}
+
+// unsupportedActionError lists the valid actions for a bad one.
+func unsupportedActionError(action string) error {
+	return &commandError{http.StatusBadRequest, fmt.Sprintf("unsupported action %q; supported: %s",
+		action, strings.Join(provider.CommandActions, ", "))}
+}
+
+// dispatchCommand sends a command to one device through its provider and
+// logs the outcome to the activity log. built caches providers by name so a
+// bulk dispatch builds each provider (and its token cache) once; it may be nil.
+func (s *Server) dispatchCommand(ctx context.Context, device *models.Device, cmd provider.Command, built map[string]provider.Provider) (string, error) {
+	if !provider.IsCommandAction(cmd.Action) {
+		return "", unsupportedActionError(cmd.Action)
+	}
+	if device.SourceID == "" {
+		return "", &commandError{http.StatusConflict, "device has no source ID; it was not synced from a provider"}
+	}
+
+	p := built[device.ProviderName]
+	if p == nil {
+		cfg, err := s.providerConfigs.GetByName(device.ProviderName)
+		if err != nil || cfg == nil {
+			return "", &commandError{http.StatusConflict, "provider " + device.ProviderName + " is not configured"}
+		}
+		if !cfg.Enabled {
+			return "", &commandError{http.StatusConflict, "provider " + cfg.Name + " is disabled"}
+		}
+		p, err = s.buildProvider(cfg)
+		if err != nil {
+			return "", &commandError{http.StatusBadRequest, err.Error()}
+		}
+		if built != nil {
+			built[device.ProviderName] = p
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+	commandID, err := p.SendCommand(ctx, device.SourceID, cmd)
+	state := models.CommandStatePending
+	if err != nil {
+		state = models.CommandStateFailed
+	}
+	if rerr := s.devices.RecordCommand(device.ID, cmd.Action, state); rerr != nil {
+		log.Printf("[api] %v", rerr)
+	}
+	if err != nil {
+		log.Printf("[api] %s command to %s failed: %v", cmd.Action, device.DeviceName, err)
+		s.activity.Logf(device.ProviderName, "error", "Command %s to %s failed: %s", cmd.Action, device.DeviceName, err)
+		return "", &commandError{http.StatusBadGateway, err.Error()}
+	}
+
+	log.Printf("[api] dispatched %s to %s (%s)", cmd.Action, device.DeviceName, commandID)
+	s.activity.Logf(device.ProviderName, "info", "Command %s sent to %s", cmd.Action, device.DeviceName)
+	return commandID, nil
+}
+
+// POST /api/v1/devices/{id}/commands  {"action": "sync", "params": {...}}
+func (s *Server) apiSendDeviceCommand(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	device, err := s.devices.GetByID(id)
+	if err != nil {
+		log.Printf("[api] get device error: %v", err)
+		jsonError(w, http.StatusInternalServerError, "failed to get device")
+		return
+	}
+	if device == nil {
+		jsonError(w, http.StatusNotFound, "device not found")
+		return
+	}
+
+	var body struct {
+		Action string            `json:"action"`
+		Params map[string]string `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	commandID, err := s.dispatchCommand(r.Context(), device, provider.Command{Action: body.Action, Params: body.Params}, nil)
+	if err != nil {
+		jsonError(w, commandStatus(err), err.Error())
+		return
+	}
+	s.auditf(r, "command", auditDevice, device.ID, "%s sent to %s", body.Action, device.DeviceName)
+	jsonOK(w, map[string]any{
+		"command_id": commandID,
+		"device_id":  device.ID,
+		"action":     body.Action,
+	})
+}
+
+// handleDeviceCommand sends a command from the device detail page and
+// redirects back to it. POST /devices/{id}/command
+func (s *Server) handleDeviceCommand(w http.ResponseWriter, r *http.Request) {
+	device, err := s.devices.GetByID(r.PathValue("id"))
+	if err != nil || device == nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+	back := "/devices/" + device.ID
+
+	action := r.FormValue("action")
+	if _, err := s.dispatchCommand(r.Context(), device, provider.Command{Action: action}, nil); err != nil {
+		http.Redirect(w, r, back+"?flash="+url.QueryEscape(err.Error())+"&flash_type=error", http.StatusSeeOther)
+		return
+	}
+	s.auditf(r, "command", auditDevice, device.ID, "%s sent to %s", action, device.DeviceName)
+	http.Redirect(w, r, back+"?flash="+url.QueryEscape("Sent "+action+" to "+device.DeviceName)+"&flash_type=success", http.StatusSeeOther)
+}
+
+// ── Bulk actions ────────────────────────────────────────────────────────
+
+// Bulk actions accepted by POST /api/v1/devices/bulk.
+const (
+	bulkActionDelete  = "delete"
+	bulkActionCommand = "command"
+	bulkActionTag     = "tag"
+)
+
+// bulkResult is the per-device outcome of a bulk action.
+type bulkResult struct {
+	ID        string `json:"id"`
+	OK        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"`
+	CommandID string `json:"command_id,omitempty"`
+}
+
+// POST /api/v1/devices/bulk
+//
+//	{"action": "delete", "ids": [...]}
+//	{"action": "command", "command": "sync", "params": {...}, "ids": [...]}
+//	{"action": "tag", "tag": "kiosk", "ids": [...]}
+//
+// Each device is processed independently; the response lists a result per ID.
+func (s *Server) apiBulkDevices(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Action  string            `json:"action"`
+		IDs     []string          `json:"ids"`
+		Command string            `json:"command"`
+		Params  map[string]string `json:"params"`
+		Tag     string            `json:"tag"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if len(body.IDs) == 0 {
+		jsonError(w, http.StatusBadRequest, "'ids' must list at least one device")
+		return
+	}
+	if len(body.IDs) > maxBulkDevices {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("at most %d devices per request", maxBulkDevices))
+		return
+	}
+
+	switch body.Action {
+	case bulkActionDelete:
+	case bulkActionCommand:
+		if !provider.IsCommandAction(body.Command) {
+			jsonError(w, http.StatusBadRequest, unsupportedActionError(body.Command).Error())
+			return
+		}
+	case bulkActionTag:
+		tag, ok := cleanTag(body.Tag)
+		if !ok {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("'tag' must be 1-%d characters", maxTagLength))
+			return
+		}
+		body.Tag = tag
+	default:
+		jsonError(w, http.StatusBadRequest, "action must be 'delete', 'command' or 'tag'")
+		return
+	}
+
+	built := make(map[string]provider.Provider)
+	results := make([]bulkResult, 0, len(body.IDs))
+	succeeded := 0
+	for _, id := range body.IDs {
+		res := bulkResult{ID: id}
+		device, err := s.devices.GetByID(id)
+		switch {
+		case err != nil:
+			log.Printf("[api] bulk get device error: %v", err)
+			res.Error = "failed to get device"
+		case device == nil:
+			res.Error = "device not found"
+		case body.Action == bulkActionDelete:
+			if err := s.devices.Delete(id); err != nil {
+				res.Error = err.Error()
+			} else {
+				res.OK = true
+				s.auditf(r, "delete", auditDevice, id, "%s (bulk)", device.DeviceName)
+			}
+		case body.Action == bulkActionCommand:
+			res.CommandID, err = s.dispatchCommand(r.Context(), device, provider.Command{Action: body.Command, Params: body.Params}, built)
+			if err != nil {
+				res.Error = err.Error()
+			} else {
+				res.OK = true
+				s.auditf(r, "command", auditDevice, id, "%s sent to %s (bulk)", body.Command, device.DeviceName)
+			}
+		case body.Action == bulkActionTag:
+			if err := s.devices.AddTag(id, body.Tag); err != nil {
+				res.Error = err.Error()
+			} else {
+				res.OK = true
+				s.auditf(r, "tag", auditDevice, id, "%s tagged %q (bulk)", device.DeviceName, body.Tag)
+			}
+		}
+		if res.OK {
+			succeeded++
+		}
+		results = append(results, res)
+	}
+
+	if body.Action == bulkActionDelete && succeeded > 0 {
+		s.activity.Logf("system", "info", "Bulk deleted %d devices", succeeded)
+	}
+	if body.Action == bulkActionTag && succeeded > 0 {
+		s.activity.Logf("system", "info", "Tagged %d devices %q", succeeded, body.Tag)
+	}
+	jsonOK(w, map[string]any{
+		"action":    body.Action,
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+		"results":   results,
+	})
+}
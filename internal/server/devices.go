@@ -4,8 +4,12 @@ import (
 	"crypto/rand"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/dan/moe/internal/models"
+	"github.com/dan/moe/internal/provider"
+	"github.com/dan/moe/internal/store"
 )
 
 // ── Template data ───────────────────────────────────────────────────────
@@ -17,6 +21,15 @@ type deviceListData struct {
 	Total     int
 	Providers []string
 	OSList    []string
+	Tags      []string
+}
+
+type deviceDetailData struct {
+	Nav               string
+	Device            *models.Device
+	ComplianceHistory []models.ComplianceChange // newest first
+	SyncRuns          []models.SyncRun          // recent syncs of the device's provider
+	Commands          []string                  // actions the command form offers
 }
 
 type deviceFormData struct {
@@ -30,14 +43,8 @@ type deviceFormData struct {
 // ── Handlers ────────────────────────────────────────────────────────────
 
 func (s *Server) handleDeviceList(w http.ResponseWriter, r *http.Request) {
-	filter := models.DeviceFilter{
-		ProviderName: r.URL.Query().Get("provider"),
-		OS:           r.URL.Query().Get("os"),
-		Compliance:   r.URL.Query().Get("compliance"),
-		Search:       r.URL.Query().Get("q"),
-		Limit:        500,
-		Offset:       0,
-	}
+	filter := deviceFilterFromQuery(r.URL.Query())
+	filter.Limit = 500
 
 	devices, total, err := s.devices.List(filter)
 	if err != nil {
@@ -47,6 +54,7 @@ func (s *Server) handleDeviceList(w http.ResponseWriter, r *http.Request) {
 
 	providers, _ := s.devices.DistinctProviders()
 	osList, _ := s.devices.DistinctOS()
+	tags, _ := s.devices.DistinctTags()
 
 	s.render.render(w, "devices.html", deviceListData{
 		Nav:       "devices",
@@ -55,19 +63,14 @@ func (s *Server) handleDeviceList(w http.ResponseWriter, r *http.Request) {
 		Total:     total,
 		Providers: providers,
 		OSList:    osList,
+		Tags:      tags,
 	})
 }
 
 // handleDeviceRows renders just the table rows for htmx partial updates.
 func (s *Server) handleDeviceRows(w http.ResponseWriter, r *http.Request) {
-	filter := models.DeviceFilter{
-		ProviderName: r.URL.Query().Get("provider"),
-		OS:           r.URL.Query().Get("os"),
-		Compliance:   r.URL.Query().Get("compliance"),
-		Search:       r.URL.Query().Get("q"),
-		Limit:        500,
-		Offset:       0,
-	}
+	filter := deviceFilterFromQuery(r.URL.Query())
+	filter.Limit = 500
 
 	devices, _, err := s.devices.List(filter)
 	if err != nil {
@@ -82,12 +85,32 @@ func (s *Server) handleDeviceRows(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleDeviceDetail renders a read-only view of one device.
+func (s *Server) handleDeviceDetail(w http.ResponseWriter, r *http.Request) {
+	d, err := s.devices.GetByID(r.PathValue("id"))
+	if err != nil || d == nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+	d.Tags, _ = s.devices.TagsForDevice(d.ID)
+	history, _ := s.devices.ComplianceHistory(d.ID)
+	runs, _ := s.syncRuns.List(d.ProviderName, recentSyncRuns)
+
+	s.render.render(w, "device_detail.html", deviceDetailData{
+		Nav:               "devices",
+		Device:            d,
+		ComplianceHistory: history,
+		SyncRuns:          runs,
+		Commands:          provider.CommandActions,
+	})
+}
+
 func (s *Server) handleDeviceNew(w http.ResponseWriter, r *http.Request) {
 	providers, _ := s.providerConfigs.ListAll()
 
 	s.render.render(w, "device_form.html", deviceFormData{
 		Nav:       "devices",
-		Device:    &models.Device{Compliance: "unknown"},
+		Device:    &models.Device{Compliance: "unknown", Ownership: "unknown"},
 		Providers: providers,
 		IsNew:     true,
 	})
@@ -112,6 +135,7 @@ func (s *Server) handleDeviceCreate(w http.ResponseWriter, r *http.Request) {
 		UserName:     r.FormValue("user_name"),
 		UserEmail:    r.FormValue("user_email"),
 		Compliance:   r.FormValue("compliance"),
+		Ownership:    r.FormValue("ownership"),
 	}
 
 	// Look up provider type from config.
@@ -147,6 +171,7 @@ func (s *Server) handleDeviceCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.auditf(r, "create", auditDevice, d.ID, "%s", d.DeviceName)
 	http.Redirect(w, r, "/devices?flash=Device+created&flash_type=success", http.StatusSeeOther)
 }
 
@@ -192,6 +217,7 @@ func (s *Server) handleDeviceUpdate(w http.ResponseWriter, r *http.Request) {
 	d.UserName = r.FormValue("user_name")
 	d.UserEmail = r.FormValue("user_email")
 	d.Compliance = r.FormValue("compliance")
+	d.Ownership = r.FormValue("ownership")
 
 	for _, p := range providers {
 		if p.Name == d.ProviderName {
@@ -222,6 +248,7 @@ func (s *Server) handleDeviceUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.auditf(r, "update", auditDevice, d.ID, "%s", d.DeviceName)
 	http.Redirect(w, r, "/devices?flash=Device+updated&flash_type=success", http.StatusSeeOther)
 }
 
@@ -231,9 +258,104 @@ func (s *Server) handleDeviceDelete(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.auditf(r, "delete", auditDevice, id, "")
 	http.Redirect(w, r, "/devices?flash=Device+deleted&flash_type=success", http.StatusSeeOther)
 }
 
+// handleDeviceFlag toggles a device's follow-up flag and re-renders its row
+// for htmx.
+func (s *Server) handleDeviceFlag(w http.ResponseWriter, r *http.Request) {
+	d, err := s.toggleDeviceFlag(r.PathValue("id"), nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if d == nil {
+		http.NotFound(w, r)
+		return
+	}
+	s.auditDeviceFlag(r, d)
+	s.render.renderBlock(w, "devices.html", "device-row", d)
+}
+
+// auditDeviceFlag records a flag change made by toggleDeviceFlag.
+func (s *Server) auditDeviceFlag(r *http.Request, d *models.Device) {
+	action := "unflag"
+	if d.Flagged {
+		action = "flag"
+	}
+	s.auditf(r, action, auditDevice, d.ID, "%s", d.DeviceName)
+}
+
+// toggleDeviceFlag sets a device's follow-up flag to *flagged, or flips it
+// when flagged is nil, and returns the updated device. A nil device means
+// it does not exist.
+func (s *Server) toggleDeviceFlag(id string, flagged *bool) (*models.Device, error) {
+	d, err := s.devices.GetByID(id)
+	if err != nil || d == nil {
+		return nil, err
+	}
+	want := !d.Flagged
+	if flagged != nil {
+		want = *flagged
+	}
+	if err := s.devices.SetFlagged(d.ID, want); err != nil {
+		return nil, err
+	}
+	d.Flagged = want
+	return d, nil
+}
+
+// maxTagLength bounds a device tag so tags stay usable as filter labels.
+const maxTagLength = 64
+
+// cleanTag normalises a device tag: trimmed and lower-cased, so "Kiosk" and
+// "kiosk " are the same group. ok is false for empty or over-long tags.
+func cleanTag(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	return tag, tag != "" && len(tag) <= maxTagLength
+}
+
+// deviceFilterFromQuery builds a DeviceFilter from the query parameters shared
+// by the device list page, its htmx rows, and the device API endpoints.
+// Pagination is left to the caller.
+func deviceFilterFromQuery(q url.Values) models.DeviceFilter {
+	// Tags are stored lower-cased; an over-long tag simply matches nothing.
+	tag, _ := cleanTag(q.Get("tag"))
+	return models.DeviceFilter{
+		ProviderName:    q.Get("provider"),
+		OS:              q.Get("os"),
+		Compliance:      q.Get("compliance"),
+		Ownership:       q.Get("ownership"),
+		ManagementAgent: q.Get("agent"),
+		Search:          q.Get("q"),
+		Flagged:         q.Get("flagged") == "true",
+		Tag:             tag,
+		Status:          q.Get("status"),
+		OSVersionMin:    q.Get("os_version_min"),
+		OSVersionMax:    q.Get("os_version_max"),
+		StaleDays:       queryInt(q, "stale_days", 0),
+		SortBy:          q.Get("sort"),
+		SortDir:         q.Get("dir"),
+	}
+}
+
+// invalidVersionBounds returns an error message for an OS version bound
+// that isn't a version number, or "" when both are usable. The store
+// ignores unusable bounds, so the API checks them up front.
+func invalidVersionBounds(f models.DeviceFilter) string {
+	bounds := []struct{ param, v string }{
+		{"os_version_min", f.OSVersionMin},
+		{"os_version_max", f.OSVersionMax},
+	}
+	for _, b := range bounds {
+		if _, ok := store.OSVersionKey(b.v); b.v != "" && !ok {
+			return fmt.Sprintf("invalid %s %q; expected a version such as 17 or 17.2.1", b.param, b.v)
+		}
+	}
+	return ""
+}
+
 // newID generates a short random hex ID.
 func newID() string {
 	b := make([]byte, 16)
@@ -3,6 +3,8 @@ package server
 import (
 	"encoding/json"
 	"net/http"
+	"sort"
+	"time"
 )
 
 // healthResponse is the JSON shape returned by the health endpoint.
@@ -10,14 +12,39 @@ type healthResponse struct {
 	Status     string `json:"status"`
 	DB         string `json:"db"`
 	Migrations int    `json:"migrations_applied"`
+
+	// Providers lists the enabled providers' last health check results.
+	// Disabled providers aren't tracked, so they don't appear.
+	Providers          []healthProvider `json:"providers"`
+	ProvidersConnected int              `json:"providers_connected"`
+	ProvidersErrored   int              `json:"providers_errored"`
+}
+
+// healthProvider is one provider's entry in the health response.
+type healthProvider struct {
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Status    string    `json:"status"` // "connected", "error", "checking"
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	Silenced  bool      `json:"silenced,omitempty"`
 }
 
-// handleHealth reports whether the server and database are operational.
+// handleHealth reports whether the server, database and providers are
+// operational. The status is "degraded" when the database is unreachable,
+// which also answers 503, or when a provider's last check failed, which
+// doesn't: the server itself can still serve requests. Provider state comes
+// from the in-memory status tracker, so probing this endpoint never
+// contacts a provider.
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	resp := healthResponse{
 		Status: "ok",
 		DB:     "connected",
 	}
+	resp.Providers, resp.ProvidersConnected, resp.ProvidersErrored = providerHealth(s.status.All())
+	if resp.ProvidersErrored > 0 {
+		resp.Status = "degraded"
+	}
 
 	if err := s.db.Ping(); err != nil {
 		resp.Status = "degraded"
@@ -33,3 +60,27 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+// providerHealth summarises tracked provider statuses for the health
+// response, sorted by name, with how many are connected and in error.
+func providerHealth(statuses map[string]*ProviderStatus) (providers []healthProvider, connected, errored int) {
+	providers = make([]healthProvider, 0, len(statuses))
+	for _, st := range statuses {
+		providers = append(providers, healthProvider{
+			Name:      st.Name,
+			Type:      st.Type,
+			Status:    st.Status,
+			Error:     st.Error,
+			CheckedAt: st.CheckedAt,
+			Silenced:  st.Silenced,
+		})
+		switch st.Status {
+		case "connected":
+			connected++
+		case "error":
+			errored++
+		}
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].Name < providers[j].Name })
+	return providers, connected, errored
+}
@@ -2,21 +2,26 @@ package server
 
 import (
 	"context"
+	"errors"
 	"log"
 	"sync"
 	"time"
+
+	"github.com/dan/moe/internal/metrics"
+	"github.com/dan/moe/internal/models"
 )
 
-const healthCheckInterval = 2 * time.Minute
-const healthCheckTimeout = 15 * time.Second
+// healthTick is how often the poller looks for providers that are due a
+// check. Each provider is checked on its own interval (see healthInterval).
+const healthTick = MinHealthInterval / 2
 
 // healthPoller runs in a goroutine and periodically checks all enabled
 // providers in parallel, updating the status tracker and activity log.
 func (s *Server) healthPoller() {
 	// Run an initial check immediately after startup.
-	s.checkAllProviders()
+	s.sweepIfIdle(true)
 
-	ticker := time.NewTicker(healthCheckInterval)
+	ticker := time.NewTicker(healthTick)
 	defer ticker.Stop()
 
 	for {
@@ -25,13 +30,78 @@ func (s *Server) healthPoller() {
 			log.Println("[health] poller stopped")
 			return
 		case <-ticker.C:
-			s.checkAllProviders()
+			s.sweepIfIdle(false)
 		}
 	}
 }
 
-// checkAllProviders tests connectivity to every enabled provider in parallel.
-func (s *Server) checkAllProviders() {
+// errSweepRunning is returned by startHealthSweep while a sweep is running.
+var errSweepRunning = errors.New("a health check of all providers is already running")
+
+// errSweepMaintenance is returned by startHealthSweep in maintenance mode.
+var errSweepMaintenance = errors.New("health checks are paused in maintenance mode")
+
+// sweepIfIdle runs checkAllProviders unless a sweep is already running, in
+// which case this tick is skipped.
+func (s *Server) sweepIfIdle(force bool) {
+	if !s.healthSweeping.CompareAndSwap(false, true) {
+		return
+	}
+	defer s.healthSweeping.Store(false)
+	s.checkAllProviders(force)
+}
+
+// startHealthSweep forces a check of every enabled provider in the
+// background and returns immediately. Only one sweep runs at a time, so
+// repeated requests don't stack up concurrent checks of every tenant.
+func (s *Server) startHealthSweep() error {
+	if s.inMaintenance() {
+		return errSweepMaintenance
+	}
+	if !s.healthSweeping.CompareAndSwap(false, true) {
+		return errSweepRunning
+	}
+	s.bgWg.Add(1)
+	go func() {
+		defer s.bgWg.Done()
+		defer s.healthSweeping.Store(false)
+		s.checkAllProviders(true)
+	}()
+	return nil
+}
+
+// healthInterval returns how often cfg should be health checked: its own
+// HealthInterval if that parses, otherwise the server default. Either way
+// it is at least MinHealthInterval.
+func (s *Server) healthInterval(cfg models.ProviderConfig) time.Duration {
+	d, err := time.ParseDuration(cfg.HealthInterval)
+	if err != nil || d <= 0 {
+		d = s.cfg.HealthInterval
+	}
+	return max(d, MinHealthInterval)
+}
+
+// healthDue reports whether cfg's last check is old enough for another.
+// Half a tick of slack stops a check from slipping to the following tick
+// because the previous one finished a moment after its tick fired.
+func (s *Server) healthDue(cfg models.ProviderConfig, now time.Time) bool {
+	if cfg.LastCheckAt.IsZero() {
+		return true
+	}
+	return now.Sub(cfg.LastCheckAt) >= s.healthInterval(cfg)-healthTick/2
+}
+
+// checkAllProviders tests connectivity to every enabled provider that is
+// due a check, in parallel; all of them when force is set. It is skipped
+// while maintenance mode is active.
+func (s *Server) checkAllProviders(force bool) {
+	if s.inMaintenance() {
+		if force {
+			log.Println("[health] paused — maintenance mode active")
+		}
+		return
+	}
+
 	configs, err := s.providerConfigs.ListEnabled()
 	if err != nil {
 		log.Printf("[health] failed to list providers: %v", err)
@@ -39,14 +109,29 @@ func (s *Server) checkAllProviders() {
 	}
 
 	if len(configs) == 0 {
+		s.recordProviderMetrics(configs)
 		return
 	}
 
-	log.Printf("[health] checking %d provider(s)…", len(configs))
-	s.activity.Logf("system", "info", "Health check started for %d provider(s)", len(configs))
+	due := configs
+	if !force {
+		due = nil
+		now := time.Now()
+		for _, cfg := range configs {
+			if s.healthDue(cfg, now) {
+				due = append(due, cfg)
+			}
+		}
+		if len(due) == 0 {
+			return
+		}
+	}
+
+	log.Printf("[health] checking %d provider(s)…", len(due))
+	s.activity.Logf("system", "info", "Health check started for %d provider(s)", len(due))
 
 	var wg sync.WaitGroup
-	for _, cfg := range configs {
+	for _, cfg := range due {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -54,13 +139,37 @@ func (s *Server) checkAllProviders() {
 		}()
 	}
 	wg.Wait()
+	s.recordProviderMetrics(configs)
 
 	s.activity.Logf("system", "info", "Health check complete")
 }
 
+// recordProviderMetrics refreshes the provider health and device count
+// gauges from the status tracker and device store.
+func (s *Server) recordProviderMetrics(configs []models.ProviderConfig) {
+	health := make([]metrics.ProviderHealth, 0, len(configs))
+	for _, cfg := range configs {
+		st := s.status.Get(cfg.Name)
+		health = append(health, metrics.ProviderHealth{
+			Name: cfg.Name,
+			Type: cfg.Type,
+			Up:   st != nil && st.Status == "connected",
+		})
+	}
+	metrics.SetProviderHealth(health)
+
+	counts, err := s.devices.CountByProvider()
+	if err != nil {
+		log.Printf("[health] count devices for metrics: %v", err)
+		return
+	}
+	metrics.SetDeviceCounts(counts)
+}
+
 // checkProvider tests a single provider and updates the status tracker.
 func (s *Server) checkProvider(name, providerType string) {
-	// Mark as checking.
+	// Mark as checking, remembering the previous status to spot a recovery.
+	prev := s.status.Get(name)
 	s.status.Set(&ProviderStatus{
 		Name:      name,
 		Type:      providerType,
@@ -91,13 +200,14 @@ func (s *Server) checkProvider(name, providerType string) {
 			Error:       err.Error(),
 			CheckedAt:   time.Now().UTC(),
 			ConsecFails: fails,
+			Silenced:    cfg.IsSilenced(),
 		})
 		_ = s.providerConfigs.RecordCheckResult(name, false, err.Error(), fails)
-		s.activity.Logf(name, "error", "Build failed: %s", err)
+		s.notify(cfg, "error", "Build failed: %s", err)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.HealthTimeout)
 	defer cancel()
 
 	start := time.Now()
@@ -114,22 +224,45 @@ func (s *Server) checkProvider(name, providerType string) {
 			CheckedAt:   time.Now().UTC(),
 			Latency:     latency,
 			ConsecFails: fails,
+			Silenced:    cfg.IsSilenced(),
 		})
 		_ = s.providerConfigs.RecordCheckResult(name, false, checkErr.Error(), fails)
-		s.activity.Logf(name, "error", "Connection failed (%s): %s", latency.Round(time.Millisecond), checkErr)
+		s.notify(cfg, "error", "Connection failed (%s): %s", latency.Round(time.Millisecond), checkErr)
 		log.Printf("[health] %s: FAIL (%s) — %v", name, latency.Round(time.Millisecond), checkErr)
 	} else {
+		// Only successful checks are sampled: a failure's latency measures
+		// how quickly it failed, not how responsive the provider is.
+		s.status.RecordLatency(name, latency)
 		s.status.Set(&ProviderStatus{
 			Name:      name,
 			Type:      providerType,
 			Status:    "connected",
 			CheckedAt: time.Now().UTC(),
 			Latency:   latency,
+			Silenced:  cfg.IsSilenced(),
 		})
 		_ = s.providerConfigs.RecordCheckResult(name, true, "", 0)
-		s.activity.Logf(name, "success", "Connected (%s)", latency.Round(time.Millisecond))
-		log.Printf("[health] %s: OK (%s)", name, latency.Round(time.Millisecond))
+		if isRecovery(prev, cfg.ConsecFails) {
+			s.notify(cfg, "success", "Recovered after %d failed check(s) (%s)", max(cfg.ConsecFails, 1), latency.Round(time.Millisecond))
+			log.Printf("[health] %s: RECOVERED (%s) after %d failed check(s)", name, latency.Round(time.Millisecond), max(cfg.ConsecFails, 1))
+		} else {
+			s.activity.Logf(name, "success", "Connected (%s)", latency.Round(time.Millisecond))
+			log.Printf("[health] %s: OK (%s)", name, latency.Round(time.Millisecond))
+		}
+	}
+}
+
+// testProviderConfig builds a provider from cfg and tests its connection,
+// without touching the status tracker or the stored config. cfg need not be
+// saved yet, so the provider form can verify settings before persisting.
+func (s *Server) testProviderConfig(ctx context.Context, cfg *models.ProviderConfig) error {
+	p, err := s.buildProvider(cfg)
+	if err != nil {
+		return err
 	}
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.HealthTimeout)
+	defer cancel()
+	return p.TestConnection(ctx)
 }
 
 // CheckProviderNow runs an immediate health check for a single provider
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// settingMaintenance is the settings key that persists maintenance mode
+// across restarts.
+const settingMaintenance = "maintenance_mode"
+
+// loadMaintenance restores maintenance mode from the settings table.
+func (s *Server) loadMaintenance() {
+	v, err := s.settings.Get(settingMaintenance)
+	if err != nil {
+		log.Printf("[startup] load maintenance mode: %v", err)
+		return
+	}
+	s.maintenance.Store(v == "on")
+}
+
+// inMaintenance reports whether background jobs are paused.
+func (s *Server) inMaintenance() bool {
+	return s.maintenance.Load()
+}
+
+// setMaintenance persists and applies maintenance mode.
+func (s *Server) setMaintenance(on bool, by string) error {
+	val := "off"
+	if on {
+		val = "on"
+	}
+	if err := s.settings.Set(settingMaintenance, val); err != nil {
+		return err
+	}
+	s.maintenance.Store(on)
+
+	if on {
+		log.Printf("[maintenance] enabled by %s — background jobs paused", by)
+		s.activity.Logf("system", "warning", "Maintenance mode enabled by %s — background jobs paused", by)
+	} else {
+		log.Printf("[maintenance] disabled by %s — background jobs resumed", by)
+		s.activity.Logf("system", "info", "Maintenance mode disabled by %s — background jobs resumed", by)
+	}
+	return nil
+}
+
+// auditMaintenance records an operator turning maintenance mode on or off.
+func (s *Server) auditMaintenance(r *http.Request, on bool) {
+	action := "maintenance-off"
+	if on {
+		action = "maintenance-on"
+	}
+	s.auditf(r, action, auditServer, "", "")
+}
+
+// handleMaintenanceToggle flips maintenance mode and redirects back to the
+// referring page. POST /maintenance
+func (s *Server) handleMaintenanceToggle(w http.ResponseWriter, r *http.Request) {
+	on := !s.inMaintenance()
+	if err := s.setMaintenance(on, "operator"); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.auditMaintenance(r, on)
+
+	// Return to the page the toggle was clicked on (path only).
+	back := "/console"
+	if ref, err := url.Parse(r.Referer()); err == nil && strings.HasPrefix(ref.Path, "/") {
+		back = ref.Path
+	}
+	msg := "Maintenance+mode+disabled"
+	if on {
+		msg = "Maintenance+mode+enabled"
+	}
+	http.Redirect(w, r, back+"?flash="+msg+"&flash_type=success", http.StatusSeeOther)
+}
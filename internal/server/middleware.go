@@ -3,15 +3,22 @@ package server
 import (
 	"log"
 	"net/http"
+	"net/url"
 	"runtime/debug"
+	"strings"
 	"time"
+
+	"github.com/dan/moe/internal/metrics"
+	"github.com/dan/moe/internal/provider"
 )
 
-// responseWriter wraps http.ResponseWriter to capture the status code.
+// responseWriter wraps http.ResponseWriter to capture the status code and
+// the route that handled the request.
 type responseWriter struct {
 	http.ResponseWriter
 	status int
 	wrote  bool
+	route  string // ServeMux pattern, set by notFound
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
@@ -30,13 +37,61 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return rw.ResponseWriter.Write(b)
 }
 
-// logging logs every request with method, path, status, and duration.
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// flush a streamed response.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// requestIDHeader carries a request's ID in both directions.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen bounds a client-supplied request ID.
+const maxRequestIDLen = 64
+
+// requestIDs gives every request an ID: the client's X-Request-ID when it is
+// a sensible token, otherwise a fresh one. The ID is echoed in the response
+// header and stored in the request context, where logging and the providers
+// pick it up.
+func requestIDs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(provider.WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID reports whether a client-supplied ID is safe to log and
+// echo: at most maxRequestIDLen letters, digits, '-', '_' or '.'.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// logging logs every request with method, path, status, duration and
+// request ID, and records it in the request metrics under the route pattern
+// notFound saw matched.
 func logging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
 		next.ServeHTTP(rw, r)
-		log.Printf("%s %s %d %s", r.Method, r.URL.Path, rw.status, time.Since(start).Round(time.Microsecond))
+		elapsed := time.Since(start)
+		log.Printf("%s %s %d %s req=%s", r.Method, r.URL.Path, rw.status, elapsed.Round(time.Microsecond), provider.RequestID(r.Context()))
+		metrics.ObserveRequest(r.Method, rw.route, rw.status, elapsed)
 	})
 }
 
@@ -54,12 +109,43 @@ func recovery(next http.Handler) http.Handler {
 	})
 }
 
+// DefaultContentSecurityPolicy is the Content-Security-Policy sent when
+// Config leaves it unset. htmx and Alpine are served from /static, so
+// everything loads from our own origin, but the templates rely on inline
+// event handlers and style attributes, Alpine evaluates its expressions
+// with Function, and htmx injects its indicator styles; hence the
+// 'unsafe-inline' and 'unsafe-eval' sources.
+const DefaultContentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self' 'unsafe-inline' 'unsafe-eval'; " +
+	"style-src 'self' 'unsafe-inline'; " +
+	"img-src 'self' data:; " +
+	"connect-src 'self'; " +
+	"object-src 'none'; " +
+	"base-uri 'self'; " +
+	"form-action 'self'; " +
+	"frame-ancestors 'none'"
+
+// securityHeaders sets the browser hardening headers on every response.
+// They are set before the handler runs, so a handler can still override
+// one for its own response.
+func securityHeaders(csp string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Security-Policy", csp)
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "same-origin")
+		next.ServeHTTP(w, r)
+	})
+}
+
 // notFound wraps a ServeMux so that unknown routes get a styled 404 page
 // instead of Go's default plain text response.
 func notFound(mux *http.ServeMux, fallback http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Check whether the mux has a real (non-default) handler for this request.
 		_, pattern := mux.Handler(r)
+		setRoute(w, pattern)
 		if pattern == "" {
 			fallback.ServeHTTP(w, r)
 			return
@@ -67,3 +153,58 @@ func notFound(mux *http.ServeMux, fallback http.Handler) http.Handler {
 		mux.ServeHTTP(w, r)
 	})
 }
+
+// setRoute records the pattern that routed a request for logging. The
+// ServeMux sets r.Pattern only on the request it is handed, and middleware
+// such as requireAuth passes on a copy, so logging can't read it there.
+func setRoute(w http.ResponseWriter, pattern string) {
+	if rw, ok := w.(*responseWriter); ok {
+		rw.route = pattern
+	}
+}
+
+// readOnlySafePaths are POST endpoints that change nothing, so read-only
+// mode lets them through.
+var readOnlySafePaths = map[string]bool{
+	"/api/v1/policies/snapshots/import/preview": true,
+	"/api/v1/policies/compare/upload":           true,
+}
+
+// readOnlyMessage explains why a request was refused in read-only mode.
+const readOnlyMessage = "MOE is in read-only mode; changes are disabled"
+
+// readOnly refuses any request other than GET, HEAD or OPTIONS, except
+// signing in and out and POSTs in readOnlySafePaths. API callers get a 403
+// JSON error; browsers are sent back to the referring page with the message
+// as a flash (htmx via HX-Redirect).
+func readOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.URL.Path == "/login" || r.URL.Path == "/logout" || readOnlySafePaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			jsonError(w, http.StatusForbidden, readOnlyMessage)
+			return
+		}
+		// Return to the referring page, query included, if it is local.
+		back, q := "/", url.Values{}
+		if ref, err := url.Parse(r.Referer()); err == nil && safeNext(ref.Path) == ref.Path {
+			back, q = ref.Path, ref.Query()
+		}
+		q.Set("flash", readOnlyMessage)
+		q.Set("flash_type", "error")
+		back += "?" + q.Encode()
+		if r.Header.Get("HX-Request") == "true" {
+			w.Header().Set("HX-Redirect", back)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.Redirect(w, r, back, http.StatusSeeOther)
+	})
+}
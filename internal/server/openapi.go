@@ -0,0 +1,538 @@
+package server
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dan/moe/internal/models"
+)
+
+// ── OpenAPI spec ────────────────────────────────────────────────────────
+
+// apiOp documents one /api/v1 endpoint. Data and Body are zero values of the
+// Go types the handler encodes and decodes, so the component schemas are
+// reflected from the real structs. Data is wrapped in the apiResponse
+// envelope unless Raw names the content type of a file download.
+type apiOp struct {
+	Method  string
+	Path    string
+	Summary string
+	Query   []apiParam
+	Body    any
+	Form    []apiParam // multipart/form-data fields; Type "file" is an upload
+	Data    any
+	Status  int    // success status; 0 means 200
+	Raw     string // content type of a non-envelope response
+}
+
+// apiParam is an optional query parameter.
+type apiParam struct {
+	Name string
+	Type string // "string", "integer" or "boolean"; "file" in apiOp.Form
+	Desc string
+}
+
+// apiFields describes a handler that responds with a map[string]any; each
+// value is a zero value of the type stored under that key. Keys ending in
+// "?" are only present sometimes.
+type apiFields map[string]any
+
+// Query parameters shared by several endpoints.
+var (
+	deviceFilterParams = []apiParam{
+		{"provider", "string", "Provider name"},
+		{"os", "string", "Operating system"},
+		{"compliance", "string", "compliant, non-compliant or unknown"},
+		{"ownership", "string", "corporate, personal or unknown"},
+		{"agent", "string", "Management agent"},
+		{"q", "string", "Free-text search across name, user, email, model, serial number and IMEI"},
+		{"flagged", "boolean", "Only devices flagged for follow-up"},
+		{"tag", "string", "Only devices carrying this tag"},
+		{"status", "string", "active or retired"},
+		{"os_version_min", "string", "Only OS versions at or above this, compared numerically (e.g. 16.4)"},
+		{"os_version_max", "string", "Only OS versions below this, compared numerically (e.g. 17)"},
+		{"stale_days", "integer", "Only devices last seen more than this many days ago"},
+		{"sort", "string", "device_name, provider_name, os, compliance, last_seen, enrolled_at or updated_at"},
+		{"dir", "string", "asc or desc"},
+	}
+	pageParams = []apiParam{
+		{"limit", "integer", "Maximum results to return"},
+		{"offset", "integer", "Results to skip"},
+	}
+	diffParams = []apiParam{
+		{"ignore", "string", "Comma-separated setting-name patterns to exclude, e.g. lastModified*,version"},
+		{"strict_empty", "boolean", "Treat absent settings as different from empty ones"},
+		{"ignore_volatile", "boolean", "Treat timestamp/GUID-only changes as matching"},
+	}
+)
+
+// apiOps lists every /api/v1 endpoint. Keep it in step with routes.go;
+// TestAPIOpsCoverRoutes fails when a route is missing here.
+var apiOps = []apiOp{
+	// Devices
+	{Method: "GET", Path: "/api/v1/devices", Summary: "List devices",
+		Query: append(append([]apiParam{}, deviceFilterParams...), pageParams...),
+		Data: apiFields{"devices": []apiDevice{}, "total": 0, "limit": 0, "offset": 0,
+			"has_more": false, "next_offset": (*int)(nil), "prev_offset": (*int)(nil)}},
+	{Method: "DELETE", Path: "/api/v1/devices", Summary: "Delete every device matching a filter (at least one is required)",
+		Query: deviceFilterParams[:len(deviceFilterParams)-2], // sort and dir don't apply
+		Data:  apiFields{"deleted": 0}},
+	{Method: "GET", Path: "/api/v1/devices/export/csv", Summary: "Export devices as CSV",
+		Query: deviceFilterParams, Raw: "text/csv"},
+	{Method: "POST", Path: "/api/v1/devices/import/csv", Summary: "Create or update devices from a CSV in the export's format",
+		Form: []apiParam{
+			{"file", "file", "CSV with a header row; ProviderName and SourceID identify each device, and an update changes only the columns given"},
+			{"provider", "string", "Provider of rows without a ProviderName"},
+		},
+		Data: deviceImportResult{}},
+	{Method: "GET", Path: "/api/v1/devices/stats", Summary: "Count devices by OS, compliance, provider and ownership",
+		Data: apiDeviceStats{}},
+	{Method: "GET", Path: "/api/v1/devices/stale", Summary: "List devices not seen recently",
+		Query: append(append([]apiParam{{"days", "integer", "Stale threshold in days"}}, deviceFilterParams...), pageParams...),
+		Data: apiFields{"devices": []apiDevice{}, "total": 0, "days": 0, "stale_before": time.Time{}, "limit": 0, "offset": 0,
+			"has_more": false, "next_offset": (*int)(nil), "prev_offset": (*int)(nil)}},
+	{Method: "GET", Path: "/api/v1/devices/changes", Summary: "List devices whose compliance or encryption changed recently",
+		Query: []apiParam{{"since", "string", "RFC 3339 time; defaults to 24 hours ago"}},
+		Data:  apiFields{"devices": []apiDevice{}, "total": 0, "since": time.Time{}}},
+	{Method: "POST", Path: "/api/v1/devices/bulk", Summary: "Delete, command or tag several devices",
+		Body: struct {
+			Action  string            `json:"action"`
+			IDs     []string          `json:"ids"`
+			Command string            `json:"command,omitempty"`
+			Params  map[string]string `json:"params,omitempty"`
+			Tag     string            `json:"tag,omitempty"`
+		}{},
+		Data: apiFields{"action": "", "succeeded": 0, "failed": 0, "results": []bulkResult{}}},
+	{Method: "GET", Path: "/api/v1/devices/{id}", Summary: "Get a device",
+		Data: apiDevice{}},
+	{Method: "POST", Path: "/api/v1/devices/{id}/commands", Summary: "Send a command to a device",
+		Body: struct {
+			Action string            `json:"action"`
+			Params map[string]string `json:"params,omitempty"`
+		}{},
+		Data: apiFields{"command_id": "", "device_id": "", "action": ""}},
+	{Method: "POST", Path: "/api/v1/devices/{id}/flag", Summary: "Set a device's follow-up flag",
+		Body: struct {
+			Flagged bool `json:"flagged"`
+		}{},
+		Data: apiFields{"id": "", "flagged": false}},
+	{Method: "POST", Path: "/api/v1/devices/{id}/tags", Summary: "Tag a device",
+		Body: struct {
+			Tag string `json:"tag"`
+		}{},
+		Data: apiFields{"id": "", "tags": []string{}}},
+	{Method: "DELETE", Path: "/api/v1/devices/{id}/tags/{tag}", Summary: "Remove a tag from a device",
+		Data: apiFields{"id": "", "tags": []string{}}},
+
+	// Providers
+	{Method: "GET", Path: "/api/v1/providers", Summary: "List providers",
+		Data: []models.ProviderConfig{}},
+	{Method: "POST", Path: "/api/v1/providers/check", Summary: "Start a background health check of every enabled provider",
+		Data: apiFields{"started": false}, Status: http.StatusAccepted},
+	{Method: "GET", Path: "/api/v1/providers/export", Summary: "Export provider configs as JSON, without secrets",
+		Raw: "application/json", Data: providerExport{}},
+	{Method: "POST", Path: "/api/v1/providers/import", Summary: "Create or update provider configs from an export",
+		Body: providerImport{}, Data: providerImportResult{}},
+	{Method: "GET", Path: "/api/v1/providers/{name}/sync-runs", Summary: "List a provider's recent sync runs",
+		Query: []apiParam{{"limit", "integer", "Maximum runs to return"}},
+		Data:  []models.SyncRun{}},
+	{Method: "GET", Path: "/api/v1/providers/{name}/latency", Summary: "Recent connection latencies in milliseconds, oldest first",
+		Data: apiFields{"name": "", "samples_ms": []float64{}}},
+	{Method: "POST", Path: "/api/v1/providers/{name}/resync", Summary: "Sync a provider's devices now, optionally dropping cached devices it no longer reports",
+		Query: []apiParam{{"full", "boolean", "Test the connection first, then delete rather than retire cached devices the provider no longer reports"}},
+		Data:  apiFields{"name": "", "full": false, "devices": 0, "missing": 0}},
+	{Method: "PUT", Path: "/api/v1/providers/{id}/silence", Summary: "Silence a provider's failure alerts",
+		Body: struct {
+			Until    time.Time `json:"until,omitempty"`
+			Duration string    `json:"duration,omitempty"`
+		}{},
+		Data: models.ProviderConfig{}},
+	{Method: "DELETE", Path: "/api/v1/providers/{id}/silence", Summary: "Unsilence a provider",
+		Data: models.ProviderConfig{}},
+
+	// Maintenance and audit
+	{Method: "GET", Path: "/api/v1/maintenance", Summary: "Get maintenance mode",
+		Data: apiFields{"enabled": false}},
+	{Method: "PUT", Path: "/api/v1/maintenance", Summary: "Set maintenance mode",
+		Body: struct {
+			Enabled bool `json:"enabled"`
+		}{},
+		Data: apiFields{"enabled": false}},
+	{Method: "GET", Path: "/api/v1/audit", Summary: "List audit log entries, newest first",
+		Query: pageParams,
+		Data: apiFields{"entries": []models.AuditEntry{}, "total": 0, "limit": 0, "offset": 0,
+			"has_more": false, "next_offset": (*int)(nil), "prev_offset": (*int)(nil)}},
+	{Method: "GET", Path: "/api/v1/admin/backup", Summary: "Download a consistent copy of the database (requires admin login)",
+		Raw: "application/vnd.sqlite3"},
+	{Method: "POST", Path: "/api/v1/admin/vacuum", Summary: "Compact the database and truncate its WAL (requires admin login)",
+		Data: apiFields{"size_before": int64(0), "size_after": int64(0), "reclaimed": int64(0)}},
+
+	// Snapshots
+	{Method: "GET", Path: "/api/v1/policies/snapshots", Summary: "List snapshots",
+		Data: []models.PolicySnapshot{}},
+	{Method: "POST", Path: "/api/v1/policies/snapshots", Summary: "Start capturing a snapshot",
+		Body: struct {
+			ProviderID string   `json:"provider_id"`
+			Label      string   `json:"label,omitempty"`
+			Categories []string `json:"categories,omitempty"`
+		}{},
+		Data: models.PolicySnapshot{}, Status: http.StatusAccepted},
+	{Method: "GET", Path: "/api/v1/policies/snapshots/{id}", Summary: "Get a snapshot and its categories",
+		Data: apiFields{"snapshot": models.PolicySnapshot{}, "categories": []string{}}},
+	{Method: "GET", Path: "/api/v1/policies/snapshots/{id}/items", Summary: "List a snapshot's policies",
+		Query: append([]apiParam{{"category", "string", "Only this category"}, {"q", "string", "Policy name search"}, {"scope_tag", "string", "Only policies with this role scope tag"}}, pageParams...),
+		Data: apiFields{"snapshot_id": "", "count": 0, "total": 0, "limit": 0, "offset": 0, "items": []models.PolicyItem{},
+			"has_more": false, "next_offset": (*int)(nil), "prev_offset": (*int)(nil)}},
+	{Method: "GET", Path: "/api/v1/policies/snapshots/{id}/status", Summary: "Poll a snapshot's capture status",
+		Data: apiFields{"id": "", "status": "", "status_message": "", "policy_count": 0,
+			"category_count": 0, "missing_settings_count": 0, "progress?": CaptureProgress{}}},
+	{Method: "GET", Path: "/api/v1/policies/snapshots/{id}/export", Summary: "Export a snapshot as JSON",
+		Raw: "application/json", Data: snapshotExport{}},
+	{Method: "GET", Path: "/api/v1/policies/snapshots/{id}/export/csv", Summary: "Export a snapshot as CSV",
+		Query: []apiParam{{"mode", "string", "policy (default) for one row per policy, or flat for one row per setting"}},
+		Raw:   "text/csv"},
+	{Method: "GET", Path: "/api/v1/policies/export/all", Summary: "Export every snapshot as a ZIP of JSON exports",
+		Raw: "application/zip"},
+	{Method: "POST", Path: "/api/v1/policies/snapshots/import", Summary: "Import a snapshot export",
+		Query: []apiParam{{"benchmark", "boolean", "Import as a benchmark template"}},
+		Body:  snapshotExport{}, Data: importResult{}, Status: http.StatusCreated},
+	{Method: "POST", Path: "/api/v1/policies/snapshots/import/preview", Summary: "Validate and summarise an import without saving it",
+		Query: []apiParam{{"benchmark", "boolean", "Preview as a benchmark template"}},
+		Body:  snapshotExport{},
+		Data: apiFields{"provider_name": "", "provider_type": "", "label": "", "taken_at": time.Time{},
+			"taken_at_adjusted": false, "is_benchmark": false, "capture_method": "", "policy_count": 0,
+			"missing_settings_count": 0, "categories": map[string]int{}, "platforms": map[string]int{},
+			"skipped": []importSkip{}}},
+	{Method: "PATCH", Path: "/api/v1/policies/snapshots/{id}", Summary: "Relabel a snapshot",
+		Body: struct {
+			Label string `json:"label"`
+		}{},
+		Data: models.PolicySnapshot{}},
+	{Method: "POST", Path: "/api/v1/policies/snapshots/{id}/clone", Summary: "Clone a complete snapshot",
+		Body: struct {
+			Label string `json:"label,omitempty"`
+		}{},
+		Data: models.PolicySnapshot{}, Status: http.StatusCreated},
+
+	// Comparison and search
+	{Method: "GET", Path: "/api/v1/policies/compare", Summary: "Compare two snapshots",
+		Query: append([]apiParam{{"left", "string", "Left snapshot ID"}, {"right", "string", "Right snapshot ID"},
+			{"filter", "string", "Only policies that are matching, different, left-only or right-only"}}, diffParams...),
+		Data: apiCompareResult{}},
+	{Method: "POST", Path: "/api/v1/policies/compare/upload", Summary: "Compare a snapshot against an uploaded snapshot export",
+		Query: append([]apiParam{{"left", "string", "Left snapshot ID"},
+			{"filter", "string", "Only policies that are matching, different, left-only or right-only"}}, diffParams...),
+		Body: snapshotExport{}, Data: apiCompareResult{}},
+	{Method: "GET", Path: "/api/v1/policies/compare3", Summary: "Compare three snapshots",
+		Query: append([]apiParam{{"base", "string", "Base snapshot ID"}, {"left", "string", "Left snapshot ID"},
+			{"right", "string", "Right snapshot ID"}}, diffParams...),
+		Data: apiCompare3Result{}},
+	{Method: "GET", Path: "/api/v1/policies/benchmark", Summary: "Score a snapshot against a benchmark",
+		Query: append([]apiParam{{"snapshot", "string", "Snapshot ID"}, {"benchmark", "string", "Benchmark ID"}}, diffParams...),
+		Data:  apiBenchmarkResult{}},
+	{Method: "GET", Path: "/api/v1/policies/benchmark/checklist/csv", Summary: "Export a benchmark checklist as CSV",
+		Query: append([]apiParam{{"snapshot", "string", "Snapshot ID"}, {"benchmark", "string", "Benchmark ID"}}, diffParams...),
+		Raw:   "text/csv"},
+	{Method: "GET", Path: "/api/v1/policies/search", Summary: "Search setting names and values across snapshots",
+		Query: []apiParam{{"q", "string", "Search text (required)"}},
+		Data:  apiFields{"query": "", "count": 0, "hits": []models.SettingHit{}}},
+	{Method: "GET", Path: "/api/v1/policies/items/{id}/settings", Summary: "One policy's settings, flattened to the configured depth",
+		Data: apiFields{"id": "", "settings": []PolicySetting{}}},
+	{Method: "GET", Path: "/api/v1/policies/items/{id}/diff", Summary: "Diff one policy's settings against another's, in any snapshot",
+		Query: append([]apiParam{{"against", "string", "ID of the policy item to compare with (required)"}}, diffParams...),
+		Data:  apiPolicyItemDiff{}},
+
+	{Method: "GET", Path: "/api/v1/reports/platform-coverage", Summary: "Compare devices per OS with a snapshot's policies per platform",
+		Query: []apiParam{{"snapshot", "string", "Snapshot ID (required)"}},
+		Data:  []platformCoverage{}},
+	{Method: "GET", Path: "/api/v1/reports/compliance-trend", Summary: "Daily device compliance counts, oldest first",
+		Query: []apiParam{{"provider", "string", "Provider name; all providers are summed when omitted"},
+			{"days", "integer", "Days to cover, including today (default 30, at most 366)"}},
+		Data: []models.ComplianceSnapshot{}},
+
+	{Method: "GET", Path: "/api/v1/openapi.json", Summary: "This OpenAPI document",
+		Raw: "application/json"},
+}
+
+// openAPISpec builds the spec once; it depends only on apiOps and the types.
+var openAPISpec = sync.OnceValue(func() []byte {
+	b, err := json.MarshalIndent(buildOpenAPI(apiOps), "", "  ")
+	if err != nil {
+		panic("openapi: " + err.Error())
+	}
+	return b
+})
+
+// GET /api/v1/openapi.json
+func (s *Server) apiOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec())
+}
+
+var pathParamRe = regexp.MustCompile(`\{(\w+)\}`)
+
+// buildOpenAPI renders ops as an OpenAPI 3.0 document.
+func buildOpenAPI(ops []apiOp) map[string]any {
+	sc := newSchemaSet()
+	envelope := sc.schema(reflect.TypeOf(apiResponse{}))
+	errResp := map[string]any{
+		"description": "Failure; ok is false and error describes it",
+		"content":     map[string]any{"application/json": map[string]any{"schema": envelope}},
+	}
+
+	paths := map[string]map[string]any{}
+	for _, op := range ops {
+		var params []any
+		for _, m := range pathParamRe.FindAllStringSubmatch(op.Path, -1) {
+			params = append(params, map[string]any{
+				"name": m[1], "in": "path", "required": true,
+				"schema": map[string]any{"type": "string"},
+			})
+		}
+		for _, p := range op.Query {
+			params = append(params, map[string]any{
+				"name": p.Name, "in": "query", "description": p.Desc,
+				"schema": map[string]any{"type": p.Type},
+			})
+		}
+
+		content := map[string]any{}
+		switch {
+		case op.Raw == "":
+			data := map[string]any{}
+			if op.Data != nil {
+				data = sc.value(op.Data)
+			}
+			content["application/json"] = map[string]any{"schema": map[string]any{
+				"allOf": []any{envelope, map[string]any{
+					"type":       "object",
+					"properties": map[string]any{"data": data},
+				}},
+			}}
+		case op.Data != nil:
+			content[op.Raw] = map[string]any{"schema": sc.value(op.Data)}
+		default:
+			content[op.Raw] = map[string]any{"schema": map[string]any{"type": "string"}}
+		}
+
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		o := map[string]any{
+			"summary":     op.Summary,
+			"operationId": operationID(op),
+			"responses": map[string]any{
+				strconv.Itoa(status): map[string]any{"description": http.StatusText(status), "content": content},
+				"default":            errResp,
+			},
+		}
+		if params != nil {
+			o["parameters"] = params
+		}
+		if op.Body != nil {
+			o["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{"application/json": map[string]any{
+					"schema": sc.value(op.Body),
+				}},
+			}
+		}
+		if op.Form != nil {
+			props := map[string]any{}
+			for _, f := range op.Form {
+				schema := map[string]any{"type": f.Type, "description": f.Desc}
+				if f.Type == "file" {
+					schema = map[string]any{"type": "string", "format": "binary", "description": f.Desc}
+				}
+				props[f.Name] = schema
+			}
+			o["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{"multipart/form-data": map[string]any{
+					"schema": map[string]any{"type": "object", "properties": props},
+				}},
+			}
+		}
+		if paths[op.Path] == nil {
+			paths[op.Path] = map[string]any{}
+		}
+		paths[op.Path][strings.ToLower(op.Method)] = o
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "moe API",
+			"version": "v1",
+			"description": "Every JSON response is wrapped in an envelope: " +
+				`{"ok": true, "data": ...} on success, {"ok": false, "error": "..."} on failure. ` +
+				"File downloads are returned unwrapped.",
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": sc.components},
+	}
+}
+
+// operationID derives a stable ID such as getApiV1DevicesById.
+func operationID(op apiOp) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(op.Method))
+	for _, seg := range strings.FieldsFunc(op.Path, func(r rune) bool { return r == '/' || r == '-' || r == '.' }) {
+		if m := pathParamRe.FindStringSubmatch(seg); m != nil {
+			seg = "By" + strings.ToUpper(m[1][:1]) + m[1][1:]
+		}
+		b.WriteString(strings.ToUpper(seg[:1]) + seg[1:])
+	}
+	return b.String()
+}
+
+// ── Schema reflection ───────────────────────────────────────────────────
+
+// schemaSet reflects Go types into JSON schemas following encoding/json's
+// rules. Named structs become components referenced by $ref.
+type schemaSet struct {
+	components map[string]any
+	names      map[reflect.Type]string
+}
+
+func newSchemaSet() *schemaSet {
+	return &schemaSet{components: map[string]any{}, names: map[reflect.Type]string{}}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// value describes v, a zero value from an apiOp.
+func (sc *schemaSet) value(v any) map[string]any {
+	if fields, ok := v.(apiFields); ok {
+		return sc.fieldsSchema(fields)
+	}
+	return sc.schema(reflect.TypeOf(v))
+}
+
+func (sc *schemaSet) schema(t reflect.Type) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == reflect.TypeOf(time.Duration(0)):
+		return map[string]any{"type": "integer", "format": "int64", "description": "nanoseconds"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := sc.schema(t.Elem())
+		return nullable(s)
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": sc.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": sc.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return sc.structSchema(t)
+		}
+		name, ok := sc.names[t]
+		if !ok {
+			name = t.Name()
+			if _, taken := sc.components[name]; taken {
+				name = t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:] + "." + name
+			}
+			sc.names[t] = name
+			sc.components[name] = map[string]any{} // placeholder for recursive types
+			sc.components[name] = sc.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{} // interface: any JSON value
+}
+
+// structSchema describes t's exported, JSON-visible fields. Fields without
+// omitempty are always present and so required; nil slices, maps and
+// pointers among them encode as null. Untagged embedded structs contribute
+// their fields, as encoding/json flattens them.
+func (sc *schemaSet) structSchema(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && f.Tag.Get("json") == "" {
+			embedded := sc.structSchema(f.Type)
+			maps.Copy(props, embedded["properties"].(map[string]any))
+			if req, ok := embedded["required"].([]string); ok {
+				required = append(required, req...)
+			}
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s := sc.schema(f.Type)
+		omitempty := strings.Contains(opts, "omitempty")
+		if !omitempty {
+			required = append(required, name)
+			if k := f.Type.Kind(); k == reflect.Slice || k == reflect.Map {
+				s = nullable(s)
+			}
+		}
+		props[name] = s
+	}
+	out := map[string]any{"type": "object", "properties": props}
+	if required != nil {
+		sort.Strings(required)
+		out["required"] = required
+	}
+	return out
+}
+
+// fieldsSchema describes an apiFields map.
+func (sc *schemaSet) fieldsSchema(fields apiFields) map[string]any {
+	props := map[string]any{}
+	required := make([]string, 0, len(fields))
+	for k, v := range fields {
+		name, optional := strings.CutSuffix(k, "?")
+		props[name] = sc.schema(reflect.TypeOf(v))
+		if !optional {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+	return map[string]any{"type": "object", "properties": props, "required": required}
+}
+
+// nullable marks s as also accepting null. A $ref can't carry siblings in
+// OpenAPI 3.0, so references are wrapped in allOf.
+func nullable(s map[string]any) map[string]any {
+	if _, ok := s["$ref"]; ok {
+		return map[string]any{"allOf": []any{s}, "nullable": true}
+	}
+	s["nullable"] = true
+	return s
+}
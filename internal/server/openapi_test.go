@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"testing"
+)
+
+// TestAPIOpsCoverRoutes keeps the OpenAPI spec in step with routes.go.
+func TestAPIOpsCoverRoutes(t *testing.T) {
+	src, err := os.ReadFile("routes.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	documented := map[string]bool{}
+	for _, op := range apiOps {
+		documented[op.Method+" "+op.Path] = true
+	}
+	routes := regexp.MustCompile(`HandleFunc\("(\w+ /api/v1/[^"]+)"`).FindAllSubmatch(src, -1)
+	if len(routes) == 0 {
+		t.Fatal("no /api/v1 routes found in routes.go")
+	}
+	for _, m := range routes {
+		route := string(m[1])
+		if !documented[route] {
+			t.Errorf("%s is not described in apiOps", route)
+		}
+		delete(documented, route)
+	}
+	for route := range documented {
+		t.Errorf("apiOps describes %s, which is not routed", route)
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	var spec struct {
+		Paths      map[string]map[string]json.RawMessage
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]json.RawMessage
+				Required   []string
+			}
+		}
+	}
+	if err := json.Unmarshal(openAPISpec(), &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	env, ok := spec.Components.Schemas["apiResponse"]
+	if !ok {
+		t.Fatal("envelope schema missing")
+	}
+	for _, f := range []string{"ok", "error", "data"} {
+		if _, ok := env.Properties[f]; !ok {
+			t.Errorf("envelope lacks %q", f)
+		}
+	}
+	if len(env.Required) != 1 || env.Required[0] != "ok" {
+		t.Errorf("envelope required = %v, want [ok]", env.Required)
+	}
+
+	// ClientSecret is tagged json:"-" and must not leak into the schema.
+	if _, ok := spec.Components.Schemas["ProviderConfig"].Properties["ClientSecret"]; ok {
+		t.Error("ProviderConfig schema exposes ClientSecret")
+	}
+	if _, ok := spec.Paths["/api/v1/devices/{id}"]["get"]; !ok {
+		t.Error("GET /api/v1/devices/{id} missing from paths")
+	}
+}
@@ -7,9 +7,15 @@ import (
 	"html"
 	"log"
 	"net/http"
+	"net/url"
+	"path"
+	"regexp"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/dan/moe/internal/metrics"
 	"github.com/dan/moe/internal/models"
 	"github.com/dan/moe/internal/provider"
 	"github.com/dan/moe/internal/provider/intune"
@@ -19,16 +25,63 @@ import (
 
 // PolicySnapshotSummary is the list-level view of a snapshot (no full policy data).
 type PolicySnapshotSummary struct {
-	ID            string
-	ProviderName  string
-	ProviderType  string
-	Label         string
-	DisplayName   string // Label if set, otherwise ProviderName
-	TakenAt       time.Time
-	PolicyCount   int
-	CategoryCount int
-	Status        string // "capturing", "complete", "error"
-	StatusMessage string
+	ID              string
+	ProviderName    string
+	ProviderType    string
+	Label           string
+	DisplayName     string // Label if set, otherwise ProviderName
+	TakenAt         time.Time
+	PolicyCount     int
+	CategoryCount   int
+	Status          string // "queued", "capturing", "complete", "error"
+	StatusMessage   string
+	MissingSettings int    // policies whose settings could not be captured
+	CaptureMethod   string // "utcm", "legacy" or "" when unknown
+	Coverage        []models.CategoryCoverage
+	FailedResources []string // resource types a partial capture could not fetch
+	IsBenchmark     bool
+	Cloned          bool     // copied from another snapshot; exempt from retention
+	Categories      []string // capture narrowed to these; empty = all
+	Progress        string   // latest capture progress while capturing, e.g. "Settings Catalog (412 so far)"
+}
+
+// InProgress reports whether the snapshot's capture is queued or running.
+func (s PolicySnapshotSummary) InProgress() bool {
+	return s.Status == models.SnapshotStatusQueued || s.Status == models.SnapshotStatusCapturing
+}
+
+// Partial reports whether the snapshot is complete but some resource types
+// could not be captured.
+func (s PolicySnapshotSummary) Partial() bool {
+	return s.Status == models.SnapshotStatusComplete && len(s.FailedResources) > 0
+}
+
+// CaptureMethodLabel is the display name of the snapshot's capture method.
+func (s PolicySnapshotSummary) CaptureMethodLabel() string {
+	return captureMethodLabel(s.CaptureMethod)
+}
+
+// coverageTotals counts a snapshot's attempted categories by outcome.
+type coverageTotals struct {
+	Populated int
+	Empty     int // fetched successfully but returned no policies
+	Failed    int
+}
+
+// CoverageTotals summarises Coverage for the snapshot page.
+func (s PolicySnapshotSummary) CoverageTotals() coverageTotals {
+	var t coverageTotals
+	for _, c := range s.Coverage {
+		switch {
+		case c.Error != "":
+			t.Failed++
+		case c.Count == 0:
+			t.Empty++
+		default:
+			t.Populated++
+		}
+	}
+	return t
 }
 
 // PolicySetting is a single key/value setting within a policy.
@@ -39,14 +92,18 @@ type PolicySetting struct {
 
 // PolicyItem represents one policy within a snapshot.
 type PolicyItem struct {
-	ID           string          `json:"ID"`
-	Category     string          `json:"Category"`
-	PolicyName   string          `json:"PolicyName"`
-	PolicyType   string          `json:"PolicyType"`
-	Platform     string          `json:"Platform"`
-	Description  string          `json:"Description"`
-	SettingCount int             `json:"SettingCount"`
-	Settings     []PolicySetting `json:"Settings"`
+	ID            string `json:"ID"`
+	Category      string `json:"Category"`
+	PolicyName    string `json:"PolicyName"`
+	PolicyType    string `json:"PolicyType"`
+	Platform      string `json:"Platform"`
+	Description   string `json:"Description"`
+	SettingCount  int    `json:"SettingCount"`            // at the default flatten depth
+	SettingsError string `json:"SettingsError,omitempty"` // settings not captured
+	// Assignments is nil when none were captured and empty for a policy
+	// that isn't assigned to anything.
+	Assignments []provider.PolicyAssignment `json:"Assignments"`
+	ScopeTags   []string                    `json:"ScopeTags"`
 }
 
 // PolicyCategoryGroup is a set of policies grouped by category for display.
@@ -57,9 +114,11 @@ type PolicyCategoryGroup struct {
 
 // policiesPageData is the data for the /policies list page.
 type policiesPageData struct {
-	Nav       string
-	Providers []models.ProviderConfig
-	Snapshots []PolicySnapshotSummary
+	Nav        string
+	Providers  []models.ProviderConfig
+	Snapshots  []PolicySnapshotSummary
+	Benchmarks []PolicySnapshotSummary
+	Categories []string // categories a capture can be narrowed to
 }
 
 // policySnapshotPageData is the data for the /policies/snapshots/{id} detail page.
@@ -70,6 +129,14 @@ type policySnapshotPageData struct {
 	Platforms    []string
 	Items        []PolicyItem
 	GroupedItems []PolicyCategoryGroup
+	Changes      *snapshotChanges // nil without a previous capture to compare
+}
+
+// snapshotChanges summarises how a snapshot differs from the provider's
+// previous capture, for the banner on the snapshot page.
+type snapshotChanges struct {
+	Previous PolicySnapshotSummary
+	Stats    CompareStats
 }
 
 // CompareStats holds summary counts for a comparison.
@@ -86,6 +153,7 @@ type SettingDiff struct {
 	LeftValue  string `json:"LeftValue"`
 	RightValue string `json:"RightValue"`
 	Changed    bool   `json:"Changed"`
+	Volatile   bool   `json:"Volatile,omitempty"` // changed only in timestamp/GUID-shaped values
 }
 
 // PolicyDiff represents one policy's comparison result.
@@ -100,20 +168,37 @@ type PolicyDiff struct {
 
 // policyComparePageData is the data for the /policies/compare page.
 type policyComparePageData struct {
-	Nav        string
-	Snapshots  []PolicySnapshotSummary
-	LeftID     string
-	RightID    string
-	LeftName   string
-	RightName  string
-	HasResults bool
-	Stats      CompareStats
-	Diffs      []PolicyDiff
-	Platforms  []string // distinct platforms across all diffs
-	Categories []string // distinct categories across all diffs
-	TotalCount int      // total policy count (for alignment %)
+	Nav            string
+	Snapshots      []PolicySnapshotSummary
+	LeftID         string
+	RightID        string
+	Ignore         string // comma-separated setting-name patterns excluded from the diff
+	StrictEmpty    bool   // absent settings differ from present-but-empty ones
+	IgnoreVolatile bool   // timestamp/GUID-only changes count as matching
+	LeftName       string
+	RightName      string
+	HasResults     bool
+	Stats          CompareStats
+	Diffs          []PolicyDiff
+	Platforms      []string // distinct platforms across all diffs
+	Categories     []string // distinct categories across all diffs
+	TotalCount     int      // total policy count (for alignment %)
+
+	// MethodWarning is set when the two snapshots were captured by
+	// different methods (see captureMethodMismatch).
+	MethodWarning string
+
+	// Progressive pages render without diffs; the browser fetches them
+	// from DataURL (the compare API) after load.
+	Progressive bool
+	DataURL     string
 }
 
+// compareInlineLimit is the combined policy count of the two snapshots
+// above which the compare page always loads its diffs progressively rather
+// than inlining them in the HTML.
+const compareInlineLimit = 1000
+
 // ── Handlers ────────────────────────────────────────────────────────────
 
 // handlePolicies serves the main policies page with snapshot list.
@@ -125,16 +210,22 @@ func (s *Server) handlePolicies(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[policies] list snapshots error: %v", err)
 	}
 
-	summaries := make([]PolicySnapshotSummary, len(snapshots))
-	for i, snap := range snapshots {
-		summaries[i] = snapshotToSummary(snap)
+	data := policiesPageData{
+		Nav:        "policies",
+		Providers:  providers,
+		Snapshots:  []PolicySnapshotSummary{},
+		Benchmarks: []PolicySnapshotSummary{},
+		Categories: intune.PolicyCategories(),
+	}
+	for _, snap := range snapshots {
+		if snap.IsBenchmark {
+			data.Benchmarks = append(data.Benchmarks, snapshotToSummary(snap))
+		} else {
+			data.Snapshots = append(data.Snapshots, s.snapshotSummary(snap))
+		}
 	}
 
-	s.render.render(w, "policies.html", policiesPageData{
-		Nav:       "policies",
-		Providers: providers,
-		Snapshots: summaries,
-	})
+	s.render.render(w, "policies.html", data)
 }
 
 // handlePolicySnapshot serves the snapshot detail/browse page.
@@ -156,12 +247,13 @@ func (s *Server) handlePolicySnapshot(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		log.Printf("[policies] categories error: %v", err)
 	}
-	items, err := s.policies.ListItems(id, "", "")
+	items, err := s.policies.ListItems(id, "", "", "")
 	if err != nil {
 		log.Printf("[policies] list items error: %v", err)
 	}
 
-	viewItems, grouped := buildPolicyView(items)
+	s.categoryOrder.sortStrings(categories)
+	viewItems, grouped := buildPolicyView(items, s.categoryOrder)
 
 	// Extract unique platforms for tabs
 	platSet := map[string]bool{}
@@ -185,13 +277,42 @@ func (s *Server) handlePolicySnapshot(w http.ResponseWriter, r *http.Request) {
 		Platforms:    platforms,
 		Items:        viewItems,
 		GroupedItems: grouped,
+		Changes:      s.snapshotChanges(snap),
 	})
 }
 
+// snapshotChanges compares a complete capture with the provider's previous
+// one. It returns nil for benchmarks, clones, captures still in progress and
+// a provider's first capture.
+func (s *Server) snapshotChanges(snap *models.PolicySnapshot) *snapshotChanges {
+	if snap.Status != models.SnapshotStatusComplete || snap.IsBenchmark || snap.ClonedFrom != "" {
+		return nil
+	}
+	prevID, err := s.policies.PreviousSnapshotID(*snap)
+	if err != nil {
+		log.Printf("[policies] previous snapshot error: %v", err)
+		return nil
+	}
+	if prevID == "" {
+		return nil
+	}
+	prev, err := s.policies.GetSnapshot(prevID)
+	if err != nil || prev == nil {
+		return nil
+	}
+	stats, _, err := s.compareSnapshots(prev, snap, "", diffOptions{})
+	if err != nil {
+		log.Printf("[policies] compare with previous snapshot error: %v", err)
+		return nil
+	}
+	return &snapshotChanges{Previous: snapshotToSummary(*prev), Stats: stats}
+}
+
 // handlePolicySnapshotCreate takes a new policy snapshot from a provider.
 func (s *Server) handlePolicySnapshotCreate(w http.ResponseWriter, r *http.Request) {
 	providerID := r.FormValue("provider_id")
 	label := r.FormValue("label")
+	categories := cleanCategories(r.Form["categories"])
 	if providerID == "" {
 		http.Redirect(w, r, "/policies?flash=Select+a+provider&flash_type=error", http.StatusSeeOther)
 		return
@@ -229,6 +350,7 @@ func (s *Server) handlePolicySnapshotCreate(w http.ResponseWriter, r *http.Reque
 		Label:        label,
 		TakenAt:      time.Now().UTC(),
 		Status:       models.SnapshotStatusCapturing,
+		Categories:   categories,
 	}
 	if err := s.policies.CreateSnapshot(snap); err != nil {
 		log.Printf("[policies] create snapshot error: %v", err)
@@ -236,62 +358,246 @@ func (s *Server) handlePolicySnapshotCreate(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	s.auditf(r, "snapshot", auditSnapshot, snapshotID, "%s capture started", snap.DisplayName())
+
 	// Redirect immediately — the capture runs in the background.
 	http.Redirect(w, r, "/policies?flash=Baseline+capture+started&flash_type=info", http.StatusSeeOther)
 
 	// Run the actual capture in a background goroutine.
+	ctx := s.captureContext(r)
 	s.bgWg.Add(1)
 	go func() {
 		defer s.bgWg.Done()
-		s.runSnapshotCapture(s.shutdownCtx, snapshotID, cfg.Name, pp)
+		s.runSnapshotCapture(ctx, snapshotID, cfg.Name, pp, categories)
 	}()
 }
 
-// runSnapshotCapture performs the async policy sync and updates the snapshot when done.
-func (s *Server) runSnapshotCapture(ctx context.Context, snapshotID, providerName string, pp provider.PolicyProvider) {
-	syncPolicies, err := pp.SyncPolicies(ctx, func(category string, count int) {
-		s.activity.Logf(providerName, "info", "Policy snapshot: fetched %s (%d total so far)", category, count)
-	})
+// captureContext returns the context for a capture started by r: it ends at
+// shutdown rather than with r, but keeps r's request ID so the provider's log
+// lines can be traced back to the request.
+func (s *Server) captureContext(r *http.Request) context.Context {
+	return provider.WithRequestID(s.shutdownCtx, provider.RequestID(r.Context()))
+}
+
+// runSnapshotCapture performs the async policy sync and updates the snapshot
+// when done. A non-empty categories list narrows the capture to those
+// categories.
+func (s *Server) runSnapshotCapture(ctx context.Context, snapshotID, providerName string, pp provider.PolicyProvider, categories []string) {
+	start := time.Now()
+	ctx, cancel := context.WithCancel(ctx)
+	s.trackCapture(snapshotID, cancel)
+	defer s.untrackCapture(snapshotID)
+
+	var (
+		syncPolicies []provider.SyncPolicy
+		prov         provider.PolicyProvenance
+	)
+	err := s.waitForCaptureSlot(ctx, snapshotID, providerName)
+	if err == nil {
+		defer s.releaseCaptureSlot()
+		start = time.Now() // time spent queued isn't capture time
+		opts := provider.PolicySyncOptions{Categories: categories}
+		syncPolicies, prov, err = pp.SyncPolicies(ctx, opts, func(category string, count int) {
+			s.setSnapshotProgress(snapshotID, category, count)
+			s.activity.Logf(providerName, "info", "Policy snapshot: fetched %s (%d total so far)", category, count)
+		})
+	}
 	if err != nil {
-		// Distinguish shutdown cancellation from genuine errors.
-		if ctx.Err() != nil {
+		// Distinguish shutdown and operator cancellation from genuine errors.
+		if s.shutdownCtx.Err() != nil {
 			log.Printf("[policies] snapshot for %s interrupted by shutdown", providerName)
 			s.activity.Logf(providerName, "warning", "Policy snapshot interrupted — server shutting down")
 			_ = s.policies.UpdateSnapshotStatus(snapshotID, models.SnapshotStatusError, "interrupted — server was stopped")
+			metrics.ObserveCapture(providerName, models.SnapshotStatusError, time.Since(start))
+			return
+		}
+		if ctx.Err() != nil {
+			s.markCaptureCancelled(snapshotID, providerName, start)
 			return
 		}
 		log.Printf("[policies] async sync error for %s: %v", providerName, err)
 		s.activity.Logf(providerName, "error", "Policy snapshot error: %s", err)
 		_ = s.policies.UpdateSnapshotStatus(snapshotID, models.SnapshotStatusError, err.Error())
+		metrics.ObserveCapture(providerName, models.SnapshotStatusError, time.Since(start))
 		return
 	}
 
 	// Store all policy items
 	for _, sp := range syncPolicies {
 		item := &models.PolicyItem{
-			ID:           newID(),
-			SnapshotID:   snapshotID,
-			Category:     sp.Category,
-			SourceID:     sp.SourceID,
-			PolicyName:   sp.PolicyName,
-			PolicyType:   sp.PolicyType,
-			Platform:     sp.Platform,
-			Description:  sp.Description,
-			SettingsJSON: sp.SettingsJSON,
+			ID:            newID(),
+			SnapshotID:    snapshotID,
+			Category:      sp.Category,
+			SourceID:      sp.SourceID,
+			PolicyName:    sp.PolicyName,
+			PolicyType:    sp.PolicyType,
+			Platform:      sp.Platform,
+			Description:   sp.Description,
+			SettingsJSON:  sp.SettingsJSON,
+			SettingsError: sp.SettingsError,
+			ScopeTags:     sp.ScopeTags,
+			SettingCount:  settingCount(sp.SettingsJSON),
 		}
 		if err := s.policies.InsertItem(item); err != nil {
 			log.Printf("[policies] insert item error: %v", err)
 		}
 	}
 
+	coverage := make([]models.CategoryCoverage, len(prov.Coverage))
+	failed := 0
+	for i, c := range prov.Coverage {
+		coverage[i] = models.CategoryCoverage{Category: c.Category, Count: c.Count, Error: c.Error}
+		if c.Error != "" {
+			failed++
+		}
+	}
+	if err := s.policies.SetSnapshotProvenance(snapshotID, prov.CaptureMethod, coverage, prov.FailedResources); err != nil {
+		log.Printf("[policies] record provenance error: %v", err)
+	}
+	if failed > 0 {
+		s.activity.Logf(providerName, "warning", "Policy snapshot: categories not fetched: %d — see the baseline's capture coverage", failed)
+	}
+	if len(prov.FailedResources) > 0 {
+		s.activity.Logf(providerName, "warning", "Policy snapshot is partial: %s", partialCaptureMessage(prov.FailedResources))
+	}
+
+	// A cancel that lands after the fetch finished still wins.
+	if ctx.Err() != nil {
+		s.markCaptureCancelled(snapshotID, providerName, start)
+		return
+	}
+
 	// Update denormalised counts and mark complete
 	_ = s.policies.UpdateSnapshotCounts(snapshotID)
-	_ = s.policies.UpdateSnapshotStatus(snapshotID, models.SnapshotStatusComplete, "")
-
-	// Keep only 10 snapshots per provider
-	_ = s.policies.DeleteOldSnapshots(10)
+	_ = s.policies.UpdateSnapshotStatus(snapshotID, models.SnapshotStatusComplete, partialCaptureMessage(prov.FailedResources))
+	metrics.ObserveCapture(providerName, models.SnapshotStatusComplete, time.Since(start))
+
+	// Prune old snapshots (per-provider override, else the server default).
+	// Pruning doesn't report which snapshots went, so drop every cached
+	// comparison rather than risk keeping one for a deleted snapshot.
+	if err := s.policies.DeleteOldSnapshots(s.cfg.SnapshotRetention); err != nil {
+		log.Printf("[policies] prune old snapshots: %v", err)
+	}
+	s.compareCache.clear()
 
 	s.activity.Logf(providerName, "success", "Policy snapshot complete — %d policies captured", len(syncPolicies))
+	if snap, _ := s.policies.GetSnapshot(snapshotID); snap != nil && snap.MissingSettingsCount > 0 {
+		s.activity.Logf(providerName, "warning", "%d policies captured without settings — see the baseline for details", snap.MissingSettingsCount)
+	}
+}
+
+// partialCaptureMessage is the status message of a complete snapshot whose
+// capture could not fetch the failed resource types, or "" when none failed.
+func partialCaptureMessage(failed []string) string {
+	switch len(failed) {
+	case 0:
+		return ""
+	case 1:
+		return "completed with 1 resource type failed: " + failed[0]
+	}
+	return fmt.Sprintf("completed with %d resource types failed: %s", len(failed), strings.Join(failed, "; "))
+}
+
+// ── Capture progress ────────────────────────────────────────────────────
+
+// snapshotCancelledMessage is the status message of a cancelled capture.
+const snapshotCancelledMessage = "cancelled by operator"
+
+// CaptureProgress is the latest progress report from an in-flight capture:
+// the category just fetched and the running policy count.
+type CaptureProgress struct {
+	Category  string    `json:"category"`
+	Count     int       `json:"count"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// String formats the progress for the baselines table.
+func (p CaptureProgress) String() string {
+	return fmt.Sprintf("%s (%d so far)", p.Category, p.Count)
+}
+
+// SnapshotProgress returns the latest progress for a capture in flight. ok
+// is false once the capture has finished or before its first report.
+func (s *Server) SnapshotProgress(id string) (CaptureProgress, bool) {
+	s.capturesMu.Lock()
+	defer s.capturesMu.Unlock()
+	p, ok := s.progress[id]
+	return p, ok
+}
+
+func (s *Server) setSnapshotProgress(id, category string, count int) {
+	s.capturesMu.Lock()
+	defer s.capturesMu.Unlock()
+	s.progress[id] = CaptureProgress{Category: category, Count: count, UpdatedAt: time.Now()}
+}
+
+// trackCapture registers the cancel func of a capture that is starting.
+func (s *Server) trackCapture(id string, cancel context.CancelFunc) {
+	s.capturesMu.Lock()
+	defer s.capturesMu.Unlock()
+	s.cancels[id] = cancel
+}
+
+// untrackCapture forgets a finished capture and releases its context.
+func (s *Server) untrackCapture(id string) {
+	s.capturesMu.Lock()
+	defer s.capturesMu.Unlock()
+	if cancel, ok := s.cancels[id]; ok {
+		cancel()
+	}
+	delete(s.cancels, id)
+	delete(s.progress, id)
+}
+
+// cancelCapture cancels an in-flight capture. It reports false if no
+// capture is running for id.
+func (s *Server) cancelCapture(id string) bool {
+	s.capturesMu.Lock()
+	defer s.capturesMu.Unlock()
+	cancel, ok := s.cancels[id]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// waitForCaptureSlot blocks until fewer than Config.MaxCaptures captures are
+// running, so scheduled captures across many tenants queue rather than
+// stampede Graph. The snapshot shows as queued while it waits. It returns
+// ctx's error if the capture is cancelled or the server shuts down first.
+func (s *Server) waitForCaptureSlot(ctx context.Context, snapshotID, providerName string) error {
+	select {
+	case s.captureSlots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	log.Printf("[policies] snapshot %s for %s queued: %d capture(s) already running", snapshotID, providerName, cap(s.captureSlots))
+	s.activity.Logf(providerName, "info", "Policy snapshot queued — waiting for a running capture to finish")
+	_ = s.policies.UpdateSnapshotStatus(snapshotID, models.SnapshotStatusQueued, "waiting for a running capture to finish")
+	select {
+	case s.captureSlots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if err := ctx.Err(); err != nil {
+		s.releaseCaptureSlot()
+		return err
+	}
+	_ = s.policies.UpdateSnapshotStatus(snapshotID, models.SnapshotStatusCapturing, "")
+	return nil
+}
+
+// releaseCaptureSlot frees the slot taken by waitForCaptureSlot.
+func (s *Server) releaseCaptureSlot() {
+	<-s.captureSlots
+}
+
+// markCaptureCancelled records an operator cancel on the snapshot.
+func (s *Server) markCaptureCancelled(snapshotID, providerName string, start time.Time) {
+	log.Printf("[policies] snapshot %s for %s cancelled by operator", snapshotID, providerName)
+	_ = s.policies.UpdateSnapshotStatus(snapshotID, models.SnapshotStatusError, snapshotCancelledMessage)
+	metrics.ObserveCapture(providerName, models.SnapshotStatusError, time.Since(start))
 }
 
 // handleSnapshotRow returns an htmx partial — a single <tr> for the baselines table.
@@ -303,20 +609,21 @@ func (s *Server) handleSnapshotRow(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
-	summary := snapshotToSummary(*snap)
+	summary := s.snapshotSummary(*snap)
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	renderSnapshotRow(w, summary)
 }
 
 // renderSnapshotRow writes a single snapshot <tr> to w.
 func renderSnapshotRow(w http.ResponseWriter, s PolicySnapshotSummary) {
-	capturing := s.Status == models.SnapshotStatusCapturing
+	capturing := s.InProgress()
 	errored := s.Status == models.SnapshotStatusError
 
 	dn := html.EscapeString(s.DisplayName)
 	pn := html.EscapeString(s.ProviderName)
 	pt := html.EscapeString(s.ProviderType)
 	sm := html.EscapeString(s.StatusMessage)
+	pg := html.EscapeString(s.Progress)
 
 	// Polling attribute — only while capturing
 	pollAttr := ""
@@ -327,14 +634,24 @@ func renderSnapshotRow(w http.ResponseWriter, s PolicySnapshotSummary) {
 	fmt.Fprintf(w, `<tr id="snapshot-row-%s"%s>`, s.ID, pollAttr)
 
 	// Name column
-	fmt.Fprintf(w, `<td><strong>%s</strong>`, dn)
-	if capturing {
+	fmt.Fprintf(w, `<td><strong class="snapshot-name">%s</strong>`, dn)
+	if s.Cloned {
+		fmt.Fprint(w, ` <span class="badge badge-muted" title="Cloned baseline — not pruned by retention">Clone</span>`)
+	}
+	if s.Status == models.SnapshotStatusQueued {
+		fmt.Fprintf(w, ` <span class="badge badge-muted" title="%s">Queued</span>`, sm)
+	} else if capturing {
 		fmt.Fprint(w, ` <span class="badge badge-capturing"><span class="spinner-sm"></span> Capturing…</span>`)
+		if pg != "" {
+			fmt.Fprintf(w, `<div class="capture-progress">%s</div>`, pg)
+		}
 	} else if errored {
 		fmt.Fprint(w, ` <span class="badge badge-error">Error</span>`)
 		if sm != "" {
 			fmt.Fprintf(w, `<div class="error-detail">%s</div>`, sm)
 		}
+	} else if s.Partial() {
+		fmt.Fprintf(w, ` <span class="badge badge-warning" title="%s">Partial</span>`, sm)
 	}
 	fmt.Fprint(w, `</td>`)
 
@@ -348,6 +665,9 @@ func renderSnapshotRow(w http.ResponseWriter, s PolicySnapshotSummary) {
 	// Policies
 	if capturing || errored {
 		fmt.Fprintf(w, `<td class="text-muted">—</td>`)
+	} else if s.MissingSettings > 0 {
+		fmt.Fprintf(w, `<td>%d <span class="badge badge-warning" title="Settings could not be captured for %d policies">%d missing settings</span></td>`,
+			s.PolicyCount, s.MissingSettings, s.MissingSettings)
 	} else {
 		fmt.Fprintf(w, `<td>%d</td>`, s.PolicyCount)
 	}
@@ -362,7 +682,9 @@ func renderSnapshotRow(w http.ResponseWriter, s PolicySnapshotSummary) {
 	// Actions
 	fmt.Fprint(w, `<td class="text-right">`)
 	if capturing {
-		fmt.Fprintf(w, `<a href="/console" class="btn btn-sm">View Progress</a>`)
+		fmt.Fprintf(w, `<a href="/console" class="btn btn-sm">View Progress</a> `)
+		fmt.Fprintf(w, `<form method="post" action="/policies/snapshots/%s/cancel" style="display:inline" onsubmit="return confirm('Cancel this capture?')">`, s.ID)
+		fmt.Fprint(w, `<button type="submit" class="btn btn-sm btn-danger">Cancel</button></form>`)
 	} else if errored {
 		fmt.Fprintf(w, `<form method="post" action="/policies/snapshots/%s/retry" style="display:inline">`, s.ID)
 		fmt.Fprint(w, `<button type="submit" class="btn btn-sm">Retry</button></form> `)
@@ -372,6 +694,8 @@ func renderSnapshotRow(w http.ResponseWriter, s PolicySnapshotSummary) {
 		fmt.Fprintf(w, `<a href="/policies/snapshots/%s" class="btn btn-sm">Browse</a> `, s.ID)
 		fmt.Fprintf(w, `<a href="/api/v1/policies/snapshots/%s/export" class="btn btn-sm">JSON</a> `, s.ID)
 		fmt.Fprintf(w, `<a href="/api/v1/policies/snapshots/%s/export/csv" class="btn btn-sm">CSV</a> `, s.ID)
+		fmt.Fprintf(w, `<button type="button" class="btn btn-sm mutating rename-snapshot" data-id="%s">Rename</button> `, s.ID)
+		fmt.Fprintf(w, `<button type="button" class="btn btn-sm mutating clone-snapshot" data-id="%s" data-name="%s">Clone</button> `, s.ID, dn)
 		fmt.Fprintf(w, `<form method="post" action="/policies/snapshots/%s/delete" style="display:inline" onsubmit="return confirm('Delete this baseline?')">`, s.ID)
 		fmt.Fprint(w, `<button type="submit" class="btn btn-sm btn-danger">Delete</button></form>`)
 	}
@@ -421,24 +745,49 @@ func (s *Server) handlePolicySnapshotRetry(w http.ResponseWriter, r *http.Reques
 	}
 
 	s.activity.Logf(cfg.Name, "info", "Retrying policy snapshot…")
+	s.auditf(r, "retry", auditSnapshot, id, "%s", snap.DisplayName())
 	http.Redirect(w, r, "/policies?flash=Baseline+capture+retrying&flash_type=info", http.StatusSeeOther)
 
+	ctx := s.captureContext(r)
 	s.bgWg.Add(1)
 	go func() {
 		defer s.bgWg.Done()
-		s.runSnapshotCapture(s.shutdownCtx, id, cfg.Name, pp)
+		s.runSnapshotCapture(ctx, id, cfg.Name, pp, snap.Categories)
 	}()
 }
 
+// handlePolicySnapshotCancel stops an in-flight capture and marks the
+// snapshot as failed so it can be retried or deleted.
+func (s *Server) handlePolicySnapshotCancel(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	snap, err := s.policies.GetSnapshot(id)
+	if err != nil || snap == nil {
+		http.Redirect(w, r, "/policies?flash=Snapshot+not+found&flash_type=error", http.StatusSeeOther)
+		return
+	}
+	if !snap.InProgress() || !s.cancelCapture(id) {
+		http.Redirect(w, r, "/policies?flash=Snapshot+is+not+capturing&flash_type=error", http.StatusSeeOther)
+		return
+	}
+
+	if err := s.policies.UpdateSnapshotStatus(id, models.SnapshotStatusError, snapshotCancelledMessage); err != nil {
+		log.Printf("[policies] cancel snapshot error: %v", err)
+	}
+	s.activity.Logf(snap.ProviderName, "warning", "Policy snapshot cancelled by operator")
+	s.auditf(r, "cancel", auditSnapshot, id, "%s", snap.DisplayName())
+	http.Redirect(w, r, "/policies?flash=Baseline+capture+cancelled&flash_type=info", http.StatusSeeOther)
+}
+
 // handlePolicySnapshotDelete deletes a snapshot.
 func (s *Server) handlePolicySnapshotDelete(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 
 	// Look up snapshot name for logging before we delete it
 	snap, _ := s.policies.GetSnapshot(id)
-	snapshotLabel := id
+	snapshotLabel, displayName := id, id
 	if snap != nil {
-		snapshotLabel = snap.ProviderName
+		snapshotLabel, displayName = snap.ProviderName, snap.DisplayName()
 	}
 
 	if err := s.policies.DeleteSnapshot(id); err != nil {
@@ -448,8 +797,10 @@ func (s *Server) handlePolicySnapshotDelete(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	s.compareCache.forget(id)
 	log.Printf("[policies] deleted snapshot %s (%s)", id, snapshotLabel)
 	s.activity.Logf(snapshotLabel, "info", "Policy snapshot deleted")
+	s.auditf(r, "delete", auditSnapshot, id, "%s", displayName)
 	http.Redirect(w, r, "/policies?flash=Snapshot+deleted&flash_type=success", http.StatusSeeOther)
 }
 
@@ -457,6 +808,7 @@ func (s *Server) handlePolicySnapshotDelete(w http.ResponseWriter, r *http.Reque
 func (s *Server) handlePolicyCompare(w http.ResponseWriter, r *http.Request) {
 	leftID := r.URL.Query().Get("left")
 	rightID := r.URL.Query().Get("right")
+	opts := diffOptionsFromQuery(r.URL.Query())
 
 	// Load all snapshots for the picker dropdowns
 	snapshots, _ := s.policies.ListSnapshots()
@@ -466,10 +818,13 @@ func (s *Server) handlePolicyCompare(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := policyComparePageData{
-		Nav:       "policies",
-		Snapshots: summaries,
-		LeftID:    leftID,
-		RightID:   rightID,
+		Nav:            "policies",
+		Snapshots:      summaries,
+		LeftID:         leftID,
+		RightID:        rightID,
+		Ignore:         strings.Join(opts.Ignore, ", "),
+		StrictEmpty:    opts.StrictEmpty,
+		IgnoreVolatile: opts.IgnoreVolatile,
 	}
 
 	// Only compute results if both snapshots selected
@@ -480,14 +835,24 @@ func (s *Server) handlePolicyCompare(w http.ResponseWriter, r *http.Request) {
 			data.HasResults = true
 			data.LeftName = leftSnap.ProviderName
 			data.RightName = rightSnap.ProviderName
-
-			leftItems, _ := s.policies.ListItems(leftID, "", "")
-			rightItems, _ := s.policies.ListItems(rightID, "", "")
+			data.MethodWarning = captureMethodMismatch(leftSnap, rightSnap)
+
+			data.Progressive = r.URL.Query().Get("progressive") == "true" ||
+				leftSnap.PolicyCount+rightSnap.PolicyCount > compareInlineLimit
+			if data.Progressive {
+				data.DataURL = compareAPIURL(leftID, rightID, opts)
+				s.render.render(w, "policy_compare.html", data)
+				return
+			}
 
 			// Always pass ALL diffs — client-side Alpine handles filtering
-			data.Stats, data.Diffs = computeDiff(leftItems, rightItems, "")
+			var err error
+			data.Stats, data.Diffs, err = s.compareSnapshots(leftSnap, rightSnap, "", opts)
+			if err != nil {
+				log.Printf("[policies] compare error: %v", err)
+			}
 			data.TotalCount = data.Stats.Matching + data.Stats.Different + data.Stats.LeftOnly + data.Stats.RightOnly
-			data.Platforms, data.Categories = extractDimensions(data.Diffs)
+			data.Platforms, data.Categories = extractDimensions(data.Diffs, s.categoryOrder)
 		}
 	}
 
@@ -496,43 +861,126 @@ func (s *Server) handlePolicyCompare(w http.ResponseWriter, r *http.Request) {
 
 // ── Helpers ─────────────────────────────────────────────────────────────
 
+// compareAPIURL returns the compare API URL for a two-way comparison with
+// the given options, as fetched by the progressive compare page.
+func compareAPIURL(leftID, rightID string, opts diffOptions) string {
+	q := url.Values{"left": {leftID}, "right": {rightID}}
+	if len(opts.Ignore) > 0 {
+		q.Set("ignore", strings.Join(opts.Ignore, ","))
+	}
+	if opts.StrictEmpty {
+		q.Set("strict_empty", "true")
+	}
+	if opts.IgnoreVolatile {
+		q.Set("ignore_volatile", "true")
+	}
+	return "/api/v1/policies/compare?" + q.Encode()
+}
+
+// cleanCategories trims a submitted category selection and drops blanks
+// and duplicates. An empty result means every category.
+func cleanCategories(in []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, c := range in {
+		c = strings.TrimSpace(c)
+		if c == "" || seen[strings.ToLower(c)] {
+			continue
+		}
+		seen[strings.ToLower(c)] = true
+		out = append(out, c)
+	}
+	return out
+}
+
+// snapshotSummary is snapshotToSummary plus the live progress of an
+// in-flight capture.
+func (s *Server) snapshotSummary(snap models.PolicySnapshot) PolicySnapshotSummary {
+	summary := snapshotToSummary(snap)
+	if snap.Status == models.SnapshotStatusCapturing {
+		if p, ok := s.SnapshotProgress(snap.ID); ok {
+			summary.Progress = p.String()
+		}
+	}
+	return summary
+}
+
 // snapshotToSummary converts a DB model to a template view model.
 func snapshotToSummary(snap models.PolicySnapshot) PolicySnapshotSummary {
 	return PolicySnapshotSummary{
-		ID:            snap.ID,
-		ProviderName:  snap.ProviderName,
-		ProviderType:  snap.ProviderType,
-		Label:         snap.Label,
-		DisplayName:   snap.DisplayName(),
-		TakenAt:       snap.TakenAt,
-		PolicyCount:   snap.PolicyCount,
-		CategoryCount: snap.CategoryCount,
-		Status:        snap.Status,
-		StatusMessage: snap.StatusMessage,
+		ID:              snap.ID,
+		ProviderName:    snap.ProviderName,
+		ProviderType:    snap.ProviderType,
+		Label:           snap.Label,
+		DisplayName:     snap.DisplayName(),
+		TakenAt:         snap.TakenAt,
+		PolicyCount:     snap.PolicyCount,
+		CategoryCount:   snap.CategoryCount,
+		Status:          snap.Status,
+		StatusMessage:   snap.StatusMessage,
+		MissingSettings: snap.MissingSettingsCount,
+		CaptureMethod:   snap.CaptureMethod,
+		Coverage:        snap.Coverage,
+		FailedResources: snap.FailedResources,
+		IsBenchmark:     snap.IsBenchmark,
+		Cloned:          snap.ClonedFrom != "",
+		Categories:      snap.Categories,
+	}
+}
+
+// captureMethodLabel is the display name of a capture method.
+func captureMethodLabel(method string) string {
+	switch method {
+	case provider.CaptureMethodUTCM:
+		return "UTCM"
+	case provider.CaptureMethodLegacy:
+		return "legacy Graph endpoints"
+	default:
+		return method
 	}
 }
 
-// buildPolicyView converts DB models into view models with flattened settings.
-func buildPolicyView(items []models.PolicyItem) ([]PolicyItem, []PolicyCategoryGroup) {
+// captureMethodMismatch returns a warning when two snapshots were captured
+// by different methods, whose settings can differ in shape for the same
+// configuration. Snapshots with no recorded method are not flagged.
+func captureMethodMismatch(left, right *models.PolicySnapshot) string {
+	if left.CaptureMethod == "" || right.CaptureMethod == "" || left.CaptureMethod == right.CaptureMethod {
+		return ""
+	}
+	return fmt.Sprintf("The baseline was captured via %s and the target via %s. Some differences may come from the capture method rather than configuration drift.",
+		captureMethodLabel(left.CaptureMethod), captureMethodLabel(right.CaptureMethod))
+}
+
+// settingsDepth is how many levels of nested settings the snapshot view
+// expands.
+func (s *Server) settingsDepth() int {
+	if s.cfg.SettingsDepth > 0 {
+		return s.cfg.SettingsDepth
+	}
+	return intune.DefaultFlattenDepth
+}
+
+// buildPolicyView converts DB models into view models, grouped by category
+// in display order. Settings aren't flattened here: the view shows each
+// item's stored count and fetches its settings when it is expanded.
+func buildPolicyView(items []models.PolicyItem, order categoryOrder) ([]PolicyItem, []PolicyCategoryGroup) {
 	viewItems := make([]PolicyItem, len(items))
 	grouped := map[string][]PolicyItem{}
 
 	for i, item := range items {
-		settings := intune.FlattenSettings(item.SettingsJSON)
-		policySettings := make([]PolicySetting, len(settings))
-		for j, s := range settings {
-			policySettings[j] = PolicySetting{Name: s.Name, Value: s.Value}
-		}
+		assignments, _ := intune.PolicyAssignments(item.SettingsJSON)
 
 		vi := PolicyItem{
-			ID:           item.ID,
-			Category:     item.Category,
-			PolicyName:   item.PolicyName,
-			PolicyType:   item.PolicyType,
-			Platform:     item.Platform,
-			Description:  item.Description,
-			SettingCount: len(policySettings),
-			Settings:     policySettings,
+			ID:            item.ID,
+			Category:      item.Category,
+			PolicyName:    item.PolicyName,
+			PolicyType:    item.PolicyType,
+			Platform:      item.Platform,
+			Description:   item.Description,
+			SettingCount:  item.SettingCount,
+			SettingsError: item.SettingsError,
+			Assignments:   assignments,
+			ScopeTags:     item.ScopeTags,
 		}
 		viewItems[i] = vi
 		grouped[item.Category] = append(grouped[item.Category], vi)
@@ -543,7 +991,7 @@ func buildPolicyView(items []models.PolicyItem) ([]PolicyItem, []PolicyCategoryG
 	for c := range grouped {
 		cats = append(cats, c)
 	}
-	sort.Strings(cats)
+	order.sortStrings(cats)
 
 	groups := make([]PolicyCategoryGroup, len(cats))
 	for i, c := range cats {
@@ -556,26 +1004,147 @@ func buildPolicyView(items []models.PolicyItem) ([]PolicyItem, []PolicyCategoryG
 	return viewItems, groups
 }
 
+// nameGroups labels the group IDs in a setting value with their captured
+// display names, e.g. "Finance Laptops (8f1c…)".
+func nameGroups(value string, groups map[string]string) string {
+	for id, name := range groups {
+		value = strings.ReplaceAll(value, id, name+" ("+id+")")
+	}
+	return value
+}
+
 // ── Comparison logic ────────────────────────────────────────────────────
 
-// computeDiff compares two sets of policy items and produces diffs.
-// Policies are matched by PolicyName + Category + PolicyType + Platform
-// to handle cases where multiple policies share the same display name
-// (e.g., Enrollment Configurations or cross-platform Security Baselines).
-func computeDiff(leftItems, rightItems []models.PolicyItem, filter string) (CompareStats, []PolicyDiff) {
-	type policyKey struct {
-		Name       string
-		Category   string
-		PolicyType string
-		Platform   string
+// policyKey identifies "the same policy" across snapshots. Policies are
+// matched by PolicyName + Category + PolicyType + Platform to handle cases
+// where multiple policies share the same display name (e.g., Enrollment
+// Configurations or cross-platform Security Baselines).
+type policyKey struct {
+	Name       string
+	Category   string
+	PolicyType string
+	Platform   string
+}
+
+// keyOf returns the comparison key for a policy item.
+func keyOf(item models.PolicyItem) policyKey {
+	return policyKey{Name: item.PolicyName, Category: item.Category, PolicyType: item.PolicyType, Platform: item.Platform}
+}
+
+// indexByKey maps each policy item by its comparison key.
+func indexByKey(items []models.PolicyItem) map[policyKey]models.PolicyItem {
+	idx := make(map[policyKey]models.PolicyItem, len(items))
+	for _, item := range items {
+		idx[keyOf(item)] = item
 	}
+	return idx
+}
 
-	// Index right items by key
-	rightIndex := make(map[policyKey]models.PolicyItem)
-	for _, item := range rightItems {
-		key := policyKey{Name: item.PolicyName, Category: item.Category, PolicyType: item.PolicyType, Platform: item.Platform}
-		rightIndex[key] = item
+// diffOptions tunes how settings are compared.
+type diffOptions struct {
+	// Ignore holds setting-name glob patterns (e.g. "lastModified*",
+	// "*.id"). Matching settings are left out of both the diff rows and the
+	// match/different decision.
+	Ignore []string
+
+	// StrictEmpty makes an absent setting differ from one present as null,
+	// "", [] or {}. By default they compare equal, since Graph is
+	// inconsistent about omitting versus nulling unset settings.
+	StrictEmpty bool
+
+	// IgnoreVolatile treats a setting whose values differ only in
+	// RFC3339 timestamps or GUIDs, including inside nested JSON, as
+	// unchanged. Otherwise such changes are still reported, flagged
+	// Volatile so the UI can de-emphasise them.
+	IgnoreVolatile bool
+}
+
+// Patterns for values that churn between captures without reflecting a
+// config change: RFC3339 timestamps and GUIDs.
+var (
+	timestampPattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:\d{2})`)
+	guidPattern      = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+)
+
+// maskVolatile replaces timestamps and GUIDs in a value with fixed
+// placeholders, so values differing only in those compare equal.
+func maskVolatile(s string) string {
+	s = timestampPattern.ReplaceAllString(s, "<timestamp>")
+	return guidPattern.ReplaceAllString(s, "<guid>")
+}
+
+// absentValue is the comparison value of a missing setting in strict mode.
+// It cannot collide with formatSettingValue output for any JSON value.
+const absentValue = "\x00absent"
+
+// compareValue returns the string a setting is compared by. Display values
+// still come from formatSettingValue; this only decides changed/unchanged.
+// Assignments are compared by target, group ID and filter: a retargeted
+// policy is drift, but a renamed group is not.
+func (o diffOptions) compareValue(m map[string]any, key string) string {
+	v, ok := m[key]
+	if !ok {
+		if o.StrictEmpty {
+			return absentValue
+		}
+		return ""
+	}
+	if key == intune.AssignmentsKey {
+		v = withoutGroupNames(v)
+	}
+	s := formatSettingValue(v)
+	if !o.StrictEmpty && (s == "[]" || s == "{}") {
+		return ""
+	}
+	if o.IgnoreVolatile {
+		return maskVolatile(s)
+	}
+	return s
+}
+
+// withoutGroupNames returns captured assignments with their group names
+// removed.
+func withoutGroupNames(v any) any {
+	list, ok := v.([]any)
+	if !ok {
+		return v
 	}
+	out := make([]any, len(list))
+	for i, a := range list {
+		m, ok := a.(map[string]any)
+		if !ok {
+			out[i] = a
+			continue
+		}
+		c := make(map[string]any, len(m))
+		for k, val := range m {
+			if k != "groupName" {
+				c[k] = val
+			}
+		}
+		out[i] = c
+	}
+	return out
+}
+
+// diffOptionsFromQuery reads the comparison options shared by the compare
+// page and the compare APIs: "ignore" patterns, "strict_empty" and
+// "ignore_volatile".
+func diffOptionsFromQuery(q url.Values) diffOptions {
+	strict, _ := strconv.ParseBool(q.Get("strict_empty"))
+	volatile, _ := strconv.ParseBool(q.Get("ignore_volatile"))
+	return diffOptions{
+		Ignore:         parseIgnorePatterns(q["ignore"]),
+		StrictEmpty:    strict,
+		IgnoreVolatile: volatile,
+	}
+}
+
+// computeDiff compares two sets of policy items and produces diffs.
+// Policies are matched with keyOf.
+func computeDiff(leftItems, rightItems []models.PolicyItem, filter string, opts diffOptions) (CompareStats, []PolicyDiff) {
+	// Index right items by key
+	rightIndex := indexByKey(rightItems)
 
 	// Track which right items were matched
 	matched := make(map[policyKey]bool)
@@ -585,7 +1154,7 @@ func computeDiff(leftItems, rightItems []models.PolicyItem, filter string) (Comp
 
 	// Compare left items against right
 	for _, left := range leftItems {
-		key := policyKey{Name: left.PolicyName, Category: left.Category, PolicyType: left.PolicyType, Platform: left.Platform}
+		key := keyOf(left)
 		right, found := rightIndex[key]
 		matched[key] = true
 
@@ -596,7 +1165,7 @@ func computeDiff(leftItems, rightItems []models.PolicyItem, filter string) (Comp
 				Category:   left.Category,
 				Platform:   left.Platform,
 				Status:     "left-only",
-				Settings:   flattenToViewSettings(left.SettingsJSON),
+				Settings:   flattenToViewSettings(left.SettingsJSON, opts.Ignore),
 			}
 			if filter == "" || filter == "left-only" {
 				diffs = append(diffs, diff)
@@ -605,7 +1174,7 @@ func computeDiff(leftItems, rightItems []models.PolicyItem, filter string) (Comp
 		}
 
 		// Both exist — compare settings
-		settingDiffs, allMatch := diffSettings(left.SettingsJSON, right.SettingsJSON)
+		settingDiffs, allMatch := diffSettings(left.SettingsJSON, right.SettingsJSON, opts)
 
 		if allMatch {
 			stats.Matching++
@@ -636,7 +1205,7 @@ func computeDiff(leftItems, rightItems []models.PolicyItem, filter string) (Comp
 
 	// Find right-only items
 	for _, right := range rightItems {
-		key := policyKey{Name: right.PolicyName, Category: right.Category, PolicyType: right.PolicyType, Platform: right.Platform}
+		key := keyOf(right)
 		if matched[key] {
 			continue
 		}
@@ -646,7 +1215,7 @@ func computeDiff(leftItems, rightItems []models.PolicyItem, filter string) (Comp
 			Category:   right.Category,
 			Platform:   right.Platform,
 			Status:     "right-only",
-			Settings:   flattenToViewSettings(right.SettingsJSON),
+			Settings:   flattenToViewSettings(right.SettingsJSON, opts.Ignore),
 		}
 		if filter == "" || filter == "right-only" {
 			diffs = append(diffs, diff)
@@ -667,7 +1236,10 @@ func computeDiff(leftItems, rightItems []models.PolicyItem, filter string) (Comp
 }
 
 // diffSettings compares two JSON settings blobs and returns per-setting diffs.
-func diffSettings(leftJSON, rightJSON string) ([]SettingDiff, bool) {
+// Settings matching opts.Ignore are skipped entirely; empty and absent values
+// are reconciled per opts.StrictEmpty, and timestamp/GUID-only changes per
+// opts.IgnoreVolatile.
+func diffSettings(leftJSON, rightJSON string, opts diffOptions) ([]SettingDiff, bool) {
 	leftMap := parseSettingsMap(leftJSON)
 	rightMap := parseSettingsMap(rightJSON)
 
@@ -684,6 +1256,7 @@ func diffSettings(leftJSON, rightJSON string) ([]SettingDiff, bool) {
 	for k := range allKeys {
 		keys = append(keys, k)
 	}
+	keys = filterSettingKeys(keys, opts.Ignore)
 	sort.Strings(keys)
 
 	var diffs []SettingDiff
@@ -692,7 +1265,7 @@ func diffSettings(leftJSON, rightJSON string) ([]SettingDiff, bool) {
 	for _, k := range keys {
 		lv := formatSettingValue(leftMap[k])
 		rv := formatSettingValue(rightMap[k])
-		changed := lv != rv
+		changed := opts.compareValue(leftMap, k) != opts.compareValue(rightMap, k)
 		if changed {
 			allMatch = false
 		}
@@ -701,18 +1274,23 @@ func diffSettings(leftJSON, rightJSON string) ([]SettingDiff, bool) {
 			LeftValue:  lv,
 			RightValue: rv,
 			Changed:    changed,
+			Volatile:   changed && maskVolatile(lv) == maskVolatile(rv),
 		})
 	}
 
 	return diffs, allMatch
 }
 
-// parseSettingsMap parses a JSON string into a map of settings.
+// parseSettingsMap parses a JSON string into a map of settings for
+// comparison. Captured group names are left out: they label the IDs that
+// settings reference rather than configure anything, so a renamed group
+// would otherwise show as drift.
 func parseSettingsMap(jsonStr string) map[string]any {
 	var m map[string]any
 	if err := json.Unmarshal([]byte(jsonStr), &m); err != nil {
 		return map[string]any{}
 	}
+	delete(m, intune.GroupNamesKey)
 	return m
 }
 
@@ -740,18 +1318,96 @@ func formatSettingValue(v any) string {
 	}
 }
 
-// flattenToViewSettings converts a JSON blob into PolicySetting view models.
-func flattenToViewSettings(settingsJSON string) []PolicySetting {
-	settings := intune.FlattenSettings(settingsJSON)
-	ps := make([]PolicySetting, len(settings))
-	for i, s := range settings {
-		ps[i] = PolicySetting{Name: s.Name, Value: s.Value}
+// viewSettings flattens a policy's settings depth levels deep for display.
+// Captured assignments and group names are left out: assignments are shown
+// separately, and group names are folded into the values that reference
+// them.
+func viewSettings(settingsJSON string, depth int) []PolicySetting {
+	settings := intune.FlattenSettingsDepth(settingsJSON, depth)
+	groups := intune.GroupNames(settingsJSON)
+	out := make([]PolicySetting, 0, len(settings))
+	for _, s := range settings {
+		if isSettingUnder(s.Name, intune.AssignmentsKey) || isSettingUnder(s.Name, intune.GroupNamesKey) {
+			continue
+		}
+		out = append(out, PolicySetting{Name: s.Name, Value: nameGroups(s.Value, groups)})
+	}
+	return out
+}
+
+// settingCount is the number of settings a policy has at the default
+// flatten depth, as stored on its item when it is captured or copied. The
+// snapshot view shows it until the policy is expanded.
+func settingCount(settingsJSON string) int {
+	return len(viewSettings(settingsJSON, intune.DefaultFlattenDepth))
+}
+
+// isSettingUnder reports whether a flattened setting name is key itself or
+// one of the entries expanded from it.
+func isSettingUnder(name, key string) bool {
+	return name == key || strings.HasPrefix(name, key+".")
+}
+
+// flattenToViewSettings converts a JSON blob into PolicySetting view models,
+// dropping captured group names and any settings whose names match the
+// ignore patterns. Settings stay one per top-level key, like the
+// comparison's diffs, so ignore patterns mean the same on both.
+func flattenToViewSettings(settingsJSON string, ignore []string) []PolicySetting {
+	settings := intune.FlattenSettingsDepth(settingsJSON, 0)
+	ps := make([]PolicySetting, 0, len(settings))
+	for _, s := range settings {
+		if s.Name == intune.GroupNamesKey || matchesAnyPattern(s.Name, ignore) {
+			continue
+		}
+		ps = append(ps, PolicySetting{Name: s.Name, Value: s.Value})
 	}
 	return ps
 }
 
-// extractDimensions returns sorted unique platforms and categories from diffs.
-func extractDimensions(diffs []PolicyDiff) ([]string, []string) {
+// filterSettingKeys returns keys with any names matching one of the glob
+// patterns removed. Matching is case-insensitive and uses path.Match syntax.
+func filterSettingKeys(keys []string, patterns []string) []string {
+	if len(patterns) == 0 {
+		return keys
+	}
+	out := keys[:0:0]
+	for _, k := range keys {
+		if !matchesAnyPattern(k, patterns) {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// matchesAnyPattern reports whether name matches any glob pattern.
+// Malformed patterns never match.
+func matchesAnyPattern(name string, patterns []string) bool {
+	lower := strings.ToLower(name)
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToLower(p), lower); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIgnorePatterns reads the "ignore" query parameter. Patterns may be
+// comma-separated and/or the parameter repeated.
+func parseIgnorePatterns(values []string) []string {
+	var patterns []string
+	for _, v := range values {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				patterns = append(patterns, p)
+			}
+		}
+	}
+	return patterns
+}
+
+// extractDimensions returns unique platforms, sorted alphabetically, and
+// categories, in display order, from diffs.
+func extractDimensions(diffs []PolicyDiff, order categoryOrder) ([]string, []string) {
 	platSet := map[string]bool{}
 	catSet := map[string]bool{}
 	for _, d := range diffs {
@@ -771,6 +1427,6 @@ func extractDimensions(diffs []PolicyDiff) ([]string, []string) {
 	for c := range catSet {
 		categories = append(categories, c)
 	}
-	sort.Strings(categories)
+	order.sortStrings(categories)
 	return platforms, categories
 }
@@ -0,0 +1,354 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dan/moe/internal/models"
+	"github.com/dan/moe/internal/provider/intune"
+)
+
+func TestDiffSettingsAbsentVersusEmpty(t *testing.T) {
+	tests := []struct {
+		name   string
+		left   string
+		right  string
+		strict bool
+		match  bool
+	}{
+		{"absent vs empty string", `{"a":"x"}`, `{"a":"x","b":""}`, false, true},
+		{"absent vs null", `{"a":"x","b":null}`, `{"a":"x"}`, false, true},
+		{"absent vs empty list", `{"b":[]}`, `{}`, false, true},
+		{"absent vs empty object", `{}`, `{"b":{}}`, false, true},
+		{"null vs empty string", `{"b":null}`, `{"b":""}`, false, true},
+		{"absent vs value", `{}`, `{"b":"on"}`, false, false},
+		{"strict absent vs empty string", `{"a":"x"}`, `{"a":"x","b":""}`, true, false},
+		{"strict absent vs null", `{"a":"x","b":null}`, `{"a":"x"}`, true, false},
+		{"strict null vs empty string", `{"b":null}`, `{"b":""}`, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs, match := diffSettings(tt.left, tt.right, diffOptions{StrictEmpty: tt.strict})
+			if match != tt.match {
+				t.Errorf("match = %v, want %v (diffs %+v)", match, tt.match, diffs)
+			}
+		})
+	}
+}
+
+func TestDiffSettings3AbsentVersusNull(t *testing.T) {
+	rows := diffSettings3(`{"b":null}`, `{}`, `{"b":""}`, diffOptions{})
+	if len(rows) != 1 || rows[0].Class != class3AllMatch {
+		t.Fatalf("rows = %+v, want one all-match row", rows)
+	}
+
+	rows = diffSettings3(`{"b":null}`, `{}`, `{"b":""}`, diffOptions{StrictEmpty: true})
+	if len(rows) != 1 || rows[0].Class != class3OneDiffers || rows[0].Odd != "left" {
+		t.Fatalf("rows = %+v, want left as the odd one out", rows)
+	}
+}
+
+func TestDiffSettingsGroupNames(t *testing.T) {
+	left := `{"a":1,"_groups":{"g1":"Finance"},"_assignments":[{"target":"group","groupId":"g1","groupName":"Finance"}]}`
+	renamed := `{"a":1,"_groups":{"g1":"Finance EMEA"},"_assignments":[{"target":"group","groupId":"g1","groupName":"Finance EMEA"}]}`
+	diffs, allMatch := diffSettings(left, renamed, diffOptions{})
+	if !allMatch {
+		t.Errorf("renaming a group reads as drift: %+v", diffs)
+	}
+	for _, d := range diffs {
+		if d.Name == intune.GroupNamesKey {
+			t.Errorf("group names diffed as a setting: %+v", d)
+		}
+	}
+
+	retargeted := `{"a":1,"_assignments":[{"target":"group","groupId":"g2","groupName":"Finance"}]}`
+	if _, allMatch := diffSettings(left, retargeted, diffOptions{}); allMatch {
+		t.Error("assigning a policy to another group is not reported")
+	}
+}
+
+func TestDiffOptionsFromQuery(t *testing.T) {
+	q, _ := url.ParseQuery("ignore=version,lastModified*&ignore=*Id&strict_empty=true")
+	opts := diffOptionsFromQuery(q)
+	if !opts.StrictEmpty {
+		t.Error("StrictEmpty = false, want true")
+	}
+	if len(opts.Ignore) != 3 {
+		t.Errorf("Ignore = %v, want 3 patterns", opts.Ignore)
+	}
+	if diffOptionsFromQuery(url.Values{}).StrictEmpty {
+		t.Error("StrictEmpty defaults to true, want false")
+	}
+}
+
+func TestDiffSettingsVolatileValues(t *testing.T) {
+	left := `{"modified":"2026-01-01T10:00:00Z","nested":{"id":"0f8fad5b-d9cb-469f-a165-70867728950e","on":true},"mode":"a"}`
+	right := `{"modified":"2026-02-03T11:22:33.123+02:00","nested":{"id":"7c9e6679-7425-40de-944b-e07fc1f90ae7","on":true},"mode":"a"}`
+
+	diffs, match := diffSettings(left, right, diffOptions{})
+	if match {
+		t.Fatal("match = true, want timestamp/GUID changes reported by default")
+	}
+	for _, d := range diffs {
+		if d.Changed && !d.Volatile {
+			t.Errorf("%s: Changed without Volatile, want volatile-only change", d.Name)
+		}
+	}
+
+	if _, match := diffSettings(left, right, diffOptions{IgnoreVolatile: true}); !match {
+		t.Error("match = false with IgnoreVolatile, want true")
+	}
+
+	// A real change alongside a new timestamp is not volatile.
+	diffs, _ = diffSettings(`{"v":"on 2026-01-01T10:00:00Z"}`, `{"v":"off 2026-01-02T10:00:00Z"}`, diffOptions{IgnoreVolatile: true})
+	if len(diffs) != 1 || !diffs[0].Changed || diffs[0].Volatile {
+		t.Errorf("diffs = %+v, want a non-volatile change", diffs)
+	}
+}
+
+func TestCategoryOrder(t *testing.T) {
+	cats := []string{"Autopilot Profiles", "App Protection", "Compliance Scripts", "Zebra", "Endpoint Security", "Compliance Policies", "Abacus"}
+	defaultCategoryOrder.sortStrings(cats)
+	want := []string{"Compliance Policies", "Compliance Scripts", "Endpoint Security", "App Protection", "Autopilot Profiles", "Abacus", "Zebra"}
+	if strings.Join(cats, "|") != strings.Join(want, "|") {
+		t.Errorf("sorted = %v, want %v", cats, want)
+	}
+
+	items := []models.PolicyItem{
+		{Category: "Autopilot Profiles", PolicyName: "a"},
+		{Category: "compliance policies", PolicyName: "b"},
+		{Category: "Autopilot Profiles", PolicyName: "c"},
+	}
+	categoryOrder{"Compliance"}.sortItems(items)
+	if items[0].PolicyName != "b" || items[1].PolicyName != "a" || items[2].PolicyName != "c" {
+		t.Errorf("sortItems = %+v, want compliance first and name order kept within a category", items)
+	}
+}
+
+func TestSettingCount(t *testing.T) {
+	settings := `{"a":1,"b":{"c":true,"d":"x"},"_assignments":[{"target":"allDevices"}],"_groups":{"g":"Finance"}}`
+	if got := settingCount(settings); got != 3 {
+		t.Errorf("settingCount = %d, want 3 (assignments and group names left out)", got)
+	}
+
+	items := []models.PolicyItem{{Category: "c", SettingsJSON: settings, SettingCount: 7}}
+	if view, _ := buildPolicyView(items, nil); view[0].SettingCount != 7 {
+		t.Errorf("view SettingCount = %d, want the stored 7", view[0].SettingCount)
+	}
+}
+
+func TestCaptureMethodMismatch(t *testing.T) {
+	snap := func(method string) *models.PolicySnapshot { return &models.PolicySnapshot{CaptureMethod: method} }
+	tests := []struct {
+		left, right string
+		warn        bool
+	}{
+		{"utcm", "utcm", false},
+		{"legacy", "legacy", false},
+		{"utcm", "legacy", true},
+		{"legacy", "utcm", true},
+		{"", "utcm", false},
+		{"legacy", "", false},
+	}
+	for _, tt := range tests {
+		got := captureMethodMismatch(snap(tt.left), snap(tt.right))
+		if (got != "") != tt.warn {
+			t.Errorf("captureMethodMismatch(%q, %q) = %q, want warning %v", tt.left, tt.right, got, tt.warn)
+		}
+	}
+}
+
+func TestPartialCaptureMessage(t *testing.T) {
+	tests := []struct {
+		failed []string
+		want   string
+	}{
+		{nil, ""},
+		{[]string{"deviceConfigurationPolicyiOS: access denied"},
+			"completed with 1 resource type failed: deviceConfigurationPolicyiOS: access denied"},
+		{[]string{"a: timeout", "b: forbidden"},
+			"completed with 2 resource types failed: a: timeout; b: forbidden"},
+	}
+	for _, tt := range tests {
+		if got := partialCaptureMessage(tt.failed); got != tt.want {
+			t.Errorf("partialCaptureMessage(%q) = %q, want %q", tt.failed, got, tt.want)
+		}
+	}
+
+	snap := PolicySnapshotSummary{Status: models.SnapshotStatusError, FailedResources: []string{"a: timeout"}}
+	if snap.Partial() {
+		t.Error("an errored snapshot reported as partial")
+	}
+	snap.Status = models.SnapshotStatusComplete
+	if !snap.Partial() {
+		t.Error("a complete snapshot with failed resources not reported as partial")
+	}
+}
+
+func TestEvaluateBenchmark(t *testing.T) {
+	benchmark := []models.PolicyItem{
+		{PolicyName: "CIS 1.1 Password", PolicyType: "windows10CompliancePolicy", Platform: "Windows", SettingsJSON: `{"passwordRequired":true,"passwordMinimumLength":14}`},
+		{PolicyName: "CIS 2.1 Encryption", PolicyType: "windows10CompliancePolicy", Platform: "Windows", SettingsJSON: `{"bitLockerEnabled":true}`},
+		{PolicyName: "CIS 3.1 Firewall", Category: "Endpoint Security", SettingsJSON: `{"firewallEnabled":true}`},
+		{PolicyName: "iOS passcode", PolicyType: "iosCompliancePolicy", Platform: "iOS", SettingsJSON: `{"passcodeRequired":true}`},
+	}
+	target := []models.PolicyItem{
+		{PolicyName: "Win Baseline", PolicyType: "windows10CompliancePolicy", Platform: "Windows", SettingsJSON: `{"passwordRequired":true,"passwordMinimumLength":8}`},
+		{PolicyName: "Win Strict", PolicyType: "windows10CompliancePolicy", Platform: "Windows", SettingsJSON: `{"passwordMinimumLength":14,"bitLockerEnabled":true}`},
+		{PolicyName: "Defender FW", Category: "endpoint security", PolicyType: "firewall", Platform: "Windows", SettingsJSON: `{"firewallEnabled":true}`},
+		// Wrong platform for the iOS control.
+		{PolicyName: "Android passcode", PolicyType: "iosCompliancePolicy", Platform: "Android", SettingsJSON: `{"passcodeRequired":true}`},
+	}
+
+	stats, controls := evaluateBenchmark(benchmark, target, diffOptions{})
+	if stats.Controls != 4 || stats.Passed != 3 || stats.Failed != 0 || stats.NotConfigured != 1 {
+		t.Fatalf("stats = %+v, want 3 passed and 1 not configured", stats)
+	}
+	if stats.Score != 75 {
+		t.Errorf("score = %v, want 75", stats.Score)
+	}
+	if failures := benchmarkFailures(controls); len(failures) != 1 || failures[0].Status != benchmarkNotConfigured {
+		t.Errorf("failures = %+v, want only the not-configured control", failures)
+	}
+	if controls[0].PolicyName != "iOS passcode" || controls[0].Status != benchmarkNotConfigured {
+		t.Errorf("first control = %s (%s), want iOS passcode not-configured first", controls[0].PolicyName, controls[0].Status)
+	}
+	for _, c := range controls {
+		if c.PolicyName != "CIS 1.1 Password" {
+			continue
+		}
+		for _, s := range c.Settings {
+			if s.Name == "passwordMinimumLength" && s.Source != "Win Strict" {
+				t.Errorf("passwordMinimumLength source = %q, want the policy with the passing value", s.Source)
+			}
+		}
+	}
+
+	target[1].SettingsJSON = `{"passwordMinimumLength":8,"bitLockerEnabled":false}`
+	stats, controls = evaluateBenchmark(benchmark, target, diffOptions{})
+	if stats.Failed != 2 || controls[0].Status != benchmarkFail {
+		t.Errorf("stats = %+v, want the password and encryption controls failing first", stats)
+	}
+}
+
+func TestSnapshotProgress(t *testing.T) {
+	s := &Server{progress: make(map[string]CaptureProgress), cancels: make(map[string]context.CancelFunc)}
+	if _, ok := s.SnapshotProgress("snap1"); ok {
+		t.Fatal("progress reported before the first callback")
+	}
+
+	s.setSnapshotProgress("snap1", "Settings Catalog", 412)
+	p, ok := s.SnapshotProgress("snap1")
+	if !ok || p.String() != "Settings Catalog (412 so far)" {
+		t.Fatalf("progress = %q, %v", p, ok)
+	}
+
+	w := httptest.NewRecorder()
+	renderSnapshotRow(w, PolicySnapshotSummary{ID: "snap1", Status: models.SnapshotStatusCapturing, Progress: p.String()})
+	if !strings.Contains(w.Body.String(), "Settings Catalog (412 so far)") {
+		t.Errorf("row does not show progress: %s", w.Body.String())
+	}
+
+	s.untrackCapture("snap1")
+	if _, ok := s.SnapshotProgress("snap1"); ok {
+		t.Error("progress still reported after the capture finished")
+	}
+}
+
+func TestCancelCapture(t *testing.T) {
+	s := &Server{progress: make(map[string]CaptureProgress), cancels: make(map[string]context.CancelFunc)}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.trackCapture("snap1", cancel)
+
+	if !s.cancelCapture("snap1") {
+		t.Fatal("cancelCapture = false for a running capture")
+	}
+	if ctx.Err() == nil {
+		t.Error("capture context not cancelled")
+	}
+
+	s.untrackCapture("snap1")
+	if s.cancelCapture("snap1") {
+		t.Error("cancelCapture = true after the capture finished")
+	}
+}
+
+func TestQueuedSnapshotRow(t *testing.T) {
+	w := httptest.NewRecorder()
+	renderSnapshotRow(w, PolicySnapshotSummary{ID: "snap1", Status: models.SnapshotStatusQueued})
+	body := w.Body.String()
+	if !strings.Contains(body, "Queued") || strings.Contains(body, "Capturing") {
+		t.Errorf("row does not show the capture as queued: %s", body)
+	}
+	if !strings.Contains(body, `hx-trigger="every 3s"`) || !strings.Contains(body, "/cancel") {
+		t.Errorf("queued row should poll and offer cancel: %s", body)
+	}
+}
+
+func TestRemediationChecklist(t *testing.T) {
+	controls := []BenchmarkControl{
+		{PolicyName: "Passcode", Severity: "low", Status: benchmarkFail, Settings: []BenchmarkSetting{
+			{Name: "passcodeRequired", Expected: "true", Status: benchmarkPass, Source: "iOS"},
+			{Name: "passcodeMinimumLength", Expected: "6", Actual: "4", Status: benchmarkFail, Source: "iOS"},
+		}},
+		{PolicyName: "Firewall", Status: benchmarkNotConfigured, Settings: []BenchmarkSetting{
+			{Name: "firewallEnabled", Expected: "true", Status: benchmarkNotConfigured},
+		}},
+		{PolicyName: "BitLocker", Severity: "Critical", Status: benchmarkFail, Settings: []BenchmarkSetting{
+			{Name: "bitLockerEnabled", Expected: "true", Actual: "false", Status: benchmarkFail, Source: "Win"},
+		}},
+		{PolicyName: "Defender", Severity: "critical", Status: benchmarkPass},
+	}
+
+	items := remediationChecklist(controls)
+	var got []string
+	for _, it := range items {
+		got = append(got, it.Control+"/"+it.Setting)
+	}
+	want := []string{"BitLocker/bitLockerEnabled", "Passcode/passcodeMinimumLength", "Firewall/firewallEnabled"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("checklist = %v, want %v", got, want)
+	}
+	if items[1].Current != "4" || items[1].Policy != "iOS" {
+		t.Errorf("passcode item = %+v, want current 4 in policy iOS", items[1])
+	}
+	if items[2].Policy != "" {
+		t.Errorf("not-configured item names policy %q, want none", items[2].Policy)
+	}
+}
+
+func TestCompareCache(t *testing.T) {
+	c := newCompareCache(2)
+	key := func(left, right string) compareKey {
+		return newCompareKey(left, right, "", diffOptions{})
+	}
+
+	c.put(key("a", "b"), CompareStats{Matching: 1}, nil)
+	c.put(key("a", "c"), CompareStats{Matching: 2}, nil)
+	if stats, _, ok := c.get(key("a", "b")); !ok || stats.Matching != 1 {
+		t.Fatalf("get(a, b) = %+v, %v; want the stored stats", stats, ok)
+	}
+	if _, _, ok := c.get(newCompareKey("a", "b", "different", diffOptions{})); ok {
+		t.Error("a different filter hit the cache")
+	}
+
+	// a/b was used more recently than a/c, so a/c is evicted.
+	c.put(key("b", "c"), CompareStats{}, nil)
+	if _, _, ok := c.get(key("a", "c")); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	if _, _, ok := c.get(key("a", "b")); !ok {
+		t.Error("recently used entry was evicted")
+	}
+
+	c.forget("a")
+	if _, _, ok := c.get(key("a", "b")); ok {
+		t.Error("entry for a forgotten snapshot is still cached")
+	}
+	if _, _, ok := c.get(key("b", "c")); !ok {
+		t.Error("forget dropped an unrelated entry")
+	}
+}
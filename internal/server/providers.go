@@ -3,8 +3,12 @@ package server
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/dan/moe/internal/models"
+	"github.com/dan/moe/internal/provider/intune"
 )
 
 // ── Template data ───────────────────────────────────────────────────────
@@ -14,13 +18,35 @@ type providerListData struct {
 	Providers    []models.ProviderConfig
 	DeviceCounts map[string]int
 	Statuses     map[string]*ProviderStatus
+	SyncRuns     map[string][]models.SyncRun // most recent runs per provider name
 }
 
+// recentSyncRuns is how many sync runs each provider card shows.
+const recentSyncRuns = 5
+
 type providerFormData struct {
-	Nav      string
-	Provider *models.ProviderConfig
-	IsNew    bool
-	Error    string
+	Nav              string
+	Provider         *models.ProviderConfig
+	IsNew            bool
+	Error            string
+	DefaultRetention int           // server-wide snapshot retention, shown as the placeholder
+	DefaultHealth    time.Duration // server-wide health check interval, shown as the placeholder
+	TestBeforeSave   bool          // connection test requested before persisting
+}
+
+// renderProviderForm renders the provider form for p with the server-wide
+// defaults its placeholders show. errMsg is shown above the form when set,
+// and the test-before-save box keeps its submitted state.
+func (s *Server) renderProviderForm(w http.ResponseWriter, r *http.Request, p *models.ProviderConfig, isNew bool, errMsg string) {
+	s.render.render(w, "provider_form.html", providerFormData{
+		Nav:              "providers",
+		DefaultRetention: s.cfg.SnapshotRetention,
+		DefaultHealth:    s.cfg.HealthInterval,
+		Provider:         p,
+		IsNew:            isNew,
+		Error:            errMsg,
+		TestBeforeSave:   r.FormValue("test_before_save") == "on",
+	})
 }
 
 // ── Handlers ────────────────────────────────────────────────────────────
@@ -34,20 +60,22 @@ func (s *Server) handleProviderList(w http.ResponseWriter, r *http.Request) {
 
 	deviceCounts, _ := s.devices.CountByProvider()
 
+	syncRuns := make(map[string][]models.SyncRun, len(providers))
+	for _, p := range providers {
+		syncRuns[p.Name], _ = s.syncRuns.List(p.Name, recentSyncRuns)
+	}
+
 	s.render.render(w, "providers.html", providerListData{
 		Nav:          "providers",
 		Providers:    providers,
 		DeviceCounts: deviceCounts,
 		Statuses:     s.status.All(),
+		SyncRuns:     syncRuns,
 	})
 }
 
 func (s *Server) handleProviderNew(w http.ResponseWriter, r *http.Request) {
-	s.render.render(w, "provider_form.html", providerFormData{
-		Nav:      "providers",
-		Provider: &models.ProviderConfig{SyncInterval: "15m", Enabled: true},
-		IsNew:    true,
-	})
+	s.renderProviderForm(w, r, &models.ProviderConfig{SyncInterval: "15m", Enabled: true}, true, "")
 }
 
 func (s *Server) handleProviderCreate(w http.ResponseWriter, r *http.Request) {
@@ -57,19 +85,29 @@ func (s *Server) handleProviderCreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	p := &models.ProviderConfig{
-		ID:           newID(),
-		Name:         r.FormValue("name"),
-		Type:         r.FormValue("type"),
-		SyncInterval: r.FormValue("sync_interval"),
-		Enabled:      r.FormValue("enabled") == "on",
+		ID:                newID(),
+		Name:              r.FormValue("name"),
+		Type:              r.FormValue("type"),
+		SyncInterval:      r.FormValue("sync_interval"),
+		Enabled:           r.FormValue("enabled") == "on",
+		SnapshotRetention: formRetention(r),
+		HealthInterval:    strings.TrimSpace(r.FormValue("health_interval")),
 	}
 
 	// Populate type-specific fields.
+	var pageSizeErr error
 	switch p.Type {
 	case "intune":
 		p.TenantID = r.FormValue("tenant_id")
 		p.ClientID = r.FormValue("client_id")
 		p.ClientSecret = r.FormValue("client_secret")
+		p.Cloud = r.FormValue("cloud")
+		p.SyncPageSize, pageSizeErr = formSyncPageSize(r)
+		p.SyncFilter = strings.TrimSpace(r.FormValue("sync_filter"))
+	case "jamf":
+		p.BaseURL = r.FormValue("jamf_base_url")
+		p.ClientID = r.FormValue("jamf_client_id")
+		p.ClientSecret = r.FormValue("jamf_client_secret")
 	case "uem":
 		p.BaseURL = r.FormValue("base_url")
 		p.TenantID = r.FormValue("uem_tenant_id")
@@ -78,26 +116,41 @@ func (s *Server) handleProviderCreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if p.Name == "" || p.Type == "" {
-		s.render.render(w, "provider_form.html", providerFormData{
-			Nav:      "providers",
-			Provider: p,
-			IsNew:    true,
-			Error:    "Name and type are required.",
-		})
+		s.renderProviderForm(w, r, p, true, "Name and type are required.")
+		return
+	}
+	if err := validHealthInterval(p.HealthInterval); err != nil {
+		s.renderProviderForm(w, r, p, true, "Invalid health check interval: "+err.Error())
+		return
+	}
+	if pageSizeErr != nil {
+		s.renderProviderForm(w, r, p, true, "Invalid sync page size: "+pageSizeErr.Error())
+		return
+	}
+	if err := intune.ValidateDeviceFilter(p.SyncFilter); err != nil {
+		s.renderProviderForm(w, r, p, true, "Invalid device sync filter: "+err.Error())
 		return
 	}
 
+	testFirst := r.FormValue("test_before_save") == "on"
+	if testFirst {
+		if err := s.testProviderConfig(r.Context(), p); err != nil {
+			s.renderProviderForm(w, r, p, true, "Connection test failed: "+err.Error())
+			return
+		}
+	}
+
 	if err := s.providerConfigs.Create(p); err != nil {
-		s.render.render(w, "provider_form.html", providerFormData{
-			Nav:      "providers",
-			Provider: p,
-			IsNew:    true,
-			Error:    err.Error(),
-		})
+		s.renderProviderForm(w, r, p, true, err.Error())
 		return
 	}
 
-	http.Redirect(w, r, "/providers?flash=Provider+"+p.Name+"+created&flash_type=success", http.StatusSeeOther)
+	s.auditf(r, "create", auditProvider, p.ID, "%s (%s)", p.Name, p.Type)
+	flash := "Provider+" + p.Name + "+created"
+	if testFirst {
+		flash += "+—+connection+verified"
+	}
+	http.Redirect(w, r, "/providers?flash="+flash+"&flash_type=success", http.StatusSeeOther)
 }
 
 func (s *Server) handleProviderEdit(w http.ResponseWriter, r *http.Request) {
@@ -108,11 +161,7 @@ func (s *Server) handleProviderEdit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.render.render(w, "provider_form.html", providerFormData{
-		Nav:      "providers",
-		Provider: p,
-		IsNew:    false,
-	})
+	s.renderProviderForm(w, r, p, false, "")
 }
 
 func (s *Server) handleProviderUpdate(w http.ResponseWriter, r *http.Request) {
@@ -132,8 +181,12 @@ func (s *Server) handleProviderUpdate(w http.ResponseWriter, r *http.Request) {
 	p.Type = r.FormValue("type")
 	p.SyncInterval = r.FormValue("sync_interval")
 	p.Enabled = r.FormValue("enabled") == "on"
+	p.SnapshotRetention = formRetention(r)
+	p.HealthInterval = strings.TrimSpace(r.FormValue("health_interval"))
 
 	// Populate type-specific fields; clear the other type's fields.
+	var pageSizeErr error
+	p.SyncPageSize, p.SyncFilter = 0, ""
 	switch p.Type {
 	case "intune":
 		p.TenantID = r.FormValue("tenant_id")
@@ -141,10 +194,24 @@ func (s *Server) handleProviderUpdate(w http.ResponseWriter, r *http.Request) {
 		if secret := r.FormValue("client_secret"); secret != "" {
 			p.ClientSecret = secret
 		}
-		// Clear UEM fields.
+		p.Cloud = r.FormValue("cloud")
+		p.SyncPageSize, pageSizeErr = formSyncPageSize(r)
+		p.SyncFilter = strings.TrimSpace(r.FormValue("sync_filter"))
+		// Clear UEM/Jamf fields.
 		p.BaseURL = ""
 		p.Username = ""
 		p.Password = ""
+	case "jamf":
+		p.BaseURL = r.FormValue("jamf_base_url")
+		p.ClientID = r.FormValue("jamf_client_id")
+		if secret := r.FormValue("jamf_client_secret"); secret != "" {
+			p.ClientSecret = secret
+		}
+		// Clear Intune/UEM fields.
+		p.TenantID = ""
+		p.Cloud = ""
+		p.Username = ""
+		p.Password = ""
 	case "uem":
 		p.BaseURL = r.FormValue("base_url")
 		p.TenantID = r.FormValue("uem_tenant_id")
@@ -155,37 +222,59 @@ func (s *Server) handleProviderUpdate(w http.ResponseWriter, r *http.Request) {
 		// Clear Intune fields.
 		p.ClientID = ""
 		p.ClientSecret = ""
+		p.Cloud = ""
 	}
 
 	if p.Name == "" || p.Type == "" {
-		s.render.render(w, "provider_form.html", providerFormData{
-			Nav:      "providers",
-			Provider: p,
-			IsNew:    false,
-			Error:    "Name and type are required.",
-		})
+		s.renderProviderForm(w, r, p, false, "Name and type are required.")
+		return
+	}
+	if err := validHealthInterval(p.HealthInterval); err != nil {
+		s.renderProviderForm(w, r, p, false, "Invalid health check interval: "+err.Error())
+		return
+	}
+	if pageSizeErr != nil {
+		s.renderProviderForm(w, r, p, false, "Invalid sync page size: "+pageSizeErr.Error())
+		return
+	}
+	if err := intune.ValidateDeviceFilter(p.SyncFilter); err != nil {
+		s.renderProviderForm(w, r, p, false, "Invalid device sync filter: "+err.Error())
 		return
 	}
 
+	testFirst := r.FormValue("test_before_save") == "on"
+	if testFirst {
+		if err := s.testProviderConfig(r.Context(), p); err != nil {
+			s.renderProviderForm(w, r, p, false, "Connection test failed: "+err.Error())
+			return
+		}
+	}
+
 	if err := s.providerConfigs.Update(p); err != nil {
-		s.render.render(w, "provider_form.html", providerFormData{
-			Nav:      "providers",
-			Provider: p,
-			IsNew:    false,
-			Error:    err.Error(),
-		})
+		s.renderProviderForm(w, r, p, false, err.Error())
 		return
 	}
 
-	http.Redirect(w, r, "/providers?flash=Provider+"+p.Name+"+updated&flash_type=success", http.StatusSeeOther)
+	s.auditf(r, "update", auditProvider, p.ID, "%s", p.Name)
+	flash := "Provider+" + p.Name + "+updated"
+	if testFirst {
+		flash += "+—+connection+verified"
+	}
+	http.Redirect(w, r, "/providers?flash="+flash+"&flash_type=success", http.StatusSeeOther)
 }
 
 func (s *Server) handleProviderDelete(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
+	name := id
+	if cfg, _ := s.providerConfigs.GetByID(id); cfg != nil {
+		name = cfg.Name
+	}
 	if err := s.providerConfigs.Delete(id); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.status.Remove(name)
+	s.auditf(r, "delete", auditProvider, id, "%s", name)
 	http.Redirect(w, r, "/providers?flash=Provider+deleted&flash_type=success", http.StatusSeeOther)
 }
 
@@ -204,10 +293,10 @@ func (s *Server) handleProviderToggle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	action := "disabled"
+	action, verb := "disabled", "disable"
 	flashType := "success"
 	if newState {
-		action = "enabled"
+		action, verb = "enabled", "enable"
 		// Trigger an immediate health check on re-enable.
 		go s.CheckProviderNow(cfg.Name, cfg.Type)
 	} else {
@@ -216,5 +305,102 @@ func (s *Server) handleProviderToggle(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.activity.Logf(cfg.Name, "info", "Provider %s by operator", action)
+	s.auditf(r, verb, auditProvider, id, "%s", cfg.Name)
 	http.Redirect(w, r, fmt.Sprintf("/providers?flash=%s+%s&flash_type=%s", cfg.Name, action, flashType), http.StatusSeeOther)
 }
+
+// handleProviderSilence sets or clears a provider's alert silence window.
+// POST /providers/{id}/silence  duration=4h (0 clears)
+func (s *Server) handleProviderSilence(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	cfg, err := s.providerConfigs.GetByID(id)
+	if err != nil || cfg == nil {
+		http.Error(w, "Provider not found", http.StatusNotFound)
+		return
+	}
+
+	until, err := silenceUntil(r.FormValue("duration"))
+	if err != nil {
+		http.Redirect(w, r, "/providers?flash=Invalid+silence+duration&flash_type=error", http.StatusSeeOther)
+		return
+	}
+	if err := s.providerConfigs.SetSilencedUntil(id, until); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if until.IsZero() {
+		s.activity.Logf(cfg.Name, "info", "Alerts unsilenced by operator")
+		s.auditf(r, "unsilence", auditProvider, id, "%s", cfg.Name)
+		http.Redirect(w, r, fmt.Sprintf("/providers?flash=%s+unsilenced&flash_type=success", cfg.Name), http.StatusSeeOther)
+		return
+	}
+	s.activity.Logf(cfg.Name, "info", "Alerts silenced by operator until %s", until.Format(time.RFC3339))
+	s.auditf(r, "silence", auditProvider, id, "%s until %s", cfg.Name, until.Format(time.RFC3339))
+	http.Redirect(w, r, fmt.Sprintf("/providers?flash=%s+silenced&flash_type=success", cfg.Name), http.StatusSeeOther)
+}
+
+// silenceUntil converts a duration string ("4h", "90m") into an absolute
+// silence deadline. An empty or zero duration returns the zero time (clear).
+func silenceUntil(duration string) (time.Time, error) {
+	if duration == "" || duration == "0" {
+		return time.Time{}, nil
+	}
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if d <= 0 {
+		return time.Time{}, nil
+	}
+	return time.Now().UTC().Add(d), nil
+}
+
+// validHealthInterval checks a provider's health_interval override. Blank
+// means use the server default.
+func validHealthInterval(v string) error {
+	if v == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("%q is not a duration like 5m or 1h", v)
+	}
+	if d < MinHealthInterval {
+		return fmt.Errorf("must be at least %s", MinHealthInterval)
+	}
+	return nil
+}
+
+// formSyncPageSize parses the Intune sync_page_size form field. Blank means
+// the default and is stored as zero.
+func formSyncPageSize(r *http.Request) (int, error) {
+	v := strings.TrimSpace(r.FormValue("sync_page_size"))
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", v)
+	}
+	return n, validSyncPageSize(n)
+}
+
+// validSyncPageSize checks a provider's sync page size: zero for the
+// default, otherwise at most what Graph returns in one page.
+func validSyncPageSize(n int) error {
+	if n < 0 || n > intune.MaxPageSize {
+		return fmt.Errorf("must be between 1 and %d", intune.MaxPageSize)
+	}
+	return nil
+}
+
+// formRetention parses the snapshot_retention form field. Blank or invalid
+// values mean "use the server default" and are stored as zero.
+func formRetention(r *http.Request) int {
+	n, err := strconv.Atoi(r.FormValue("snapshot_retention"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"io"
 	"io/fs"
 	"net/http"
 	"strings"
@@ -19,9 +20,43 @@ type renderer struct {
 	pages map[string]*template.Template
 }
 
+// pageBlock names a template block a handler executes from a page template.
+type pageBlock struct {
+	page, block string
+}
+
+// pageBlocks lists every (page, block) pair the handlers render. "content"
+// stands for a full page rendered through the layout; the rest are the
+// fragments served to htmx and the console stream. newRenderer refuses to
+// start if any is missing, so a renamed block fails at boot, not per request.
+var pageBlocks = []pageBlock{
+	{"audit.html", "content"},
+	{"campaigns.html", "content"},
+	{"console.html", "content"},
+	{"console.html", "event-rows"},
+	{"console.html", "event-row"},
+	{"console.html", "status-cards-inner"},
+	{"dashboard.html", "content"},
+	{"device_detail.html", "content"},
+	{"device_form.html", "content"},
+	{"devices.html", "content"},
+	{"devices.html", "device-rows"},
+	{"devices.html", "device-row"},
+	{"login.html", "content"},
+	{"not_found.html", "content"},
+	{"policies.html", "content"},
+	{"policy_benchmark.html", "content"},
+	{"policy_checklist.html", "content"},
+	{"policy_compare.html", "content"},
+	{"policy_snapshot.html", "content"},
+	{"provider_form.html", "content"},
+	{"providers.html", "content"},
+}
+
 // newRenderer parses the layout template once, then clones it for each page
-// template, producing a separate compiled template per page.
-func newRenderer() (*renderer, error) {
+// template, producing a separate compiled template per page. Any extra
+// functions are merged into the shared funcMap.
+func newRenderer(extra template.FuncMap) (*renderer, error) {
 	// Template functions available in all templates.
 	funcMap := template.FuncMap{
 		"pages": func(n int) []int {
@@ -31,6 +66,7 @@ func newRenderer() (*renderer, error) {
 			}
 			return s
 		},
+		"static": staticURL,
 		"osOptions": func() []string {
 			return []string{"iOS", "Android", "Windows", "macOS"}
 		},
@@ -79,6 +115,11 @@ func newRenderer() (*renderer, error) {
 			switch tv := v.(type) {
 			case time.Time:
 				t = tv
+			case *time.Time:
+				if tv == nil {
+					return "never"
+				}
+				t = *tv
 			default:
 				return "never"
 			}
@@ -86,6 +127,10 @@ func newRenderer() (*renderer, error) {
 		},
 	}
 
+	for name, fn := range extra {
+		funcMap[name] = fn
+	}
+
 	// Parse the layout first.
 	layout, err := template.New("layout.html").Funcs(funcMap).ParseFS(web.TemplateFS, "templates/layout.html")
 	if err != nil {
@@ -116,9 +161,31 @@ func newRenderer() (*renderer, error) {
 		pages[name] = clone
 	}
 
+	if err := checkBlocks(pages, pageBlocks); err != nil {
+		return nil, err
+	}
 	return &renderer{pages: pages}, nil
 }
 
+// checkBlocks reports every required block that its page doesn't define.
+func checkBlocks(pages map[string]*template.Template, required []pageBlock) error {
+	var missing []string
+	for _, pb := range required {
+		tmpl, ok := pages[pb.page]
+		if !ok {
+			missing = append(missing, pb.page+" (no such page)")
+			continue
+		}
+		if tmpl.Lookup(pb.block) == nil {
+			missing = append(missing, fmt.Sprintf("%s: block %q", pb.page, pb.block))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("templates missing: %s", strings.Join(missing, "; "))
+	}
+	return nil
+}
+
 // render executes the named page template with the given data. The page
 // parameter is the template filename (e.g. "dashboard.html").
 func (rn *renderer) render(w http.ResponseWriter, page string, data any) {
@@ -149,6 +216,17 @@ func (rn *renderer) renderBlock(w http.ResponseWriter, page, block string, data
 	}
 }
 
+// executeBlock renders a named block from a page template into w, for
+// callers that frame the output themselves, such as the console's event
+// stream.
+func (rn *renderer) executeBlock(w io.Writer, page, block string, data any) error {
+	tmpl, ok := rn.pages[page]
+	if !ok {
+		return fmt.Errorf("template not found: %s", page)
+	}
+	return tmpl.ExecuteTemplate(w, block, data)
+}
+
 // timeAgoString formats a time.Time as a human-readable "X ago" string.
 func timeAgoString(t time.Time) string {
 	if t.IsZero() {
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRendererBlocks(t *testing.T) {
+	rn, err := newRenderer((&Server{}).templateFuncs())
+	if err != nil {
+		t.Fatalf("newRenderer: %v", err)
+	}
+
+	err = checkBlocks(rn.pages, []pageBlock{
+		{"devices.html", "device-rows"},
+		{"devices.html", "no-such-block"},
+		{"missing.html", "content"},
+	})
+	if err == nil {
+		t.Fatal("checkBlocks accepted a missing block and page")
+	}
+	for _, want := range []string{`devices.html: block "no-such-block"`, "missing.html (no such page)"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "device-rows") {
+		t.Errorf("error %q lists a block that exists", err)
+	}
+}
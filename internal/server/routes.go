@@ -1,44 +1,60 @@
 package server
 
+import "github.com/dan/moe/internal/metrics"
+
 // routes registers all HTTP handlers on the server's mux.
 // New routes are added here as the application grows.
 func (s *Server) routes() {
 	// Dashboard
 	s.router.HandleFunc("GET /{$}", s.handleDashboard)
 	s.router.HandleFunc("GET /health", s.handleHealth)
+	s.router.HandleFunc("GET /login", s.handleLoginPage)
+	s.router.HandleFunc("POST /login", s.handleLogin)
+	s.router.HandleFunc("POST /logout", s.handleLogout)
+	s.router.Handle("GET /metrics", metrics.Handler())
 
 	// Devices
 	s.router.HandleFunc("GET /devices", s.handleDeviceList)
 	s.router.HandleFunc("GET /devices/rows", s.handleDeviceRows)
 	s.router.HandleFunc("GET /devices/new", s.handleDeviceNew)
 	s.router.HandleFunc("POST /devices", s.handleDeviceCreate)
+	s.router.HandleFunc("GET /devices/{id}", s.handleDeviceDetail)
 	s.router.HandleFunc("GET /devices/{id}/edit", s.handleDeviceEdit)
 	s.router.HandleFunc("POST /devices/{id}", s.handleDeviceUpdate)
 	s.router.HandleFunc("POST /devices/{id}/delete", s.handleDeviceDelete)
+	s.router.HandleFunc("POST /devices/{id}/flag", s.handleDeviceFlag)
+	s.router.HandleFunc("POST /devices/{id}/command", s.handleDeviceCommand)
 
 	// Providers
 	s.router.HandleFunc("GET /providers", s.handleProviderList)
 	s.router.HandleFunc("GET /providers/new", s.handleProviderNew)
 	s.router.HandleFunc("POST /providers", s.handleProviderCreate)
+	s.router.HandleFunc("POST /providers/check", s.handleProviderCheckAll)
 	s.router.HandleFunc("GET /providers/{id}/edit", s.handleProviderEdit)
 	s.router.HandleFunc("POST /providers/{id}", s.handleProviderUpdate)
 	s.router.HandleFunc("POST /providers/{id}/delete", s.handleProviderDelete)
 	s.router.HandleFunc("POST /providers/{id}/sync", s.handleProviderSync)
 	s.router.HandleFunc("POST /providers/{id}/test", s.handleProviderTest)
 	s.router.HandleFunc("POST /providers/{id}/toggle", s.handleProviderToggle)
+	s.router.HandleFunc("POST /providers/{id}/silence", s.handleProviderSilence)
 
 	// Console (live activity feed)
 	s.router.HandleFunc("GET /console", s.handleConsole)
 	s.router.HandleFunc("GET /console/events", s.handleConsoleEvents)
+	s.router.HandleFunc("GET /console/stream", s.handleConsoleStream)
 	s.router.HandleFunc("GET /console/statuses", s.handleConsoleStatuses)
+	s.router.HandleFunc("POST /maintenance", s.handleMaintenanceToggle)
 
 	// Policies
 	s.router.HandleFunc("GET /policies", s.handlePolicies)
 	s.router.HandleFunc("POST /policies/snapshot", s.handlePolicySnapshotCreate)
 	s.router.HandleFunc("GET /policies/compare", s.handlePolicyCompare)
+	s.router.HandleFunc("GET /policies/benchmark", s.handlePolicyBenchmark)
+	s.router.HandleFunc("GET /policies/benchmark/checklist", s.handleBenchmarkChecklist)
 	s.router.HandleFunc("GET /policies/snapshots/{id}", s.handlePolicySnapshot)
 	s.router.HandleFunc("GET /policies/snapshots/{id}/row", s.handleSnapshotRow)
 	s.router.HandleFunc("POST /policies/snapshots/{id}/retry", s.handlePolicySnapshotRetry)
+	s.router.HandleFunc("POST /policies/snapshots/{id}/cancel", s.handlePolicySnapshotCancel)
 	s.router.HandleFunc("POST /policies/snapshots/{id}/delete", s.handlePolicySnapshotDelete)
 
 	// Placeholder pages (coming soon)
@@ -47,15 +63,53 @@ func (s *Server) routes() {
 
 	// ── JSON API (read-only) ────────────────────────────────────────────
 	s.router.HandleFunc("GET /api/v1/devices", s.apiListDevices)
+	s.router.HandleFunc("DELETE /api/v1/devices", s.apiDeleteDevices)
+	s.router.HandleFunc("GET /api/v1/devices/export/csv", s.apiExportDevicesCSV)
+	s.router.HandleFunc("POST /api/v1/devices/import/csv", s.apiImportDevicesCSV)
+	s.router.HandleFunc("GET /api/v1/devices/stats", s.apiDeviceStats)
+	s.router.HandleFunc("GET /api/v1/devices/stale", s.apiListStaleDevices)
+	s.router.HandleFunc("GET /api/v1/devices/changes", s.apiListChangedDevices)
+	s.router.HandleFunc("POST /api/v1/devices/bulk", s.apiBulkDevices)
 	s.router.HandleFunc("GET /api/v1/devices/{id}", s.apiGetDevice)
+	s.router.HandleFunc("POST /api/v1/devices/{id}/commands", s.apiSendDeviceCommand)
+	s.router.HandleFunc("POST /api/v1/devices/{id}/flag", s.apiFlagDevice)
+	s.router.HandleFunc("POST /api/v1/devices/{id}/tags", s.apiAddDeviceTag)
+	s.router.HandleFunc("DELETE /api/v1/devices/{id}/tags/{tag}", s.apiRemoveDeviceTag)
 	s.router.HandleFunc("GET /api/v1/providers", s.apiListProviders)
+	s.router.HandleFunc("POST /api/v1/providers/check", s.apiCheckProviders)
+	s.router.HandleFunc("GET /api/v1/providers/export", s.apiExportProviders)
+	s.router.HandleFunc("POST /api/v1/providers/import", s.apiImportProviders)
+	s.router.HandleFunc("GET /api/v1/providers/{name}/sync-runs", s.apiListSyncRuns)
+	s.router.HandleFunc("GET /api/v1/providers/{name}/latency", s.apiProviderLatency)
+	s.router.HandleFunc("POST /api/v1/providers/{name}/resync", s.apiResyncProvider)
+	s.router.HandleFunc("PUT /api/v1/providers/{id}/silence", s.apiSilenceProvider)
+	s.router.HandleFunc("DELETE /api/v1/providers/{id}/silence", s.apiUnsilenceProvider)
+	s.router.HandleFunc("GET /api/v1/maintenance", s.apiGetMaintenance)
+	s.router.HandleFunc("PUT /api/v1/maintenance", s.apiSetMaintenance)
 	s.router.HandleFunc("GET /api/v1/policies/snapshots", s.apiListSnapshots)
 	s.router.HandleFunc("POST /api/v1/policies/snapshots", s.apiCreateSnapshot)
 	s.router.HandleFunc("GET /api/v1/policies/snapshots/{id}", s.apiGetSnapshot)
+	s.router.HandleFunc("PATCH /api/v1/policies/snapshots/{id}", s.apiUpdateSnapshot)
 	s.router.HandleFunc("GET /api/v1/policies/snapshots/{id}/items", s.apiListSnapshotItems)
 	s.router.HandleFunc("GET /api/v1/policies/snapshots/{id}/status", s.apiSnapshotStatus)
 	s.router.HandleFunc("GET /api/v1/policies/snapshots/{id}/export", s.apiExportSnapshot)
 	s.router.HandleFunc("GET /api/v1/policies/snapshots/{id}/export/csv", s.apiExportSnapshotCSV)
+	s.router.HandleFunc("GET /api/v1/policies/export/all", s.apiExportAllSnapshots)
 	s.router.HandleFunc("POST /api/v1/policies/snapshots/import", s.apiImportSnapshot)
+	s.router.HandleFunc("POST /api/v1/policies/snapshots/import/preview", s.apiPreviewSnapshotImport)
+	s.router.HandleFunc("POST /api/v1/policies/snapshots/{id}/clone", s.apiCloneSnapshot)
+	s.router.HandleFunc("GET /api/v1/audit", s.apiListAudit)
+	s.router.HandleFunc("GET /api/v1/admin/backup", s.apiBackup)
+	s.router.HandleFunc("POST /api/v1/admin/vacuum", s.apiVacuum)
 	s.router.HandleFunc("GET /api/v1/policies/compare", s.apiCompareSnapshots)
+	s.router.HandleFunc("POST /api/v1/policies/compare/upload", s.apiCompareUpload)
+	s.router.HandleFunc("GET /api/v1/policies/compare3", s.apiCompareSnapshots3)
+	s.router.HandleFunc("GET /api/v1/policies/benchmark", s.apiBenchmarkSnapshot)
+	s.router.HandleFunc("GET /api/v1/policies/benchmark/checklist/csv", s.apiBenchmarkChecklistCSV)
+	s.router.HandleFunc("GET /api/v1/policies/search", s.apiSearchSettings)
+	s.router.HandleFunc("GET /api/v1/policies/items/{id}/settings", s.apiPolicyItemSettings)
+	s.router.HandleFunc("GET /api/v1/policies/items/{id}/diff", s.apiDiffPolicyItems)
+	s.router.HandleFunc("GET /api/v1/reports/platform-coverage", s.apiPlatformCoverage)
+	s.router.HandleFunc("GET /api/v1/reports/compliance-trend", s.apiComplianceTrend)
+	s.router.HandleFunc("GET /api/v1/openapi.json", s.apiOpenAPI)
 }
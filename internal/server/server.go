@@ -3,60 +3,188 @@ package server
 import (
 	"context"
 	"fmt"
-	"io/fs"
+	"html/template"
 	"log"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dan/moe/internal/db"
+	"github.com/dan/moe/internal/provider/intune"
 	"github.com/dan/moe/internal/store"
-	"github.com/dan/moe/web"
 )
 
+// Config holds the runtime options for a Server, usually populated from
+// command-line flags.
+type Config struct {
+	Addr string // HTTP listen address
+
+	// TLSCertFile and TLSKeyFile are PEM files for serving HTTPS. Unless
+	// both are set the server speaks plain HTTP.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// SnapshotRetention is the default number of policy snapshots kept per
+	// provider. Individual providers may override it.
+	SnapshotRetention int
+
+	// CategoryOrder lists policy category prefixes in display order. Empty
+	// means defaultCategoryOrder.
+	CategoryOrder []string
+
+	// HealthInterval is how often each provider's connection is checked.
+	// Individual providers may override it. Values below MinHealthInterval
+	// are raised to it.
+	HealthInterval time.Duration
+
+	// HealthTimeout bounds a single provider connection test.
+	HealthTimeout time.Duration
+
+	// ReadOnly rejects every request that could change state, for demos and
+	// shared dashboards. Background jobs still run.
+	ReadOnly bool
+
+	// MissingDevices is what a full sync does with devices the provider no
+	// longer reports: MissingDevicesRetire (the default) or
+	// MissingDevicesDelete.
+	MissingDevices string
+
+	// PolicyConcurrency caps the Graph requests a legacy Intune policy
+	// capture has in flight. Zero uses the provider's default.
+	PolicyConcurrency int
+
+	// GraphTimeout bounds a single Microsoft Graph request made by an
+	// Intune provider. Zero uses intune.DefaultTimeout.
+	GraphTimeout time.Duration
+
+	// SettingsDepth is how many levels of nested policy settings the
+	// snapshot view expands into dotted keys such as "omaSettings.0.value"
+	// before showing the rest as JSON. Zero uses intune.DefaultFlattenDepth.
+	SettingsDepth int
+
+	// ContentSecurityPolicy is the Content-Security-Policy header sent with
+	// every response. Empty uses DefaultContentSecurityPolicy.
+	ContentSecurityPolicy string
+
+	// StaleDeviceDays is how many days a device can go without checking in
+	// before it counts as stale on the dashboard, in the API and in exports.
+	// Zero uses defaultStaleDeviceDays.
+	StaleDeviceDays int
+
+	// MaxCaptures caps how many policy captures run at once across all
+	// providers; the rest wait as "queued". Zero uses defaultMaxCaptures.
+	MaxCaptures int
+}
+
+// Values for Config.MissingDevices.
+const (
+	MissingDevicesRetire = "retire"
+	MissingDevicesDelete = "delete"
+)
+
+// defaultSnapshotRetention is used when Config.SnapshotRetention is unset.
+const defaultSnapshotRetention = 10
+
+// defaultMaxCaptures is used when Config.MaxCaptures is unset.
+const defaultMaxCaptures = 2
+
+// Health check defaults, used when Config leaves them unset.
+const (
+	defaultHealthInterval = 2 * time.Minute
+	defaultHealthTimeout  = 15 * time.Second
+)
+
+// MinHealthInterval is the shortest health check interval allowed, server
+// wide or per provider, so a typo can't hammer a tenant's token endpoint.
+const MinHealthInterval = 30 * time.Second
+
 // Server holds the HTTP server and its dependencies.
 type Server struct {
+	cfg             Config
 	db              *db.DB
 	devices         *store.DeviceStore
 	providerConfigs *store.ProviderConfigStore
 	policies        *store.PolicyStore
+	settings        *store.SettingsStore
+	syncRuns        *store.SyncRunStore
+	complianceTrend *store.ComplianceTrendStore
+	auditLog        *store.AuditStore
+	admins          *store.AdminUserStore
+	sessionKey      []byte      // signs session cookies; see auth.go
+	authRequired    atomic.Bool // set once an admin user exists; see loginRequired
+	authMu          sync.Mutex  // guards authChecked
+	authChecked     time.Time   // when loginRequired last counted admins
+	categoryOrder   categoryOrder
 	render          *renderer
 	router          *http.ServeMux
 	http            *http.Server
 	status          *statusTracker
 	activity        *activityLog
+	compareCache    *compareCache
 	stopHealth      chan struct{} // signals the health poller to stop
 	shutdownCtx     context.Context
 	shutdownCancel  context.CancelFunc
 	bgWg            sync.WaitGroup // tracks in-flight background goroutines
+	maintenance     atomic.Bool    // pauses background jobs while set
+	healthSweeping  atomic.Bool    // a checkAllProviders sweep is running
+	capturesMu      sync.Mutex
+	progress        map[string]CaptureProgress    // in-flight captures by snapshot ID
+	cancels         map[string]context.CancelFunc // in-flight captures by snapshot ID
+	captureSlots    chan struct{}                 // one token per running capture; see waitForCaptureSlot
 }
 
 // New creates a new Server wired to the given database. It sets up routes and
 // middleware but does not start listening.
-func New(database *db.DB, addr string) (*Server, error) {
-	mux := http.NewServeMux()
-
-	rn, err := newRenderer()
-	if err != nil {
-		return nil, fmt.Errorf("init renderer: %w", err)
+func New(database *db.DB, cfg Config) (*Server, error) {
+	if cfg.SnapshotRetention <= 0 {
+		cfg.SnapshotRetention = defaultSnapshotRetention
+	}
+	if cfg.HealthInterval <= 0 {
+		cfg.HealthInterval = defaultHealthInterval
+	}
+	cfg.HealthInterval = max(cfg.HealthInterval, MinHealthInterval)
+	if cfg.HealthTimeout <= 0 {
+		cfg.HealthTimeout = defaultHealthTimeout
+	}
+	if cfg.MissingDevices == "" {
+		cfg.MissingDevices = MissingDevicesRetire
+	}
+	if cfg.StaleDeviceDays <= 0 {
+		cfg.StaleDeviceDays = defaultStaleDeviceDays
+	}
+	if cfg.MaxCaptures <= 0 {
+		cfg.MaxCaptures = defaultMaxCaptures
 	}
 
+	mux := http.NewServeMux()
+
 	shutdownCtx, shutdownCancel := context.WithCancel(context.Background())
 
 	s := &Server{
+		cfg:             cfg,
 		db:              database,
 		devices:         store.NewDeviceStore(database.Conn),
 		providerConfigs: store.NewProviderConfigStore(database.Conn),
 		policies:        store.NewPolicyStore(database.Conn),
-		render:          rn,
+		settings:        store.NewSettingsStore(database.Conn),
+		syncRuns:        store.NewSyncRunStore(database.Conn),
+		complianceTrend: store.NewComplianceTrendStore(database.Conn),
+		auditLog:        store.NewAuditStore(database.Conn),
+		admins:          store.NewAdminUserStore(database.Conn),
+		categoryOrder:   defaultCategoryOrder,
 		router:          mux,
 		status:          newStatusTracker(),
 		activity:        newActivityLog(200),
+		compareCache:    newCompareCache(compareCacheSize),
+		progress:        make(map[string]CaptureProgress),
+		cancels:         make(map[string]context.CancelFunc),
+		captureSlots:    make(chan struct{}, cfg.MaxCaptures),
 		stopHealth:      make(chan struct{}),
 		shutdownCtx:     shutdownCtx,
 		shutdownCancel:  shutdownCancel,
 		http: &http.Server{
-			Addr:         addr,
+			Addr:         cfg.Addr,
 			Handler:      mux,
 			ReadTimeout:  15 * time.Second,
 			WriteTimeout: 120 * time.Second, // generous for policy sync (9 endpoints)
@@ -64,29 +192,85 @@ func New(database *db.DB, addr string) (*Server, error) {
 		},
 	}
 
+	if len(cfg.CategoryOrder) > 0 {
+		s.categoryOrder = categoryOrder(cfg.CategoryOrder)
+	}
+
+	rn, err := newRenderer(s.templateFuncs())
+	if err != nil {
+		return nil, fmt.Errorf("init renderer: %w", err)
+	}
+	s.render = rn
+
+	s.loadMaintenance()
+	if n, err := s.devices.BackfillOSVersionKeys(); err != nil {
+		log.Printf("[db] %v", err)
+	} else if n > 0 {
+		log.Printf("[db] computed OS version keys for %d devices", n)
+	}
+	if n, err := s.policies.BackfillSettingCounts(settingCount); err != nil {
+		log.Printf("[db] %v", err)
+	} else if n > 0 {
+		log.Printf("[db] computed setting counts for %d policy items", n)
+	}
+	if err := s.loadAuth(); err != nil {
+		return nil, fmt.Errorf("init auth: %w", err)
+	}
+
 	s.routes()
 	s.staticFiles()
 
 	// Custom 404 handler for unmatched routes.
 	notFoundHandler := http.HandlerFunc(s.handleNotFound)
-	handler := notFound(mux, notFoundHandler)
+	handler := s.requireAuth(notFound(mux, notFoundHandler))
+
+	if cfg.ReadOnly {
+		handler = readOnly(handler)
+	}
+
+	csp := cfg.ContentSecurityPolicy
+	if csp == "" {
+		csp = DefaultContentSecurityPolicy
+	}
 
 	// Wrap with middleware (outermost runs first).
-	s.http.Handler = logging(recovery(handler))
+	s.http.Handler = requestIDs(logging(securityHeaders(csp, recovery(handler))))
 
 	return s, nil
 }
 
-// Start begins listening. It blocks until the server is shut down.
+// templateFuncs returns template functions that depend on live server state
+// (e.g. the maintenance banner in the layout).
+func (s *Server) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"maintenance": s.inMaintenance,
+		"readOnly":    func() bool { return s.cfg.ReadOnly },
+		"authEnabled": s.loginRequired,
+		"isStale": func(lastSeen *time.Time) bool {
+			_, stale := s.deviceStaleness(lastSeen, time.Now())
+			return stale
+		},
+		"staleDeviceDays":       func() int { return s.cfg.StaleDeviceDays },
+		"intuneDefaultPageSize": func() int { return intune.DefaultPageSize },
+		"intuneMaxPageSize":     func() int { return intune.MaxPageSize },
+	}
+}
+
+// Start begins listening, over HTTPS when Config names a certificate and
+// key and plain HTTP otherwise. It blocks until the server is shut down.
 func (s *Server) Start() error {
-	log.Printf("server listening on %s", s.http.Addr)
+	if s.cfg.TLSCertFile != "" && s.cfg.TLSKeyFile != "" {
+		log.Printf("server listening on %s (HTTPS)", s.http.Addr)
+		return s.http.ListenAndServeTLS(s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+	}
+	log.Printf("server listening on %s (plain HTTP)", s.http.Addr)
 	return s.http.ListenAndServe()
 }
 
 // StartBackgroundJobs launches the health poller and any other recurring work.
 // Call this before Start().
 func (s *Server) StartBackgroundJobs() {
-	// Mark any snapshots left in "capturing" state from a previous crash.
+	// Mark any snapshots left queued or capturing by a previous crash.
 	recovered, err := s.policies.RecoverStaleCapturing("interrupted — server was stopped")
 	if err != nil {
 		log.Printf("[startup] recover stale snapshots: %v", err)
@@ -96,7 +280,15 @@ func (s *Server) StartBackgroundJobs() {
 	}
 
 	go s.healthPoller()
-	s.activity.Logf("system", "info", "MOE started — background health checks active")
+	go s.complianceRollup()
+	if s.cfg.ReadOnly {
+		s.activity.Logf("system", "info", "MOE is in read-only mode — changes are disabled")
+	}
+	if s.inMaintenance() {
+		s.activity.Logf("system", "warning", "MOE started in maintenance mode — background jobs paused")
+	} else {
+		s.activity.Logf("system", "info", "MOE started — background health checks active")
+	}
 }
 
 // Shutdown gracefully shuts down the HTTP server and background jobs.
@@ -127,10 +319,5 @@ func (s *Server) Shutdown(ctx context.Context) error {
 
 // staticFiles registers the handler for serving embedded static assets.
 func (s *Server) staticFiles() {
-	// Sub into the "static" directory so URLs map as /static/css/style.css etc.
-	sub, err := fs.Sub(web.StaticFS, "static")
-	if err != nil {
-		log.Fatalf("static fs: %v", err)
-	}
-	s.router.Handle("GET /static/", http.StripPrefix("/static/", http.FileServer(http.FS(sub))))
+	s.router.Handle("GET /static/", http.StripPrefix("/static/", cacheStatic(http.FileServer(http.FS(staticFS())))))
 }
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/dan/moe/web"
+)
+
+// staticImmutable is the Cache-Control of an asset requested at its current
+// version (see staticURL): that URL never serves different content, so
+// browsers may keep it for a year without asking again.
+const staticImmutable = "public, max-age=31536000, immutable"
+
+// staticFS is the embedded static directory, so that "css/style.css" is
+// served at /static/css/style.css.
+func staticFS() fs.FS {
+	sub, err := fs.Sub(web.StaticFS, "static")
+	if err != nil {
+		panic("static fs: " + err.Error())
+	}
+	return sub
+}
+
+// staticHashes maps each static asset's path to a hash of its contents. The
+// assets are embedded, so it is computed once.
+var staticHashes = sync.OnceValue(func() map[string]string {
+	hashes := map[string]string{}
+	fsys := staticFS()
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(b)
+		hashes[path] = hex.EncodeToString(sum[:8])
+		return nil
+	})
+	if err != nil {
+		panic("static fs: " + err.Error())
+	}
+	return hashes
+})
+
+// staticURL returns the URL of a static asset with its content hash as a
+// ?v= version, so the URL changes whenever the file does.
+func staticURL(path string) string {
+	if h, ok := staticHashes()[path]; ok {
+		return fmt.Sprintf("/static/%s?v=%s", path, h)
+	}
+	return "/static/" + path
+}
+
+// cacheStatic sets caching headers on static assets, whose embedded files
+// have no modification time to validate against. Each gets its content hash
+// as ETag, which the file server checks against If-None-Match. A request for
+// the current version may be cached for good; any other must revalidate,
+// which costs a 304 rather than the file.
+func cacheStatic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := staticHashes()[strings.TrimPrefix(r.URL.Path, "/")]; ok {
+			w.Header().Set("ETag", `"`+h+`"`)
+			if r.URL.Query().Get("v") == h {
+				w.Header().Set("Cache-Control", staticImmutable)
+			} else {
+				w.Header().Set("Cache-Control", "no-cache")
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
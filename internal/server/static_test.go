@@ -0,0 +1,50 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStaticCaching(t *testing.T) {
+	s := &Server{router: http.NewServeMux()}
+	s.staticFiles()
+	get := func(url, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	versioned := staticURL("css/style.css")
+	if !strings.Contains(versioned, "?v=") {
+		t.Fatalf("staticURL = %q, want a ?v= version", versioned)
+	}
+	rec := get(versioned, "")
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" || rec.Header().Get("Cache-Control") != staticImmutable {
+		t.Fatalf("versioned GET = %d, ETag %q, Cache-Control %q", rec.Code, etag, rec.Header().Get("Cache-Control"))
+	}
+
+	rec = get("/static/css/style.css", "")
+	if rec.Header().Get("ETag") != etag || rec.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("unversioned GET: ETag %q, Cache-Control %q; want %q, no-cache", rec.Header().Get("ETag"), rec.Header().Get("Cache-Control"), etag)
+	}
+	if rec := get("/static/css/style.css?v=stale", ""); rec.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("old version: Cache-Control %q, want no-cache", rec.Header().Get("Cache-Control"))
+	}
+
+	if rec := get("/static/css/style.css", etag); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("If-None-Match current = %d with %d bytes, want 304 and no body", rec.Code, rec.Body.Len())
+	}
+	if rec := get("/static/css/style.css", `"other"`); rec.Code != http.StatusOK {
+		t.Errorf("If-None-Match other = %d, want 200", rec.Code)
+	}
+	if rec := get("/static/missing.css", ""); rec.Code != http.StatusNotFound || rec.Header().Get("ETag") != "" {
+		t.Errorf("missing asset = %d with ETag %q, want 404 without one", rec.Code, rec.Header().Get("ETag"))
+	}
+}
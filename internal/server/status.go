@@ -17,28 +17,103 @@ type ProviderStatus struct {
 	CheckedAt   time.Time     `json:"checked_at"`
 	Latency     time.Duration `json:"latency"`
 	ConsecFails int           `json:"consec_fails"`
+	Silenced    bool          `json:"silenced"` // failure alerts suppressed by operator
+
+	// RecentErrors holds the provider's most recent distinct errors, newest
+	// first. It is kept by the tracker across status changes.
+	RecentErrors []ErrorRecord `json:"recent_errors,omitempty"`
+}
+
+// ErrorRecord is one distinct error in a provider's recent history.
+type ErrorRecord struct {
+	Error     string    `json:"error"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Count     int       `json:"count"`
 }
 
+// maxErrorHistory bounds the distinct errors remembered per provider.
+const maxErrorHistory = 10
+
+// maxLatencyHistory bounds the latency samples remembered per provider; at
+// the default health interval it covers about two hours.
+const maxLatencyHistory = 60
+
 // statusTracker keeps an in-memory map of provider statuses, safe for
-// concurrent reads and writes.
+// concurrent reads and writes, plus a short history of distinct errors per
+// provider so flapping between different failures stays visible, and a
+// rolling window of connection latencies so gradual degradation does too.
 type statusTracker struct {
 	mu       sync.RWMutex
 	statuses map[string]*ProviderStatus
+	errors   map[string][]ErrorRecord
+	latency  map[string][]time.Duration
 }
 
 func newStatusTracker() *statusTracker {
 	return &statusTracker{
 		statuses: make(map[string]*ProviderStatus),
+		errors:   make(map[string][]ErrorRecord),
+		latency:  make(map[string][]time.Duration),
 	}
 }
 
-// Set stores a status for a provider, replacing any existing entry.
+// Set stores a status for a provider, replacing any existing entry. An
+// error status is added to the provider's error history, and the history
+// is attached to the stored status.
 func (st *statusTracker) Set(s *ProviderStatus) {
 	st.mu.Lock()
 	defer st.mu.Unlock()
+	if s.Status == "error" && s.Error != "" {
+		st.errors[s.Name] = recordError(st.errors[s.Name], s.Error, s.CheckedAt)
+	}
+	s.RecentErrors = st.errors[s.Name]
 	st.statuses[s.Name] = s
 }
 
+// recordError adds msg to a newest-first error history. A repeat of an
+// error already in the history moves it to the front and bumps its count
+// rather than adding a duplicate; the oldest entry is dropped beyond
+// maxErrorHistory. The input slice is not modified, so statuses already
+// handed out keep a consistent view.
+func recordError(history []ErrorRecord, msg string, at time.Time) []ErrorRecord {
+	rec := ErrorRecord{Error: msg, FirstSeen: at, LastSeen: at, Count: 1}
+	out := make([]ErrorRecord, 0, min(len(history)+1, maxErrorHistory))
+	for _, e := range history {
+		if e.Error == msg {
+			rec.FirstSeen = e.FirstSeen
+			rec.Count = e.Count + 1
+			break
+		}
+	}
+	out = append(out, rec)
+	for _, e := range history {
+		if e.Error != msg && len(out) < maxErrorHistory {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// RecordLatency appends a connection latency sample for a provider,
+// dropping the oldest beyond maxLatencyHistory.
+func (st *statusTracker) RecordLatency(name string, d time.Duration) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	h := append(st.latency[name], d)
+	if len(h) > maxLatencyHistory {
+		h = append([]time.Duration(nil), h[len(h)-maxLatencyHistory:]...)
+	}
+	st.latency[name] = h
+}
+
+// History returns a copy of a provider's latency samples, oldest first.
+func (st *statusTracker) History(name string) []time.Duration {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return append([]time.Duration{}, st.latency[name]...)
+}
+
 // Get returns the status for a single provider (nil if never checked).
 func (st *statusTracker) Get(name string) *ProviderStatus {
 	st.mu.RLock()
@@ -62,6 +137,8 @@ func (st *statusTracker) Remove(name string) {
 	st.mu.Lock()
 	defer st.mu.Unlock()
 	delete(st.statuses, name)
+	delete(st.errors, name)
+	delete(st.latency, name)
 }
 
 // ── Activity Log ────────────────────────────────────────────────────────
@@ -72,52 +149,109 @@ type ActivityEvent struct {
 	Provider string    `json:"provider"`
 	Type     string    `json:"type"` // "info", "success", "error", "warning"
 	Message  string    `json:"message"`
+	Seq      int64     `json:"seq"` // position in the log, set by Add
 }
 
+// activitySubscriberBuffer is how many events a subscriber may fall behind
+// before Add drops it; see Subscribe.
+const activitySubscriberBuffer = 64
+
 // activityLog is a thread-safe ring buffer of recent events.
 type activityLog struct {
 	mu     sync.RWMutex
 	events []ActivityEvent
 	cap    int
 	seq    int64 // monotonic sequence for change detection
+	subs   map[chan ActivityEvent]struct{}
 }
 
 func newActivityLog(capacity int) *activityLog {
 	return &activityLog{
 		events: make([]ActivityEvent, 0, capacity),
 		cap:    capacity,
+		subs:   make(map[chan ActivityEvent]struct{}),
 	}
 }
 
-// Add appends an event, evicting the oldest if at capacity.
+// Add appends an event, evicting the oldest if at capacity, and sends it to
+// every subscriber. It never blocks on a subscriber: one whose buffer is
+// full is unsubscribed and its channel closed.
 func (al *activityLog) Add(e ActivityEvent) {
 	al.mu.Lock()
 	defer al.mu.Unlock()
 	if len(al.events) >= al.cap {
 		al.events = al.events[1:]
 	}
-	al.events = append(al.events, e)
 	al.seq++
+	e.Seq = al.seq
+	al.events = append(al.events, e)
+
+	for ch := range al.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(al.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe registers a channel that receives every event added from now
+// on, and returns the buffered events after seq (oldest first) so the
+// caller can catch up without a gap. The channel is closed if the
+// subscriber falls too far behind; a caller that sees that should
+// resubscribe from the last seq it handled. Call Unsubscribe when done.
+func (al *activityLog) Subscribe(seq int64) (ch chan ActivityEvent, backlog []ActivityEvent) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	for _, e := range al.events {
+		if e.Seq > seq {
+			backlog = append(backlog, e)
+		}
+	}
+	ch = make(chan ActivityEvent, activitySubscriberBuffer)
+	al.subs[ch] = struct{}{}
+	return ch, backlog
+}
+
+// Unsubscribe removes a channel registered by Subscribe and closes it, if
+// Add hasn't already.
+func (al *activityLog) Unsubscribe(ch chan ActivityEvent) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	if _, ok := al.subs[ch]; ok {
+		delete(al.subs, ch)
+		close(ch)
+	}
 }
 
 // Recent returns up to n most recent events (newest first).
 func (al *activityLog) Recent(n int) []ActivityEvent {
+	return al.RecentFiltered(n, "", "")
+}
+
+// RecentFiltered returns up to n most recent events (newest first) from
+// the given provider and of the given type. Empty criteria match anything.
+func (al *activityLog) RecentFiltered(n int, provider, eventType string) []ActivityEvent {
 	al.mu.RLock()
 	defer al.mu.RUnlock()
 
-	total := len(al.events)
-	if n > total {
-		n = total
-	}
-
 	// Return in reverse chronological order.
-	out := make([]ActivityEvent, n)
-	for i := 0; i < n; i++ {
-		out[i] = al.events[total-1-i]
+	out := make([]ActivityEvent, 0, min(n, len(al.events)))
+	for i := len(al.events) - 1; i >= 0 && len(out) < n; i-- {
+		if e := al.events[i]; e.Matches(provider, eventType) {
+			out = append(out, e)
+		}
 	}
 	return out
 }
 
+// Matches reports whether the event is from the given provider and of the
+// given type. Empty criteria match anything.
+func (e ActivityEvent) Matches(provider, eventType string) bool {
+	return (provider == "" || e.Provider == provider) && (eventType == "" || e.Type == eventType)
+}
+
 // Seq returns the current sequence number, useful for htmx polling to
 // detect whether new events have arrived.
 func (al *activityLog) Seq() int64 {
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dan/moe/internal/models"
+)
+
+func TestStatusTrackerErrorHistory(t *testing.T) {
+	st := newStatusTracker()
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	set := func(i int, status, msg string) {
+		st.Set(&ProviderStatus{Name: "p1", Status: status, Error: msg, CheckedAt: t0.Add(time.Duration(i) * time.Minute)})
+	}
+
+	// Flapping between two errors with a success in between.
+	set(0, "error", "timeout")
+	set(1, "error", "HTTP 403")
+	set(2, "connected", "")
+	set(3, "error", "timeout")
+
+	got := st.Get("p1").RecentErrors
+	if len(got) != 2 {
+		t.Fatalf("RecentErrors = %+v, want 2 distinct errors", got)
+	}
+	if got[0].Error != "timeout" || got[0].Count != 2 || !got[0].FirstSeen.Equal(t0) || !got[0].LastSeen.Equal(t0.Add(3*time.Minute)) {
+		t.Errorf("newest = %+v, want timeout seen twice from t0 to t0+3m", got[0])
+	}
+	if got[1].Error != "HTTP 403" || got[1].Count != 1 {
+		t.Errorf("second = %+v, want HTTP 403 seen once", got[1])
+	}
+
+	for i := range maxErrorHistory + 5 {
+		set(10+i, "error", fmt.Sprintf("error %d", i))
+	}
+	if n := len(st.Get("p1").RecentErrors); n != maxErrorHistory {
+		t.Errorf("len(RecentErrors) = %d, want bounded at %d", n, maxErrorHistory)
+	}
+
+	st.Remove("p1")
+	set(0, "connected", "")
+	if n := len(st.Get("p1").RecentErrors); n != 0 {
+		t.Errorf("len(RecentErrors) after Remove = %d, want 0", n)
+	}
+}
+
+func TestHealthDue(t *testing.T) {
+	s := &Server{cfg: Config{HealthInterval: 10 * time.Minute}}
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		interval string
+		ago      time.Duration
+		want     bool
+	}{
+		{"never checked", "", -1, true},
+		{"default not due", "", 5 * time.Minute, false},
+		{"default due", "", 10 * time.Minute, true},
+		{"override due", "2m", 2 * time.Minute, true},
+		{"override not due", "1h", 30 * time.Minute, false},
+		{"invalid override uses default", "soon", 10 * time.Minute, true},
+		{"override below minimum is raised", "1s", 10 * time.Second, false},
+	}
+	for _, tt := range tests {
+		cfg := models.ProviderConfig{HealthInterval: tt.interval}
+		if tt.ago >= 0 {
+			cfg.LastCheckAt = now.Add(-tt.ago)
+		}
+		if got := s.healthDue(cfg, now); got != tt.want {
+			t.Errorf("%s: healthDue = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStatusTrackerLatencyHistory(t *testing.T) {
+	st := newStatusTracker()
+	if h := st.History("p1"); len(h) != 0 {
+		t.Fatalf("History before any samples = %v, want empty", h)
+	}
+
+	for i := range maxLatencyHistory + 5 {
+		st.RecordLatency("p1", time.Duration(i)*time.Millisecond)
+	}
+	h := st.History("p1")
+	if len(h) != maxLatencyHistory {
+		t.Fatalf("len(History) = %d, want bounded at %d", len(h), maxLatencyHistory)
+	}
+	if h[0] != 5*time.Millisecond || h[len(h)-1] != time.Duration(maxLatencyHistory+4)*time.Millisecond {
+		t.Errorf("History spans %v..%v, want the newest %d samples oldest first", h[0], h[len(h)-1], maxLatencyHistory)
+	}
+
+	h[0] = 0
+	if st.History("p1")[0] == 0 {
+		t.Error("History returned the tracker's own slice")
+	}
+
+	st.Remove("p1")
+	if h := st.History("p1"); len(h) != 0 {
+		t.Errorf("History after Remove = %v, want empty", h)
+	}
+}
+
+func TestStartHealthSweepRefusesOverlap(t *testing.T) {
+	s := &Server{}
+	s.healthSweeping.Store(true)
+	if err := s.startHealthSweep(); err != errSweepRunning {
+		t.Errorf("startHealthSweep during a sweep = %v, want errSweepRunning", err)
+	}
+
+	s.healthSweeping.Store(false)
+	s.maintenance.Store(true)
+	if err := s.startHealthSweep(); err != errSweepMaintenance {
+		t.Errorf("startHealthSweep in maintenance = %v, want errSweepMaintenance", err)
+	}
+	if s.healthSweeping.Load() {
+		t.Error("a refused sweep left the sweep flag set")
+	}
+}
+
+func TestProviderHealth(t *testing.T) {
+	st := newStatusTracker()
+	st.Set(&ProviderStatus{Name: "jamf-eu", Type: "jamf", Status: "error", Error: "HTTP 401"})
+	st.Set(&ProviderStatus{Name: "intune-corp", Type: "intune", Status: "connected"})
+	st.Set(&ProviderStatus{Name: "uem-anz", Type: "uem", Status: "checking"})
+
+	providers, connected, errored := providerHealth(st.All())
+	if connected != 1 || errored != 1 {
+		t.Errorf("connected, errored = %d, %d; want 1, 1", connected, errored)
+	}
+	var names []string
+	for _, p := range providers {
+		names = append(names, p.Name)
+	}
+	if fmt.Sprint(names) != "[intune-corp jamf-eu uem-anz]" {
+		t.Errorf("providers = %v, want sorted by name", names)
+	}
+	if providers[1].Error != "HTTP 401" {
+		t.Errorf("jamf-eu error = %q, want HTTP 401", providers[1].Error)
+	}
+
+	if providers, _, _ := providerHealth(nil); providers == nil {
+		t.Error("no providers should encode as [], not null")
+	}
+}
+
+func TestActivityLogSubscribe(t *testing.T) {
+	al := newActivityLog(10)
+	al.Logf("p1", "info", "one")
+	al.Logf("p1", "info", "two")
+
+	ch, backlog := al.Subscribe(1)
+	if len(backlog) != 1 || backlog[0].Message != "two" || backlog[0].Seq != 2 {
+		t.Fatalf("backlog = %+v, want just event 2", backlog)
+	}
+	al.Logf("p1", "info", "three")
+	if e := <-ch; e.Message != "three" || e.Seq != 3 {
+		t.Errorf("received %+v, want event 3", e)
+	}
+
+	// A subscriber that stops reading is dropped instead of blocking Add.
+	for i := range activitySubscriberBuffer + 1 {
+		al.Logf("p1", "info", "flood %d", i)
+	}
+	n := 0
+	for range ch {
+		n++
+	}
+	if n != activitySubscriberBuffer {
+		t.Errorf("slow subscriber got %d events before its channel closed, want %d", n, activitySubscriberBuffer)
+	}
+	al.Unsubscribe(ch) // already dropped; must not panic
+}
+
+func TestActivityLogRecentFiltered(t *testing.T) {
+	al := newActivityLog(10)
+	al.Logf("p1", "error", "p1 failed")
+	al.Logf("p2", "error", "p2 failed")
+	al.Logf("p1", "success", "p1 ok")
+	al.Logf("p1", "error", "p1 failed again")
+
+	var got []string
+	for _, e := range al.RecentFiltered(10, "p1", "error") {
+		got = append(got, e.Message)
+	}
+	if fmt.Sprint(got) != "[p1 failed again p1 failed]" {
+		t.Errorf("RecentFiltered(p1, error) = %v, want p1's errors newest first", got)
+	}
+	if n := len(al.RecentFiltered(1, "", "error")); n != 1 {
+		t.Errorf("RecentFiltered(1, any, error) returned %d events, want 1", n)
+	}
+	if n := len(al.Recent(10)); n != 4 {
+		t.Errorf("Recent(10) returned %d events, want all 4", n)
+	}
+}
+
+func TestIsRecovery(t *testing.T) {
+	tests := []struct {
+		name  string
+		prev  *ProviderStatus
+		fails int
+		want  bool
+	}{
+		{"first check", nil, 0, false},
+		{"still connected", &ProviderStatus{Status: "connected"}, 0, false},
+		{"tracked error", &ProviderStatus{Status: "error"}, 0, true},
+		{"stored failures after restart", nil, 3, true},
+		{"checking with stored failures", &ProviderStatus{Status: "checking"}, 1, true},
+	}
+	for _, tt := range tests {
+		if got := isRecovery(tt.prev, tt.fails); got != tt.want {
+			t.Errorf("%s: isRecovery = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -5,11 +5,11 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/dan/moe/internal/models"
 	"github.com/dan/moe/internal/provider"
-	"github.com/dan/moe/internal/provider/intune"
 )
 
 // handleProviderSync triggers an immediate device sync for a provider.
@@ -30,7 +30,12 @@ func (s *Server) handleProviderSync(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.activity.Logf(cfg.Name, "info", "Sync started…")
-	count, syncErr := s.syncProvider(r.Context(), p)
+	count, _, syncErr := s.syncProvider(r.Context(), p, s.cfg.MissingDevices)
+	if syncErr != nil {
+		s.auditf(r, "sync", auditProvider, id, "%s failed: %s", cfg.Name, syncErr)
+	} else {
+		s.auditf(r, "sync", auditProvider, id, "%s — %d devices", cfg.Name, count)
+	}
 	if syncErr != nil {
 		log.Printf("[sync] error syncing %s: %v", cfg.Name, syncErr)
 		s.activity.Logf(cfg.Name, "error", "Sync failed: %s", syncErr)
@@ -44,64 +49,150 @@ func (s *Server) handleProviderSync(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, fmt.Sprintf("/providers?flash=Synced %s — %d devices&flash_type=success", cfg.Name, count), http.StatusSeeOther)
 }
 
-// buildProvider creates a Provider instance from a ProviderConfig.
+// POST /api/v1/providers/{name}/resync?full=true
+// Runs a device sync now. With full=true the connection is tested first
+// and, once every page has been fetched, cached devices the provider no
+// longer reports are deleted rather than retired: the recovery for a cache
+// that has drifted from the provider. Nothing is deleted until the provider
+// has answered, so a bad secret or an outage leaves the cache as it was,
+// and devices that are still reported keep their tags, flags and
+// compliance history. Syncs always fetch every page, so there is no delta
+// state to reset yet.
+func (s *Server) apiResyncProvider(w http.ResponseWriter, r *http.Request) {
+	cfg, err := s.providerConfigs.GetByName(r.PathValue("name"))
+	if err != nil || cfg == nil {
+		jsonError(w, http.StatusNotFound, "provider not found")
+		return
+	}
+	full := r.URL.Query().Get("full") == "true"
+
+	p, err := s.buildProvider(cfg)
+	if err != nil {
+		s.activity.Logf(cfg.Name, "error", "Sync failed — could not initialise provider: %s", err)
+		jsonError(w, http.StatusInternalServerError, "failed to initialise provider: "+err.Error())
+		return
+	}
+
+	verb, missing := "sync", s.cfg.MissingDevices
+	if full {
+		verb, missing = "resync", MissingDevicesDelete
+		if err := p.TestConnection(r.Context()); err != nil {
+			s.auditf(r, verb, auditProvider, cfg.ID, "%s failed: %s", cfg.Name, err)
+			log.Printf("[sync] full resync of %s aborted, connection test failed: %v", cfg.Name, err)
+			s.activity.Logf(cfg.Name, "error", "Full resync aborted — connection test failed: %s", err)
+			jsonError(w, http.StatusBadGateway, "connection test failed: "+err.Error())
+			return
+		}
+	}
+
+	// Don't let a dropped connection abandon a sync halfway through.
+	s.activity.Logf(cfg.Name, "info", "Sync started…")
+	count, missingCount, syncErr := s.syncProvider(context.WithoutCancel(r.Context()), p, missing)
+	if syncErr != nil {
+		s.auditf(r, verb, auditProvider, cfg.ID, "%s failed: %s", cfg.Name, syncErr)
+		log.Printf("[sync] error syncing %s: %v", cfg.Name, syncErr)
+		s.activity.Logf(cfg.Name, "error", "Sync failed: %s", syncErr)
+		jsonError(w, http.StatusBadGateway, "sync failed: "+syncErr.Error())
+		return
+	}
+	if full {
+		s.auditf(r, verb, auditProvider, cfg.ID, "%s — synced %d devices, deleted %d no longer reported", cfg.Name, count, missingCount)
+	} else {
+		s.auditf(r, verb, auditProvider, cfg.ID, "%s — %d devices", cfg.Name, count)
+	}
+
+	log.Printf("[sync] completed %s: %d devices synced", cfg.Name, count)
+	s.activity.Logf(cfg.Name, "success", "Sync complete — %d devices", count)
+	_ = s.providerConfigs.RecordSyncSuccess(cfg.Name)
+	jsonOK(w, map[string]any{
+		"name":    cfg.Name,
+		"full":    full,
+		"devices": count,
+		"missing": missingCount, // retired, or deleted with full
+	})
+}
+
+// buildProvider creates a Provider instance from a ProviderConfig using the
+// factory its package registered for the type, with the server's Graph
+// timeout and policy concurrency. Types with no registered factory, such as
+// "uem", can hold devices but can't be synced or checked.
 func (s *Server) buildProvider(cfg *models.ProviderConfig) (provider.Provider, error) {
-	switch cfg.Type {
-	case "intune":
-		return intune.New(intune.Config{
-			Name:         cfg.Name,
-			TenantID:     cfg.TenantID,
-			ClientID:     cfg.ClientID,
-			ClientSecret: cfg.ClientSecret,
-		}), nil
-	case "uem":
+	if cfg.Type == "uem" {
 		return nil, fmt.Errorf("UEM provider not yet implemented")
-	default:
-		return nil, fmt.Errorf("unknown provider type: %s", cfg.Type)
 	}
+	return provider.New(*cfg, provider.Options{
+		Timeout:           s.cfg.GraphTimeout,
+		PolicyConcurrency: s.cfg.PolicyConcurrency,
+	})
 }
 
 // syncProvider runs a full device sync for the given provider, upserting all
-// returned devices into the local cache. Returns the total device count.
-func (s *Server) syncProvider(ctx context.Context, p provider.Provider) (int, error) {
+// returned devices into the local cache, and records the run in the sync
+// history. Once every page has been fetched, devices the provider no longer
+// reports are retired or deleted, per missing (see reconcileMissing).
+// Returns the total device count and how many devices were reconciled.
+func (s *Server) syncProvider(ctx context.Context, p provider.Provider, missing string) (total, reconciled int, err error) {
+	run := &models.SyncRun{
+		ID:           newID(),
+		ProviderName: p.Name(),
+		StartedAt:    time.Now().UTC(),
+	}
+	defer func() {
+		run.FinishedAt = time.Now().UTC()
+		run.DeviceCount = total
+		if err != nil {
+			run.Error = err.Error()
+		}
+		if rerr := s.syncRuns.Create(run); rerr != nil {
+			log.Printf("[sync] record sync run for %s: %v", p.Name(), rerr)
+		}
+	}()
+
 	var (
 		cursor string
-		total  int
+		seen   []string
 	)
-
 	for {
 		devices, nextCursor, err := p.SyncDevices(ctx, cursor)
 		if err != nil {
-			return total, fmt.Errorf("sync page: %w", err)
+			return total, 0, fmt.Errorf("sync page: %w", err)
 		}
 
 		now := time.Now().UTC()
 		for _, sd := range devices {
 			d := &models.Device{
-				ID:           newID(),
-				ProviderName: p.Name(),
-				ProviderType: p.Type(),
-				SourceID:     sd.SourceID,
-				DeviceName:   sd.DeviceName,
-				OS:           sd.OS,
-				OSVersion:    sd.OSVersion,
-				Model:        sd.Model,
-				UserName:     sd.UserName,
-				UserEmail:    sd.UserEmail,
-				Compliance:   sd.Compliance,
-				IsEncrypted:  sd.IsEncrypted,
-				JailBroken:   sd.JailBroken,
-				IsSupervised: sd.IsSupervised,
-				ThreatState:  sd.ThreatState,
-				LastSeen:     sd.LastSeen,
-				LastSyncedAt: &now,
-				CreatedAt:    now,
+				ID:              newID(),
+				ProviderName:    p.Name(),
+				ProviderType:    p.Type(),
+				SourceID:        sd.SourceID,
+				DeviceName:      sd.DeviceName,
+				OS:              sd.OS,
+				OSVersion:       sd.OSVersion,
+				Model:           sd.Model,
+				Serial:          sd.Serial,
+				IMEI:            sd.IMEI,
+				UserName:        sd.UserName,
+				UserEmail:       sd.UserEmail,
+				Compliance:      sd.Compliance,
+				IsEncrypted:     sd.IsEncrypted,
+				JailBroken:      sd.JailBroken,
+				IsSupervised:    sd.IsSupervised,
+				ThreatState:     sd.ThreatState,
+				LastSeen:        sd.LastSeen,
+				Ownership:       sd.Ownership,
+				ManagementAgent: sd.ManagementAgent,
+				EnrolledAt:      sd.EnrolledAt,
+				LastSyncedAt:    &now,
+				CreatedAt:       now,
 			}
 			if err := s.devices.Upsert(d); err != nil {
 				log.Printf("[sync] upsert error for %s/%s: %v", p.Name(), sd.SourceID, err)
 			}
 		}
 
+		for _, sd := range devices {
+			seen = append(seen, sd.SourceID)
+		}
 		total += len(devices)
 
 		if nextCursor == "" {
@@ -110,5 +201,40 @@ func (s *Server) syncProvider(ctx context.Context, p provider.Provider) (int, er
 		cursor = nextCursor
 	}
 
-	return total, nil
+	return total, s.reconcileMissing(p.Name(), seen, missing), nil
+}
+
+// reconcileMissing retires or deletes, per missing (MissingDevicesRetire or
+// MissingDevicesDelete), the provider's devices that a complete sync did
+// not return, and returns how many it changed. An empty result is more
+// likely a provider-side glitch than a wiped tenant, so it is left alone
+// rather than retiring every device.
+func (s *Server) reconcileMissing(providerName string, seen []string, missing string) int {
+	if len(seen) == 0 {
+		log.Printf("[sync] %s returned no devices; skipping missing-device reconciliation", providerName)
+		return 0
+	}
+
+	var (
+		n    int
+		err  error
+		verb string
+	)
+	if missing == MissingDevicesDelete {
+		n, err = s.devices.DeleteMissingForProvider(providerName, seen)
+		verb = "Deleted"
+	} else {
+		n, err = s.devices.RetireMissingForProvider(providerName, seen)
+		verb = "Retired"
+	}
+	if err != nil {
+		log.Printf("[sync] reconcile %s: %v", providerName, err)
+		s.activity.Logf(providerName, "error", "Could not reconcile missing devices: %s", err)
+		return 0
+	}
+	if n > 0 {
+		log.Printf("[sync] %s: %s %d devices no longer reported", providerName, strings.ToLower(verb), n)
+		s.activity.Logf(providerName, "info", "%s %d devices no longer reported by the provider", verb, n)
+	}
+	return n
 }
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dan/moe/internal/models"
+)
+
+// AdminUserStore handles persistence for web UI administrators.
+type AdminUserStore struct {
+	db *sql.DB
+}
+
+// NewAdminUserStore creates an AdminUserStore.
+func NewAdminUserStore(db *sql.DB) *AdminUserStore {
+	return &AdminUserStore{db: db}
+}
+
+// Create inserts a new admin user. PasswordHash must already be set.
+func (s *AdminUserStore) Create(u *models.AdminUser) error {
+	u.CreatedAt = time.Now().UTC()
+	_, err := s.db.Exec(`
+		INSERT INTO admin_users (id, username, password_hash, created_at)
+		VALUES (?, ?, ?, ?)`,
+		u.ID, u.Username, u.PasswordHash, u.CreatedAt,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint") {
+			return fmt.Errorf("an admin user named %q already exists", u.Username)
+		}
+		return fmt.Errorf("insert admin user: %w", err)
+	}
+	return nil
+}
+
+// GetByUsername returns an admin user by username, or nil if there is none.
+func (s *AdminUserStore) GetByUsername(username string) (*models.AdminUser, error) {
+	var u models.AdminUser
+	var lastLogin string
+	err := s.db.QueryRow(`
+		SELECT id, username, password_hash, created_at, last_login_at
+		FROM admin_users WHERE username = ?`, username,
+	).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.CreatedAt, &lastLogin)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get admin user: %w", err)
+	}
+	if lastLogin != "" {
+		u.LastLoginAt, _ = time.Parse(time.RFC3339, lastLogin)
+	}
+	return &u, nil
+}
+
+// Count returns the number of admin users.
+func (s *AdminUserStore) Count() (int, error) {
+	var n int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM admin_users").Scan(&n)
+	return n, err
+}
+
+// RecordLogin stamps a successful sign-in.
+func (s *AdminUserStore) RecordLogin(username string) error {
+	_, err := s.db.Exec("UPDATE admin_users SET last_login_at = ? WHERE username = ?",
+		time.Now().UTC().Format(time.RFC3339), username)
+	if err != nil {
+		return fmt.Errorf("record admin login: %w", err)
+	}
+	return nil
+}
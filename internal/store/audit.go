@@ -0,0 +1,64 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/dan/moe/internal/models"
+)
+
+// AuditStore handles persistence for the audit log.
+type AuditStore struct {
+	db *sql.DB
+}
+
+// NewAuditStore creates an AuditStore.
+func NewAuditStore(db *sql.DB) *AuditStore {
+	return &AuditStore{db: db}
+}
+
+// Record appends an entry to the audit log.
+func (s *AuditStore) Record(e *models.AuditEntry) error {
+	_, err := s.db.Exec(`
+		INSERT INTO audit_log (id, at, actor, action, target_type, target_id, detail)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		e.ID, e.At, e.Actor, e.Action, e.TargetType, e.TargetID, e.Detail,
+	)
+	if err != nil {
+		return fmt.Errorf("insert audit entry: %w", err)
+	}
+	return nil
+}
+
+// List returns audit entries newest first, with the total number of
+// entries for paging. A limit of zero or less defaults to 50.
+func (s *AuditStore) List(limit, offset int) ([]models.AuditEntry, int, error) {
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM audit_log").Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count audit entries: %w", err)
+	}
+
+	if limit <= 0 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	rows, err := s.db.Query(`
+		SELECT id, at, actor, action, target_type, target_id, detail
+		FROM audit_log ORDER BY at DESC, rowid DESC LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var e models.AuditEntry
+		if err := rows.Scan(&e.ID, &e.At, &e.Actor, &e.Action, &e.TargetType, &e.TargetID, &e.Detail); err != nil {
+			return nil, 0, fmt.Errorf("scan audit entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
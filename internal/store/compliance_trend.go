@@ -0,0 +1,74 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/dan/moe/internal/models"
+)
+
+// ComplianceTrendStore keeps the daily compliance rollup behind the
+// compliance trend report.
+type ComplianceTrendStore struct {
+	db *sql.DB
+}
+
+// NewComplianceTrendStore creates a ComplianceTrendStore.
+func NewComplianceTrendStore(db *sql.DB) *ComplianceTrendStore {
+	return &ComplianceTrendStore{db: db}
+}
+
+// trendDate is the layout of compliance_snapshots.date.
+const trendDate = "2006-01-02"
+
+// Record stores the current compliance breakdown of each provider's devices
+// as the rollup for day's UTC date, replacing any taken earlier that day.
+// It returns how many providers were recorded.
+func (s *ComplianceTrendStore) Record(day time.Time) (int, error) {
+	res, err := s.db.Exec(`
+		INSERT INTO compliance_snapshots (date, provider_name, compliant, noncompliant, unknown)
+		SELECT ?, provider_name,
+			SUM(compliance = 'compliant'),
+			SUM(compliance = 'non-compliant'),
+			SUM(compliance NOT IN ('compliant', 'non-compliant'))
+		FROM devices WHERE true GROUP BY provider_name
+		ON CONFLICT(date, provider_name) DO UPDATE SET
+			compliant    = excluded.compliant,
+			noncompliant = excluded.noncompliant,
+			unknown      = excluded.unknown`,
+		day.UTC().Format(trendDate))
+	if err != nil {
+		return 0, fmt.Errorf("record compliance snapshot: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// Series returns the daily rollups from since's UTC date onwards, oldest
+// first: one provider's, or with provider empty the sum over all providers.
+func (s *ComplianceTrendStore) Series(provider string, since time.Time) ([]models.ComplianceSnapshot, error) {
+	query := `SELECT date, '', SUM(compliant), SUM(noncompliant), SUM(unknown)
+		FROM compliance_snapshots WHERE date >= ? GROUP BY date ORDER BY date`
+	args := []any{since.UTC().Format(trendDate)}
+	if provider != "" {
+		query = `SELECT date, provider_name, compliant, noncompliant, unknown
+			FROM compliance_snapshots WHERE date >= ? AND provider_name = ? ORDER BY date`
+		args = append(args, provider)
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list compliance snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	series := []models.ComplianceSnapshot{}
+	for rows.Next() {
+		var c models.ComplianceSnapshot
+		if err := rows.Scan(&c.Date, &c.ProviderName, &c.Compliant, &c.NonCompliant, &c.Unknown); err != nil {
+			return nil, fmt.Errorf("scan compliance snapshot: %w", err)
+		}
+		series = append(series, c)
+	}
+	return series, rows.Err()
+}
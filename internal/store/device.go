@@ -2,6 +2,7 @@ package store
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -19,25 +20,57 @@ func NewDeviceStore(db *sql.DB) *DeviceStore {
 	return &DeviceStore{db: db}
 }
 
+// column list shared by all SELECT queries.
+const deviceCols = `id, provider_name, provider_type, source_id,
+	device_name, os, os_version, model, serial, imei,
+	user_name, user_email, compliance,
+	is_encrypted, jail_broken, is_supervised, threat_state,
+	ownership, management_agent, enrolled_at, flagged, status,
+	last_seen, last_synced_at, state_changed_at, created_at, updated_at,
+	last_command_at, last_command_action, last_command_state`
+
+// scanDevice scans a full row into a Device.
+func scanDevice(sc interface{ Scan(...any) error }) (*models.Device, error) {
+	d := &models.Device{}
+	err := sc.Scan(
+		&d.ID, &d.ProviderName, &d.ProviderType, &d.SourceID,
+		&d.DeviceName, &d.OS, &d.OSVersion, &d.Model, &d.Serial, &d.IMEI,
+		&d.UserName, &d.UserEmail, &d.Compliance,
+		&d.IsEncrypted, &d.JailBroken, &d.IsSupervised, &d.ThreatState,
+		&d.Ownership, &d.ManagementAgent, &d.EnrolledAt, &d.Flagged, &d.Status,
+		&d.LastSeen, &d.LastSyncedAt, &d.StateChangedAt, &d.CreatedAt, &d.UpdatedAt,
+		&d.LastCommandAt, &d.LastCommandAction, &d.LastCommandState,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
 // Create inserts a new device record.
 func (s *DeviceStore) Create(d *models.Device) error {
 	now := time.Now().UTC()
 	d.CreatedAt = now
 	d.UpdatedAt = now
+	if d.Status == "" {
+		d.Status = models.DeviceStatusActive
+	}
 
 	_, err := s.db.Exec(`
 		INSERT INTO devices (
 			id, provider_name, provider_type, source_id,
-			device_name, os, os_version, model,
+			device_name, os, os_version, model, serial, imei,
 			user_name, user_email, compliance,
 			is_encrypted, jail_broken, is_supervised, threat_state,
-			last_seen, last_synced_at, created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			ownership, management_agent, enrolled_at, flagged, status,
+			last_seen, last_synced_at, created_at, updated_at, os_version_key
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		d.ID, d.ProviderName, d.ProviderType, d.SourceID,
-		d.DeviceName, d.OS, d.OSVersion, d.Model,
+		d.DeviceName, d.OS, d.OSVersion, d.Model, d.Serial, d.IMEI,
 		d.UserName, d.UserEmail, d.Compliance,
 		d.IsEncrypted, d.JailBroken, d.IsSupervised, d.ThreatState,
-		d.LastSeen, d.LastSyncedAt, d.CreatedAt, d.UpdatedAt,
+		d.Ownership, d.ManagementAgent, d.EnrolledAt, d.Flagged, d.Status,
+		d.LastSeen, d.LastSyncedAt, d.CreatedAt, d.UpdatedAt, osVersionKey(d.OSVersion),
 	)
 	if err != nil {
 		return fmt.Errorf("insert device: %w", err)
@@ -46,24 +79,52 @@ func (s *DeviceStore) Create(d *models.Device) error {
 }
 
 // Upsert inserts or updates a device keyed by (provider_name, source_id).
-// Used by the sync engine to refresh cached data.
+// Used by the sync engine to refresh cached data. A retired device that the
+// provider reports again becomes active. A change in an existing device's
+// compliance state is appended to its compliance history, and a change in
+// compliance or encryption sets its state_changed_at.
 func (s *DeviceStore) Upsert(d *models.Device) error {
 	now := time.Now().UTC()
 	d.UpdatedAt = now
 
-	_, err := s.db.Exec(`
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("upsert device: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The upsert overwrites compliance and encryption, so read the prior
+	// state first.
+	var (
+		prevID, prevCompliance string
+		prevEncrypted          bool
+	)
+	err = tx.QueryRow(`SELECT id, compliance, is_encrypted FROM devices WHERE provider_name = ? AND source_id = ?`,
+		d.ProviderName, d.SourceID).Scan(&prevID, &prevCompliance, &prevEncrypted)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("upsert device: read prior state: %w", err)
+	}
+	existed := err == nil
+	complianceChanged := existed && prevCompliance != d.Compliance
+	encryptionChanged := existed && prevEncrypted != d.IsEncrypted
+
+	_, err = tx.Exec(`
 		INSERT INTO devices (
 			id, provider_name, provider_type, source_id,
-			device_name, os, os_version, model,
+			device_name, os, os_version, model, serial, imei,
 			user_name, user_email, compliance,
 			is_encrypted, jail_broken, is_supervised, threat_state,
-			last_seen, last_synced_at, created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ownership, management_agent, enrolled_at,
+			last_seen, last_synced_at, created_at, updated_at, os_version_key
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(provider_name, source_id) DO UPDATE SET
 			device_name    = excluded.device_name,
 			os             = excluded.os,
 			os_version     = excluded.os_version,
+			os_version_key = excluded.os_version_key,
 			model          = excluded.model,
+			serial         = excluded.serial,
+			imei           = excluded.imei,
 			user_name      = excluded.user_name,
 			user_email     = excluded.user_email,
 			compliance     = excluded.compliance,
@@ -71,38 +132,85 @@ func (s *DeviceStore) Upsert(d *models.Device) error {
 			jail_broken    = excluded.jail_broken,
 			is_supervised  = excluded.is_supervised,
 			threat_state   = excluded.threat_state,
+			ownership      = excluded.ownership,
+			management_agent = excluded.management_agent,
+			enrolled_at    = excluded.enrolled_at,
 			last_seen      = excluded.last_seen,
 			last_synced_at = excluded.last_synced_at,
+			status         = 'active',
 			updated_at     = excluded.updated_at`,
 		d.ID, d.ProviderName, d.ProviderType, d.SourceID,
-		d.DeviceName, d.OS, d.OSVersion, d.Model,
+		d.DeviceName, d.OS, d.OSVersion, d.Model, d.Serial, d.IMEI,
 		d.UserName, d.UserEmail, d.Compliance,
 		d.IsEncrypted, d.JailBroken, d.IsSupervised, d.ThreatState,
-		d.LastSeen, d.LastSyncedAt, d.CreatedAt, d.UpdatedAt,
+		d.Ownership, d.ManagementAgent, d.EnrolledAt,
+		d.LastSeen, d.LastSyncedAt, d.CreatedAt, d.UpdatedAt, osVersionKey(d.OSVersion),
 	)
 	if err != nil {
 		return fmt.Errorf("upsert device: %w", err)
 	}
-	return nil
+	if complianceChanged || encryptionChanged {
+		if _, err := tx.Exec(`UPDATE devices SET state_changed_at = ? WHERE id = ?`, now, prevID); err != nil {
+			return fmt.Errorf("upsert device: mark state change: %w", err)
+		}
+	}
+	if complianceChanged {
+		_, err = tx.Exec(`INSERT INTO device_compliance_history (device_id, from_state, to_state, changed_at) VALUES (?, ?, ?, ?)`,
+			prevID, prevCompliance, d.Compliance, now)
+		if err != nil {
+			return fmt.Errorf("upsert device: record compliance change: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// RecentlyChanged returns the devices whose compliance or encryption state a
+// sync changed at or after since, most recently changed first.
+func (s *DeviceStore) RecentlyChanged(since time.Time) ([]models.Device, error) {
+	rows, err := s.db.Query(`SELECT `+deviceCols+` FROM devices
+		WHERE state_changed_at >= ? ORDER BY state_changed_at DESC, device_name`, since.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("list recently changed devices: %w", err)
+	}
+	defer rows.Close()
+
+	devices := []models.Device{}
+	for rows.Next() {
+		d, err := scanDevice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan device: %w", err)
+		}
+		devices = append(devices, *d)
+	}
+	return devices, rows.Err()
+}
+
+// ComplianceHistory returns a device's recorded compliance changes, newest
+// first.
+func (s *DeviceStore) ComplianceHistory(deviceID string) ([]models.ComplianceChange, error) {
+	rows, err := s.db.Query(`
+		SELECT from_state, to_state, changed_at FROM device_compliance_history
+		WHERE device_id = ? ORDER BY changed_at DESC, id DESC`, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("list compliance history: %w", err)
+	}
+	defer rows.Close()
+
+	changes := []models.ComplianceChange{}
+	for rows.Next() {
+		var c models.ComplianceChange
+		if err := rows.Scan(&c.From, &c.To, &c.ChangedAt); err != nil {
+			return nil, fmt.Errorf("scan compliance change: %w", err)
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
 }
 
 // GetByID returns a single device by its MOE internal ID.
 func (s *DeviceStore) GetByID(id string) (*models.Device, error) {
-	d := &models.Device{}
-	err := s.db.QueryRow(`
-		SELECT id, provider_name, provider_type, source_id,
-			device_name, os, os_version, model,
-			user_name, user_email, compliance,
-			is_encrypted, jail_broken, is_supervised, threat_state,
-			last_seen, last_synced_at, created_at, updated_at
-		FROM devices WHERE id = ?`, id,
-	).Scan(
-		&d.ID, &d.ProviderName, &d.ProviderType, &d.SourceID,
-		&d.DeviceName, &d.OS, &d.OSVersion, &d.Model,
-		&d.UserName, &d.UserEmail, &d.Compliance,
-		&d.IsEncrypted, &d.JailBroken, &d.IsSupervised, &d.ThreatState,
-		&d.LastSeen, &d.LastSyncedAt, &d.CreatedAt, &d.UpdatedAt,
-	)
+	row := s.db.QueryRow(`SELECT `+deviceCols+` FROM devices WHERE id = ?`, id)
+	d, err := scanDevice(row)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -112,6 +220,20 @@ func (s *DeviceStore) GetByID(id string) (*models.Device, error) {
 	return d, nil
 }
 
+// GetBySource returns a provider's device by its source ID, or nil if the
+// provider has no such device.
+func (s *DeviceStore) GetBySource(provider, sourceID string) (*models.Device, error) {
+	row := s.db.QueryRow(`SELECT `+deviceCols+` FROM devices WHERE provider_name = ? AND source_id = ?`, provider, sourceID)
+	d, err := scanDevice(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get device by source: %w", err)
+	}
+	return d, nil
+}
+
 // Update modifies an existing device by ID.
 func (s *DeviceStore) Update(d *models.Device) error {
 	d.UpdatedAt = time.Now().UTC()
@@ -119,15 +241,17 @@ func (s *DeviceStore) Update(d *models.Device) error {
 	res, err := s.db.Exec(`
 		UPDATE devices SET
 			provider_name = ?, provider_type = ?, source_id = ?,
-			device_name = ?, os = ?, os_version = ?, model = ?,
+			device_name = ?, os = ?, os_version = ?, os_version_key = ?, model = ?, serial = ?, imei = ?,
 			user_name = ?, user_email = ?, compliance = ?,
 			is_encrypted = ?, jail_broken = ?, is_supervised = ?, threat_state = ?,
+			ownership = ?, management_agent = ?, enrolled_at = ?,
 			last_seen = ?, last_synced_at = ?, updated_at = ?
 		WHERE id = ?`,
 		d.ProviderName, d.ProviderType, d.SourceID,
-		d.DeviceName, d.OS, d.OSVersion, d.Model,
+		d.DeviceName, d.OS, d.OSVersion, osVersionKey(d.OSVersion), d.Model, d.Serial, d.IMEI,
 		d.UserName, d.UserEmail, d.Compliance,
 		d.IsEncrypted, d.JailBroken, d.IsSupervised, d.ThreatState,
+		d.Ownership, d.ManagementAgent, d.EnrolledAt,
 		d.LastSeen, d.LastSyncedAt, d.UpdatedAt,
 		d.ID,
 	)
@@ -141,6 +265,31 @@ func (s *DeviceStore) Update(d *models.Device) error {
 	return nil
 }
 
+// SetFlagged sets or clears a device's follow-up flag. It is kept apart
+// from Update so editing a device never clobbers the flag.
+func (s *DeviceStore) SetFlagged(id string, flagged bool) error {
+	res, err := s.db.Exec("UPDATE devices SET flagged = ? WHERE id = ?", flagged, id)
+	if err != nil {
+		return fmt.Errorf("set device flag: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return fmt.Errorf("device not found: %s", id)
+	}
+	return nil
+}
+
+// RecordCommand stores the last command sent to a device and its state,
+// models.CommandStatePending or models.CommandStateFailed.
+func (s *DeviceStore) RecordCommand(id, action, state string) error {
+	_, err := s.db.Exec(`UPDATE devices SET last_command_at = ?, last_command_action = ?, last_command_state = ? WHERE id = ?`,
+		time.Now().UTC(), action, state, id)
+	if err != nil {
+		return fmt.Errorf("record device command: %w", err)
+	}
+	return nil
+}
+
 // Delete removes a device by ID.
 func (s *DeviceStore) Delete(id string) error {
 	res, err := s.db.Exec("DELETE FROM devices WHERE id = ?", id)
@@ -154,8 +303,235 @@ func (s *DeviceStore) Delete(id string) error {
 	return nil
 }
 
-// List returns devices matching the given filter criteria.
-func (s *DeviceStore) List(f models.DeviceFilter) ([]models.Device, int, error) {
+// ErrEmptyDeviceFilter is returned by DeleteByFilter for a filter with no
+// criteria, which would match every device.
+var ErrEmptyDeviceFilter = errors.New("device filter has no criteria")
+
+// DeleteByFilter deletes every device matching f, with its tags and
+// compliance history, ignoring sorting and paging. A filter with no criteria
+// is refused with ErrEmptyDeviceFilter rather than emptying the table.
+// Returns the number of devices deleted.
+func (s *DeviceStore) DeleteByFilter(f models.DeviceFilter) (int, error) {
+	whereClause, args := filterClause(f)
+	if whereClause == "" {
+		return 0, ErrEmptyDeviceFilter
+	}
+	res, err := s.db.Exec("DELETE FROM devices "+whereClause, args...)
+	if err != nil {
+		return 0, fmt.Errorf("delete devices: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// DeleteMissingForProvider deletes the provider's devices whose source IDs
+// are not in seenSourceIDs, as reconciliation after a full sync. Returns
+// the number of devices deleted.
+func (s *DeviceStore) DeleteMissingForProvider(provider string, seenSourceIDs []string) (int, error) {
+	ids, err := s.missingForProvider(provider, seenSourceIDs, "")
+	if err != nil {
+		return 0, fmt.Errorf("delete missing devices: %w", err)
+	}
+	if err := s.execEach(ids, `DELETE FROM devices WHERE id = ?`); err != nil {
+		return 0, fmt.Errorf("delete missing devices: %w", err)
+	}
+	return len(ids), nil
+}
+
+// RetireMissingForProvider marks the provider's active devices whose source
+// IDs are not in seenSourceIDs as retired. Returns the number of devices
+// newly retired.
+func (s *DeviceStore) RetireMissingForProvider(provider string, seenSourceIDs []string) (int, error) {
+	ids, err := s.missingForProvider(provider, seenSourceIDs, models.DeviceStatusActive)
+	if err != nil {
+		return 0, fmt.Errorf("retire missing devices: %w", err)
+	}
+	now := time.Now().UTC()
+	if err := s.execEach(ids, `UPDATE devices SET status = ?, updated_at = ? WHERE id = ?`,
+		models.DeviceStatusRetired, now); err != nil {
+		return 0, fmt.Errorf("retire missing devices: %w", err)
+	}
+	return len(ids), nil
+}
+
+// missingForProvider returns the IDs of the provider's devices (only those
+// in status, if set) whose source IDs are not in seen. The difference is
+// taken in Go because a large tenant's source IDs would exceed SQLite's
+// bound-parameter limit.
+func (s *DeviceStore) missingForProvider(provider string, seen []string, status string) ([]string, error) {
+	seenSet := make(map[string]bool, len(seen))
+	for _, id := range seen {
+		seenSet[id] = true
+	}
+
+	query := `SELECT id, source_id FROM devices WHERE provider_name = ?`
+	args := []any{provider}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var missing []string
+	for rows.Next() {
+		var id, sourceID string
+		if err := rows.Scan(&id, &sourceID); err != nil {
+			return nil, err
+		}
+		if !seenSet[sourceID] {
+			missing = append(missing, id)
+		}
+	}
+	return missing, rows.Err()
+}
+
+// execEach runs stmt once per ID in a single transaction, binding args
+// followed by the ID.
+func (s *DeviceStore) execEach(ids []string, stmt string, args ...any) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, id := range ids {
+		if _, err := tx.Exec(stmt, append(args, id)...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// osVersionParts and osVersionWidth shape an OS version key: four numeric
+// components, each zero-padded wide enough for Windows build numbers.
+const (
+	osVersionParts = 4
+	osVersionWidth = 6
+)
+
+// OSVersionKey normalises an OS version such as "17.2.1" or
+// "10.0.22631.2861" into a string that sorts in version order. Only the
+// leading dotted-number part counts, so "14.2 (23C64)" is 14.2; ok is false
+// when there is none. Missing components are zero, so "17" equals "17.0".
+func OSVersionKey(v string) (string, bool) {
+	end := strings.IndexFunc(v, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if end >= 0 {
+		v = v[:end]
+	}
+	parts := strings.Split(strings.TrimRight(v, "."), ".")
+	if parts[0] == "" {
+		return "", false
+	}
+	key := make([]string, osVersionParts)
+	for i := range key {
+		n := "0"
+		if i < len(parts) {
+			n = strings.TrimLeft(parts[i], "0")
+			if parts[i] == "" || len(n) > osVersionWidth {
+				return "", false
+			}
+		}
+		key[i] = strings.Repeat("0", osVersionWidth-len(n)) + n
+	}
+	return strings.Join(key, "."), true
+}
+
+// osVersionKey is the stored form of OSVersionKey: "" when v has no
+// version number, so such devices drop out of range filters.
+func osVersionKey(v string) string {
+	key, _ := OSVersionKey(v)
+	return key
+}
+
+// BackfillOSVersionKeys computes os_version_key for devices stored before
+// the column existed. It is cheap to call when there is nothing to do.
+func (s *DeviceStore) BackfillOSVersionKeys() (int, error) {
+	rows, err := s.db.Query(`SELECT id, os_version FROM devices WHERE os_version_key IS NULL`)
+	if err != nil {
+		return 0, fmt.Errorf("backfill os version keys: %w", err)
+	}
+	keys := map[string]string{}
+	for rows.Next() {
+		var id, v string
+		if err := rows.Scan(&id, &v); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("backfill os version keys: %w", err)
+		}
+		keys[id] = osVersionKey(v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("backfill os version keys: %w", err)
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("backfill os version keys: %w", err)
+	}
+	defer tx.Rollback()
+	for id, key := range keys {
+		if _, err := tx.Exec(`UPDATE devices SET os_version_key = ? WHERE id = ?`, key, id); err != nil {
+			return 0, fmt.Errorf("backfill os version keys: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("backfill os version keys: %w", err)
+	}
+	return len(keys), nil
+}
+
+// deviceSortColumns is the allowlist of columns List can order by. Sort
+// keys are interpolated into SQL, so anything not listed here is ignored.
+var deviceSortColumns = map[string]bool{
+	"device_name":   true,
+	"provider_name": true,
+	"os":            true,
+	"compliance":    true,
+	"last_seen":     true,
+	"enrolled_at":   true,
+	"updated_at":    true,
+}
+
+// ValidDeviceSort reports whether sortBy and dir are accepted by List.
+// Empty values select the default order (updated_at DESC).
+func ValidDeviceSort(sortBy, dir string) bool {
+	if sortBy != "" && !deviceSortColumns[sortBy] {
+		return false
+	}
+	switch strings.ToLower(dir) {
+	case "", "asc", "desc":
+		return true
+	}
+	return false
+}
+
+// orderClause builds the ORDER BY expression for a DeviceFilter, falling
+// back to updated_at DESC for unknown columns. id breaks ties so paging is
+// stable when many devices share a value.
+func orderClause(f models.DeviceFilter) string {
+	col := "updated_at"
+	if deviceSortColumns[f.SortBy] {
+		col = f.SortBy
+	}
+	dir := "DESC"
+	if strings.EqualFold(f.SortDir, "asc") {
+		dir = "ASC"
+	}
+	return col + " " + dir + ", id " + dir
+}
+
+// filterClause builds the WHERE clause and args for a DeviceFilter.
+// Limit and Offset are not applied here.
+func filterClause(f models.DeviceFilter) (string, []any) {
 	var (
 		where []string
 		args  []any
@@ -177,16 +553,55 @@ func (s *DeviceStore) List(f models.DeviceFilter) ([]models.Device, int, error)
 		where = append(where, "compliance = ?")
 		args = append(args, f.Compliance)
 	}
+	if f.Ownership != "" {
+		where = append(where, "ownership = ?")
+		args = append(args, f.Ownership)
+	}
+	if f.ManagementAgent != "" {
+		where = append(where, "management_agent = ?")
+		args = append(args, f.ManagementAgent)
+	}
+	if f.Flagged {
+		where = append(where, "flagged = 1")
+	}
+	if f.Tag != "" {
+		where = append(where, "id IN (SELECT device_id FROM device_tags WHERE tag = ?)")
+		args = append(args, f.Tag)
+	}
+	if f.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, f.Status)
+	}
+	if key, ok := OSVersionKey(f.OSVersionMin); ok {
+		where = append(where, "os_version_key != '' AND os_version_key >= ?")
+		args = append(args, key)
+	}
+	if key, ok := OSVersionKey(f.OSVersionMax); ok {
+		where = append(where, "os_version_key != '' AND os_version_key < ?")
+		args = append(args, key)
+	}
+	if f.StaleDays > 0 {
+		where = append(where, "last_seen IS NOT NULL AND last_seen < ?")
+		args = append(args, time.Now().AddDate(0, 0, -f.StaleDays).UTC())
+	}
 	if f.Search != "" {
-		where = append(where, "(device_name LIKE ? OR user_name LIKE ? OR user_email LIKE ? OR model LIKE ?)")
+		where = append(where, "(device_name LIKE ? OR user_name LIKE ? OR user_email LIKE ? OR model LIKE ? OR serial LIKE ? OR REPLACE(imei, ' ', '') LIKE ?)")
 		q := "%" + f.Search + "%"
-		args = append(args, q, q, q, q)
+		// Graph returns IMEIs grouped with spaces; compare digits only so a
+		// search for the bare number still finds the device.
+		imei := "%" + strings.ReplaceAll(f.Search, " ", "") + "%"
+		args = append(args, q, q, q, q, q, imei)
 	}
 
-	whereClause := ""
-	if len(where) > 0 {
-		whereClause = "WHERE " + strings.Join(where, " AND ")
+	if len(where) == 0 {
+		return "", args
 	}
+	return "WHERE " + strings.Join(where, " AND "), args
+}
+
+// List returns devices matching the given filter criteria.
+func (s *DeviceStore) List(f models.DeviceFilter) ([]models.Device, int, error) {
+	whereClause, args := filterClause(f)
 
 	// Count total matches.
 	var total int
@@ -205,15 +620,10 @@ func (s *DeviceStore) List(f models.DeviceFilter) ([]models.Device, int, error)
 		offset = 0
 	}
 
-	querySQL := fmt.Sprintf(`
-		SELECT id, provider_name, provider_type, source_id,
-			device_name, os, os_version, model,
-			user_name, user_email, compliance,
-			is_encrypted, jail_broken, is_supervised, threat_state,
-			last_seen, last_synced_at, created_at, updated_at
+	querySQL := fmt.Sprintf(`SELECT `+deviceCols+`
 		FROM devices %s
-		ORDER BY updated_at DESC
-		LIMIT ? OFFSET ?`, whereClause)
+		ORDER BY %s
+		LIMIT ? OFFSET ?`, whereClause, orderClause(f))
 
 	queryArgs := append(args, limit, offset)
 	rows, err := s.db.Query(querySQL, queryArgs...)
@@ -224,22 +634,43 @@ func (s *DeviceStore) List(f models.DeviceFilter) ([]models.Device, int, error)
 
 	var devices []models.Device
 	for rows.Next() {
-		var d models.Device
-		if err := rows.Scan(
-			&d.ID, &d.ProviderName, &d.ProviderType, &d.SourceID,
-			&d.DeviceName, &d.OS, &d.OSVersion, &d.Model,
-			&d.UserName, &d.UserEmail, &d.Compliance,
-			&d.IsEncrypted, &d.JailBroken, &d.IsSupervised, &d.ThreatState,
-			&d.LastSeen, &d.LastSyncedAt, &d.CreatedAt, &d.UpdatedAt,
-		); err != nil {
+		d, err := scanDevice(rows)
+		if err != nil {
 			return nil, 0, fmt.Errorf("scan device: %w", err)
 		}
-		devices = append(devices, d)
+		devices = append(devices, *d)
 	}
 
 	return devices, total, rows.Err()
 }
 
+// ListAll returns every device matching the filter, ignoring Limit and
+// Offset. Used by exports that need the full filtered set.
+func (s *DeviceStore) ListAll(f models.DeviceFilter) ([]models.Device, error) {
+	whereClause, args := filterClause(f)
+
+	order := "device_name"
+	if f.SortBy != "" {
+		order = orderClause(f)
+	}
+
+	rows, err := s.db.Query(`SELECT `+deviceCols+` FROM devices `+whereClause+` ORDER BY `+order, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list all devices: %w", err)
+	}
+	defer rows.Close()
+
+	var devices []models.Device
+	for rows.Next() {
+		d, err := scanDevice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan device: %w", err)
+		}
+		devices = append(devices, *d)
+	}
+	return devices, rows.Err()
+}
+
 // Count returns the total number of devices.
 func (s *DeviceStore) Count() (int, error) {
 	var count int
@@ -247,6 +678,13 @@ func (s *DeviceStore) Count() (int, error) {
 	return count, err
 }
 
+// CountFlagged returns the number of devices flagged for follow-up.
+func (s *DeviceStore) CountFlagged() (int, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM devices WHERE flagged = 1").Scan(&count)
+	return count, err
+}
+
 // CountByProvider returns device counts grouped by provider_name.
 func (s *DeviceStore) CountByProvider() (map[string]int, error) {
 	rows, err := s.db.Query("SELECT provider_name, COUNT(*) FROM devices GROUP BY provider_name")
@@ -267,6 +705,79 @@ func (s *DeviceStore) CountByProvider() (map[string]int, error) {
 	return result, rows.Err()
 }
 
+// ComplianceBreakdown returns device counts keyed by compliance state. The
+// three states ("compliant", "non-compliant", "unknown") are always present,
+// zero when no device is in them.
+func (s *DeviceStore) ComplianceBreakdown() (map[string]int, error) {
+	rows, err := s.db.Query("SELECT compliance, COUNT(*) FROM devices GROUP BY compliance")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := map[string]int{"compliant": 0, "non-compliant": 0, "unknown": 0}
+	for rows.Next() {
+		var state string
+		var count int
+		if err := rows.Scan(&state, &count); err != nil {
+			return nil, err
+		}
+		result[state] = count
+	}
+	return result, rows.Err()
+}
+
+// CountByOwnership returns device counts keyed by ownership. The three
+// values ("corporate", "personal", "unknown") are always present, zero when
+// no device has them.
+func (s *DeviceStore) CountByOwnership() (map[string]int, error) {
+	rows, err := s.db.Query("SELECT ownership, COUNT(*) FROM devices GROUP BY ownership")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := map[string]int{"corporate": 0, "personal": 0, "unknown": 0}
+	for rows.Next() {
+		var ownership string
+		var count int
+		if err := rows.Scan(&ownership, &count); err != nil {
+			return nil, err
+		}
+		result[ownership] = count
+	}
+	return result, rows.Err()
+}
+
+// CountByOS returns device counts grouped by OS. Devices with no OS recorded
+// are counted under "".
+func (s *DeviceStore) CountByOS() (map[string]int, error) {
+	rows, err := s.db.Query("SELECT os, COUNT(*) FROM devices GROUP BY os")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string]int)
+	for rows.Next() {
+		var os string
+		var count int
+		if err := rows.Scan(&os, &count); err != nil {
+			return nil, err
+		}
+		result[os] = count
+	}
+	return result, rows.Err()
+}
+
+// CountStale returns the number of devices last seen before the given time.
+// Devices that have never reported a last-seen time are not counted.
+func (s *DeviceStore) CountStale(before time.Time) (int, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM devices WHERE last_seen IS NOT NULL AND last_seen < ?", before.UTC()).Scan(&count)
+	return count, err
+}
+
 // DistinctProviders returns the list of distinct provider names that have devices.
 func (s *DeviceStore) DistinctProviders() ([]string, error) {
 	rows, err := s.db.Query("SELECT DISTINCT provider_name FROM devices ORDER BY provider_name")
@@ -324,3 +835,67 @@ func (s *DeviceStore) LastSyncByProvider() (map[string]time.Time, error) {
 	}
 	return result, rows.Err()
 }
+
+// AddTag attaches tag to a device. Adding a tag the device already has is
+// not an error.
+func (s *DeviceStore) AddTag(deviceID, tag string) error {
+	_, err := s.db.Exec("INSERT INTO device_tags (device_id, tag) VALUES (?, ?) ON CONFLICT DO NOTHING", deviceID, tag)
+	if err != nil {
+		return fmt.Errorf("add device tag: %w", err)
+	}
+	return nil
+}
+
+// RemoveTag detaches tag from a device. It reports whether the device had
+// the tag.
+func (s *DeviceStore) RemoveTag(deviceID, tag string) (bool, error) {
+	res, err := s.db.Exec("DELETE FROM device_tags WHERE device_id = ? AND tag = ?", deviceID, tag)
+	if err != nil {
+		return false, fmt.Errorf("remove device tag: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// TagsForDevice returns a device's tags in alphabetical order.
+func (s *DeviceStore) TagsForDevice(deviceID string) ([]string, error) {
+	rows, err := s.db.Query("SELECT tag FROM device_tags WHERE device_id = ? ORDER BY tag", deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("list device tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// ListByTag returns every device carrying tag, ordered by name.
+func (s *DeviceStore) ListByTag(tag string) ([]models.Device, error) {
+	return s.ListAll(models.DeviceFilter{Tag: tag})
+}
+
+// DistinctTags returns every tag in use, in alphabetical order.
+func (s *DeviceStore) DistinctTags() ([]string, error) {
+	rows, err := s.db.Query("SELECT DISTINCT tag FROM device_tags ORDER BY tag")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
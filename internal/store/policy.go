@@ -2,7 +2,11 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/dan/moe/internal/models"
 )
@@ -24,10 +28,11 @@ func (s *PolicyStore) CreateSnapshot(snap *models.PolicySnapshot) error {
 		status = models.SnapshotStatusComplete
 	}
 	_, err := s.db.Exec(`
-		INSERT INTO policy_snapshots (id, provider_name, provider_type, label, taken_at, policy_count, category_count, status, status_message)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		INSERT INTO policy_snapshots (id, provider_name, provider_type, label, taken_at, policy_count, category_count, status, status_message, capture_method, coverage_json, is_benchmark, categories_json, cloned_from, failed_resources_json)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		snap.ID, snap.ProviderName, snap.ProviderType, snap.Label, snap.TakenAt, snap.PolicyCount, snap.CategoryCount,
-		status, snap.StatusMessage,
+		status, snap.StatusMessage, snap.CaptureMethod, marshalCoverage(snap.Coverage), snap.IsBenchmark, marshalCategories(snap.Categories), snap.ClonedFrom,
+		marshalFailedResources(snap.FailedResources),
 	)
 	if err != nil {
 		return fmt.Errorf("insert snapshot: %w", err)
@@ -40,19 +45,41 @@ func (s *PolicyStore) UpdateSnapshotCounts(id string) error {
 	_, err := s.db.Exec(`
 		UPDATE policy_snapshots SET
 			policy_count = (SELECT COUNT(*) FROM policy_items WHERE snapshot_id = ?),
-			category_count = (SELECT COUNT(DISTINCT category) FROM policy_items WHERE snapshot_id = ?)
-		WHERE id = ?`, id, id, id)
+			category_count = (SELECT COUNT(DISTINCT category) FROM policy_items WHERE snapshot_id = ?),
+			missing_settings_count = (SELECT COUNT(*) FROM policy_items WHERE snapshot_id = ? AND settings_error != '')
+		WHERE id = ?`, id, id, id, id)
 	return err
 }
 
+// PreviousSnapshotID returns the ID of the newest complete snapshot of the
+// same provider taken before snap, or "" if there is none. Benchmarks and
+// clones are skipped: they aren't captures of the tenant.
+func (s *PolicyStore) PreviousSnapshotID(snap models.PolicySnapshot) (string, error) {
+	var id string
+	err := s.db.QueryRow(`
+		SELECT id FROM policy_snapshots
+		WHERE provider_name = ? AND taken_at < ? AND id != ?
+		AND status = ? AND is_benchmark = 0 AND cloned_from = ''
+		ORDER BY taken_at DESC LIMIT 1`,
+		snap.ProviderName, snap.TakenAt, snap.ID, models.SnapshotStatusComplete).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("previous snapshot: %w", err)
+	}
+	return id, nil
+}
+
 // InsertItem inserts a single policy item into a snapshot.
 func (s *PolicyStore) InsertItem(item *models.PolicyItem) error {
 	_, err := s.db.Exec(`
-		INSERT INTO policy_items (id, snapshot_id, category, source_id, policy_name, policy_type, platform, description, settings_json)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		INSERT INTO policy_items (id, snapshot_id, category, source_id, policy_name, policy_type, platform, description, settings_json, settings_error, severity, scope_tags, setting_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		item.ID, item.SnapshotID, item.Category, item.SourceID,
 		item.PolicyName, item.PolicyType, item.Platform,
-		item.Description, item.SettingsJSON,
+		item.Description, item.SettingsJSON, item.SettingsError, item.Severity, marshalScopeTags(item.ScopeTags),
+		item.SettingCount,
 	)
 	if err != nil {
 		return fmt.Errorf("insert policy item: %w", err)
@@ -63,7 +90,7 @@ func (s *PolicyStore) InsertItem(item *models.PolicyItem) error {
 // ListSnapshots returns all snapshots ordered by most recent first.
 func (s *PolicyStore) ListSnapshots() ([]models.PolicySnapshot, error) {
 	rows, err := s.db.Query(`
-		SELECT id, provider_name, provider_type, label, taken_at, policy_count, category_count, status, status_message
+		SELECT id, provider_name, provider_type, label, taken_at, policy_count, category_count, status, status_message, missing_settings_count, capture_method, coverage_json, is_benchmark, categories_json, cloned_from, failed_resources_json
 		FROM policy_snapshots ORDER BY taken_at DESC`)
 	if err != nil {
 		return nil, fmt.Errorf("list snapshots: %w", err)
@@ -73,11 +100,17 @@ func (s *PolicyStore) ListSnapshots() ([]models.PolicySnapshot, error) {
 	var snapshots []models.PolicySnapshot
 	for rows.Next() {
 		var snap models.PolicySnapshot
+		var coverage, categories string
+		var failed sql.NullString
 		if err := rows.Scan(&snap.ID, &snap.ProviderName, &snap.ProviderType,
 			&snap.Label, &snap.TakenAt, &snap.PolicyCount, &snap.CategoryCount,
-			&snap.Status, &snap.StatusMessage); err != nil {
+			&snap.Status, &snap.StatusMessage, &snap.MissingSettingsCount, &snap.CaptureMethod, &coverage, &snap.IsBenchmark, &categories, &snap.ClonedFrom,
+			&failed); err != nil {
 			return nil, fmt.Errorf("scan snapshot: %w", err)
 		}
+		snap.Coverage = unmarshalCoverage(coverage)
+		snap.Categories = unmarshalCategories(categories)
+		snap.FailedResources = unmarshalFailedResources(failed)
 		snapshots = append(snapshots, snap)
 	}
 	if snapshots == nil {
@@ -89,18 +122,24 @@ func (s *PolicyStore) ListSnapshots() ([]models.PolicySnapshot, error) {
 // GetSnapshot returns a single snapshot by ID.
 func (s *PolicyStore) GetSnapshot(id string) (*models.PolicySnapshot, error) {
 	var snap models.PolicySnapshot
+	var coverage, categories string
+	var failed sql.NullString
 	err := s.db.QueryRow(`
-		SELECT id, provider_name, provider_type, label, taken_at, policy_count, category_count, status, status_message
+		SELECT id, provider_name, provider_type, label, taken_at, policy_count, category_count, status, status_message, missing_settings_count, capture_method, coverage_json, is_benchmark, categories_json, cloned_from, failed_resources_json
 		FROM policy_snapshots WHERE id = ?`, id,
 	).Scan(&snap.ID, &snap.ProviderName, &snap.ProviderType,
 		&snap.Label, &snap.TakenAt, &snap.PolicyCount, &snap.CategoryCount,
-		&snap.Status, &snap.StatusMessage)
+		&snap.Status, &snap.StatusMessage, &snap.MissingSettingsCount, &snap.CaptureMethod, &coverage, &snap.IsBenchmark, &categories, &snap.ClonedFrom,
+		&failed)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("get snapshot: %w", err)
 	}
+	snap.Coverage = unmarshalCoverage(coverage)
+	snap.Categories = unmarshalCategories(categories)
+	snap.FailedResources = unmarshalFailedResources(failed)
 	return &snap, nil
 }
 
@@ -111,6 +150,125 @@ func (s *PolicyStore) UpdateSnapshotStatus(id, status, message string) error {
 	return err
 }
 
+// UpdateSnapshotLabel sets a snapshot's user-supplied label.
+func (s *PolicyStore) UpdateSnapshotLabel(id, label string) error {
+	_, err := s.db.Exec(`UPDATE policy_snapshots SET label = ? WHERE id = ?`, label, id)
+	return err
+}
+
+// SetSnapshotProvenance records how a snapshot's policies were fetched, the
+// per-category capture results, and the resource types a partial capture
+// could not fetch.
+func (s *PolicyStore) SetSnapshotProvenance(id, method string, coverage []models.CategoryCoverage, failedResources []string) error {
+	_, err := s.db.Exec(`UPDATE policy_snapshots SET capture_method = ?, coverage_json = ?, failed_resources_json = ? WHERE id = ?`,
+		method, marshalCoverage(coverage), marshalFailedResources(failedResources), id)
+	return err
+}
+
+// marshalCoverage encodes snapshot coverage for the coverage_json column;
+// nil is stored as "".
+func marshalCoverage(coverage []models.CategoryCoverage) string {
+	if coverage == nil {
+		return ""
+	}
+	b, err := json.Marshal(coverage)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// unmarshalCoverage decodes the coverage_json column. An empty or
+// unreadable value yields nil (coverage unknown).
+func unmarshalCoverage(s string) []models.CategoryCoverage {
+	if s == "" {
+		return nil
+	}
+	var coverage []models.CategoryCoverage
+	if err := json.Unmarshal([]byte(s), &coverage); err != nil {
+		return nil
+	}
+	return coverage
+}
+
+// marshalCategories encodes a capture's category selection for the
+// categories_json column; an empty selection is stored as "".
+func marshalCategories(categories []string) string {
+	if len(categories) == 0 {
+		return ""
+	}
+	b, err := json.Marshal(categories)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// unmarshalCategories decodes the categories_json column. An empty or
+// unreadable value yields nil (every category).
+func unmarshalCategories(s string) []string {
+	if s == "" {
+		return nil
+	}
+	var categories []string
+	if err := json.Unmarshal([]byte(s), &categories); err != nil {
+		return nil
+	}
+	return categories
+}
+
+// marshalScopeTags encodes a policy's scope tags for the scope_tags column;
+// none is stored as "".
+func marshalScopeTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	b, err := json.Marshal(tags)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// unmarshalScopeTags decodes the scope_tags column. An empty or unreadable
+// value yields nil.
+func unmarshalScopeTags(s string) []string {
+	if s == "" {
+		return nil
+	}
+	var tags []string
+	if err := json.Unmarshal([]byte(s), &tags); err != nil {
+		return nil
+	}
+	return tags
+}
+
+// marshalFailedResources encodes a partial capture's failed resource types
+// for the nullable failed_resources_json column; none is stored as NULL.
+func marshalFailedResources(failed []string) sql.NullString {
+	if len(failed) == 0 {
+		return sql.NullString{}
+	}
+	b, err := json.Marshal(failed)
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(b), Valid: true}
+}
+
+// unmarshalFailedResources decodes the failed_resources_json column. NULL
+// or an unreadable value yields nil (no known failures).
+func unmarshalFailedResources(s sql.NullString) []string {
+	if !s.Valid {
+		return nil
+	}
+	var failed []string
+	if err := json.Unmarshal([]byte(s.String), &failed); err != nil {
+		return nil
+	}
+	return failed
+}
+
 // ResetSnapshotForRetry clears a snapshot's items and resets it to "capturing" status
 // with a fresh timestamp so it can be re-captured.
 func (s *PolicyStore) ResetSnapshotForRetry(id string) error {
@@ -118,7 +276,7 @@ func (s *PolicyStore) ResetSnapshotForRetry(id string) error {
 		return fmt.Errorf("clear items for retry: %w", err)
 	}
 	_, err := s.db.Exec(
-		`UPDATE policy_snapshots SET status = 'capturing', status_message = '', policy_count = 0, category_count = 0, taken_at = datetime('now') WHERE id = ?`,
+		`UPDATE policy_snapshots SET status = 'capturing', status_message = '', policy_count = 0, category_count = 0, missing_settings_count = 0, capture_method = '', coverage_json = '', failed_resources_json = NULL, taken_at = datetime('now') WHERE id = ?`,
 		id)
 	if err != nil {
 		return fmt.Errorf("reset snapshot for retry: %w", err)
@@ -126,12 +284,12 @@ func (s *PolicyStore) ResetSnapshotForRetry(id string) error {
 	return nil
 }
 
-// RecoverStaleCapturing marks any snapshots still in "capturing" status as "error".
+// RecoverStaleCapturing marks any snapshots still "queued" or "capturing" as "error".
 // This is called on startup to clean up snapshots interrupted by a previous crash/stop.
 // Returns the number of rows affected.
 func (s *PolicyStore) RecoverStaleCapturing(message string) (int, error) {
 	result, err := s.db.Exec(
-		`UPDATE policy_snapshots SET status = 'error', status_message = ? WHERE status = 'capturing'`,
+		`UPDATE policy_snapshots SET status = 'error', status_message = ? WHERE status IN ('queued', 'capturing')`,
 		message)
 	if err != nil {
 		return 0, fmt.Errorf("recover stale capturing: %w", err)
@@ -152,9 +310,10 @@ func (s *PolicyStore) DeleteSnapshot(id string) error {
 	return nil
 }
 
-// ListItems returns all policy items for a snapshot, optionally filtered.
-func (s *PolicyStore) ListItems(snapshotID, category, search string) ([]models.PolicyItem, error) {
-	query := "SELECT id, snapshot_id, category, source_id, policy_name, policy_type, platform, description, settings_json FROM policy_items WHERE snapshot_id = ?"
+// ListItems returns all policy items for a snapshot, optionally filtered by
+// category, a name/description/type search, and a scope tag name.
+func (s *PolicyStore) ListItems(snapshotID, category, search, scopeTag string) ([]models.PolicyItem, error) {
+	query := "SELECT id, snapshot_id, category, source_id, policy_name, policy_type, platform, description, settings_json, settings_error, severity, scope_tags, COALESCE(setting_count, 0) FROM policy_items WHERE snapshot_id = ?"
 	args := []any{snapshotID}
 
 	if category != "" {
@@ -166,6 +325,10 @@ func (s *PolicyStore) ListItems(snapshotID, category, search string) ([]models.P
 		q := "%" + search + "%"
 		args = append(args, q, q, q)
 	}
+	if scopeTag != "" {
+		query += " AND EXISTS (SELECT 1 FROM json_each(NULLIF(scope_tags, '')) WHERE value = ?)"
+		args = append(args, scopeTag)
+	}
 
 	query += " ORDER BY category, policy_name"
 
@@ -178,11 +341,14 @@ func (s *PolicyStore) ListItems(snapshotID, category, search string) ([]models.P
 	var items []models.PolicyItem
 	for rows.Next() {
 		var item models.PolicyItem
+		var scopeTags string
 		if err := rows.Scan(&item.ID, &item.SnapshotID, &item.Category, &item.SourceID,
 			&item.PolicyName, &item.PolicyType, &item.Platform,
-			&item.Description, &item.SettingsJSON); err != nil {
+			&item.Description, &item.SettingsJSON, &item.SettingsError, &item.Severity, &scopeTags,
+			&item.SettingCount); err != nil {
 			return nil, fmt.Errorf("scan policy item: %w", err)
 		}
+		item.ScopeTags = unmarshalScopeTags(scopeTags)
 		items = append(items, item)
 	}
 	if items == nil {
@@ -191,6 +357,66 @@ func (s *PolicyStore) ListItems(snapshotID, category, search string) ([]models.P
 	return items, rows.Err()
 }
 
+// GetItem returns a policy item by ID, or nil if it doesn't exist.
+func (s *PolicyStore) GetItem(id string) (*models.PolicyItem, error) {
+	var item models.PolicyItem
+	var scopeTags string
+	err := s.db.QueryRow(`SELECT id, snapshot_id, category, source_id, policy_name, policy_type, platform, description, settings_json, settings_error, severity, scope_tags, COALESCE(setting_count, 0)
+		FROM policy_items WHERE id = ?`, id).Scan(&item.ID, &item.SnapshotID, &item.Category, &item.SourceID,
+		&item.PolicyName, &item.PolicyType, &item.Platform,
+		&item.Description, &item.SettingsJSON, &item.SettingsError, &item.Severity, &scopeTags,
+		&item.SettingCount)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get policy item: %w", err)
+	}
+	item.ScopeTags = unmarshalScopeTags(scopeTags)
+	return &item, nil
+}
+
+// BackfillSettingCounts stores setting_count, as computed by count from the
+// settings JSON, for items stored before the column existed. It is cheap to
+// call when there is nothing to do.
+func (s *PolicyStore) BackfillSettingCounts(count func(settingsJSON string) int) (int, error) {
+	rows, err := s.db.Query(`SELECT id, settings_json FROM policy_items WHERE setting_count IS NULL`)
+	if err != nil {
+		return 0, fmt.Errorf("backfill setting counts: %w", err)
+	}
+	counts := map[string]int{}
+	for rows.Next() {
+		var id, settings string
+		if err := rows.Scan(&id, &settings); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("backfill setting counts: %w", err)
+		}
+		counts[id] = count(settings)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("backfill setting counts: %w", err)
+	}
+	if len(counts) == 0 {
+		return 0, nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("backfill setting counts: %w", err)
+	}
+	defer tx.Rollback()
+	for id, n := range counts {
+		if _, err := tx.Exec(`UPDATE policy_items SET setting_count = ? WHERE id = ?`, n, id); err != nil {
+			return 0, fmt.Errorf("backfill setting counts: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("backfill setting counts: %w", err)
+	}
+	return len(counts), nil
+}
+
 // DistinctCategories returns the unique categories in a snapshot.
 func (s *PolicyStore) DistinctCategories(snapshotID string) ([]string, error) {
 	rows, err := s.db.Query(
@@ -215,6 +441,27 @@ func (s *PolicyStore) DistinctCategories(snapshotID string) ([]string, error) {
 	return cats, rows.Err()
 }
 
+// CountByPlatform returns how many policies in a snapshot target each
+// platform. Policies with no platform are counted under "".
+func (s *PolicyStore) CountByPlatform(snapshotID string) (map[string]int, error) {
+	rows, err := s.db.Query("SELECT platform, COUNT(*) FROM policy_items WHERE snapshot_id = ? GROUP BY platform", snapshotID)
+	if err != nil {
+		return nil, fmt.Errorf("count policies by platform: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string]int)
+	for rows.Next() {
+		var platform string
+		var count int
+		if err := rows.Scan(&platform, &count); err != nil {
+			return nil, fmt.Errorf("count policies by platform: %w", err)
+		}
+		result[platform] = count
+	}
+	return result, rows.Err()
+}
+
 // SnapshotExists checks if a snapshot with given ID exists.
 func (s *PolicyStore) SnapshotExists(id string) (bool, error) {
 	var exists bool
@@ -222,47 +469,155 @@ func (s *PolicyStore) SnapshotExists(id string) (bool, error) {
 	return exists, err
 }
 
-// DeleteOldSnapshots keeps only the N most recent snapshots per provider and deletes older ones.
-func (s *PolicyStore) DeleteOldSnapshots(keepPerProvider int) error {
-	// Get all provider names that have snapshots
-	rows, err := s.db.Query("SELECT DISTINCT provider_name FROM policy_snapshots")
+// DeleteOldSnapshots keeps only the most recent snapshots per provider and deletes
+// older ones. Providers with a snapshot_retention override keep that many;
+// all others keep defaultKeep. Benchmarks and clones are never pruned and
+// don't count towards a provider's retention.
+func (s *PolicyStore) DeleteOldSnapshots(defaultKeep int) error {
+	// Get all provider names that have snapshots, with any per-provider override
+	rows, err := s.db.Query(`
+		SELECT DISTINCT ps.provider_name, COALESCE(pc.snapshot_retention, 0)
+		FROM policy_snapshots ps
+		LEFT JOIN provider_configs pc ON pc.name = ps.provider_name
+		WHERE ps.is_benchmark = 0 AND ps.cloned_from = ''`)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 
+	keep := make(map[string]int)
 	var providers []string
 	for rows.Next() {
 		var name string
-		if err := rows.Scan(&name); err != nil {
+		var override int
+		if err := rows.Scan(&name, &override); err != nil {
 			return err
 		}
+		if override <= 0 {
+			override = defaultKeep
+		}
+		keep[name] = override
 		providers = append(providers, name)
 	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
 
 	for _, prov := range providers {
 		_, err := s.db.Exec(`
 			DELETE FROM policy_items WHERE snapshot_id IN (
 				SELECT id FROM policy_snapshots
-				WHERE provider_name = ?
-				ORDER BY taken_at DESC
-				LIMIT -1 OFFSET ?
-			)`, prov, keepPerProvider)
+				WHERE provider_name = ? AND is_benchmark = 0 AND cloned_from = ''
+				AND id NOT IN (
+					SELECT id FROM policy_snapshots
+					WHERE provider_name = ? AND is_benchmark = 0 AND cloned_from = ''
+					ORDER BY taken_at DESC
+					LIMIT ?
+				)
+			)`, prov, prov, keep[prov])
 		if err != nil {
 			return err
 		}
 		_, err = s.db.Exec(`
 			DELETE FROM policy_snapshots
-			WHERE provider_name = ?
+			WHERE provider_name = ? AND is_benchmark = 0 AND cloned_from = ''
 			AND id NOT IN (
 				SELECT id FROM policy_snapshots
-				WHERE provider_name = ?
+				WHERE provider_name = ? AND is_benchmark = 0 AND cloned_from = ''
 				ORDER BY taken_at DESC
 				LIMIT ?
-			)`, prov, prov, keepPerProvider)
+			)`, prov, prov, keep[prov])
 		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// maxSettingHits caps SearchSettings results so a broad query can't return
+// every setting in the database.
+const maxSettingHits = 500
+
+// SearchSettings finds settings whose name or value contains query
+// (case-insensitive) across every snapshot, newest snapshot first. Candidate
+// policies come from the policy_items_fts trigram index; queries shorter than
+// three characters, which trigrams can't match, fall back to a LIKE scan.
+// Matching individual settings within each candidate is done here.
+func (s *PolicyStore) SearchSettings(query string) ([]models.SettingHit, error) {
+	query = strings.TrimSpace(query)
+	hits := []models.SettingHit{}
+	if query == "" {
+		return hits, nil
+	}
+
+	const cols = `SELECT pi.snapshot_id, ps.label, ps.provider_name, ps.taken_at,
+		pi.policy_name, pi.category, pi.settings_json
+		FROM policy_items pi JOIN policy_snapshots ps ON ps.id = pi.snapshot_id`
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	if utf8.RuneCountInString(query) >= 3 {
+		// Quote as an FTS5 string so operators in the query are literal.
+		phrase := `"` + strings.ReplaceAll(query, `"`, `""`) + `"`
+		rows, err = s.db.Query(cols+`
+			WHERE pi.rowid IN (SELECT rowid FROM policy_items_fts WHERE policy_items_fts MATCH ?)
+			ORDER BY ps.taken_at DESC, pi.policy_name`, phrase)
+	} else {
+		rows, err = s.db.Query(cols+`
+			WHERE pi.settings_json LIKE ?
+			ORDER BY ps.taken_at DESC, pi.policy_name`, "%"+query+"%")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("search settings: %w", err)
+	}
+	defer rows.Close()
+
+	needle := strings.ToLower(query)
+	for rows.Next() {
+		var hit models.SettingHit
+		var settingsJSON string
+		if err := rows.Scan(&hit.SnapshotID, &hit.SnapshotLabel, &hit.ProviderName, &hit.TakenAt,
+			&hit.PolicyName, &hit.Category, &settingsJSON); err != nil {
+			return nil, fmt.Errorf("scan setting hit: %w", err)
+		}
+
+		var settings map[string]any
+		if err := json.Unmarshal([]byte(settingsJSON), &settings); err != nil {
+			continue
+		}
+		names := make([]string, 0, len(settings))
+		for k := range settings {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			value := settingText(settings[name])
+			if !strings.Contains(strings.ToLower(name), needle) && !strings.Contains(strings.ToLower(value), needle) {
+				continue
+			}
+			h := hit
+			h.Setting, h.Value = name, value
+			hits = append(hits, h)
+			if len(hits) >= maxSettingHits {
+				return hits, nil
+			}
+		}
+	}
+	return hits, rows.Err()
+}
+
+// settingText renders a settings_json value for search matching and display.
+func settingText(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	default:
+		b, _ := json.Marshal(val)
+		return string(b)
+	}
+}
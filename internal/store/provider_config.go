@@ -20,20 +20,20 @@ func NewProviderConfigStore(db *sql.DB) *ProviderConfigStore {
 }
 
 // column list shared by all SELECT queries.
-const providerCols = `id, name, type, base_url, tenant_id, client_id, client_secret,
-	username, password, sync_interval, enabled,
-	last_check_at, last_check_ok, last_check_err, last_sync_at, consec_fails,
-	created_at, updated_at`
+const providerCols = `id, name, type, base_url, tenant_id, client_id, client_secret, cloud,
+	username, password, sync_interval, enabled, snapshot_retention, health_interval, sync_page_size, sync_filter,
+	last_check_at, last_check_ok, last_check_err, last_sync_at, consec_fails, silenced_until,
+	last_error, last_error_at, created_at, updated_at`
 
 // scanProvider scans a full row into a ProviderConfig.
 func scanProvider(sc interface{ Scan(...any) error }) (*models.ProviderConfig, error) {
 	p := &models.ProviderConfig{}
-	var lastCheckAt, lastSyncAt string
+	var lastCheckAt, lastSyncAt, silencedUntil, lastErrorAt string
 	err := sc.Scan(
-		&p.ID, &p.Name, &p.Type, &p.BaseURL, &p.TenantID, &p.ClientID, &p.ClientSecret,
-		&p.Username, &p.Password, &p.SyncInterval, &p.Enabled,
-		&lastCheckAt, &p.LastCheckOK, &p.LastCheckErr, &lastSyncAt, &p.ConsecFails,
-		&p.CreatedAt, &p.UpdatedAt,
+		&p.ID, &p.Name, &p.Type, &p.BaseURL, &p.TenantID, &p.ClientID, &p.ClientSecret, &p.Cloud,
+		&p.Username, &p.Password, &p.SyncInterval, &p.Enabled, &p.SnapshotRetention, &p.HealthInterval, &p.SyncPageSize, &p.SyncFilter,
+		&lastCheckAt, &p.LastCheckOK, &p.LastCheckErr, &lastSyncAt, &p.ConsecFails, &silencedUntil,
+		&p.LastError, &lastErrorAt, &p.CreatedAt, &p.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -44,6 +44,12 @@ func scanProvider(sc interface{ Scan(...any) error }) (*models.ProviderConfig, e
 	if lastSyncAt != "" {
 		p.LastSyncAt, _ = time.Parse(time.RFC3339, lastSyncAt)
 	}
+	if silencedUntil != "" {
+		p.SilencedUntil, _ = time.Parse(time.RFC3339, silencedUntil)
+	}
+	if lastErrorAt != "" {
+		p.LastErrorAt, _ = time.Parse(time.RFC3339, lastErrorAt)
+	}
 	return p, nil
 }
 
@@ -54,9 +60,9 @@ func (s *ProviderConfigStore) Create(p *models.ProviderConfig) error {
 	p.UpdatedAt = now
 
 	_, err := s.db.Exec(`
-		INSERT INTO provider_configs (id, name, type, base_url, tenant_id, client_id, client_secret, username, password, sync_interval, enabled, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		p.ID, p.Name, p.Type, p.BaseURL, p.TenantID, p.ClientID, p.ClientSecret, p.Username, p.Password, p.SyncInterval, p.Enabled, p.CreatedAt, p.UpdatedAt,
+		INSERT INTO provider_configs (id, name, type, base_url, tenant_id, client_id, client_secret, cloud, username, password, sync_interval, enabled, snapshot_retention, health_interval, sync_page_size, sync_filter, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.ID, p.Name, p.Type, p.BaseURL, p.TenantID, p.ClientID, p.ClientSecret, p.Cloud, p.Username, p.Password, p.SyncInterval, p.Enabled, p.SnapshotRetention, p.HealthInterval, p.SyncPageSize, p.SyncFilter, p.CreatedAt, p.UpdatedAt,
 	)
 	if err != nil {
 		if strings.Contains(err.Error(), "UNIQUE constraint") {
@@ -100,14 +106,14 @@ func (s *ProviderConfigStore) Update(p *models.ProviderConfig) error {
 	res, err := s.db.Exec(`
 		UPDATE provider_configs SET
 			name = ?, type = ?, base_url = ?, tenant_id = ?,
-			client_id = ?, client_secret = ?,
+			client_id = ?, client_secret = ?, cloud = ?,
 			username = ?, password = ?,
-			sync_interval = ?, enabled = ?, updated_at = ?
+			sync_interval = ?, enabled = ?, snapshot_retention = ?, health_interval = ?, sync_page_size = ?, sync_filter = ?, updated_at = ?
 		WHERE id = ?`,
 		p.Name, p.Type, p.BaseURL, p.TenantID,
-		p.ClientID, p.ClientSecret,
+		p.ClientID, p.ClientSecret, p.Cloud,
 		p.Username, p.Password,
-		p.SyncInterval, p.Enabled, p.UpdatedAt, p.ID,
+		p.SyncInterval, p.Enabled, p.SnapshotRetention, p.HealthInterval, p.SyncPageSize, p.SyncFilter, p.UpdatedAt, p.ID,
 	)
 	if err != nil {
 		return fmt.Errorf("update provider config: %w", err)
@@ -135,15 +141,40 @@ func (s *ProviderConfigStore) SetEnabled(id string, enabled bool) error {
 	return nil
 }
 
-// RecordCheckResult persists the outcome of a health check.
+// SetSilencedUntil sets or clears (zero time) a provider's alert silence window.
+func (s *ProviderConfigStore) SetSilencedUntil(id string, until time.Time) error {
+	var val string
+	if !until.IsZero() {
+		val = until.UTC().Format(time.RFC3339)
+	}
+	res, err := s.db.Exec(
+		`UPDATE provider_configs SET silenced_until = ?, updated_at = ? WHERE id = ?`,
+		val, time.Now().UTC(), id,
+	)
+	if err != nil {
+		return fmt.Errorf("set silenced until: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return fmt.Errorf("provider config not found: %s", id)
+	}
+	return nil
+}
+
+// RecordCheckResult persists the outcome of a health check. A failure is
+// also kept as the provider's last error, which a later success leaves alone.
 func (s *ProviderConfigStore) RecordCheckResult(name string, ok bool, errMsg string, consecFails int) error {
-	_, err := s.db.Exec(`
+	now := time.Now().UTC()
+	query := `
 		UPDATE provider_configs SET
 			last_check_at = ?, last_check_ok = ?, last_check_err = ?,
-			consec_fails = ?, updated_at = ?
-		WHERE name = ?`,
-		time.Now().UTC().Format(time.RFC3339), ok, errMsg, consecFails, time.Now().UTC(), name,
-	)
+			consec_fails = ?, updated_at = ?`
+	args := []any{now.Format(time.RFC3339), ok, errMsg, consecFails, now}
+	if !ok {
+		query += `, last_error = ?, last_error_at = ?`
+		args = append(args, errMsg, now.Format(time.RFC3339))
+	}
+	_, err := s.db.Exec(query+` WHERE name = ?`, append(args, name)...)
 	if err != nil {
 		return fmt.Errorf("record check result: %w", err)
 	}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SettingsStore handles persistence for app-level key/value settings.
+type SettingsStore struct {
+	db *sql.DB
+}
+
+// NewSettingsStore creates a SettingsStore.
+func NewSettingsStore(db *sql.DB) *SettingsStore {
+	return &SettingsStore{db: db}
+}
+
+// Get returns the value for key, or "" if the key is not set.
+func (s *SettingsStore) Get(key string) (string, error) {
+	var v string
+	err := s.db.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&v)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("get setting %s: %w", key, err)
+	}
+	return v, nil
+}
+
+// Set stores value for key, replacing any existing value.
+func (s *SettingsStore) Set(key, value string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO settings (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value`,
+		key, value,
+	)
+	if err != nil {
+		return fmt.Errorf("set setting %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/dan/moe/internal/models"
+)
+
+// maxSyncRunsPerProvider bounds the sync history kept for each provider.
+const maxSyncRunsPerProvider = 200
+
+// SyncRunStore handles persistence for device sync history.
+type SyncRunStore struct {
+	db *sql.DB
+}
+
+// NewSyncRunStore creates a SyncRunStore.
+func NewSyncRunStore(db *sql.DB) *SyncRunStore {
+	return &SyncRunStore{db: db}
+}
+
+// Create records a finished sync run and prunes the provider's history to
+// the most recent maxSyncRunsPerProvider runs.
+func (s *SyncRunStore) Create(run *models.SyncRun) error {
+	run.DurationMS = run.FinishedAt.Sub(run.StartedAt).Milliseconds()
+	_, err := s.db.Exec(`
+		INSERT INTO sync_runs (id, provider_name, started_at, finished_at, device_count, error)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		run.ID, run.ProviderName, run.StartedAt, run.FinishedAt, run.DeviceCount, run.Error,
+	)
+	if err != nil {
+		return fmt.Errorf("insert sync run: %w", err)
+	}
+
+	_, err = s.db.Exec(`
+		DELETE FROM sync_runs WHERE provider_name = ? AND id NOT IN (
+			SELECT id FROM sync_runs WHERE provider_name = ?
+			ORDER BY started_at DESC LIMIT ?
+		)`, run.ProviderName, run.ProviderName, maxSyncRunsPerProvider)
+	if err != nil {
+		return fmt.Errorf("prune sync runs: %w", err)
+	}
+	return nil
+}
+
+// List returns a provider's most recent sync runs, newest first. A limit of
+// zero or less returns the full retained history.
+func (s *SyncRunStore) List(provider string, limit int) ([]models.SyncRun, error) {
+	if limit <= 0 {
+		limit = maxSyncRunsPerProvider
+	}
+	rows, err := s.db.Query(`
+		SELECT id, provider_name, started_at, finished_at, device_count, error
+		FROM sync_runs WHERE provider_name = ?
+		ORDER BY started_at DESC LIMIT ?`, provider, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list sync runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []models.SyncRun
+	for rows.Next() {
+		var r models.SyncRun
+		if err := rows.Scan(&r.ID, &r.ProviderName, &r.StartedAt, &r.FinishedAt, &r.DeviceCount, &r.Error); err != nil {
+			return nil, fmt.Errorf("scan sync run: %w", err)
+		}
+		r.DurationMS = r.FinishedAt.Sub(r.StartedAt).Milliseconds()
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
@@ -40,3 +40,409 @@ function toastManager() {
         }
     };
 }
+
+// ── Device bulk selection (Alpine.js component) ─────────────────────────
+// Keyboard: j/k or ↓/↑ move between rows, Space toggles the focused row,
+// Shift+A selects every visible row, Escape clears the selection.
+function deviceSelection() {
+    return {
+        selected: [],
+        busy: false,
+
+        boxes() {
+            return Array.prototype.slice.call(document.querySelectorAll("#device-rows .device-select"));
+        },
+
+        get allSelected() {
+            var boxes = this.boxes();
+            return boxes.length > 0 && this.selected.length === boxes.length;
+        },
+
+        toggleAll() {
+            this.selected = this.allSelected ? [] : this.boxes().map(function(b) { return b.value; });
+        },
+
+        onKey(e) {
+            if (e.target.matches("input[type=text], select")) return;
+            var boxes = this.boxes();
+            var i = boxes.indexOf(document.activeElement);
+            if (e.key === "j" || e.key === "ArrowDown") {
+                e.preventDefault();
+                if (boxes.length) boxes[Math.min(i + 1, boxes.length - 1)].focus();
+            } else if (e.key === "k" || e.key === "ArrowUp") {
+                e.preventDefault();
+                if (boxes.length) boxes[Math.max(i - 1, 0)].focus();
+            } else if (e.key === "A" && e.shiftKey) {
+                e.preventDefault();
+                this.selected = boxes.map(function(b) { return b.value; });
+            } else if (e.key === "Escape") {
+                this.selected = [];
+            }
+        },
+
+        // apply runs a bulk action; arg is the command for "command" and
+        // the tag for "tag".
+        apply(action, arg) {
+            if (!this.selected.length || this.busy) return;
+            var n = this.selected.length;
+            if (action === "delete" && !confirm("Delete " + n + " device" + (n === 1 ? "" : "s") + "?")) return;
+            if (action === "tag" && !arg.trim()) return;
+            var body = { action: action, ids: this.selected };
+            if (action === "command") body.command = arg;
+            if (action === "tag") body.tag = arg;
+            this.busy = true;
+            var self = this;
+            fetch("/api/v1/devices/bulk", {
+                method: "POST",
+                headers: { "Content-Type": "application/json" },
+                body: JSON.stringify(body)
+            }).then(function(r) { return r.json(); }).then(function(res) {
+                var msg, type;
+                if (!res.ok) {
+                    msg = res.error; type = "error";
+                } else {
+                    var verb = action === "delete" ? "Deleted" : action === "tag" ? "Tagged" : "Sent " + arg + " to";
+                    msg = verb + " " + res.data.succeeded + " of " + n + " devices";
+                    type = res.data.failed ? "error" : "success";
+                }
+                window.location = "/devices?flash=" + encodeURIComponent(msg) + "&flash_type=" + type;
+            }).catch(function() {
+                self.busy = false;
+            });
+        }
+    };
+}
+
+// ── Policy settings (Alpine.js component) ───────────────────────────────
+// A policy in the snapshot view shows its stored setting count until it is
+// first expanded, when its flattened settings are fetched.
+function policySettings(itemId) {
+    return {
+        open: false,
+        settings: null,
+        loading: false,
+        error: "",
+
+        load() {
+            if (this.settings || this.loading) return;
+            var self = this;
+            this.loading = true;
+            this.error = "";
+            fetch("/api/v1/policies/items/" + encodeURIComponent(itemId) + "/settings")
+                .then(function(r) { return r.json(); })
+                .then(function(res) {
+                    self.loading = false;
+                    if (res.ok) self.settings = res.data.settings;
+                    else self.error = res.error;
+                })
+                .catch(function() {
+                    self.loading = false;
+                    self.error = "Could not load settings";
+                });
+        }
+    };
+}
+
+// ── Single-policy diff (Alpine.js component) ────────────────────────────
+// "Compare with…" on a policy in the snapshot view: pick any snapshot, then
+// any policy in it, and the setting diff is shown inline. A policy with the
+// same name is preselected. The snapshot list is fetched once per page.
+var policyDiffSnapshots = null;
+
+function policyDiff(itemId, policyName, snapshotId) {
+    return {
+        open: false,
+        snapshots: [],
+        snapshotId: snapshotId,
+        items: [],
+        againstId: "",
+        result: null,
+        error: "",
+        onlyChanged: true,
+
+        start() {
+            this.open = true;
+            var self = this;
+            if (!policyDiffSnapshots) {
+                policyDiffSnapshots = fetch("/api/v1/policies/snapshots")
+                    .then(function(r) { return r.json(); })
+                    .then(function(res) { return res.ok ? res.data.filter(function(s) { return s.status === "complete"; }) : []; });
+            }
+            policyDiffSnapshots.then(function(list) {
+                self.snapshots = list;
+                self.loadItems();
+            });
+        },
+
+        snapshotLabel(s) {
+            return (s.label || s.provider_name) + " — " + new Date(s.taken_at).toLocaleString();
+        },
+
+        loadItems() {
+            var self = this;
+            this.items = [];
+            this.againstId = "";
+            this.result = null;
+            fetch("/api/v1/policies/snapshots/" + encodeURIComponent(this.snapshotId) + "/items")
+                .then(function(r) { return r.json(); })
+                .then(function(res) {
+                    if (!res.ok) { self.error = res.error; return; }
+                    self.items = res.data.items.filter(function(i) { return i.id !== itemId; });
+                    var same = self.items.find(function(i) { return i.policy_name === policyName; });
+                    if (same) {
+                        self.againstId = same.id;
+                        self.run();
+                    }
+                });
+        },
+
+        run() {
+            var self = this;
+            this.error = "";
+            this.result = null;
+            if (!this.againstId) return;
+            fetch("/api/v1/policies/items/" + encodeURIComponent(itemId) + "/diff?against=" + encodeURIComponent(this.againstId))
+                .then(function(r) { return r.json(); })
+                .then(function(res) {
+                    if (res.ok) self.result = res.data;
+                    else self.error = res.error;
+                });
+        },
+
+        get rows() {
+            if (!this.result) return [];
+            if (!this.onlyChanged) return this.result.settings;
+            return this.result.settings.filter(function(s) { return s.Changed; });
+        }
+    };
+}
+
+// ── Console live feed ───────────────────────────────────────────────────
+// New activity events arrive over Server-Sent Events as rendered rows. The
+// browser reconnects on its own after a drop, sending the last event ID so
+// the server replays what was missed. Changing the provider or type filter
+// re-fetches the rows and reopens the stream with the same filter.
+(function() {
+    var log = document.getElementById("event-log");
+    if (!log) return;
+    var filters = document.getElementById("event-filters");
+    var limit = parseInt(log.dataset.limit, 10) || 100;
+    var source = null;
+
+    function filterQuery() {
+        var q = new URLSearchParams();
+        new FormData(filters).forEach(function(v, k) { if (v) q.set(k, v); });
+        return q;
+    }
+
+    function updateCount() {
+        var tbody = log.querySelector("tbody");
+        var count = document.getElementById("event-count");
+        if (count && tbody) count.textContent = tbody.querySelectorAll("tr:not(.event-empty)").length + " events";
+    }
+
+    function connect() {
+        if (source) source.close();
+        var table = log.querySelector("table");
+        if (!window.EventSource || !table) return;
+        var q = filterQuery();
+        q.set("seq", table.dataset.seq);
+        source = new EventSource("/console/stream?" + q);
+        source.onmessage = function(e) {
+            var tbody = log.querySelector("tbody");
+            if (!tbody) return;
+            var empty = tbody.querySelector(".event-empty");
+            if (empty) empty.remove();
+            tbody.insertAdjacentHTML("afterbegin", e.data);
+            while (tbody.rows.length > limit) tbody.deleteRow(-1);
+            updateCount();
+        };
+    }
+
+    if (filters) {
+        filters.addEventListener("change", function() {
+            var q = filterQuery();
+            var url = new URL(window.location);
+            url.search = q.toString();
+            window.history.replaceState({}, "", url);
+            fetch("/console/events?" + q).then(function(r) { return r.text(); }).then(function(html) {
+                log.innerHTML = html;
+                updateCount();
+                connect();
+            });
+        });
+    }
+    connect();
+})();
+
+// ── Console error history ───────────────────────────────────────────────
+// The status cards are re-rendered by htmx polling, which would collapse
+// any open error history. Remember which providers' histories are open and
+// re-open them after each swap.
+(function() {
+    var open = {};
+    document.addEventListener("toggle", function(e) {
+        var d = e.target;
+        if (d.classList && d.classList.contains("error-history")) {
+            open[d.dataset.provider] = d.open;
+        }
+    }, true);
+    document.addEventListener("htmx:afterSwap", function(e) {
+        if (e.target.id !== "status-cards") return;
+        e.target.querySelectorAll("details.error-history").forEach(function(d) {
+            if (open[d.dataset.provider]) d.open = true;
+        });
+    });
+})();
+
+// ── Device list sorting ─────────────────────────────────────────────────
+// Column headers re-fetch /devices/rows with sort/dir. The current order
+// lives in the hidden sort/dir inputs so the filters keep it too. Clicking
+// the active column flips direction; other columns start at data-dir
+// (default asc).
+(function() {
+    function input(name) {
+        return document.querySelector(".filter-bar input[name=" + name + "]");
+    }
+
+    function markSorted() {
+        var sort = input("sort"), dir = input("dir");
+        if (!sort) return;
+        document.querySelectorAll(".sort-header").forEach(function(b) {
+            var th = b.closest("th");
+            if (b.dataset.sort === sort.value) {
+                th.setAttribute("aria-sort", dir.value === "asc" ? "ascending" : "descending");
+            } else {
+                th.removeAttribute("aria-sort");
+            }
+        });
+    }
+
+    document.addEventListener("htmx:configRequest", function(e) {
+        var b = e.detail.elt;
+        if (!b.classList || !b.classList.contains("sort-header")) return;
+        var sort = input("sort"), dir = input("dir");
+        var next = b.dataset.dir || "asc";
+        if (sort.value === b.dataset.sort) {
+            next = dir.value === "asc" ? "desc" : "asc";
+        }
+        sort.value = b.dataset.sort;
+        dir.value = next;
+        e.detail.parameters.sort = sort.value;
+        e.detail.parameters.dir = next;
+        markSorted();
+    });
+
+    document.addEventListener("DOMContentLoaded", markSorted);
+})();
+
+// ── Snapshot cloning ────────────────────────────────────────────────────
+// Clone buttons are rendered both by the template and by the htmx row
+// poller, so clicks are handled by delegation rather than per-button.
+(function() {
+    document.addEventListener("click", function(e) {
+        var b = e.target.closest(".clone-snapshot");
+        if (!b || b.disabled) return;
+        var label = prompt("Label for the cloned baseline:", b.dataset.name + " (copy)");
+        if (label === null) return;
+        b.disabled = true;
+        fetch("/api/v1/policies/snapshots/" + b.dataset.id + "/clone", {
+            method: "POST",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify({ label: label })
+        }).then(function(r) { return r.json(); }).then(function(res) {
+            var msg = res.ok ? "Cloned as " + res.data.label : "Clone failed: " + res.error;
+            window.location = "/policies?flash=" + encodeURIComponent(msg) + "&flash_type=" + (res.ok ? "success" : "error");
+        }).catch(function() {
+            b.disabled = false;
+        });
+    });
+})();
+
+// ── Provider full resync ────────────────────────────────────────────────
+(function() {
+    document.addEventListener("click", function(e) {
+        var b = e.target.closest(".full-resync");
+        if (!b || b.disabled) return;
+        if (!confirm("Clear every cached device for " + b.dataset.name + " and sync them all again?\n\n" +
+            "Tags, flags and compliance history on those devices will be lost.")) return;
+        b.disabled = true;
+        b.innerHTML = "<span class=spinner></span> Resyncing…";
+        fetch("/api/v1/providers/" + encodeURIComponent(b.dataset.name) + "/resync?full=true", { method: "POST" })
+            .then(function(r) { return r.json(); }).then(function(res) {
+                var msg = res.ok ? "Resynced " + res.data.name + " — " + res.data.devices + " devices" : "Resync failed: " + res.error;
+                window.location = "/providers?flash=" + encodeURIComponent(msg) + "&flash_type=" + (res.ok ? "success" : "error");
+            }).catch(function() {
+                window.location.reload();
+            });
+    });
+})();
+
+// ── Snapshot renaming ───────────────────────────────────────────────────
+// Rename swaps the row's name for a text box: Enter saves the new label,
+// Escape or leaving the box puts the old name back.
+(function() {
+    document.addEventListener("click", function(e) {
+        var b = e.target.closest(".rename-snapshot");
+        if (!b || b.disabled) return;
+        var row = b.closest("tr");
+        var name = row && row.querySelector(".snapshot-name");
+        if (!name) return;
+
+        var input = document.createElement("input");
+        input.type = "text";
+        input.className = "form-control snapshot-label-input";
+        input.value = name.textContent;
+        name.style.display = "none";
+        name.after(input);
+        b.disabled = true;
+        input.focus();
+        input.select();
+
+        var done = false;
+        function finish(label) {
+            if (done) return;
+            done = true;
+            if (label) {
+                name.textContent = label;
+                var clone = row.querySelector(".clone-snapshot");
+                if (clone) clone.dataset.name = label;
+            }
+            input.remove();
+            name.style.display = "";
+            b.disabled = false;
+        }
+
+        input.addEventListener("keydown", function(ev) {
+            if (ev.key === "Escape") {
+                finish();
+            } else if (ev.key === "Enter") {
+                ev.preventDefault();
+                var label = input.value.trim();
+                if (!label) {
+                    alert("The label can't be empty.");
+                    return;
+                }
+                input.disabled = true;
+                fetch("/api/v1/policies/snapshots/" + b.dataset.id, {
+                    method: "PATCH",
+                    headers: { "Content-Type": "application/json" },
+                    body: JSON.stringify({ label: label })
+                }).then(function(r) { return r.json(); }).then(function(res) {
+                    if (res.ok) {
+                        finish(res.data.label);
+                    } else {
+                        alert("Rename failed: " + res.error);
+                        input.disabled = false;
+                        input.focus();
+                    }
+                }).catch(function() {
+                    input.disabled = false;
+                });
+            }
+        });
+        input.addEventListener("blur", function() {
+            if (!input.disabled) finish();
+        });
+    });
+})();